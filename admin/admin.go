@@ -0,0 +1,315 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	v2 "github.com/asyncapi/event-gateway/asyncapi/v2"
+	"github.com/asyncapi/event-gateway/config"
+	"github.com/asyncapi/event-gateway/kafka"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/asyncapi/event-gateway/proxy"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "<redacted>"
+
+// sensitiveFlag matches the names of the flags whose values should never be exposed.
+var sensitiveFlag = regexp.MustCompile(`(?i)(password|secret|token|credential)`)
+
+// API is a read-only HTTP API exposing the loaded AsyncAPI contract and the runtime state of the Event-Gateway.
+type API struct {
+	servers           []config.ServerMapping
+	channels          []v2.ValidatedChannel
+	kafkaProxyConfigs []*kafka.ProxyConfig
+	sessions          *Sessions
+	sampler           *message.Sampler
+	kafkaProxies      []KafkaProxy
+	// tcpProxies indexed by protocol.
+	tcpProxies map[string][]TCPProxy
+}
+
+// KafkaProxy is a running Kafka proxy exposing its stats, such as *kafka.Proxy.
+type KafkaProxy interface {
+	Name() string
+	ValidationQueueStats() proxy.ValidationQueueStats
+	ProduceRequestStats() kafka.ProduceRequestStats
+}
+
+// TCPProxy is a running proxy relaying the connections of clients to a single broker, such as *mqtt.Proxy.
+type TCPProxy interface {
+	Name() string
+	ListenAddress() string
+	BrokerAddress() string
+}
+
+// Opt is a functional option used for configuring an API.
+type Opt func(*API)
+
+// WithServers configures the servers and their address mappings.
+func WithServers(servers ...config.ServerMapping) Opt {
+	return func(a *API) {
+		a.servers = servers
+	}
+}
+
+// WithValidatedChannels configures the channels whose messages are validated.
+func WithValidatedChannels(channels ...v2.ValidatedChannel) Opt {
+	return func(a *API) {
+		a.channels = channels
+	}
+}
+
+// WithKafkaProxyConfigs configures the config of the active Kafka proxies.
+func WithKafkaProxyConfigs(c ...*kafka.ProxyConfig) Opt {
+	return func(a *API) {
+		a.kafkaProxyConfigs = c
+	}
+}
+
+// WithSessions configures the tracker of connected Websocket sessions.
+func WithSessions(s *Sessions) Opt {
+	return func(a *API) {
+		a.sessions = s
+	}
+}
+
+// WithSampler configures the sampler of the validated messages, so its stats are exposed.
+func WithSampler(s *message.Sampler) Opt {
+	return func(a *API) {
+		a.sampler = s
+	}
+}
+
+// WithKafkaProxies configures the running Kafka proxies whose stats are exposed.
+func WithKafkaProxies(p ...KafkaProxy) Opt {
+	return func(a *API) {
+		a.kafkaProxies = p
+	}
+}
+
+// WithTCPProxies configures the running proxies of the given protocol (i.e. mqtt) whose config is exposed.
+func WithTCPProxies(protocol string, p ...TCPProxy) Opt {
+	return func(a *API) {
+		if a.tcpProxies == nil {
+			a.tcpProxies = make(map[string][]TCPProxy)
+		}
+
+		a.tcpProxies[protocol] = append(a.tcpProxies[protocol], p...)
+	}
+}
+
+// NewAPI creates a new API.
+func NewAPI(opts ...Opt) *API {
+	a := new(API)
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// Router returns a router serving all the API endpoints.
+func (a *API) Router() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/servers", a.handleServers)
+	r.Get("/channels", a.handleChannels)
+	r.Get("/config", a.handleConfig)
+	r.Get("/sessions", a.handleSessions)
+	r.Get("/sampling", a.handleSampling)
+	r.Get("/validation-queues", a.handleValidationQueues)
+	r.Get("/produce-requests", a.handleProduceRequests)
+
+	return r
+}
+
+func (a *API) handleServers(w http.ResponseWriter, _ *http.Request) {
+	servers := a.servers
+	if servers == nil {
+		servers = []config.ServerMapping{}
+	}
+
+	writeJSON(w, servers)
+}
+
+func (a *API) handleChannels(w http.ResponseWriter, _ *http.Request) {
+	channels := a.channels
+	if channels == nil {
+		channels = []v2.ValidatedChannel{}
+	}
+
+	writeJSON(w, channels)
+}
+
+func (a *API) handleConfig(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, newProxyConfigView(a.kafkaProxyConfigs, a.tcpProxies))
+}
+
+func (a *API) handleSessions(w http.ResponseWriter, _ *http.Request) {
+	sessions := []Session{}
+	if a.sessions != nil {
+		sessions = a.sessions.List()
+	}
+
+	writeJSON(w, sessions)
+}
+
+func (a *API) handleSampling(w http.ResponseWriter, _ *http.Request) {
+	stats := map[string]message.SamplingStats{}
+	if a.sampler != nil {
+		stats = a.sampler.Stats()
+	}
+
+	writeJSON(w, stats)
+}
+
+func (a *API) handleValidationQueues(w http.ResponseWriter, _ *http.Request) {
+	stats := make(map[string]proxy.ValidationQueueStats, len(a.kafkaProxies))
+	for _, p := range a.kafkaProxies {
+		stats[p.Name()] = p.ValidationQueueStats()
+	}
+
+	writeJSON(w, stats)
+}
+
+func (a *API) handleProduceRequests(w http.ResponseWriter, _ *http.Request) {
+	stats := make(map[string]kafka.ProduceRequestStats, len(a.kafkaProxies))
+	for _, p := range a.kafkaProxies {
+		stats[p.Name()] = p.ProduceRequestStats()
+	}
+
+	writeJSON(w, stats)
+}
+
+// proxyConfigView is the representation of the proxies config that is safe to be exposed.
+// Proxies are indexed by protocol and name.
+type proxyConfigView map[string]map[string]interface{}
+
+// tcpProxyConfigView is the representation of the config of a TCPProxy.
+type tcpProxyConfigView struct {
+	BrokerAddress string `json:"brokerAddress"`
+	ListenAddress string `json:"listenAddress"`
+}
+
+// kafkaProxyConfigView is the representation of a kafka.ProxyConfig that is safe to be exposed.
+type kafkaProxyConfigView struct {
+	Address            string           `json:"address"`
+	BrokersMapping     []string         `json:"brokersMapping"`
+	DialAddressMapping []string         `json:"dialAddressMapping,omitempty"`
+	ExtraConfig        []string         `json:"extraConfig,omitempty"`
+	MessageValidation  bool             `json:"messageValidation"`
+	PublishToTopic     string           `json:"publishToTopic,omitempty"`
+	TLS                *kafka.TLSConfig `json:"tls,omitempty"`
+	SASL               *saslConfigView  `json:"sasl,omitempty"`
+	ListenerTLS        *listenerTLSView `json:"listenerTLS,omitempty"`
+	ProducePolicies    []policyView     `json:"producePolicies,omitempty"`
+	Debug              bool             `json:"debug"`
+}
+
+type policyView struct {
+	Name string           `json:"name"`
+	Mode kafka.PolicyMode `json:"mode"`
+}
+
+type listenerTLSView struct {
+	CertFile     string `json:"certFile"`
+	KeyFile      string `json:"keyFile"`
+	KeyPassword  string `json:"keyPassword,omitempty"`
+	ClientCAFile string `json:"clientCAFile,omitempty"`
+}
+
+type saslConfigView struct {
+	Mechanism string `json:"mechanism"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+	TokenFile string `json:"tokenFile,omitempty"`
+}
+
+func newProxyConfigView(kafkaConfigs []*kafka.ProxyConfig, tcpProxies map[string][]TCPProxy) proxyConfigView {
+	v := make(proxyConfigView)
+	for _, c := range kafkaConfigs {
+		name := c.Name
+		if name == "" {
+			name = "kafka"
+		}
+
+		v.add("kafka", name, newKafkaProxyConfigView(c))
+	}
+
+	for protocol, proxies := range tcpProxies {
+		for _, p := range proxies {
+			v.add(protocol, p.Name(), tcpProxyConfigView{BrokerAddress: p.BrokerAddress(), ListenAddress: p.ListenAddress()})
+		}
+	}
+
+	return v
+}
+
+func (v proxyConfigView) add(protocol, name string, config interface{}) {
+	if v[protocol] == nil {
+		v[protocol] = make(map[string]interface{})
+	}
+
+	v[protocol][name] = config
+}
+
+func newKafkaProxyConfigView(c *kafka.ProxyConfig) kafkaProxyConfigView {
+	var v kafkaProxyConfigView
+	v.Address = c.Address
+	v.BrokersMapping = c.BrokersMapping
+	v.DialAddressMapping = c.DialAddressMapping
+	v.ExtraConfig = redactFlags(c.ExtraConfig)
+	v.MessageValidation = c.MessageHandler != nil
+	v.PublishToTopic = c.PublishToTopic
+	v.TLS = c.TLS
+	if c.SASL != nil {
+		v.SASL = &saslConfigView{Mechanism: c.SASL.Mechanism, Username: c.SASL.Username, TokenFile: c.SASL.TokenFile}
+		if c.SASL.Password != "" {
+			v.SASL.Password = redacted
+		}
+	}
+	v.Debug = c.Debug
+
+	for _, p := range c.ProducePolicies {
+		v.ProducePolicies = append(v.ProducePolicies, policyView{Name: p.Name, Mode: p.Mode})
+	}
+
+	if c.ListenerTLS != nil {
+		v.ListenerTLS = &listenerTLSView{CertFile: c.ListenerTLS.CertFile, KeyFile: c.ListenerTLS.KeyFile, ClientCAFile: c.ListenerTLS.ClientCAFile}
+		if c.ListenerTLS.KeyPassword != "" {
+			v.ListenerTLS.KeyPassword = redacted
+		}
+	}
+
+	return v
+}
+
+// redactFlags replaces the values of sensitive flags (i.e. passwords) in the form of `flag=value`.
+func redactFlags(flags []string) []string {
+	if flags == nil {
+		return nil
+	}
+
+	result := make([]string, len(flags))
+	for i, f := range flags {
+		name := strings.SplitN(f, "=", 2)[0]
+		if sensitiveFlag.MatchString(name) {
+			result[i] = name + "=" + redacted
+			continue
+		}
+
+		result[i] = f
+	}
+
+	return result
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.WithError(err).Error("error encoding admin API response")
+	}
+}
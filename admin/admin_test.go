@@ -0,0 +1,184 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v2 "github.com/asyncapi/event-gateway/asyncapi/v2"
+	"github.com/asyncapi/event-gateway/config"
+	"github.com/asyncapi/event-gateway/kafka"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/asyncapi/event-gateway/proxy"
+	"github.com/olahol/melody"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPI_Router(t *testing.T) {
+	sessions := NewSessions()
+	sessions.now = func() time.Time {
+		return time.Date(2021, 7, 1, 10, 0, 0, 0, time.UTC)
+	}
+	sessions.Connect(&melody.Session{Request: httptest.NewRequest(http.MethodGet, "/ws", nil)})
+
+	sampler, err := message.NewSampler(1)
+	require.NoError(t, err)
+	sampler.Sample(message.New([]byte(`{}`), "events"))
+
+	api := NewAPI(
+		WithServers(config.ServerMapping{Server: "test", URL: "broker.mybrokers.org:9092", Protocol: "kafka", ListenAt: ":20000"}),
+		WithValidatedChannels(v2.ValidatedChannel{Channel: "events", Messages: []string{"event"}, Documents: []string{"Test 1.0.0"}, Schema: []byte(`{"type":"string"}`)}),
+		WithKafkaProxyConfigs(&kafka.ProxyConfig{
+			Name:           "test",
+			BrokersMapping: []string{"broker.mybrokers.org:9092,:20000"},
+			ExtraConfig:    []string{"sasl-password=s3cr3t", "proxy-request-buffer-size=8192"},
+			PublishToTopic: "invalid-messages",
+			SASL:           &kafka.SASLConfig{Mechanism: kafka.SASLMechanismScramSHA512, Username: "user", Password: "pass"},
+			ListenerTLS:    &kafka.ListenerTLSConfig{CertFile: "/etc/certs/server.crt", KeyFile: "/etc/certs/server.key", KeyPassword: "pass"},
+		}),
+		WithTCPProxies("mqtt", tcpProxy{name: "mosquitto", listenAddress: ":1883", brokerAddress: "mosquitto.org:1883"}),
+		WithSessions(sessions),
+		WithSampler(sampler),
+		WithKafkaProxies(kafkaProxy{
+			name:         "test",
+			queueStats:   proxy.ValidationQueueStats{Queued: 3, Handled: 2, Pending: 1},
+			requestStats: kafka.ProduceRequestStats{Inspected: 5, Uninspected: 1},
+		}),
+	)
+
+	tests := []struct {
+		path         string
+		expectedBody string
+	}{
+		{
+			path:         "/servers",
+			expectedBody: `[{"server":"test","url":"broker.mybrokers.org:9092","protocol":"kafka","listenAt":":20000"}]`,
+		},
+		{
+			path:         "/channels",
+			expectedBody: `[{"channel":"events","messages":["event"],"documents":["Test 1.0.0"],"schema":{"type":"string"}}]`,
+		},
+		{
+			path:         "/config",
+			expectedBody: `{"kafka":{"test":{"address":"","brokersMapping":["broker.mybrokers.org:9092,:20000"],"extraConfig":["sasl-password=<redacted>","proxy-request-buffer-size=8192"],"messageValidation":false,"publishToTopic":"invalid-messages","sasl":{"mechanism":"SCRAM-SHA-512","username":"user","password":"<redacted>"},"listenerTLS":{"certFile":"/etc/certs/server.crt","keyFile":"/etc/certs/server.key","keyPassword":"<redacted>"},"debug":false}},"mqtt":{"mosquitto":{"brokerAddress":"mosquitto.org:1883","listenAddress":":1883"}}}`,
+		},
+		{
+			path:         "/sessions",
+			expectedBody: `[{"remoteAddr":"192.0.2.1:1234","connectedAt":"2021-07-01T10:00:00Z"}]`,
+		},
+		{
+			path:         "/sampling",
+			expectedBody: `{"events":{"sampled":1,"skipped":0}}`,
+		},
+		{
+			path:         "/validation-queues",
+			expectedBody: `{"test":{"queued":3,"handled":2,"blocked":0,"droppedNewest":0,"droppedOldest":0,"skippedValidation":0,"pending":1}}`,
+		},
+		{
+			path:         "/produce-requests",
+			expectedBody: `{"test":{"inspected":5,"uninspected":1}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			api.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.JSONEq(t, test.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func TestAPI_RouterEmpty(t *testing.T) {
+	api := NewAPI()
+	for _, path := range []string{"/servers", "/channels", "/sessions"} {
+		rec := httptest.NewRecorder()
+		api.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.JSONEq(t, `[]`, rec.Body.String(), path)
+	}
+
+	for _, path := range []string{"/config", "/sampling", "/validation-queues", "/produce-requests"} {
+		rec := httptest.NewRecorder()
+		api.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.JSONEq(t, `{}`, rec.Body.String(), path)
+	}
+}
+
+type kafkaProxy struct {
+	name         string
+	queueStats   proxy.ValidationQueueStats
+	requestStats kafka.ProduceRequestStats
+}
+
+func (p kafkaProxy) Name() string {
+	return p.name
+}
+
+func (p kafkaProxy) ValidationQueueStats() proxy.ValidationQueueStats {
+	return p.queueStats
+}
+
+func (p kafkaProxy) ProduceRequestStats() kafka.ProduceRequestStats {
+	return p.requestStats
+}
+
+type tcpProxy struct {
+	name          string
+	listenAddress string
+	brokerAddress string
+}
+
+func (p tcpProxy) Name() string {
+	return p.name
+}
+
+func (p tcpProxy) ListenAddress() string {
+	return p.listenAddress
+}
+
+func (p tcpProxy) BrokerAddress() string {
+	return p.brokerAddress
+}
+
+func TestSessions(t *testing.T) {
+	sessions := NewSessions()
+	s1 := &melody.Session{Request: httptest.NewRequest(http.MethodGet, "/ws", nil)}
+	s2 := &melody.Session{}
+
+	sessions.Connect(s1)
+	sessions.Connect(s2)
+	assert.Len(t, sessions.List(), 2)
+
+	sessions.Disconnect(s1)
+	assert.Len(t, sessions.List(), 1)
+
+	sessions.Disconnect(s2)
+	assert.Empty(t, sessions.List())
+}
+
+func TestRedactFlags(t *testing.T) {
+	flags := []string{
+		"sasl-password=foo",
+		"SASL-JAAS-CLIENT-SECRET=bar",
+		"auth-gateway-client-token=baz",
+		"sasl-username=user",
+		"tls-client-key-file=/etc/key.pem",
+		"debug-enable",
+	}
+
+	expected := []string{
+		"sasl-password=<redacted>",
+		"SASL-JAAS-CLIENT-SECRET=<redacted>",
+		"auth-gateway-client-token=<redacted>",
+		"sasl-username=user",
+		"tls-client-key-file=/etc/key.pem",
+		"debug-enable",
+	}
+
+	assert.Equal(t, expected, redactFlags(flags))
+	assert.Nil(t, redactFlags(nil))
+}
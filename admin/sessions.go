@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/olahol/melody"
+)
+
+// Session is a connected Websocket session.
+type Session struct {
+	RemoteAddr  string    `json:"remoteAddr"`
+	UserAgent   string    `json:"userAgent,omitempty"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// Sessions keeps track of the connected Websocket sessions.
+// Connect and Disconnect are meant to be set as melody.HandleConnect and melody.HandleDisconnect handlers.
+type Sessions struct {
+	mu       sync.RWMutex
+	sessions map[*melody.Session]Session
+	now      func() time.Time
+}
+
+// NewSessions creates a new Sessions tracker.
+func NewSessions() *Sessions {
+	return &Sessions{
+		sessions: make(map[*melody.Session]Session),
+		now:      time.Now,
+	}
+}
+
+// Connect tracks the given session.
+func (s *Sessions) Connect(session *melody.Session) {
+	tracked := Session{ConnectedAt: s.now()}
+	if session.Request != nil {
+		tracked.RemoteAddr = session.Request.RemoteAddr
+		tracked.UserAgent = session.Request.UserAgent()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session] = tracked
+}
+
+// Disconnect stops tracking the given session.
+func (s *Sessions) Disconnect(session *melody.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, session)
+}
+
+// List returns the connected sessions, sorted by connection time.
+func (s *Sessions) List() []Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		result = append(result, session)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ConnectedAt.Before(result[j].ConnectedAt)
+	})
+
+	return result
+}
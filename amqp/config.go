@@ -0,0 +1,128 @@
+package amqp
+
+import (
+	"fmt"
+	"net"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/proxy"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ProxyConfig holds the configuration for the AMQP Proxy.
+type ProxyConfig struct {
+	// Name of the proxy. Usually the name of the AsyncAPI server it proxies. Default is amqp.
+	Name string
+	// BrokerAddress is the address of the AMQP broker in the form host:port.
+	BrokerAddress string
+	// ListenAddress is the address the proxy listens at for AMQP clients in the form host:port.
+	ListenAddress string
+	// ChannelResolver resolves the AsyncAPI channel messages are published to. Default is the routing key.
+	ChannelResolver ChannelResolver
+	proxy.MessageConfig
+	Debug bool
+}
+
+// ChannelResolver resolves the AsyncAPI channel of a message published to the given exchange with the given routing key.
+// Returns an empty string if there is no such channel.
+type ChannelResolver func(exchange, routingKey string) string
+
+// ProxyOption represents a functional configuration for the Proxy.
+type ProxyOption func(*ProxyConfig) error
+
+// WithName configures the name of the proxy.
+func WithName(name string) ProxyOption {
+	return func(c *ProxyConfig) error {
+		c.Name = name
+		return nil
+	}
+}
+
+// WithChannelResolver configures the resolver of the AsyncAPI channel messages are published to.
+func WithChannelResolver(resolver ChannelResolver) ProxyOption {
+	return func(c *ProxyConfig) error {
+		c.ChannelResolver = resolver
+		return nil
+	}
+}
+
+// WithMessageHandler configures a handler that will handle all published messages.
+func WithMessageHandler(handler watermillmessage.HandlerFunc) ProxyOption {
+	return func(c *ProxyConfig) error {
+		c.MessageHandler = handler
+		return nil
+	}
+}
+
+// WithMessagePublisher configures a publisher where the messages will be published after being handled.
+func WithMessagePublisher(publisher watermillmessage.Publisher, topic string) ProxyOption {
+	return func(c *ProxyConfig) error {
+		c.MessagePublisher = publisher
+		c.PublishToTopic = topic
+		return nil
+	}
+}
+
+// WithValidationQueue configures the queue published messages wait in until being handled.
+func WithValidationQueue(queue proxy.ValidationQueueConfig) ProxyOption {
+	return func(c *ProxyConfig) error {
+		if err := queue.Validate(); err != nil {
+			return errors.Wrap(err, "invalid validation queue config")
+		}
+
+		c.ValidationQueue = queue
+		return nil
+	}
+}
+
+// WithDebug enables/disables debug.
+func WithDebug(enabled bool) ProxyOption {
+	return func(c *ProxyConfig) error {
+		c.Debug = enabled
+		return nil
+	}
+}
+
+// NewProxyConfig creates a new ProxyConfig.
+func NewProxyConfig(brokerAddress, listenAddress string, opts ...ProxyOption) (*ProxyConfig, error) {
+	c := &ProxyConfig{BrokerAddress: brokerAddress, ListenAddress: listenAddress}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, c.Validate()
+}
+
+// Validate validates ProxyConfig.
+func (c *ProxyConfig) Validate() error {
+	if c.BrokerAddress == "" {
+		return errors.New("BrokerAddress is mandatory")
+	}
+
+	if c.ListenAddress == "" {
+		return errors.New("ListenAddress is mandatory")
+	}
+
+	if _, _, err := net.SplitHostPort(c.BrokerAddress); err != nil {
+		return errors.Wrap(err, "BrokerAddress should be in form 'host:port'")
+	}
+
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		return errors.Wrap(err, "ListenAddress should be in form 'host:port'")
+	}
+
+	if c.BrokerAddress == c.ListenAddress {
+		return fmt.Errorf("broker and proxy can't listen to the same address %s. Please configure a different listener port", c.BrokerAddress)
+	}
+
+	if c.MessageHandler == nil {
+		logrus.Warn("There is no message handler configured")
+	} else if (c.MessagePublisher != nil && c.PublishToTopic == "") || (c.MessagePublisher == nil && c.PublishToTopic != "") {
+		return fmt.Errorf("MessagePublisher and PublishToTopic should be set together")
+	}
+
+	return nil
+}
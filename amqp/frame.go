@@ -0,0 +1,178 @@
+package amqp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// AMQP 0-9-1 frame types. See https://www.rabbitmq.com/resources/specs/amqp0-9-1.pdf.
+const (
+	frameTypeMethod = 1
+	frameTypeHeader = 2
+	frameTypeBody   = 3
+)
+
+const frameEnd = 0xCE
+
+const (
+	classBasic         = 60
+	methodBasicPublish = 40
+)
+
+// maxFrameSize is the max payload size a frame can have (256 MB).
+const maxFrameSize = 268435456
+
+// protocolHeader is the header AMQP 0-9-1 clients send before any frame.
+var protocolHeader = []byte{'A', 'M', 'Q', 'P', 0, 0, 9, 1}
+
+var errMalformedFrame = errors.New("malformed frame")
+
+// frame is an AMQP frame.
+type frame struct {
+	frameType byte
+	channel   uint16
+	payload   []byte
+	// raw holds the whole frame as read, including the header and the frame end octet.
+	raw []byte
+}
+
+// readProtocolHeader reads the protocol header sent by the client, failing if it is not AMQP 0-9-1.
+// The header is returned anyway, so it can be forwarded to the broker, which replies with the protocol versions it supports.
+func readProtocolHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, len(protocolHeader))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header, protocolHeader) {
+		return header, fmt.Errorf("unsupported protocol header %q", header)
+	}
+
+	return header, nil
+}
+
+// readFrame reads an AMQP frame from r.
+func readFrame(r io.Reader) (*frame, error) {
+	// Frame header is type (1 byte) + channel (2 bytes) + size (4 bytes).
+	raw := make([]byte, 7)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(raw[3:])
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("frame of size %d too large", size)
+	}
+
+	raw = append(raw, make([]byte, size+1)...)
+	if _, err := io.ReadFull(r, raw[7:]); err != nil {
+		return nil, err
+	}
+
+	if raw[len(raw)-1] != frameEnd {
+		return nil, errMalformedFrame
+	}
+
+	return &frame{
+		frameType: raw[0],
+		channel:   binary.BigEndian.Uint16(raw[1:3]),
+		payload:   raw[7 : len(raw)-1],
+		raw:       raw,
+	}, nil
+}
+
+// decoder decodes AMQP data types.
+type decoder struct {
+	b   []byte
+	off int
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if n < 0 || d.off+n > len(d.b) {
+		return nil, errMalformedFrame
+	}
+
+	v := d.b[d.off : d.off+n]
+	d.off += n
+	return v, nil
+}
+
+func (d *decoder) uint16() (uint16, error) {
+	v, err := d.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(v), nil
+}
+
+func (d *decoder) uint64() (uint64, error) {
+	v, err := d.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+func (d *decoder) shortString() (string, error) {
+	n, err := d.read(1)
+	if err != nil {
+		return "", err
+	}
+
+	v, err := d.read(int(n[0]))
+	return string(v), err
+}
+
+// publish holds the fields of a basic.publish method needed by the proxy.
+type publish struct {
+	exchange   string
+	routingKey string
+}
+
+// decodePublish decodes a basic.publish method frame. Returns nil if the frame holds any other method.
+func decodePublish(f *frame) (*publish, error) {
+	d := &decoder{b: f.payload}
+	class, err := d.uint16()
+	if err != nil {
+		return nil, err
+	}
+
+	method, err := d.uint16()
+	if err != nil {
+		return nil, err
+	}
+
+	if class != classBasic || method != methodBasicPublish {
+		return nil, nil
+	}
+
+	if _, err := d.uint16(); err != nil { // Reserved (ticket)
+		return nil, err
+	}
+
+	exchange, err := d.shortString()
+	if err != nil {
+		return nil, err
+	}
+
+	routingKey, err := d.shortString()
+	if err != nil {
+		return nil, err
+	}
+
+	return &publish{exchange: exchange, routingKey: routingKey}, nil
+}
+
+// decodeBodySize decodes the body size of a content header frame.
+func decodeBodySize(f *frame) (uint64, error) {
+	d := &decoder{b: f.payload}
+	if _, err := d.read(4); err != nil { // Class and weight
+		return 0, err
+	}
+
+	return d.uint64()
+}
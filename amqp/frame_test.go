@@ -0,0 +1,111 @@
+package amqp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadProtocolHeader(t *testing.T) {
+	header, err := readProtocolHeader(bytes.NewReader(protocolHeader))
+	require.NoError(t, err)
+	assert.Equal(t, protocolHeader, header)
+
+	amqp10 := []byte{'A', 'M', 'Q', 'P', 0, 1, 0, 0}
+	header, err = readProtocolHeader(bytes.NewReader(amqp10))
+	assert.EqualError(t, err, `unsupported protocol header "AMQP\x00\x01\x00\x00"`)
+	assert.Equal(t, amqp10, header)
+}
+
+func TestReadFrame(t *testing.T) {
+	raw := encodeFrame(frameTypeBody, 3, []byte(`{"lumens":3}`))
+	f, err := readFrame(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.EqualValues(t, frameTypeBody, f.frameType)
+	assert.EqualValues(t, 3, f.channel)
+	assert.Equal(t, []byte(`{"lumens":3}`), f.payload)
+	assert.Equal(t, raw, f.raw)
+
+	raw[len(raw)-1] = 0
+	_, err = readFrame(bytes.NewReader(raw))
+	assert.ErrorIs(t, err, errMalformedFrame)
+}
+
+func TestDecodePublish(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     []byte
+		expected    *publish
+		expectedErr error
+	}{
+		{
+			name:     "basic.publish",
+			payload:  encodePublish("lights", "streetlights.1.measured"),
+			expected: &publish{exchange: "lights", routingKey: "streetlights.1.measured"},
+		},
+		{
+			name:     "basic.publish to the default exchange",
+			payload:  encodePublish("", "measurements"),
+			expected: &publish{routingKey: "measurements"},
+		},
+		{
+			name:    "Any other method",
+			payload: []byte{0, 10, 0, 11}, // connection.start-ok
+		},
+		{
+			name:        "Malformed basic.publish",
+			payload:     []byte{0, classBasic, 0, methodBasicPublish, 0, 0, 10, 'l'},
+			expectedErr: errMalformedFrame,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pub, err := decodePublish(&frame{frameType: frameTypeMethod, payload: test.payload})
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expected, pub)
+		})
+	}
+}
+
+func TestDecodeBodySize(t *testing.T) {
+	size, err := decodeBodySize(&frame{frameType: frameTypeHeader, payload: encodeContentHeader(1024)})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1024, size)
+
+	_, err = decodeBodySize(&frame{frameType: frameTypeHeader, payload: []byte{0, classBasic, 0, 0}})
+	assert.ErrorIs(t, err, errMalformedFrame)
+}
+
+func encodeFrame(frameType byte, channel uint16, payload []byte) []byte {
+	raw := make([]byte, 7, 8+len(payload))
+	raw[0] = frameType
+	binary.BigEndian.PutUint16(raw[1:3], channel)
+	binary.BigEndian.PutUint32(raw[3:7], uint32(len(payload)))
+	raw = append(raw, payload...)
+	return append(raw, frameEnd)
+}
+
+func encodePublish(exchange, routingKey string) []byte {
+	payload := []byte{0, classBasic, 0, methodBasicPublish, 0, 0}
+	payload = append(payload, encodeShortString(exchange)...)
+	payload = append(payload, encodeShortString(routingKey)...)
+	return append(payload, 0) // mandatory and immediate bits
+}
+
+func encodeContentHeader(bodySize uint64) []byte {
+	payload := []byte{0, classBasic, 0, 0}
+	payload = append(payload, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(payload[4:], bodySize)
+	return append(payload, 0, 0) // No properties
+}
+
+func encodeShortString(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
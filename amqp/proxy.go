@@ -0,0 +1,178 @@
+package amqp
+
+import (
+	"io"
+	"net"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/asyncapi/event-gateway/proxy"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultProxyName = "amqp"
+
+// Protocols are the AsyncAPI server protocols supported by the AMQP proxy.
+var Protocols = []string{"amqp"}
+
+// Proxy is an AMQP 0-9-1 proxy. AMQP clients connect to the broker through it.
+// Messages of basic.publish methods sent by clients are handled by the configured message handler before reaching the broker.
+type Proxy struct {
+	*proxy.TCP
+	resolver ChannelResolver
+	// handle publishes the messages for being handled. Nil if there is no message handler.
+	handle proxy.PublishFunc
+}
+
+// NewProxy creates a new AMQP Proxy based on a given configuration.
+func NewProxy(c *ProxyConfig, r *watermillmessage.Router) (*Proxy, error) {
+	if c == nil {
+		return nil, errors.New("config should be provided")
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	name := c.Name
+	if name == "" {
+		name = defaultProxyName
+	}
+
+	p := &Proxy{resolver: c.ChannelResolver}
+	p.TCP = proxy.NewTCP(name, c.ListenAddress, c.BrokerAddress, p.handleConn)
+
+	if c.MessageHandler != nil {
+		p.handle = proxy.NewMessageHandler("on-amqp-publish-"+name, r, c.MessageConfig)
+	}
+
+	return p, nil
+}
+
+func (p *Proxy) handleConn(client, broker net.Conn) error {
+	c := &connection{publish: p.publish, contents: make(map[uint16]*content)}
+	return proxy.Relay(client, broker, func() error {
+		return c.relayClientFrames(client, broker)
+	})
+}
+
+// publish publishes the message of a basic.publish method for being handled.
+func (p *Proxy) publish(pub *publish, body []byte) {
+	if p.handle == nil {
+		return
+	}
+
+	channel := pub.routingKey
+	if p.resolver != nil {
+		channel = p.resolver(pub.exchange, pub.routingKey)
+	}
+
+	if channel == "" {
+		logrus.Debugf("No AsyncAPI channel found for exchange %q and routing key %q. Skipping message...", pub.exchange, pub.routingKey)
+		return
+	}
+
+	if err := p.handle(message.New(body, channel)); err != nil {
+		logrus.WithError(err).Error("error handling message")
+	}
+}
+
+// content is the content of a basic.publish method being reassembled from its header and body frames.
+type content struct {
+	publish *publish
+	// size is the size of the body, known once the header frame is read.
+	size       uint64
+	headerRead bool
+	body       []byte
+}
+
+// connection holds the state of an AMQP connection.
+type connection struct {
+	publish func(pub *publish, body []byte)
+
+	// contents holds the content being reassembled for each AMQP channel.
+	contents map[uint16]*content
+}
+
+// relayClientFrames relays the frames sent by the client to the broker, inspecting them on the way.
+// Traffic of clients not speaking AMQP 0-9-1 is relayed as is, so the broker rejects them.
+func (c *connection) relayClientFrames(client io.Reader, broker io.Writer) error {
+	header, err := readProtocolHeader(client)
+	if header != nil {
+		if _, err := broker.Write(header); err != nil {
+			return err
+		}
+	}
+
+	if err != nil {
+		logrus.WithError(err).Warn("Relaying AMQP connection without inspecting it")
+		_, err := io.Copy(broker, client)
+		return err
+	}
+
+	for {
+		f, err := readFrame(client)
+		if err != nil {
+			return err
+		}
+
+		c.inspect(f)
+
+		if _, err := broker.Write(f.raw); err != nil {
+			return err
+		}
+	}
+}
+
+// inspect inspects a frame sent by the client. Malformed frames are forwarded anyway, so the broker rejects them.
+func (c *connection) inspect(f *frame) {
+	switch f.frameType {
+	case frameTypeMethod:
+		delete(c.contents, f.channel)
+
+		pub, err := decodePublish(f)
+		if err != nil {
+			logrus.WithError(err).Warn("error decoding AMQP method frame")
+			return
+		}
+
+		if pub != nil {
+			c.contents[f.channel] = &content{publish: pub}
+		}
+	case frameTypeHeader:
+		cont, ok := c.contents[f.channel]
+		if !ok || cont.headerRead {
+			return
+		}
+
+		size, err := decodeBodySize(f)
+		if err != nil {
+			logrus.WithError(err).Warn("error decoding AMQP content header frame")
+			delete(c.contents, f.channel)
+			return
+		}
+
+		cont.size = size
+		cont.headerRead = true
+		c.complete(f.channel, cont)
+	case frameTypeBody:
+		cont, ok := c.contents[f.channel]
+		if !ok || !cont.headerRead {
+			return
+		}
+
+		cont.body = append(cont.body, f.payload...)
+		c.complete(f.channel, cont)
+	}
+}
+
+// complete publishes the content of the given AMQP channel once its body is fully read.
+func (c *connection) complete(channel uint16, cont *content) {
+	if uint64(len(cont.body)) < cont.size {
+		return
+	}
+
+	delete(c.contents, channel)
+	c.publish(cont.publish, cont.body)
+}
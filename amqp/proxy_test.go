@@ -0,0 +1,184 @@
+package amqp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	messagetest "github.com/asyncapi/event-gateway/message/test"
+	"github.com/asyncapi/event-gateway/proxy"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProxy(t *testing.T) {
+	tests := []struct {
+		name        string
+		c           *ProxyConfig
+		expectedErr error
+	}{
+		{
+			name: "Proxy is created when config is valid",
+			c:    &ProxyConfig{BrokerAddress: "broker.mybrokers.org:5672", ListenAddress: ":5672"},
+		},
+		{
+			name:        "Proxy creation errors when config is invalid",
+			c:           &ProxyConfig{BrokerAddress: "broker.mybrokers.org:5672"},
+			expectedErr: errors.New("ListenAddress is mandatory"),
+		},
+		{
+			name:        "Proxy creation errors when config is missing",
+			expectedErr: errors.New("config should be provided"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := NewProxy(test.c, messagetest.NewRouter(t))
+			if test.expectedErr != nil {
+				assert.EqualError(t, err, test.expectedErr.Error())
+				assert.Nil(t, p)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "amqp", p.Name())
+			}
+		})
+	}
+}
+
+func TestProxy_Start(t *testing.T) {
+	tests := []struct {
+		name     string
+		resolver ChannelResolver
+		frames   [][]byte
+		expected map[string]string
+	}{
+		{
+			name: "Channel is the routing key by default",
+			frames: [][]byte{
+				encodeFrame(frameTypeMethod, 1, encodePublish("", "lights.1")),
+				encodeFrame(frameTypeHeader, 1, encodeContentHeader(12)),
+				encodeFrame(frameTypeBody, 1, []byte(`{"lumens":3}`)),
+			},
+			expected: map[string]string{`{"lumens":3}`: "lights.1"},
+		},
+		{
+			name: "Content of several channels is interleaved and split in several body frames",
+			resolver: func(exchange, routingKey string) string {
+				return exchange + "/" + routingKey
+			},
+			frames: [][]byte{
+				encodeFrame(frameTypeMethod, 1, encodePublish("lights", "1")),
+				encodeFrame(frameTypeMethod, 2, encodePublish("lights", "2")),
+				encodeFrame(frameTypeHeader, 1, encodeContentHeader(12)),
+				encodeFrame(frameTypeHeader, 2, encodeContentHeader(12)),
+				encodeFrame(frameTypeBody, 1, []byte(`{"lumens"`)),
+				encodeFrame(frameTypeBody, 2, []byte(`{"lumens":4}`)),
+				encodeFrame(frameTypeBody, 1, []byte(`:3}`)),
+			},
+			expected: map[string]string{`{"lumens":3}`: "lights/1", `{"lumens":4}`: "lights/2"},
+		},
+		{
+			name: "Messages without channel are skipped",
+			resolver: func(exchange, routingKey string) string {
+				if routingKey == "unknown" {
+					return ""
+				}
+				return routingKey
+			},
+			frames: [][]byte{
+				encodeFrame(frameTypeMethod, 1, encodePublish("", "unknown")),
+				encodeFrame(frameTypeHeader, 1, encodeContentHeader(2)),
+				encodeFrame(frameTypeBody, 1, []byte(`{}`)),
+				encodeFrame(frameTypeMethod, 1, encodePublish("", "lights.1")),
+				encodeFrame(frameTypeHeader, 1, encodeContentHeader(12)),
+				encodeFrame(frameTypeBody, 1, []byte(`{"lumens":3}`)),
+			},
+			expected: map[string]string{`{"lumens":3}`: "lights.1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker, received := runFakeBroker(t)
+
+			handled := make(chan *watermillmessage.Message, len(test.frames))
+			handler := func(msg *watermillmessage.Message) ([]*watermillmessage.Message, error) {
+				handled <- msg
+				return nil, nil
+			}
+
+			c, err := NewProxyConfig(broker, "127.0.0.1:0", WithName("test"), WithMessageHandler(handler), WithChannelResolver(test.resolver))
+			require.NoError(t, err)
+
+			r := messagetest.NewRouter(t)
+			p, err := NewProxy(c, r)
+			require.NoError(t, err)
+
+			go func() {
+				require.NoError(t, r.Run(context.Background()))
+			}()
+			<-r.Running()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() {
+				done <- proxy.Run(ctx, p)
+			}()
+			<-p.Ready()
+
+			client, err := net.Dial("tcp", p.Addr().String())
+			require.NoError(t, err)
+			defer client.Close()
+
+			sent := bytes.Join(append([][]byte{protocolHeader}, test.frames...), nil)
+			_, err = client.Write(sent)
+			require.NoError(t, err)
+
+			for range test.expected {
+				select {
+				case msg := <-handled:
+					assert.Equal(t, test.expected[string(msg.Payload)], msg.Metadata.Get(message.MetadataChannel))
+				case <-time.After(2 * time.Second):
+					t.Fatal("message was not handled")
+				}
+			}
+
+			// Frames reach the broker untouched.
+			raw := make([]byte, len(sent))
+			_, err = io.ReadFull(received, raw)
+			require.NoError(t, err)
+			assert.Equal(t, sent, raw)
+			assert.Empty(t, handled)
+
+			cancel()
+			assert.NoError(t, <-done)
+		})
+	}
+}
+
+// runFakeBroker runs a broker stand-in accepting a single connection. Everything received is written to the returned reader.
+func runFakeBroker(t *testing.T) (string, io.Reader) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = l.Close()
+	})
+
+	r, w := io.Pipe()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = io.Copy(w, conn)
+	}()
+
+	return l.Addr().String(), r
+}
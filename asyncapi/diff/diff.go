@@ -0,0 +1,475 @@
+// Package diff compares two versions of an AsyncAPI document, classifying their changes as breaking or compatible
+// for the producers and the consumers of each channel.
+//
+// As a rule of thumb, changes narrowing what a message payload can hold (e.g. a new required property, removed enum values)
+// break producers, as messages they used to produce become invalid. Changes widening it (e.g. a new enum value, a removed pattern)
+// break consumers, as they can receive messages they don't expect.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/asyncapi/event-gateway/asyncapi"
+)
+
+// Impact is the impact of a change on either producers or consumers.
+type Impact string
+
+// Impacts of a change.
+const (
+	ImpactCompatible Impact = "compatible"
+	ImpactBreaking   Impact = "breaking"
+)
+
+// Change is a change between two versions of an AsyncAPI document.
+type Change struct {
+	Channel string `json:"channel"`
+	// Message is the name of the changed message. Unnamed messages are identified by their position, e.g. #0.
+	Message string `json:"message,omitempty"`
+	// Path is the JSON pointer to the changed value of the message payload. Token * stands for any array item.
+	Path        string `json:"path,omitempty"`
+	Description string `json:"description"`
+	Producers   Impact `json:"producers"`
+	Consumers   Impact `json:"consumers"`
+}
+
+// IsBreaking tells if the change breaks either producers or consumers.
+func (c Change) IsBreaking() bool {
+	return c.Producers == ImpactBreaking || c.Consumers == ImpactBreaking
+}
+
+func (c Change) String() string {
+	var broken []string
+	if c.Producers == ImpactBreaking {
+		broken = append(broken, "producers")
+	}
+	if c.Consumers == ImpactBreaking {
+		broken = append(broken, "consumers")
+	}
+
+	impact := "compatible"
+	if len(broken) > 0 {
+		impact = "breaking for " + strings.Join(broken, " and ")
+	}
+
+	location := "channel " + c.Channel
+	if c.Message != "" {
+		location += ", message " + c.Message
+	}
+	if c.Path != "" {
+		location += ", " + c.Path
+	}
+
+	return fmt.Sprintf("[%s] %s: %s", impact, location, c.Description)
+}
+
+// Changes is a list of changes.
+type Changes []Change
+
+// Breaking returns the changes breaking either producers or consumers.
+func (c Changes) Breaking() Changes {
+	var breaking Changes
+	for _, change := range c {
+		if change.IsBreaking() {
+			breaking = append(breaking, change)
+		}
+	}
+
+	return breaking
+}
+
+// Documents compares two versions of an AsyncAPI document, from the previous one to the new one.
+// Channels are compared by path and messages by name.
+func Documents(from, to asyncapi.Document) Changes {
+	oldChannels, newChannels := channelsByPath(from), channelsByPath(to)
+
+	d := &differ{}
+	for _, path := range sortedKeys(oldChannels, newChannels) {
+		oldChannel, inOld := oldChannels[path]
+		newChannel, inNew := newChannels[path]
+		switch {
+		case !inNew:
+			d.add(Change{Channel: path, Description: "channel removed", Producers: ImpactBreaking, Consumers: ImpactBreaking})
+		case !inOld:
+			d.add(Change{Channel: path, Description: "channel added", Producers: ImpactCompatible, Consumers: ImpactCompatible})
+		default:
+			d.channel(path, oldChannel, newChannel)
+		}
+	}
+
+	return d.changes
+}
+
+// differ accumulates the changes found while comparing.
+type differ struct {
+	changes Changes
+	// visited holds the pairs of schemas being compared, so circular schemas are compared once.
+	visited map[[2]asyncapi.Schema]bool
+}
+
+func (d *differ) add(c Change) {
+	d.changes = append(d.changes, c)
+}
+
+func (d *differ) channel(path string, from, to asyncapi.Channel) {
+	oldMessages, newMessages := messagesByName(from), messagesByName(to)
+	for _, name := range sortedKeys(oldMessages, newMessages) {
+		oldMessage, inOld := oldMessages[name]
+		newMessage, inNew := newMessages[name]
+		switch {
+		case !inNew:
+			d.add(Change{Channel: path, Message: name, Description: "message removed", Producers: ImpactBreaking, Consumers: ImpactCompatible})
+		case !inOld:
+			d.add(Change{Channel: path, Message: name, Description: "message added", Producers: ImpactCompatible, Consumers: ImpactBreaking})
+		default:
+			d.visited = make(map[[2]asyncapi.Schema]bool)
+			s := &schemaDiffer{differ: d, channel: path, message: name}
+			s.compare("", oldMessage.Payload(), newMessage.Payload())
+		}
+	}
+}
+
+// schemaDiffer compares the payload schemas of a message.
+type schemaDiffer struct {
+	*differ
+	channel string
+	message string
+}
+
+func (d *schemaDiffer) change(path, description string, producers, consumers Impact) {
+	d.add(Change{Channel: d.channel, Message: d.message, Path: path, Description: description, Producers: producers, Consumers: consumers})
+}
+
+// narrowed records a change narrowing the values allowed at path, which breaks producers.
+func (d *schemaDiffer) narrowed(path, format string, args ...interface{}) {
+	d.change(path, fmt.Sprintf(format, args...), ImpactBreaking, ImpactCompatible)
+}
+
+// widened records a change widening the values allowed at path, which breaks consumers.
+func (d *schemaDiffer) widened(path, format string, args ...interface{}) {
+	d.change(path, fmt.Sprintf(format, args...), ImpactCompatible, ImpactBreaking)
+}
+
+// changed records a change both narrowing and widening the values allowed at path.
+func (d *schemaDiffer) changed(path, format string, args ...interface{}) {
+	d.change(path, fmt.Sprintf(format, args...), ImpactBreaking, ImpactBreaking)
+}
+
+func (d *schemaDiffer) compare(path string, from, to asyncapi.Schema) {
+	switch {
+	case from == nil && to == nil:
+		return
+	case from == nil:
+		d.narrowed(path, "schema added")
+		return
+	case to == nil:
+		d.widened(path, "schema removed")
+		return
+	}
+
+	pair := [2]asyncapi.Schema{from, to}
+	if d.visited[pair] {
+		return
+	}
+	d.visited[pair] = true
+
+	d.compareTypes(path, from.Type(), to.Type())
+	d.compareEnums(path, from.Enum(), to.Enum())
+	d.compareStringConstraint(path, "pattern", from.Pattern(), to.Pattern())
+	d.compareStringConstraint(path, "format", from.Format(), to.Format())
+	d.compareBounds(path, from, to)
+	d.compareRequired(path, from.Required(), to.Required())
+	d.compareProperties(path, from, to)
+	d.compareItems(path, from.Items(), to.Items())
+	d.compareSubSchemas(path, "allOf", from.AllOf(), to.AllOf(), false)
+	d.compareSubSchemas(path, "anyOf", from.AnyOf(), to.AnyOf(), true)
+	d.compareSubSchemas(path, "oneOf", from.OneOf(), to.OneOf(), true)
+}
+
+func (d *schemaDiffer) compareTypes(path string, from, to []string) {
+	switch {
+	case len(from) == 0 && len(to) == 0:
+		return
+	case len(from) == 0:
+		d.narrowed(path, "type restricted to %s", strings.Join(to, ", "))
+		return
+	case len(to) == 0:
+		d.widened(path, "type restriction %s removed", strings.Join(from, ", "))
+		return
+	}
+
+	removed, added := typesNotIn(from, to), typesNotIn(to, from)
+	switch {
+	case len(removed) > 0 && len(added) > 0:
+		d.changed(path, "type changed from %s to %s", strings.Join(from, ", "), strings.Join(to, ", "))
+	case len(removed) > 0:
+		d.narrowed(path, "type %s removed", strings.Join(removed, ", "))
+	case len(added) > 0:
+		d.widened(path, "type %s added", strings.Join(added, ", "))
+	}
+}
+
+// typesNotIn returns the types of a not covered by b. Type integer is covered by number.
+func typesNotIn(a, b []string) []string {
+	set := make(map[string]bool, len(b))
+	for _, t := range b {
+		set[t] = true
+	}
+
+	var result []string
+	for _, t := range a {
+		if !set[t] && !(t == "integer" && set["number"]) {
+			result = append(result, t)
+		}
+	}
+
+	return result
+}
+
+func (d *schemaDiffer) compareEnums(path string, from, to []interface{}) {
+	switch {
+	case len(from) == 0 && len(to) == 0:
+		return
+	case len(from) == 0:
+		d.narrowed(path, "enum %s added", joinValues(to))
+		return
+	case len(to) == 0:
+		d.widened(path, "enum %s removed", joinValues(from))
+		return
+	}
+
+	if removed := valuesNotIn(from, to); len(removed) > 0 {
+		d.narrowed(path, "enum values %s removed", joinValues(removed))
+	}
+
+	if added := valuesNotIn(to, from); len(added) > 0 {
+		d.widened(path, "enum values %s added", joinValues(added))
+	}
+}
+
+// valuesNotIn returns the values of a not present in b. Values are compared by their JSON representation.
+func valuesNotIn(a, b []interface{}) []interface{} {
+	set := make(map[string]bool, len(b))
+	for _, v := range b {
+		set[jsonValue(v)] = true
+	}
+
+	var result []interface{}
+	for _, v := range a {
+		if !set[jsonValue(v)] {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func joinValues(values []interface{}) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = jsonValue(v)
+	}
+
+	return strings.Join(s, ", ")
+}
+
+func jsonValue(v interface{}) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+
+	return string(raw)
+}
+
+// compareStringConstraint compares constraints whose values can't be compared, such as pattern or format.
+// A changed constraint may both reject values that were valid and accept values that were invalid.
+func (d *schemaDiffer) compareStringConstraint(path, name, from, to string) {
+	switch {
+	case from == to:
+	case from == "":
+		d.narrowed(path, "%s %q added", name, to)
+	case to == "":
+		d.widened(path, "%s %q removed", name, from)
+	default:
+		d.changed(path, "%s changed from %q to %q", name, from, to)
+	}
+}
+
+// bound is a numeric constraint of a schema.
+type bound struct {
+	name     string
+	from, to *float64
+	// lower tells if the bound is a lower one (e.g. minimum), so increasing it narrows the allowed values.
+	lower bool
+}
+
+func (d *schemaDiffer) compareBounds(path string, from, to asyncapi.Schema) {
+	bounds := []bound{
+		{name: "minimum", from: from.Minimum(), to: to.Minimum(), lower: true},
+		{name: "exclusiveMinimum", from: from.ExclusiveMinimum(), to: to.ExclusiveMinimum(), lower: true},
+		{name: "maximum", from: from.Maximum(), to: to.Maximum()},
+		{name: "exclusiveMaximum", from: from.ExclusiveMaximum(), to: to.ExclusiveMaximum()},
+		{name: "minLength", from: from.MinLength(), to: to.MinLength(), lower: true},
+		{name: "maxLength", from: from.MaxLength(), to: to.MaxLength()},
+		{name: "minItems", from: from.MinItems(), to: to.MinItems(), lower: true},
+		{name: "maxItems", from: from.MaxItems(), to: to.MaxItems()},
+		{name: "minProperties", from: from.MinProperties(), to: to.MinProperties(), lower: true},
+		{name: "maxProperties", from: from.MaxProperties(), to: to.MaxProperties()},
+	}
+
+	for _, b := range bounds {
+		switch {
+		case b.from == nil && b.to == nil:
+		case b.from == nil:
+			d.narrowed(path, "%s %s added", b.name, formatFloat(*b.to))
+		case b.to == nil:
+			d.widened(path, "%s %s removed", b.name, formatFloat(*b.from))
+		case *b.from == *b.to:
+		case (*b.to > *b.from) == b.lower:
+			d.narrowed(path, "%s changed from %s to %s", b.name, formatFloat(*b.from), formatFloat(*b.to))
+		default:
+			d.widened(path, "%s changed from %s to %s", b.name, formatFloat(*b.from), formatFloat(*b.to))
+		}
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func (d *schemaDiffer) compareRequired(path string, from, to []string) {
+	oldSet, newSet := stringSet(from), stringSet(to)
+	for _, name := range sortedKeys(oldSet, newSet) {
+		switch {
+		case !oldSet[name]:
+			d.narrowed(propertyPath(path, name), "property is now required")
+		case !newSet[name]:
+			d.widened(propertyPath(path, name), "property is no longer required")
+		}
+	}
+}
+
+func (d *schemaDiffer) compareProperties(path string, from, to asyncapi.Schema) {
+	oldAdditionalAllowed, newAdditionalAllowed := additionalPropertiesAllowed(from), additionalPropertiesAllowed(to)
+	switch {
+	case oldAdditionalAllowed && !newAdditionalAllowed:
+		d.narrowed(path, "additional properties are no longer allowed")
+	case !oldAdditionalAllowed && newAdditionalAllowed:
+		d.widened(path, "additional properties are now allowed")
+	}
+
+	oldProperties, newProperties := from.Properties(), to.Properties()
+	for _, name := range sortedKeys(oldProperties, newProperties) {
+		oldProperty, inOld := oldProperties[name]
+		newProperty, inNew := newProperties[name]
+		switch {
+		case !inNew && newAdditionalAllowed:
+			d.widened(propertyPath(path, name), "property removed")
+		case !inNew:
+			d.changed(propertyPath(path, name), "property removed while additional properties are not allowed")
+		case !inOld && !oldAdditionalAllowed:
+			d.widened(propertyPath(path, name), "property added while additional properties were not allowed")
+		case !inOld:
+			d.change(propertyPath(path, name), "property added", ImpactCompatible, ImpactCompatible)
+		default:
+			d.compare(propertyPath(path, name), oldProperty, newProperty)
+		}
+	}
+}
+
+func additionalPropertiesAllowed(s asyncapi.Schema) bool {
+	additional := s.AdditionalProperties()
+	return additional == nil || !additional.IsFalse()
+}
+
+func (d *schemaDiffer) compareItems(path string, from, to []asyncapi.Schema) {
+	if len(from) == 1 && len(to) == 1 {
+		d.compare(path+"/*", from[0], to[0])
+		return
+	}
+
+	d.compareSchemaLists(path, "items", from, to, func(i int) string { return path + "/" + strconv.Itoa(i) }, false)
+}
+
+// compareSubSchemas compares the sub schemas of compositions like allOf, anyOf and oneOf, by position.
+// Alternatives tells if the sub schemas are alternatives (anyOf, oneOf), so adding them widens the allowed values.
+func (d *schemaDiffer) compareSubSchemas(path, keyword string, from, to []asyncapi.Schema, alternatives bool) {
+	d.compareSchemaLists(path, keyword, from, to, func(int) string { return path }, alternatives)
+}
+
+func (d *schemaDiffer) compareSchemaLists(path, keyword string, from, to []asyncapi.Schema, itemPath func(int) string, alternatives bool) {
+	for i := 0; i < len(from) && i < len(to); i++ {
+		d.compare(itemPath(i), from[i], to[i])
+	}
+
+	switch {
+	case len(to) > len(from) && alternatives:
+		d.widened(path, "%d %s schemas added", len(to)-len(from), keyword)
+	case len(to) > len(from):
+		d.narrowed(path, "%d %s schemas added", len(to)-len(from), keyword)
+	case len(to) < len(from) && alternatives:
+		d.narrowed(path, "%d %s schemas removed", len(from)-len(to), keyword)
+	case len(to) < len(from):
+		d.widened(path, "%d %s schemas removed", len(from)-len(to), keyword)
+	}
+}
+
+func propertyPath(path, name string) string {
+	return path + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
+
+func channelsByPath(doc asyncapi.Document) map[string]asyncapi.Channel {
+	channels := make(map[string]asyncapi.Channel)
+	for _, c := range doc.Channels() {
+		channels[c.Path()] = c
+	}
+
+	return channels
+}
+
+// messagesByName indexes the messages of a channel by name. Unnamed messages are indexed by their position.
+func messagesByName(c asyncapi.Channel) map[string]asyncapi.Message {
+	messages := make(map[string]asyncapi.Message)
+	for i, m := range c.Messages() {
+		name := m.Name()
+		if name == "" {
+			name = "#" + strconv.Itoa(i)
+		}
+		messages[name] = m
+	}
+
+	return messages
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+
+	return set
+}
+
+// sortedKeys returns the sorted keys of all the given maps, which should be indexed by string.
+func sortedKeys(maps ...interface{}) []string {
+	set := make(map[string]bool)
+	for _, m := range maps {
+		for _, k := range reflect.ValueOf(m).MapKeys() {
+			set[k.String()] = true
+		}
+	}
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,232 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/asyncapi/event-gateway/asyncapi"
+	v2 "github.com/asyncapi/event-gateway/asyncapi/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const signupPayload = `
+          type: object
+          required: [email]
+          properties:
+            email:
+              type: string
+              pattern: '^\S+@\S+$'
+              maxLength: 100
+            plan:
+              type: string
+              enum: [free, pro]
+            age:
+              type: integer
+              minimum: 18
+            tags:
+              type: array
+              items:
+                type: string`
+
+func TestDocuments(t *testing.T) {
+	tests := []struct {
+		name            string
+		from            string
+		to              string
+		expectedChanges Changes
+	}{
+		{
+			name: "No changes",
+			from: signupPayload,
+			to:   signupPayload,
+		},
+		{
+			name: "Required property added",
+			from: signupPayload,
+			to:   replace(signupPayload, "required: [email]", "required: [email, plan]"),
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Path: "/plan", Description: "property is now required", Producers: ImpactBreaking, Consumers: ImpactCompatible},
+			},
+		},
+		{
+			name: "Required property removed",
+			from: signupPayload,
+			to:   replace(signupPayload, "required: [email]", "required: []"),
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Path: "/email", Description: "property is no longer required", Producers: ImpactCompatible, Consumers: ImpactBreaking},
+			},
+		},
+		{
+			name: "Enum narrowed",
+			from: signupPayload,
+			to:   replace(signupPayload, "enum: [free, pro]", "enum: [pro]"),
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Path: "/plan", Description: `enum values "free" removed`, Producers: ImpactBreaking, Consumers: ImpactCompatible},
+			},
+		},
+		{
+			name: "Enum widened",
+			from: signupPayload,
+			to:   replace(signupPayload, "enum: [free, pro]", "enum: [free, pro, enterprise]"),
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Path: "/plan", Description: `enum values "enterprise" added`, Producers: ImpactCompatible, Consumers: ImpactBreaking},
+			},
+		},
+		{
+			name: "Type changed",
+			from: signupPayload,
+			to:   replace(signupPayload, "type: integer", "type: string"),
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Path: "/age", Description: "type changed from integer to string", Producers: ImpactBreaking, Consumers: ImpactBreaking},
+			},
+		},
+		{
+			name: "Type widened from integer to number",
+			from: signupPayload,
+			to:   replace(signupPayload, "type: integer", "type: number"),
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Path: "/age", Description: "type number added", Producers: ImpactCompatible, Consumers: ImpactBreaking},
+			},
+		},
+		{
+			name: "Pattern tightened",
+			from: replace(signupPayload, `pattern: '^\S+@\S+$'`, ""),
+			to:   signupPayload,
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Path: "/email", Description: `pattern "^\\S+@\\S+$" added`, Producers: ImpactBreaking, Consumers: ImpactCompatible},
+			},
+		},
+		{
+			name: "Pattern changed",
+			from: signupPayload,
+			to:   replace(signupPayload, `pattern: '^\S+@\S+$'`, `pattern: '^\S+@example\.com$'`),
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Path: "/email", Description: `pattern changed from "^\\S+@\\S+$" to "^\\S+@example\\.com$"`, Producers: ImpactBreaking, Consumers: ImpactBreaking},
+			},
+		},
+		{
+			name: "Bounds changed",
+			from: signupPayload,
+			to:   replace(replace(signupPayload, "minimum: 18", "minimum: 21"), "maxLength: 100", "maxLength: 200"),
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Path: "/age", Description: "minimum changed from 18 to 21", Producers: ImpactBreaking, Consumers: ImpactCompatible},
+				{Channel: "signups", Message: "signup", Path: "/email", Description: "maxLength changed from 100 to 200", Producers: ImpactCompatible, Consumers: ImpactBreaking},
+			},
+		},
+		{
+			name: "Array items changed",
+			from: signupPayload,
+			to:   replace(signupPayload, "items:\n                type: string", "items:\n                type: integer"),
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Path: "/tags/*", Description: "type changed from string to integer", Producers: ImpactBreaking, Consumers: ImpactBreaking},
+			},
+		},
+		{
+			name: "Property removed",
+			from: signupPayload,
+			to:   replace(signupPayload, "            plan:\n              type: string\n              enum: [free, pro]\n", ""),
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Path: "/plan", Description: "property removed", Producers: ImpactCompatible, Consumers: ImpactBreaking},
+			},
+		},
+		{
+			name: "Additional properties no longer allowed",
+			from: signupPayload,
+			to:   replace(signupPayload, "required: [email]", "required: [email]\n          additionalProperties: false"),
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Description: "additional properties are no longer allowed", Producers: ImpactBreaking, Consumers: ImpactCompatible},
+			},
+		},
+		{
+			name: "Property added",
+			from: signupPayload,
+			to:   signupPayload + "\n            name:\n              type: string",
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Path: "/name", Description: "property added", Producers: ImpactCompatible, Consumers: ImpactCompatible},
+			},
+		},
+		{
+			name: "Property added while additional properties were not allowed",
+			from: replace(signupPayload, "required: [email]", "required: [email]\n          additionalProperties: false"),
+			to:   replace(signupPayload, "required: [email]", "required: [email]\n          additionalProperties: false") + "\n            name:\n              type: string",
+			expectedChanges: Changes{
+				{Channel: "signups", Message: "signup", Path: "/name", Description: "property added while additional properties were not allowed", Producers: ImpactCompatible, Consumers: ImpactBreaking},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := Documents(decode(t, signupsDoc(test.from)), decode(t, signupsDoc(test.to)))
+			assert.Equal(t, test.expectedChanges, changes)
+		})
+	}
+}
+
+func TestDocuments_Channels(t *testing.T) {
+	from := decode(t, signupsDoc(signupPayload)+`
+  events:
+    publish:
+      message:
+        payload:
+          type: object`)
+
+	to := decode(t, `
+asyncapi: '2.0.0'
+info:
+  title: Test
+  version: '2.0.0'
+channels:
+  signups:
+    publish:
+      message:
+        oneOf:
+          - name: signup
+            payload:`+strings.ReplaceAll(signupPayload, "\n", "\n    ")+`
+          - name: login
+            payload:
+              type: object
+  orders:
+    publish:
+      message:
+        payload:
+          type: object`)
+
+	changes := Documents(from, to)
+	assert.Equal(t, Changes{
+		{Channel: "events", Description: "channel removed", Producers: ImpactBreaking, Consumers: ImpactBreaking},
+		{Channel: "orders", Description: "channel added", Producers: ImpactCompatible, Consumers: ImpactCompatible},
+		{Channel: "signups", Message: "login", Description: "message added", Producers: ImpactCompatible, Consumers: ImpactBreaking},
+	}, changes)
+
+	assert.Equal(t, changes[:1], changes.Breaking()[:1])
+	assert.Len(t, changes.Breaking(), 2)
+	assert.Equal(t, "[breaking for producers and consumers] channel events: channel removed", changes[0].String())
+	assert.Equal(t, "[compatible] channel orders: channel added", changes[1].String())
+	assert.Equal(t, "[breaking for consumers] channel signups, message login: message added", changes[2].String())
+}
+
+func signupsDoc(payload string) string {
+	return `
+asyncapi: '2.0.0'
+info:
+  title: Test
+  version: '1.0.0'
+channels:
+  signups:
+    publish:
+      message:
+        name: signup
+        payload:` + payload
+}
+
+func decode(t *testing.T, raw string) asyncapi.Document {
+	doc := new(v2.Document)
+	require.NoError(t, v2.Decode([]byte(raw), doc))
+
+	return doc
+}
+
+func replace(s, old, new string) string {
+	return strings.Replace(s, old, new, 1)
+}
@@ -5,6 +5,8 @@ package asyncapi
 // NOTE: this interface is not completed yet.
 type Document interface {
 	Extendable
+	ID() string
+	Info() Info
 	Channels() []Channel
 	HasChannels() bool
 	ApplicationPublishableChannels() []Channel
@@ -23,6 +25,16 @@ type Document interface {
 	Server(name string) (Server, bool)
 	Servers() []Server
 	HasServers() bool
+	SecurityScheme(name string) (SecurityScheme, bool)
+	SecuritySchemes() []SecurityScheme
+}
+
+// Info provides metadata about the API.
+type Info interface {
+	Extendable
+	Describable
+	Title() string
+	Version() string
 }
 
 // Channel is an addressable component, made available by the server, for the organization of messages.
@@ -31,6 +43,7 @@ type Channel interface {
 	Extendable
 	Identifiable
 	Describable
+	Bindable
 	Path() string // Path is the identifier
 	Parameters() []ChannelParameter
 	HasParameters() bool
@@ -70,6 +83,7 @@ type Operation interface {
 type Message interface {
 	Extendable
 	Describable
+	Bindable
 	UID() string
 	Name() string
 	Title() string
@@ -158,6 +172,25 @@ type Server interface {
 	Protocol() string
 	HasProtocol() bool
 	Variables() []ServerVariable
+	SecurityRequirements() []SecurityRequirement
+}
+
+// SecurityRequirement references a security scheme that can be used for connecting to a server.
+type SecurityRequirement interface {
+	SchemeName() string
+	Scopes() []string
+}
+
+// SecuritySchemeType is the type of a security scheme.
+type SecuritySchemeType string
+
+// SecurityScheme defines a security scheme that can be used by servers.
+type SecurityScheme interface {
+	Extendable
+	Identifiable
+	Describable
+	Name() string
+	Type() SecuritySchemeType
 }
 
 // ServerVariable is an object representing a Server Variable for server URL template substitution.
@@ -178,6 +211,13 @@ type Extendable interface {
 	Extension(name string) interface{}
 }
 
+// Bindable means the object can have protocol-specific bindings.
+// See https://www.asyncapi.com/docs/specifications/v2.0.0#channelBindingsObject.
+type Bindable interface {
+	HasBindings() bool
+	Binding(protocol string) interface{}
+}
+
 // Describable means the object can have a description.
 type Describable interface {
 	Description() string
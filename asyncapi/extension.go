@@ -2,6 +2,15 @@ package asyncapi
 
 // AsyncAPI doc extensions for the Event Gateway.
 const (
-	ExtensionEventGatewayListener    = "x-eventgateway-listener"
-	ExtensionEventGatewayDialMapping = "x-eventgateway-dial-mapping"
+	ExtensionEventGatewayListener             = "x-eventgateway-listener"
+	ExtensionEventGatewayDialMapping          = "x-eventgateway-dial-mapping"
+	ExtensionEventGatewayListenerTLS          = "x-eventgateway-listener-tls"
+	ExtensionEventGatewaySASL                 = "x-eventgateway-sasl"
+	ExtensionEventGatewayClientIDs            = "x-eventgateway-client-ids"
+	ExtensionEventGatewaySensitive            = "x-eventgateway-sensitive"
+	ExtensionEventGatewayValidationSampleRate = "x-eventgateway-validation-sample-rate"
+	ExtensionEventGatewayMaxMessageBytes      = "x-eventgateway-max-message-bytes"
+	ExtensionEventGatewayMaxRecordsPerSecond  = "x-eventgateway-max-records-per-second"
+	ExtensionEventGatewayKeyEncoding          = "x-eventgateway-key-encoding"
+	ExtensionEventGatewayRequireKey           = "x-eventgateway-require-key"
 )
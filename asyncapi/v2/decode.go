@@ -33,8 +33,12 @@ func Decode(b []byte, dst interface{}) error {
 		return err
 	}
 
+	return decode(raw, dst)
+}
+
+func decode(raw interface{}, dst interface{}) error {
 	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
-		DecodeHook: mapstructure.ComposeDecodeHookFunc(setModelIdentifierHook, setDefaultsHook),
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(setModelIdentifierHook, setDefaultsHook, decodeSchemasHook),
 		Squash:     true,
 		Result:     dst,
 	})
@@ -97,3 +101,28 @@ func setDefaultsHook(_ reflect.Type, to reflect.Type, data interface{}) (interfa
 
 	return data, nil
 }
+
+// decodeSchemasHook is a hook for the mapstructure decoder.
+// It decodes the schemas of lists of asyncapi.Schema (items, allOf, etc), which mapstructure can't decode into an interface.
+// A single schema is decoded as a list of one element. Example: `items` can be either a schema or a list of schemas.
+func decodeSchemasHook(_ reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf([]asyncapi.Schema(nil)) {
+		return data, nil
+	}
+
+	raw, ok := data.([]interface{})
+	if !ok {
+		raw = []interface{}{data}
+	}
+
+	schemas := make([]asyncapi.Schema, len(raw))
+	for i, r := range raw {
+		s := new(Schema)
+		if err := decode(r, s); err != nil {
+			return nil, err
+		}
+		schemas[i] = s
+	}
+
+	return schemas, nil
+}
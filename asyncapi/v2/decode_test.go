@@ -1,6 +1,7 @@
 package v2
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
@@ -13,6 +14,10 @@ func TestDecodeFromFile(t *testing.T) {
 	doc := new(Document)
 	require.NoError(t, Decode([]byte("testdata/example-kafka.yaml"), doc))
 
+	assert.Equal(t, "Streetlights Kafka API", doc.Info().Title())
+	assert.Equal(t, "1.0.0", doc.Info().Version())
+	assert.True(t, doc.Info().HasDescription())
+
 	require.Len(t, doc.Servers(), 1)
 	s, ok := doc.Server("test")
 	assert.True(t, ok)
@@ -32,6 +37,17 @@ func TestDecodeFromFile(t *testing.T) {
 	assert.Equal(t, "broker:9092", s.Extension(asyncapi.ExtensionEventGatewayDialMapping))
 	assert.Empty(t, s.Variables())
 
+	require.Len(t, s.SecurityRequirements(), 1)
+	assert.Equal(t, "saslScram", s.SecurityRequirements()[0].SchemeName())
+	assert.Empty(t, s.SecurityRequirements()[0].Scopes())
+
+	require.Len(t, doc.SecuritySchemes(), 1)
+	scheme, ok := doc.SecurityScheme("saslScram")
+	require.True(t, ok)
+	assert.Equal(t, "saslScram", scheme.Name())
+	assert.Equal(t, SecuritySchemeTypeUserPassword, scheme.Type())
+	assert.Equal(t, "Provide your username and password for SASL/SCRAM authentication", scheme.Description())
+
 	channelPaths := []string{
 		"smartylighting.streetlights.1.0.event.{streetlightId}.lighting.measured",
 		"smartylighting.streetlights.1.0.action.{streetlightId}.turn.on",
@@ -74,6 +90,9 @@ servers:
     protocol: mqtt
 channels:
   light/measured:
+    bindings:
+      mqtt:
+        bindingVersion: 0.1.0
     publish:
       summary: Inform about environmental lighting conditions for a particular streetlight.
       operationId: onLightMeasured
@@ -148,6 +167,9 @@ components:
 	assert.Equal(t, "light/measured", channels[0].Path())
 	assert.Empty(t, channels[0].Parameters())
 	assert.False(t, channels[0].HasDescription())
+	assert.True(t, channels[0].HasBindings())
+	assert.Equal(t, map[string]interface{}{"bindingVersion": "0.1.0"}, channels[0].Binding("mqtt"))
+	assert.Nil(t, channels[0].Binding("amqp"))
 
 	operations := channels[0].Operations()
 	require.Len(t, operations, 1)
@@ -204,3 +226,124 @@ components:
 func refFloat64(v float64) *float64 {
 	return &v
 }
+
+func TestDecodeSchemasHook(t *testing.T) {
+	tests := []struct {
+		name            string
+		data            interface{}
+		expectedSchemas []asyncapi.Schema
+		expectedErr     string
+	}{
+		{
+			name: "List of schemas",
+			data: []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{"type": "number", "minimum": 0},
+			},
+			expectedSchemas: []asyncapi.Schema{
+				&Schema{TypeField: "string"},
+				&Schema{TypeField: "number", MinimumField: refFloat64(0)},
+			},
+		},
+		{
+			name:            "Single schema is decoded as a list of one",
+			data:            map[string]interface{}{"type": "string"},
+			expectedSchemas: []asyncapi.Schema{&Schema{TypeField: "string"}},
+		},
+		{
+			name: "Nested schemas",
+			data: []interface{}{
+				map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+			expectedSchemas: []asyncapi.Schema{
+				&Schema{TypeField: "array", ItemsField: []asyncapi.Schema{&Schema{TypeField: "string"}}},
+			},
+		},
+		{
+			name:        "Invalid schema",
+			data:        []interface{}{"not a schema"},
+			expectedErr: "'' expected a map, got 'string'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schemas, err := decodeSchemasHook(nil, reflect.TypeOf([]asyncapi.Schema(nil)), test.data)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedSchemas, schemas)
+		})
+	}
+}
+
+func TestDecodeSchemasHook_otherTypes(t *testing.T) {
+	data := []interface{}{map[string]interface{}{"type": "string"}}
+	decoded, err := decodeSchemasHook(nil, reflect.TypeOf([]interface{}(nil)), data)
+	require.NoError(t, err)
+	assert.Equal(t, data, decoded)
+}
+
+func TestDecodeSchemaLists(t *testing.T) {
+	raw := []byte(`
+asyncapi: '2.0.0'
+info:
+  title: Test
+  version: '1.0.0'
+channels:
+  signups:
+    publish:
+      message:
+        payload:
+          type: object
+          properties:
+            tags:
+              type: array
+              items:
+                type: string
+            coordinates:
+              type: array
+              items:
+                - type: number
+                - type: number
+            contact:
+              oneOf:
+                - type: string
+                  format: email
+                - type: object
+            address:
+              allOf:
+                - type: object
+                - required:
+                    - street
+            phone:
+              anyOf:
+                - type: string
+                - type: integer`)
+
+	doc := new(Document)
+	require.NoError(t, Decode(raw, doc))
+
+	properties := doc.Channels()[0].Messages()[0].Payload().Properties()
+
+	require.Len(t, properties["tags"].Items(), 1)
+	assert.Equal(t, []string{"string"}, properties["tags"].Items()[0].Type())
+
+	require.Len(t, properties["coordinates"].Items(), 2)
+	assert.Equal(t, []string{"number"}, properties["coordinates"].Items()[1].Type())
+
+	oneOf := properties["contact"].OneOf()
+	require.Len(t, oneOf, 2)
+	assert.Equal(t, "email", oneOf[0].Format())
+	assert.Equal(t, []string{"object"}, oneOf[1].Type())
+
+	allOf := properties["address"].AllOf()
+	require.Len(t, allOf, 2)
+	assert.Equal(t, []string{"street"}, allOf[1].Required())
+
+	anyOf := properties["phone"].AnyOf()
+	require.Len(t, anyOf, 2)
+	assert.Equal(t, []string{"integer"}, anyOf[1].Type())
+}
@@ -2,6 +2,8 @@
 package v2
 
 import (
+	"sort"
+
 	"github.com/asyncapi/event-gateway/asyncapi"
 )
 
@@ -11,10 +13,32 @@ const (
 	OperationTypeSubscribe asyncapi.OperationType = "subscribe"
 )
 
+// Constants for Security Scheme Types.
+const (
+	SecuritySchemeTypeUserPassword asyncapi.SecuritySchemeType = "userPassword"
+	SecuritySchemeTypeX509         asyncapi.SecuritySchemeType = "X509"
+	SecuritySchemeTypePlain        asyncapi.SecuritySchemeType = "plain"
+	SecuritySchemeTypeScramSha256  asyncapi.SecuritySchemeType = "scramSha256"
+	SecuritySchemeTypeScramSha512  asyncapi.SecuritySchemeType = "scramSha512"
+	SecuritySchemeTypeOAuth2       asyncapi.SecuritySchemeType = "oauth2"
+	SecuritySchemeTypeGSSAPI       asyncapi.SecuritySchemeType = "gssapi"
+)
+
 type Document struct {
 	Extendable
-	ServersField  map[string]Server  `mapstructure:"servers"`
-	ChannelsField map[string]Channel `mapstructure:"channels"`
+	IDField         string             `mapstructure:"id"`
+	InfoField       Info               `mapstructure:"info"`
+	ServersField    map[string]Server  `mapstructure:"servers"`
+	ChannelsField   map[string]Channel `mapstructure:"channels"`
+	ComponentsField Components         `mapstructure:"components"`
+}
+
+func (d Document) ID() string {
+	return d.IDField
+}
+
+func (d Document) Info() asyncapi.Info {
+	return d.InfoField
 }
 
 func (d Document) ApplicationPublishableChannels() []asyncapi.Channel {
@@ -129,6 +153,20 @@ func (d Document) HasServers() bool {
 	return len(d.ServersField) > 0
 }
 
+func (d Document) SecurityScheme(name string) (asyncapi.SecurityScheme, bool) {
+	s, ok := d.ComponentsField.SecuritySchemesField[name]
+	return s, ok
+}
+
+func (d Document) SecuritySchemes() []asyncapi.SecurityScheme {
+	var schemes []asyncapi.SecurityScheme
+	for _, s := range d.ComponentsField.SecuritySchemesField {
+		schemes = append(schemes, s)
+	}
+
+	return schemes
+}
+
 func (d Document) filterChannels(filter func(operation asyncapi.Operation) bool) []asyncapi.Channel {
 	var channels []asyncapi.Channel
 	for _, c := range d.Channels() {
@@ -168,6 +206,21 @@ func (d Document) filterOperations(filter func(operation asyncapi.Operation) boo
 	return operations
 }
 
+type Info struct {
+	Extendable
+	Describable  `mapstructure:",squash"`
+	TitleField   string `mapstructure:"title"`
+	VersionField string `mapstructure:"version"`
+}
+
+func (i Info) Title() string {
+	return i.TitleField
+}
+
+func (i Info) Version() string {
+	return i.VersionField
+}
+
 // NewChannel creates a new Channel. Useful for testing.
 func NewChannel(path string) *Channel {
 	return &Channel{
@@ -178,6 +231,7 @@ func NewChannel(path string) *Channel {
 type Channel struct {
 	Extendable
 	Describable     `mapstructure:",squash"`
+	Bindable        `mapstructure:",squash"`
 	PathField       string                      `mapstructure:"path"`
 	ParametersField map[string]ChannelParameter `mapstructure:"parameters"`
 	Subscribe       *SubscribeOperation         `mapstructure:"subscribe"`
@@ -377,6 +431,7 @@ func NewMessages(msgs []*Message) *Messages {
 type Message struct {
 	Extendable
 	Describable      `mapstructure:",squash"`
+	Bindable         `mapstructure:",squash"`
 	NameField        string  `mapstructure:"name"`
 	TitleField       string  `mapstructure:"title"`
 	SummaryField     string  `mapstructure:"summary"`
@@ -447,8 +502,8 @@ func NewFalsifiableSchema(val interface{}) *FalsifiableSchema {
 }
 
 func (f FalsifiableSchema) IsFalse() bool {
-	_, ok := f.val.(bool)
-	return ok
+	v, ok := f.val.(bool)
+	return ok && !v
 }
 
 func (f FalsifiableSchema) IsSchema() bool {
@@ -520,11 +575,20 @@ type Schema struct {
 }
 
 func (s *Schema) AdditionalItems() asyncapi.FalsifiableSchema {
-	return NewFalsifiableSchema(s.AdditionalItemsField)
+	return falsifiableSchema(s.AdditionalItemsField)
 }
 
 func (s *Schema) AdditionalProperties() asyncapi.FalsifiableSchema {
-	return NewFalsifiableSchema(s.AdditionalPropertiesField)
+	return falsifiableSchema(s.AdditionalPropertiesField)
+}
+
+// falsifiableSchema avoids returning a nil *FalsifiableSchema as a non-nil asyncapi.FalsifiableSchema.
+func falsifiableSchema(val interface{}) asyncapi.FalsifiableSchema {
+	if val == nil {
+		return nil
+	}
+
+	return NewFalsifiableSchema(val)
 }
 
 func (s *Schema) AllOf() []asyncapi.Schema {
@@ -758,6 +822,7 @@ type Server struct {
 	ProtocolField  string                    `mapstructure:"protocol"`
 	URLField       string                    `mapstructure:"url"`
 	VariablesField map[string]ServerVariable `mapstructure:"variables"`
+	SecurityField  []map[string][]string     `mapstructure:"security"`
 }
 
 func (s Server) Variables() []asyncapi.ServerVariable {
@@ -769,6 +834,25 @@ func (s Server) Variables() []asyncapi.ServerVariable {
 	return vars
 }
 
+// SecurityRequirements returns the security requirements of the server. Each of them is an alternative for connecting to the server.
+// Requirement objects listing several schemes are flattened.
+func (s Server) SecurityRequirements() []asyncapi.SecurityRequirement {
+	var requirements []asyncapi.SecurityRequirement
+	for _, r := range s.SecurityField {
+		names := make([]string, 0, len(r))
+		for name := range r {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			requirements = append(requirements, SecurityRequirement{SchemeNameField: name, ScopesField: r[name]})
+		}
+	}
+
+	return requirements
+}
+
 func (s Server) IDField() string {
 	return "name"
 }
@@ -833,6 +917,48 @@ func (s ServerVariable) AllowedValues() []string {
 	return s.Enum
 }
 
+type SecurityRequirement struct {
+	SchemeNameField string
+	ScopesField     []string
+}
+
+func (r SecurityRequirement) SchemeName() string {
+	return r.SchemeNameField
+}
+
+func (r SecurityRequirement) Scopes() []string {
+	return r.ScopesField
+}
+
+type Components struct {
+	Extendable
+	SecuritySchemesField map[string]SecurityScheme `mapstructure:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Extendable
+	Describable `mapstructure:",squash"`
+	// NameField is not an AsyncAPI field but the key of the scheme in the components. The `name` field is already used by httpApiKey schemes.
+	NameField string `mapstructure:"schemeName"`
+	TypeField string `mapstructure:"type"`
+}
+
+func (s SecurityScheme) IDField() string {
+	return "schemeName"
+}
+
+func (s SecurityScheme) ID() string {
+	return s.NameField
+}
+
+func (s SecurityScheme) Name() string {
+	return s.NameField
+}
+
+func (s SecurityScheme) Type() asyncapi.SecuritySchemeType {
+	return asyncapi.SecuritySchemeType(s.TypeField)
+}
+
 type Describable struct {
 	DescriptionField string `mapstructure:"description"`
 }
@@ -845,6 +971,18 @@ func (d Describable) HasDescription() bool {
 	return d.DescriptionField != ""
 }
 
+type Bindable struct {
+	BindingsField map[string]interface{} `mapstructure:"bindings"`
+}
+
+func (b Bindable) HasBindings() bool {
+	return len(b.BindingsField) > 0
+}
+
+func (b Bindable) Binding(protocol string) interface{} {
+	return b.BindingsField[protocol]
+}
+
 type Extendable struct {
 	Raw map[string]interface{} `mapstructure:",remain" json:"-"`
 }
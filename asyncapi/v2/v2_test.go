@@ -30,10 +30,28 @@ func TestMessage_PlainPayload_OneMessage(t *testing.T) {
 	assert.Equal(t, expectedMsg, msgs[0])
 }
 
+func TestServer_SecurityRequirements(t *testing.T) {
+	s := Server{SecurityField: []map[string][]string{
+		{"oauth": {"write", "read"}, "apiKey": {}},
+		{"scram": {}},
+	}}
+
+	expected := []asyncapi.SecurityRequirement{
+		SecurityRequirement{SchemeNameField: "apiKey", ScopesField: []string{}},
+		SecurityRequirement{SchemeNameField: "oauth", ScopesField: []string{"write", "read"}},
+		SecurityRequirement{SchemeNameField: "scram", ScopesField: []string{}},
+	}
+	assert.Equal(t, expected, s.SecurityRequirements())
+	assert.Empty(t, Server{}.SecurityRequirements())
+}
+
 func TestSchema_AdditionalProperties(t *testing.T) {
 	schema := &Schema{}
 	assert.Nil(t, schema.AdditionalProperties())
 
+	schema = &Schema{AdditionalPropertiesField: true}
+	assert.False(t, schema.AdditionalProperties().IsFalse())
+
 	schema = &Schema{AdditionalPropertiesField: false}
 	assert.True(t, schema.AdditionalProperties().IsFalse())
 	assert.False(t, schema.AdditionalProperties().IsSchema())
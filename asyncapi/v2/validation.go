@@ -1,62 +1,305 @@
 package v2
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 
 	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
 	"github.com/asyncapi/event-gateway/asyncapi"
 	"github.com/asyncapi/event-gateway/message"
-	"github.com/xeipuuv/gojsonschema"
+	"github.com/pkg/errors"
 )
 
 // FromDocJSONSchemaMessageValidator creates a message.Validator based on a given AsyncAPI doc.
 func FromDocJSONSchemaMessageValidator(doc asyncapi.Document) (message.Validator, error) {
-	channels := doc.ApplicationSubscribableChannels()
-	messageSchemas := make(map[string]gojsonschema.JSONLoader)
-	for _, c := range channels {
-		for _, o := range c.Operations() {
-			if !o.IsApplicationSubscribing() {
-				continue
-			}
+	return FromDocsJSONSchemaMessageValidator(doc)
+}
+
+// FromDocsJSONSchemaMessageValidator creates a message.Validator based on several AsyncAPI docs.
+// Channels of all docs are merged into one validation table. The same channel can be declared by several docs as long as
+// the message payloads are the same. Validation errors are attributed to the docs declaring the channel.
+// Schemas are compiled by message.GoJSONSchemaCompiler.
+func FromDocsJSONSchemaMessageValidator(docs ...asyncapi.Document) (message.Validator, error) {
+	return FromDocsMessageValidator(message.GoJSONSchemaCompiler, docs...)
+}
+
+// FromDocsMessageValidator is like FromDocsJSONSchemaMessageValidator, but compiling the schemas with the given compiler.
+func FromDocsMessageValidator(compiler message.SchemaCompiler, docs ...asyncapi.Document) (message.Validator, error) {
+	channels, err := validatedChannels(docs...)
+	if err != nil {
+		return nil, err
+	}
 
-			if len(o.Messages()) == 0 {
-				return nil, fmt.Errorf("can not generate message validation for operation %s. Reason:. Operation has no message. This is totally unexpected", o.ID())
+	messageSchemas := make(map[string][]byte, len(channels))
+	for id, c := range channels {
+		messageSchemas[id] = c.Schema
+	}
+
+	idProvider := func(msg *watermillmessage.Message) string {
+		// messageSchemas map is indexed by Channel name, so we need to tell the validator from where it should get that info.
+		return msg.Metadata.Get(message.MetadataChannel)
+	}
+
+	validator, err := message.SchemaMessageValidator(messageSchemas, idProvider, compiler)
+	if err != nil {
+		return nil, err
+	}
+
+	keySchemas := make(map[string]message.KeySchema)
+	for id, c := range channels {
+		if c.Key != nil {
+			keySchemas[id] = message.KeySchema{Schema: c.Key.Schema, Encoding: c.Key.Encoding, Required: c.Key.Required}
+		}
+	}
+
+	if len(keySchemas) > 0 {
+		keyValidator, err := message.KeyMessageValidator(keySchemas, idProvider, compiler)
+		if err != nil {
+			return nil, err
+		}
+
+		validator = message.ComposeValidators(validator, keyValidator)
+	}
+
+	return func(msg *watermillmessage.Message) (*message.ValidationError, error) {
+		validationErr, err := validator(msg)
+		if validationErr != nil {
+			if c, ok := channels[idProvider(msg)]; ok {
+				validationErr.Documents = c.Documents
 			}
+		}
+
+		return validationErr, err
+	}, nil
+}
+
+// ValidatedChannel is a channel whose messages are validated, including the JSON Schema they are validated against.
+type ValidatedChannel struct {
+	Channel   string          `json:"channel"`
+	Messages  []string        `json:"messages"`
+	Documents []string        `json:"documents"`
+	Schema    json.RawMessage `json:"schema"`
+	// Key is set if the keys of the messages are validated as well.
+	Key *ValidatedKey `json:"key,omitempty"`
+}
+
+// ValidatedKey describes how the keys of the messages of a channel are validated.
+// Key schemas are declared in the `key` of the Kafka message bindings.
+type ValidatedKey struct {
+	// Schema is the JSON Schema of the keys, or their Avro schema if the encoding is avro. Nil means any key is valid.
+	Schema   json.RawMessage     `json:"schema,omitempty"`
+	Encoding message.KeyEncoding `json:"encoding,omitempty"`
+	// Required is set by the x-eventgateway-require-key extension of the channel.
+	Required bool `json:"required,omitempty"`
+}
+
+// ValidatedChannels returns the channels whose messages are validated by the validator created from the same AsyncAPI docs.
+// See FromDocsJSONSchemaMessageValidator.
+func ValidatedChannels(docs ...asyncapi.Document) ([]ValidatedChannel, error) {
+	channels, err := validatedChannels(docs...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]ValidatedChannel, 0, len(channels))
+	for _, c := range channels {
+		result = append(result, *c)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Channel < result[j].Channel
+	})
+
+	return result, nil
+}
 
-			var payload asyncapi.Schema
-			var messageNames string
-			if len(o.Messages()) > 1 {
-				// Meaning message payload is a Schema containing several payloads as `oneOf`.
-				// Generating back just one Schema adding all payloads to oneOf field.
-				msgs := o.Messages()
-				oneOfSchemas := make([]asyncapi.Schema, len(msgs))
-				names := make([]string, len(msgs))
-				for i, msg := range msgs {
-					oneOfSchemas[i] = msg.Payload()
-					names[i] = msg.Name()
+// validatedChannels generates the JSON Schema for the messages of each channel the application subscribes to, indexed by channel name.
+func validatedChannels(docs ...asyncapi.Document) (map[string]*ValidatedChannel, error) {
+	channels := make(map[string]*ValidatedChannel)
+	for _, doc := range docs {
+		docName := DocumentName(doc)
+		for _, c := range doc.ApplicationSubscribableChannels() {
+			for _, o := range c.Operations() {
+				if !o.IsApplicationSubscribing() {
+					continue
+				}
+
+				validated, err := operationValidatedChannel(c, o)
+				if err != nil {
+					return nil, err
+				}
+
+				existing, ok := channels[c.ID()]
+				if !ok {
+					validated.Documents = []string{docName}
+					channels[c.ID()] = validated
+					continue
+				}
+
+				if !bytes.Equal(existing.Schema, validated.Schema) || !reflect.DeepEqual(existing.Key, validated.Key) {
+					return nil, fmt.Errorf("conflicting definitions for channel %s. Messages %s from %s and messages %s from %s are different", c.ID(), strings.Join(existing.Messages, ", "), strings.Join(existing.Documents, ", "), strings.Join(validated.Messages, ", "), docName)
 				}
-				payload = &Schema{OneOfField: oneOfSchemas}
-				messageNames = strings.Join(names, ", ")
-			} else {
-				payload = o.Messages()[0].Payload()
-				messageNames = o.Messages()[0].Name()
-			}
 
-			raw, err := json.Marshal(payload)
-			if err != nil {
-				return nil, fmt.Errorf("error marshaling message payload for generating json schema for validation. Operation: %s, Messages: %s", o.ID(), messageNames)
+				existing.Documents = append(existing.Documents, docName)
 			}
+		}
+	}
+
+	return channels, nil
+}
+
+func operationValidatedChannel(c asyncapi.Channel, o asyncapi.Operation) (*ValidatedChannel, error) {
+	if len(o.Messages()) == 0 {
+		return nil, fmt.Errorf("can not generate message validation for operation %s. Reason:. Operation has no message. This is totally unexpected", o.ID())
+	}
 
-			messageSchemas[c.ID()] = gojsonschema.NewBytesLoader(raw)
+	var payload asyncapi.Schema
+	var messageNames []string
+	if len(o.Messages()) > 1 {
+		// Meaning message payload is a Schema containing several payloads as `oneOf`.
+		// Generating back just one Schema adding all payloads to oneOf field.
+		msgs := o.Messages()
+		oneOfSchemas := make([]asyncapi.Schema, len(msgs))
+		messageNames = make([]string, len(msgs))
+		for i, msg := range msgs {
+			oneOfSchemas[i] = msg.Payload()
+			messageNames[i] = msg.Name()
 		}
+		payload = &Schema{OneOfField: oneOfSchemas}
+	} else {
+		payload = o.Messages()[0].Payload()
+		messageNames = []string{o.Messages()[0].Name()}
 	}
 
-	idProvider := func(msg *watermillmessage.Message) string {
-		// messageSchemas map is indexed by Channel name, so we need to tell the validator from where it should get that info.
-		return msg.Metadata.Get(message.MetadataChannel)
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling message payload for generating json schema for validation. Operation: %s, Messages: %s", o.ID(), strings.Join(messageNames, ", "))
+	}
+
+	key, err := operationValidatedKey(c, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ValidatedChannel{Channel: c.ID(), Messages: messageNames, Schema: raw, Key: key}, nil
+}
+
+// operationValidatedKey returns how the keys of the messages of the given operation are validated, if they are.
+// Keys are only validated against a schema if all messages declare one. Schemas of several messages are combined with anyOf.
+func operationValidatedKey(c asyncapi.Channel, o asyncapi.Operation) (*ValidatedKey, error) {
+	key := new(ValidatedKey)
+	if raw := c.Extension(asyncapi.ExtensionEventGatewayRequireKey); raw != nil {
+		required, ok := raw.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s of channel %s should be a boolean. Got %v", asyncapi.ExtensionEventGatewayRequireKey, c.ID(), raw)
+		}
+		key.Required = required
+	}
+
+	schemas := make([]json.RawMessage, 0, len(o.Messages()))
+	for _, msg := range o.Messages() {
+		schema, encoding, err := messageKeySchema(msg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key of message %s in channel %s", msg.Name(), c.ID())
+		}
+
+		if schema == nil {
+			schemas = nil
+			break
+		}
+
+		if key.Encoding != "" && key.Encoding != encoding {
+			return nil, fmt.Errorf("messages of channel %s have keys with different encodings: %s and %s", c.ID(), key.Encoding, encoding)
+		}
+
+		key.Encoding = encoding
+		if !containsSchema(schemas, schema) {
+			schemas = append(schemas, schema)
+		}
+	}
+
+	switch {
+	case len(schemas) == 1:
+		key.Schema = schemas[0]
+	case len(schemas) > 1 && key.Encoding == message.KeyEncodingAvro:
+		return nil, fmt.Errorf("messages of channel %s have different Avro keys, which is not supported", c.ID())
+	case len(schemas) > 1:
+		anyOf, err := json.Marshal(map[string]interface{}{"anyOf": schemas})
+		if err != nil {
+			return nil, err
+		}
+		key.Schema = anyOf
+	}
+
+	if key.Schema == nil {
+		if !key.Required {
+			return nil, nil
+		}
+		key.Encoding = ""
+	}
+
+	return key, nil
+}
+
+// messageKeySchema returns the key schema declared in the Kafka bindings of the given message, if any, and how keys are
+// encoded. Unless set by the x-eventgateway-key-encoding extension of the message, keys are strings if the schema type is
+// string, JSON otherwise.
+func messageKeySchema(msg asyncapi.Message) (json.RawMessage, message.KeyEncoding, error) {
+	binding, ok := msg.Binding("kafka").(map[string]interface{})
+	if !ok || binding["key"] == nil {
+		return nil, "", nil
+	}
+
+	schema, err := json.Marshal(binding["key"])
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error marshaling key schema")
+	}
+
+	encoding := message.KeyEncodingJSON
+	if keySchema, ok := binding["key"].(map[string]interface{}); ok && keySchema["type"] == "string" {
+		encoding = message.KeyEncodingString
+	}
+
+	if raw := msg.Extension(asyncapi.ExtensionEventGatewayKeyEncoding); raw != nil {
+		s, _ := raw.(string)
+		encoding = message.KeyEncoding(s)
+		if err := encoding.Validate(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return schema, encoding, nil
+}
+
+func containsSchema(schemas []json.RawMessage, schema json.RawMessage) bool {
+	for _, s := range schemas {
+		if bytes.Equal(s, schema) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DocumentName returns a human-readable name for the given doc.
+// The doc `id` is used if present. Otherwise, a combination of its title and version.
+func DocumentName(doc asyncapi.Document) string {
+	if id := doc.ID(); id != "" {
+		return id
+	}
+
+	info := doc.Info()
+	if info == nil || info.Title() == "" {
+		return "unnamed"
+	}
+
+	if info.Version() == "" {
+		return info.Title()
 	}
 
-	return message.JSONSchemaMessageValidator(messageSchemas, idProvider)
+	return fmt.Sprintf("%s %s", info.Title(), info.Version())
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/asyncapi/event-gateway/asyncapi"
 	"github.com/asyncapi/event-gateway/message"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFromDocJsonSchemaMessageValidator(t *testing.T) {
@@ -102,3 +103,217 @@ func TestFromDocJsonSchemaMessageValidator(t *testing.T) {
 		})
 	}
 }
+
+func TestFromDocsJsonSchemaMessageValidator(t *testing.T) {
+	schema := &Schema{
+		TypeField: "object",
+		PropertiesField: Schemas{
+			"AnIntergerField": &Schema{
+				MaximumField: refFloat64(10),
+				TypeField:    "number",
+			},
+		},
+	}
+
+	newDoc := func(title string, s *Schema, channels ...string) Document {
+		doc := Document{InfoField: Info{TitleField: title, VersionField: "1.0.0"}, ChannelsField: make(map[string]Channel)}
+		for _, name := range channels {
+			channel := NewChannel(name)
+			channel.Publish = NewPublishOperation(&Message{NameField: name, PayloadField: s})
+			doc.ChannelsField[name] = *channel
+		}
+
+		return doc
+	}
+
+	t.Run("Channels are merged and errors are attributed to their docs", func(t *testing.T) {
+		validator, err := FromDocsJSONSchemaMessageValidator(
+			newDoc("Orders", schema, "orders", "shared"),
+			newDoc("Payments", schema, "payments", "shared"),
+		)
+		require.NoError(t, err)
+
+		for channel, expectedDocs := range map[string][]string{
+			"orders":   {"Orders 1.0.0"},
+			"payments": {"Payments 1.0.0"},
+			"shared":   {"Orders 1.0.0", "Payments 1.0.0"},
+		} {
+			validationErr, err := validator(message.New([]byte(`{"AnIntergerField": 11}`), channel))
+			assert.NoError(t, err)
+			require.NotNil(t, validationErr)
+			assert.Equal(t, expectedDocs, validationErr.Documents)
+		}
+
+		validationErr, err := validator(message.New([]byte(`{"AnIntergerField": 5}`), "orders"))
+		assert.NoError(t, err)
+		assert.Nil(t, validationErr)
+	})
+
+	t.Run("Conflicting definitions for the same channel", func(t *testing.T) {
+		validator, err := FromDocsJSONSchemaMessageValidator(
+			newDoc("Orders", schema, "shared"),
+			newDoc("Payments", &Schema{TypeField: "string"}, "shared"),
+		)
+		assert.EqualError(t, err, "conflicting definitions for channel shared. Messages shared from Orders 1.0.0 and messages shared from Payments 1.0.0 are different")
+		assert.Nil(t, validator)
+	})
+}
+
+func TestDocumentName(t *testing.T) {
+	assert.Equal(t, "urn:com:smartylighting:streetlights:server", DocumentName(Document{IDField: "urn:com:smartylighting:streetlights:server", InfoField: Info{TitleField: "Streetlights"}}))
+	assert.Equal(t, "Streetlights 1.0.0", DocumentName(Document{InfoField: Info{TitleField: "Streetlights", VersionField: "1.0.0"}}))
+	assert.Equal(t, "Streetlights", DocumentName(Document{InfoField: Info{TitleField: "Streetlights"}}))
+	assert.Equal(t, "unnamed", DocumentName(Document{}))
+}
+
+func TestFromDocsMessageValidator_keys(t *testing.T) {
+	doc := new(Document)
+	require.NoError(t, Decode([]byte("testdata/keys-kafka.yaml"), doc))
+
+	validator, err := FromDocsMessageValidator(message.GoJSONSchemaCompiler, doc)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		channel           string
+		key               *string
+		payload           string
+		expectedErrors    []string
+		expectedKeyErrors []string
+	}{
+		{name: "Valid key", channel: "user.signedup", key: stringPtr("user-1")},
+		{name: "Invalid key", channel: "user.signedup", key: stringPtr("admin"), expectedKeyErrors: []string{`(root): Does not match pattern '^user-[0-9]+$'`}},
+		{name: "Missing required key", channel: "user.signedup", expectedKeyErrors: []string{"key is required"}},
+		{name: "Invalid key and payload", channel: "user.signedup", key: stringPtr("admin"), payload: `[]`, expectedErrors: []string{"(root): Invalid type. Expected: object, given: array"}, expectedKeyErrors: []string{`(root): Does not match pattern '^user-[0-9]+$'`}},
+		{name: "Valid Avro key", channel: "user.deleted", key: stringPtr("\x02")},
+		{name: "Invalid Avro key", channel: "user.deleted", key: stringPtr("user-1"), expectedKeyErrors: []string{"5 unexpected bytes after Avro value"}},
+		{name: "Any key is valid without schema", channel: "user.updated", key: stringPtr("anything")},
+		{name: "Missing required key without schema", channel: "user.updated", expectedKeyErrors: []string{"key is required"}},
+		{name: "Keys are not validated if not declared", channel: "user.logged"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := test.payload
+			if payload == "" {
+				payload = `{}`
+			}
+
+			msg := message.New([]byte(payload), test.channel)
+			if test.key != nil {
+				msg.Metadata.Set(message.MetadataKey, *test.key)
+			}
+
+			validationErr, err := validator(msg)
+			require.NoError(t, err)
+			if test.expectedErrors == nil && test.expectedKeyErrors == nil {
+				assert.Nil(t, validationErr)
+				return
+			}
+
+			require.NotNil(t, validationErr)
+			assert.Equal(t, test.expectedErrors, validationErr.Errors)
+			assert.Equal(t, test.expectedKeyErrors, validationErr.KeyErrors)
+			assert.Equal(t, []string{"Users Kafka API 1.0.0"}, validationErr.Documents)
+		})
+	}
+}
+
+func TestValidatedChannels_keys(t *testing.T) {
+	doc := new(Document)
+	require.NoError(t, Decode([]byte("testdata/keys-kafka.yaml"), doc))
+
+	channels, err := ValidatedChannels(doc)
+	require.NoError(t, err)
+
+	keys := make(map[string]*ValidatedKey)
+	for _, c := range channels {
+		keys[c.Channel] = c.Key
+	}
+
+	assert.Equal(t, map[string]*ValidatedKey{
+		"user.signedup": {Schema: []byte(`{"pattern":"^user-[0-9]+$","type":"string"}`), Encoding: message.KeyEncodingString, Required: true},
+		"user.deleted":  {Schema: []byte(`{"fields":[{"name":"id","type":"long"}],"name":"UserKey","type":"record"}`), Encoding: message.KeyEncodingAvro},
+		"user.updated":  {Required: true},
+		"user.logged":   nil,
+	}, keys)
+}
+
+func TestOperationValidatedKey(t *testing.T) {
+	newMessage := func(name string, key interface{}, encoding string) *Message {
+		msg := &Message{NameField: name, PayloadField: &Schema{TypeField: "object"}}
+		if key != nil {
+			msg.BindingsField = map[string]interface{}{"kafka": map[string]interface{}{"key": key}}
+		}
+		if encoding != "" {
+			msg.Raw = map[string]interface{}{asyncapi.ExtensionEventGatewayKeyEncoding: encoding}
+		}
+
+		return msg
+	}
+
+	tests := []struct {
+		name        string
+		messages    []*Message
+		required    interface{}
+		expected    *ValidatedKey
+		expectedErr string
+	}{
+		{
+			name:     "Key schemas of several messages are combined",
+			messages: []*Message{newMessage("a", map[string]interface{}{"type": "string"}, ""), newMessage("b", map[string]interface{}{"type": "string", "format": "uuid"}, "")},
+			expected: &ValidatedKey{Schema: []byte(`{"anyOf":[{"type":"string"},{"format":"uuid","type":"string"}]}`), Encoding: message.KeyEncodingString},
+		},
+		{
+			name:     "Keys are not validated if a message has no key schema",
+			messages: []*Message{newMessage("a", map[string]interface{}{"type": "string"}, ""), newMessage("b", nil, "")},
+		},
+		{
+			name:     "Non string keys are JSON",
+			messages: []*Message{newMessage("a", map[string]interface{}{"type": "integer"}, "")},
+			required: false,
+			expected: &ValidatedKey{Schema: []byte(`{"type":"integer"}`), Encoding: message.KeyEncodingJSON},
+		},
+		{
+			name:        "Keys with different encodings",
+			messages:    []*Message{newMessage("a", map[string]interface{}{"type": "string"}, ""), newMessage("b", map[string]interface{}{"type": "integer"}, "")},
+			expectedErr: "messages of channel test have keys with different encodings: string and json",
+		},
+		{
+			name:        "Different Avro keys",
+			messages:    []*Message{newMessage("a", "string", "avro"), newMessage("b", "long", "avro")},
+			expectedErr: "messages of channel test have different Avro keys, which is not supported",
+		},
+		{
+			name:        "Invalid key encoding",
+			messages:    []*Message{newMessage("a", "string", "protobuf")},
+			expectedErr: `invalid key of message a in channel test: key encoding "protobuf" is not valid. Valid values are string, json and avro`,
+		},
+		{
+			name:        "Invalid require key",
+			messages:    []*Message{newMessage("a", nil, "")},
+			required:    "yes",
+			expectedErr: "x-eventgateway-require-key of channel test should be a boolean. Got yes",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			channel := NewChannel("test")
+			if test.required != nil {
+				channel.Raw = map[string]interface{}{asyncapi.ExtensionEventGatewayRequireKey: test.required}
+			}
+
+			key, err := operationValidatedKey(channel, NewPublishOperation(test.messages...))
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, key)
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,274 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/go-chi/chi/v5"
+	"github.com/olahol/melody"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	subscriptionKey = "subscription"
+	headerPrefix    = "header."
+	payloadPrefix   = "payload."
+)
+
+// Bridge bridges the traffic of channels to the Websocket sessions subscribed to them.
+// Channels are consumed through the given subscriber once the first session subscribes to them, and until the last one leaves.
+// Messages are redacted before being sent, as they leave the gateway.
+type Bridge struct {
+	ws         *melody.Melody
+	subscriber watermillmessage.Subscriber
+	redactor   *message.Redactor
+	channels   map[string]struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	lock   sync.Mutex
+	// consuming holds the channels being consumed.
+	consuming map[string]*consumption
+}
+
+// consumption is the consumption of a channel, shared by the sessions subscribed to it.
+type consumption struct {
+	cancel   context.CancelFunc
+	sessions int
+}
+
+// New creates a new Bridge for the given channels. Messages are redacted by the given redactor, if any.
+func New(ws *melody.Melody, subscriber watermillmessage.Subscriber, redactor *message.Redactor, channels ...string) *Bridge {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Bridge{
+		ws:         ws,
+		subscriber: subscriber,
+		redactor:   redactor,
+		channels:   make(map[string]struct{}, len(channels)),
+		ctx:        ctx,
+		cancel:     cancel,
+		consuming:  make(map[string]*consumption),
+	}
+
+	for _, c := range channels {
+		b.channels[c] = struct{}{}
+	}
+
+	return b
+}
+
+// Router returns a router serving the Websocket subscriptions at `/{channel}`. Usually mounted at a `/channels` path.
+// Channel names containing slashes can be URL-encoded. Messages can be filtered by query params:
+//   - `header.<name>=<value>` only matches messages with such header.
+//   - `payload.<path>=<value>` only matches messages whose JSON payload holds such value at the given dot-separated path.
+func (b *Bridge) Router() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/*", b.handleSubscribe)
+
+	return r
+}
+
+// Close stops consuming channels and closes the subscriber.
+func (b *Bridge) Close() error {
+	b.cancel()
+	return b.subscriber.Close()
+}
+
+func (b *Bridge) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	channel, err := url.PathUnescape(chi.URLParam(r, "*"))
+	if err != nil {
+		http.Error(w, "invalid channel name", http.StatusBadRequest)
+		return
+	}
+
+	channel = strings.TrimSuffix(channel, "/")
+	if _, ok := b.channels[channel]; !ok {
+		http.Error(w, "channel "+channel+" is not declared in the AsyncAPI docs", http.StatusNotFound)
+		return
+	}
+
+	if err := b.consume(channel); err != nil {
+		logrus.WithError(err).WithField("channel", channel).Error("error consuming channel")
+		http.Error(w, "error consuming channel "+channel, http.StatusBadGateway)
+		return
+	}
+	defer b.release(channel)
+
+	// Handling the request blocks until the session is closed.
+	sub := &subscription{channel: channel, filter: newFilter(r.URL.Query())}
+	if err := b.ws.HandleRequestWithKeys(w, r, map[string]interface{}{subscriptionKey: sub}); err != nil {
+		logrus.WithError(err).Error("error handling Websocket subscription")
+	}
+}
+
+// consume starts consuming the given channel on behalf of a new session, unless it's already being consumed.
+// Every call should be followed by a call to release once the session leaves.
+func (b *Bridge) consume(channel string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if c, ok := b.consuming[channel]; ok {
+		c.sessions++
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(b.ctx)
+	msgs, err := b.subscriber.Subscribe(ctx, channel)
+	if err != nil {
+		cancel()
+		return errors.Wrapf(err, "error subscribing to %s", channel)
+	}
+
+	b.consuming[channel] = &consumption{cancel: cancel, sessions: 1}
+	go func() {
+		for msg := range msgs {
+			b.broadcast(channel, msg)
+			msg.Ack()
+		}
+	}()
+
+	return nil
+}
+
+// release stops consuming the given channel once the last session subscribed to it leaves.
+func (b *Bridge) release(channel string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	c, ok := b.consuming[channel]
+	if !ok {
+		return
+	}
+
+	if c.sessions--; c.sessions == 0 {
+		c.cancel()
+		delete(b.consuming, channel)
+	}
+}
+
+// event is the representation of a message sent to the subscribed sessions.
+type event struct {
+	UUID     string            `json:"uuid"`
+	Channel  string            `json:"channel"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Payload is the raw payload if it's valid JSON. Otherwise, it's a string.
+	Payload interface{} `json:"payload"`
+}
+
+// broadcast sends the given message to the sessions subscribed to the channel whose filter it matches.
+// The message is redacted first, so filters can't match sensitive values.
+func (b *Bridge) broadcast(channel string, msg *watermillmessage.Message) {
+	if b.redactor != nil {
+		msg = b.redact(channel, msg)
+	}
+
+	var payload interface{}
+	e := event{UUID: msg.UUID, Channel: channel, Metadata: msg.Metadata, Payload: string(msg.Payload)}
+	if err := json.Unmarshal(msg.Payload, &payload); err == nil {
+		e.Payload = json.RawMessage(msg.Payload)
+	}
+
+	content, err := json.Marshal(e)
+	if err != nil {
+		logrus.WithError(err).Error("error marshaling message")
+		return
+	}
+
+	err = b.ws.BroadcastFilter(content, func(s *melody.Session) bool {
+		sub, ok := s.Keys[subscriptionKey].(*subscription)
+		return ok && sub.channel == channel && sub.filter.matches(msg.Metadata, payload)
+	})
+	if err != nil {
+		logrus.WithError(err).Error("error broadcasting message to subscribed ws sessions")
+	}
+}
+
+// redact returns a redacted copy of the given message consumed from the given channel.
+// Headers reserved for gateway metadata are ignored, so they can't change which values are redacted.
+func (b *Bridge) redact(channel string, msg *watermillmessage.Message) *watermillmessage.Message {
+	msg = msg.Copy()
+	message.RemoveInternalMetadata(msg.Metadata)
+	msg.Metadata.Set(message.MetadataChannel, channel)
+
+	redacted := b.redactor.Redact(msg)
+	delete(redacted.Metadata, message.MetadataChannel)
+
+	return redacted
+}
+
+// subscription is the subscription of a Websocket session to a channel.
+type subscription struct {
+	channel string
+	filter  filter
+}
+
+// filter holds the values a message should have for being sent to a session.
+type filter struct {
+	headers map[string]string
+	// fields maps dot-separated paths of the payload to their expected value.
+	fields map[string]string
+}
+
+func newFilter(query url.Values) filter {
+	f := filter{headers: make(map[string]string), fields: make(map[string]string)}
+	for k, v := range query {
+		switch {
+		case strings.HasPrefix(k, headerPrefix):
+			f.headers[strings.TrimPrefix(k, headerPrefix)] = v[0]
+		case strings.HasPrefix(k, payloadPrefix):
+			f.fields[strings.TrimPrefix(k, payloadPrefix)] = v[0]
+		}
+	}
+
+	return f
+}
+
+// matches returns true if the message has all the headers and payload fields of the filter.
+// The payload is the JSON decoded payload, nil if not JSON.
+func (f filter) matches(metadata watermillmessage.Metadata, payload interface{}) bool {
+	for k, v := range f.headers {
+		if metadata.Get(k) != v {
+			return false
+		}
+	}
+
+	for path, v := range f.fields {
+		value, ok := field(payload, path)
+		if !ok || value != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// field returns the string representation of the value at the given dot-separated path of a JSON decoded value.
+func field(v interface{}, path string) (string, bool) {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+
+		if v, ok = obj[key]; !ok {
+			return "", false
+		}
+	}
+
+	switch value := v.(type) {
+	case string:
+		return value, true
+	case map[string]interface{}, []interface{}:
+		return "", false
+	default:
+		raw, err := json.Marshal(value)
+		return string(raw), err == nil
+	}
+}
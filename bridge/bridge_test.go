@@ -0,0 +1,182 @@
+package bridge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/gorilla/websocket"
+	"github.com/olahol/melody"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridge_Router(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+	b := New(melody.New(), pubSub, nil, "smartylighting/measured")
+	defer b.Close()
+
+	server := httptest.NewServer(b.Router())
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"/smartylighting%2Fmeasured?payload.id=1&header.source=sensor", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Only the last message matches the filter.
+	msgs := []*watermillmessage.Message{
+		watermillmessage.NewMessage("1", []byte(`{"id":2,"lumens":3}`)),
+		watermillmessage.NewMessage("2", []byte(`{"id":1,"lumens":3}`)),
+		watermillmessage.NewMessage("3", []byte(`{"id":1,"lumens":4}`)),
+	}
+	msgs[0].Metadata.Set("source", "sensor")
+	msgs[2].Metadata.Set("source", "sensor")
+	require.NoError(t, pubSub.Publish("smartylighting/measured", msgs...))
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, raw, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"uuid":"3","channel":"smartylighting/measured","metadata":{"source":"sensor"},"payload":{"id":1,"lumens":4}}`, string(raw))
+}
+
+func TestBridge_Router_redaction(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+	redactor, err := message.NewRedactor(message.RedactionModeMask, map[string][]string{"user/signedup": {"/email"}}, nil)
+	require.NoError(t, err)
+
+	b := New(melody.New(), pubSub, redactor, "user/signedup")
+	defer b.Close()
+
+	server := httptest.NewServer(b.Router())
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"/user%2Fsignedup?payload.id=1", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Filters are matched against the redacted message, so sensitive values can't be guessed.
+	guessing, _, err := websocket.DefaultDialer.Dial(wsURL+"/user%2Fsignedup?payload.email=foo@bar.com", nil)
+	require.NoError(t, err)
+	defer guessing.Close()
+
+	// Headers reserved for gateway metadata can't change the channel whose sensitive values are redacted.
+	msg := watermillmessage.NewMessage("1", []byte(`{"id":1,"email":"foo@bar.com"}`))
+	msg.Metadata.Set(message.MetadataChannel, "another")
+	require.NoError(t, pubSub.Publish("user/signedup", msg))
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, raw, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"uuid":"1","channel":"user/signedup","payload":{"id":1,"email":"<redacted>"}}`, string(raw))
+
+	require.NoError(t, guessing.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	_, _, err = guessing.ReadMessage()
+	assert.Error(t, err)
+}
+
+func TestBridge_Router_unsubscribe(t *testing.T) {
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{})
+	b := New(melody.New(), pubSub, nil, "smartylighting/measured")
+	defer b.Close()
+
+	server := httptest.NewServer(b.Router())
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	consuming := func() int {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		if c, ok := b.consuming["smartylighting/measured"]; ok {
+			return c.sessions
+		}
+		return 0
+	}
+
+	first, _, err := websocket.DefaultDialer.Dial(wsURL+"/smartylighting%2Fmeasured", nil)
+	require.NoError(t, err)
+	second, _, err := websocket.DefaultDialer.Dial(wsURL+"/smartylighting%2Fmeasured", nil)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return consuming() == 2 }, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, first.Close())
+	assert.Eventually(t, func() bool { return consuming() == 1 }, time.Second, 10*time.Millisecond)
+
+	// The channel is no longer consumed once the last session leaves.
+	require.NoError(t, second.Close())
+	assert.Eventually(t, func() bool { return consuming() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestFilter_matches(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		metadata watermillmessage.Metadata
+		payload  string
+		expected bool
+	}{
+		{
+			name:     "No filter",
+			payload:  `not json`,
+			expected: true,
+		},
+		{
+			name:     "Header",
+			query:    "header.source=sensor",
+			metadata: watermillmessage.Metadata{"source": "sensor"},
+			expected: true,
+		},
+		{
+			name:     "Missing header",
+			query:    "header.source=sensor",
+			expected: false,
+		},
+		{
+			name:     "Nested payload fields",
+			query:    "payload.light.id=1&payload.light.status=on&payload.light.dimmed=false",
+			payload:  `{"light":{"id":1,"status":"on","dimmed":false}}`,
+			expected: true,
+		},
+		{
+			name:     "Payload field with different value",
+			query:    "payload.light.id=1",
+			payload:  `{"light":{"id":2}}`,
+			expected: false,
+		},
+		{
+			name:     "Payload field of a non JSON payload",
+			query:    "payload.id=1",
+			payload:  `id=1`,
+			expected: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			require.NoError(t, err)
+
+			var payload interface{}
+			_ = json.Unmarshal([]byte(test.payload), &payload)
+
+			assert.Equal(t, test.expected, newFilter(query).matches(test.metadata, payload))
+		})
+	}
+}
+
+func TestBridge_Router_notDeclaredChannel(t *testing.T) {
+	b := New(melody.New(), gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{}), nil, "smartylighting/measured")
+	defer b.Close()
+
+	rec := httptest.NewRecorder()
+	b.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"github.com/asyncapi/event-gateway/amqp"
+	"github.com/asyncapi/event-gateway/asyncapi"
+	v2 "github.com/asyncapi/event-gateway/asyncapi/v2"
+	"github.com/asyncapi/event-gateway/message/handler"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAMQPPort = "5672"
+	amqpBinding     = "amqp"
+	amqpIsQueue     = "queue"
+)
+
+// AMQPProxy holds the config for later configuring AMQP proxies.
+type AMQPProxy struct {
+	MessageValidation AMQPMessageValidation `yaml:"messageValidation" split_words:"true"`
+}
+
+// AMQPMessageValidation holds the config about validation of AMQP messages.
+type AMQPMessageValidation struct {
+	Enabled         bool `yaml:"enabled" desc:"Enable or disable validation of messages published by AMQP clients. Default is true"`
+	ValidationQueue `yaml:",inline"`
+}
+
+// NewAMQPProxy creates a AMQPProxy with defaults.
+func NewAMQPProxy() *AMQPProxy {
+	return &AMQPProxy{MessageValidation: AMQPMessageValidation{
+		Enabled:         true,
+		ValidationQueue: NewValidationQueue(),
+	}}
+}
+
+// ServerProxyConfig creates a config struct for the AMQP Proxy of the given server.
+func (c *AMQPProxy) ServerProxyConfig(docs []asyncapi.Document, server string, debug bool) (*amqp.ProxyConfig, error) {
+	servers, err := servers(docs, server)
+	if err != nil {
+		return nil, err
+	}
+
+	s := servers[0]
+	brokerAddress, err := brokerAddress(s.URL(), defaultAMQPPort)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting address of broker %s. URL:%s", s.Name(), s.URL())
+	}
+
+	listenAt, err := listenAddress(s, brokerAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []amqp.ProxyOption{
+		amqp.WithName(s.Name()),
+		amqp.WithDebug(debug),
+		amqp.WithChannelResolver(amqpChannelResolver(docs)),
+	}
+
+	if c.MessageValidation.Enabled {
+		validator, err := v2.FromDocsJSONSchemaMessageValidator(docs...)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating message validator")
+		}
+
+		opts = append(opts,
+			amqp.WithMessageHandler(handler.ValidateMessage(validator, false)),
+			amqp.WithValidationQueue(c.MessageValidation.ValidationQueue.config()),
+		)
+	}
+
+	return amqp.NewProxyConfig(brokerAddress, listenAt, opts...)
+}
+
+// amqpChannelBinding holds the fields of AMQP channel bindings used for resolving channels.
+// See https://github.com/asyncapi/bindings/tree/master/amqp#channel-binding-object.
+type amqpChannelBinding struct {
+	Is       string `mapstructure:"is"`
+	Exchange struct {
+		Name string `mapstructure:"name"`
+	} `mapstructure:"exchange"`
+	Queue struct {
+		Name string `mapstructure:"name"`
+	} `mapstructure:"queue"`
+}
+
+type amqpDestination struct {
+	exchange   string
+	routingKey string
+}
+
+// amqpChannelResolver resolves the channels of messages published by AMQP clients based on the channels of the given docs:
+//   - Channels with an AMQP binding of type queue receive the messages published to the default exchange with the queue name
+//     (the channel name if not set) as routing key.
+//   - Channels with an AMQP binding of type routingKey declaring an exchange name receive the messages published to that
+//     exchange with the channel name as routing key.
+//   - Any other channel receives the messages published to any exchange with the channel name as routing key.
+func amqpChannelResolver(docs []asyncapi.Document) amqp.ChannelResolver {
+	destinations := make(map[amqpDestination]string)
+	routingKeys := make(map[string]string)
+	for _, doc := range docs {
+		for _, ch := range doc.Channels() {
+			raw := ch.Binding(amqpBinding)
+			if raw == nil {
+				routingKeys[ch.Path()] = ch.Path()
+				continue
+			}
+
+			binding := new(amqpChannelBinding)
+			if err := mapstructure.Decode(raw, binding); err != nil {
+				logrus.WithError(err).Warnf("Ignoring invalid AMQP binding of channel %s", ch.Path())
+				routingKeys[ch.Path()] = ch.Path()
+				continue
+			}
+
+			switch {
+			case binding.Is == amqpIsQueue:
+				queue := binding.Queue.Name
+				if queue == "" {
+					queue = ch.Path()
+				}
+				destinations[amqpDestination{routingKey: queue}] = ch.Path()
+			case binding.Exchange.Name != "":
+				destinations[amqpDestination{exchange: binding.Exchange.Name, routingKey: ch.Path()}] = ch.Path()
+			default:
+				routingKeys[ch.Path()] = ch.Path()
+			}
+		}
+	}
+
+	return func(exchange, routingKey string) string {
+		if ch, ok := destinations[amqpDestination{exchange: exchange, routingKey: routingKey}]; ok {
+			return ch
+		}
+
+		return routingKeys[routingKey]
+	}
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAMQPProxy_ServerProxyConfig(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/simple-amqp.yaml`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name                  string
+		config                *AMQPProxy
+		server                string
+		expectedBrokerAddress string
+		expectedListenAddress string
+		expectedValidation    bool
+		expectedErr           string
+	}{
+		{
+			name:                  "Default port",
+			config:                NewAMQPProxy(),
+			server:                "rabbitmq",
+			expectedBrokerAddress: "broker.mybrokers.org:5672",
+			expectedListenAddress: ":5672",
+			expectedValidation:    true,
+		},
+		{
+			name:                  "Override listener port. Validation disabled",
+			config:                &AMQPProxy{},
+			server:                "override",
+			expectedBrokerAddress: "broker.mybrokers.org:5672",
+			expectedListenAddress: ":25672",
+		},
+		{
+			name:        "Unknown server",
+			config:      NewAMQPProxy(),
+			server:      "unknown",
+			expectedErr: "server unknown not found in the provided AsyncAPI docs",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := test.config.ServerProxyConfig(docs, test.server, false)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.server, c.Name)
+			assert.Equal(t, test.expectedBrokerAddress, c.BrokerAddress)
+			assert.Equal(t, test.expectedListenAddress, c.ListenAddress)
+			assert.Equal(t, test.expectedValidation, c.MessageHandler != nil)
+			assert.NotNil(t, c.ChannelResolver)
+		})
+	}
+}
+
+func TestAMQPChannelResolver(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/simple-amqp.yaml`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		exchange   string
+		routingKey string
+		expected   string
+	}{
+		{
+			name:       "Exchange and routing key from binding",
+			exchange:   "streetlights",
+			routingKey: "streetlights.measured",
+			expected:   "streetlights.measured",
+		},
+		{
+			name:       "Routing key from binding but different exchange",
+			exchange:   "other",
+			routingKey: "streetlights.measured",
+		},
+		{
+			name:       "Queue from binding through the default exchange",
+			routingKey: "dimmed-streetlights",
+			expected:   "streetlights.dimmed",
+		},
+		{
+			name:       "Channel without binding matches routing key of any exchange",
+			exchange:   "other",
+			routingKey: "streetlights.turned.on",
+			expected:   "streetlights.turned.on",
+		},
+		{
+			name:       "Unknown routing key",
+			routingKey: "unknown",
+		},
+	}
+	resolver := amqpChannelResolver(docs)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, resolver(test.exchange, test.routingKey))
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"github.com/asyncapi/event-gateway/asyncapi"
+	"github.com/asyncapi/event-gateway/bridge"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/olahol/melody"
+	"github.com/pkg/errors"
+)
+
+// WSBridge holds the config for the bridge of channel traffic to Websocket sessions.
+type WSBridge struct {
+	Enabled       bool   `yaml:"enabled" desc:"Enable or disable Websocket subscriptions to the traffic of channels. Default is false"`
+	ConsumerGroup string `yaml:"consumerGroup" split_words:"true" desc:"Kafka consumer group used for consuming the traffic of channels. Default is asyncapi-event-gateway-ws-bridge"`
+}
+
+// NewWSBridge creates a WSBridge with defaults.
+func NewWSBridge() *WSBridge {
+	return &WSBridge{ConsumerGroup: "asyncapi-event-gateway-ws-bridge"}
+}
+
+// Bridge creates a bridge of the traffic of the channels of all docs to the sessions of the given Websocket server.
+// Channels are consumed from the Kafka servers the Kafka proxy is configured for. Messages are redacted by the given redactor.
+func (c App) Bridge(docs []asyncapi.Document, ws *melody.Melody, redactor *message.Redactor) (*bridge.Bridge, error) {
+	subscriber, err := c.KafkaProxy.Subscriber(docs, c.WSBridge.ConsumerGroup)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating Kafka subscriber")
+	}
+
+	return bridge.New(ws, subscriber, redactor, channelPaths(docs)...), nil
+}
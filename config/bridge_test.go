@@ -0,0 +1,42 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/olahol/melody"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApp_Bridge(t *testing.T) {
+	tests := []struct {
+		name        string
+		doc         string
+		expectedErr string
+	}{
+		{
+			name: "Kafka server",
+			doc:  "testdata/simple-kafka.yaml",
+		},
+		{
+			name:        "No Kafka server",
+			doc:         "testdata/simple-mqtt.yaml",
+			expectedErr: "error creating Kafka subscriber: No Kafka brokers were found when configuring",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			docs, err := decodeDocuments([]byte(test.doc))
+			require.NoError(t, err)
+
+			b, err := NewApp().Bridge(docs, melody.New(), nil)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NoError(t, b.Close())
+		})
+	}
+}
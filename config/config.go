@@ -1,17 +1,36 @@
 package config
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
 	"strings"
 
+	"github.com/asyncapi/event-gateway/asyncapi"
+	v2 "github.com/asyncapi/event-gateway/asyncapi/v2"
 	"github.com/asyncapi/event-gateway/kafka"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
 )
 
+const redacted = "<redacted>"
+
 // App holds the config for the whole application.
 type App struct {
-	Debug        bool        `desc:"Enable or disable debug logs"`
-	AsyncAPIDoc  []byte      `split_words:"true" desc:"Path or URL to a valid AsyncAPI doc (v2.0.0 is only supported)"`
-	WSServerPort int         `split_words:"true" default:"5000" desc:"Port for the Websocket server. Used for debugging events"`
-	KafkaProxy   *KafkaProxy `split_words:"true"`
+	Debug              bool                `yaml:"debug" desc:"Enable or disable debug logs"`
+	AsyncAPIDoc        string              `yaml:"asyncapiDoc" split_words:"true" desc:"Path or URL to a valid AsyncAPI doc (v2.0.0 is only supported)"`
+	AsyncAPIDocs       pipeSeparatedValues `yaml:"asyncapiDocs" split_words:"true" desc:"Paths or URLs to several valid AsyncAPI docs. Channels and servers of all docs are merged. Multiple values can be configured by using pipe separation (|)"`
+	WSServerPort       int                 `yaml:"wsServerPort" split_words:"true" desc:"Port for the Websocket server. Used for debugging events. Default is 5000"`
+	AdminPort          int                 `yaml:"adminPort" split_words:"true" desc:"Port for the read-only admin API. It has no authentication, so it is disabled (0) by default"`
+	KafkaProxy         *KafkaProxy         `yaml:"kafkaProxy" split_words:"true"`
+	MQTTProxy          *MQTTProxy          `yaml:"mqttProxy" split_words:"true"`
+	AMQPProxy          *AMQPProxy          `yaml:"amqpProxy" split_words:"true"`
+	NATSProxy          *NATSProxy          `yaml:"natsProxy" split_words:"true"`
+	HTTPProducer       *HTTPProducer       `yaml:"httpProducer" split_words:"true"`
+	WSBridge           *WSBridge           `yaml:"wsBridge" split_words:"true"`
+	Redaction          *Redaction          `yaml:"redaction"`
+	ValidationSampling *ValidationSampling `yaml:"validationSampling" split_words:"true"`
 }
 
 // Opt is a functional option used for configuring an App.
@@ -19,7 +38,17 @@ type Opt func(*App)
 
 // NewApp creates a App config with defaults.
 func NewApp(opts ...Opt) *App {
-	c := &App{KafkaProxy: NewKafkaProxy()}
+	c := &App{
+		WSServerPort:       5000,
+		KafkaProxy:         NewKafkaProxy(),
+		MQTTProxy:          NewMQTTProxy(),
+		AMQPProxy:          NewAMQPProxy(),
+		NATSProxy:          NewNATSProxy(),
+		HTTPProducer:       NewHTTPProducer(),
+		WSBridge:           NewWSBridge(),
+		Redaction:          NewRedaction(),
+		ValidationSampling: NewValidationSampling(),
+	}
 	for _, opt := range opts {
 		opt(c)
 	}
@@ -27,9 +56,178 @@ func NewApp(opts ...Opt) *App {
 	return c
 }
 
+// Documents decodes all the configured AsyncAPI docs.
+func (c App) Documents() ([]asyncapi.Document, error) {
+	raw := make([][]byte, 0, len(c.AsyncAPIDocs.Values)+1)
+	if c.AsyncAPIDoc != "" {
+		raw = append(raw, []byte(c.AsyncAPIDoc))
+	}
+
+	for _, d := range c.AsyncAPIDocs.Values {
+		if d != "" {
+			raw = append(raw, []byte(d))
+		}
+	}
+
+	if len(raw) == 0 {
+		return nil, errors.New("AsyncAPIDoc config should be provided")
+	}
+
+	return decodeDocuments(raw...)
+}
+
+// Servers returns the servers of all the configured AsyncAPI docs a proxy should be created for.
+func (c App) Servers(docs []asyncapi.Document) ([]asyncapi.Server, error) {
+	var only string
+	if c.KafkaProxy != nil {
+		only = c.KafkaProxy.BrokerFromServer
+	}
+
+	return servers(docs, only)
+}
+
 // ProxyConfig creates a config struct for the Kafka Proxy.
 func (c App) ProxyConfig() (*kafka.ProxyConfig, error) {
-	return c.KafkaProxy.ProxyConfig(c.AsyncAPIDoc, c.Debug)
+	docs, err := c.Documents()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.KafkaProxy.ProxyConfig(docs, c.Debug)
+}
+
+// LoadFile loads the config from a YAML or JSON file. Values already set in c are overridden by the ones found in the file.
+// Unknown keys are rejected.
+func (c *App) LoadFile(path string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "error reading config file %s", path)
+	}
+
+	if err := yaml.UnmarshalStrict(raw, c); err != nil {
+		return errors.Wrapf(err, "error decoding config file %s", path)
+	}
+
+	return nil
+}
+
+// YAML returns the YAML representation of the config. Secrets are redacted.
+func (c App) YAML() ([]byte, error) {
+	if c.KafkaProxy != nil {
+		kafkaProxy := *c.KafkaProxy
+		if kafkaProxy.SASL != nil && kafkaProxy.SASL.Password != "" {
+			sasl := *kafkaProxy.SASL
+			sasl.Password = redacted
+			kafkaProxy.SASL = &sasl
+		}
+
+		if kafkaProxy.ListenerTLS != nil && kafkaProxy.ListenerTLS.KeyPassword != "" {
+			listenerTLS := *kafkaProxy.ListenerTLS
+			listenerTLS.KeyPassword = redacted
+			kafkaProxy.ListenerTLS = &listenerTLS
+		}
+
+		c.KafkaProxy = &kafkaProxy
+	}
+
+	return yaml.Marshal(c)
+}
+
+// servers returns the servers declared in the given docs. Servers with the same name declared in several docs should be the same.
+// If only is set, just that server is returned.
+func servers(docs []asyncapi.Document, only string) ([]asyncapi.Server, error) {
+	var servers []asyncapi.Server
+	seen := make(map[string]asyncapi.Server)
+	for _, doc := range docs {
+		for _, s := range doc.Servers() {
+			if only != "" && s.Name() != only {
+				continue
+			}
+
+			if existing, ok := seen[s.Name()]; ok {
+				if existing.URL() != s.URL() || existing.Protocol() != s.Protocol() {
+					return nil, fmt.Errorf("server %s is declared several times with different url or protocol", s.Name())
+				}
+				continue
+			}
+
+			seen[s.Name()] = s
+			servers = append(servers, s)
+		}
+	}
+
+	if only != "" && len(servers) == 0 {
+		return nil, fmt.Errorf("server %s not found in the provided AsyncAPI docs", only)
+	}
+
+	return servers, nil
+}
+
+// listenAddress returns the address the proxy of the given server should listen at, given the address of the broker.
+// It is the x-eventgateway-listener extension if set. Otherwise, the port of the broker is used.
+func listenAddress(s asyncapi.Server, brokerAddress string) (string, error) {
+	// If extension is configured, it overrides the value of the port.
+	if overridePort := s.Extension(asyncapi.ExtensionEventGatewayListener); overridePort != nil {
+		if val := fmt.Sprintf("%v", overridePort); val != "" { // Convert value to string rep as can be either string or number
+			if host, _, _ := net.SplitHostPort(val); host == "" {
+				val = ":" + val // If no host, prefix with : as localhost is inferred
+			}
+			return val, nil
+		}
+	}
+
+	// Use the same port as remote but locally.
+	_, port, err := net.SplitHostPort(brokerAddress)
+	if err != nil {
+		return "", errors.Wrapf(err, "error getting port from broker %s. URL:%s", s.Name(), s.URL())
+	}
+
+	return ":" + port, nil // Prefix with : as localhost is inferred
+}
+
+// brokerAddress returns the host:port address of a server URL. The scheme is optional. If the URL has no port, defaultPort is used.
+func brokerAddress(serverURL, defaultPort string) (string, error) {
+	address := serverURL
+	if strings.Contains(serverURL, "://") {
+		u, err := url.Parse(serverURL)
+		if err != nil {
+			return "", err
+		}
+
+		address = u.Host
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return net.JoinHostPort(address, defaultPort), nil
+	}
+
+	return address, nil
+}
+
+// channelPaths returns the paths of the channels declared in the given docs.
+func channelPaths(docs []asyncapi.Document) []string {
+	var paths []string
+	for _, doc := range docs {
+		for _, ch := range doc.Channels() {
+			paths = append(paths, ch.Path())
+		}
+	}
+
+	return paths
+}
+
+func decodeDocuments(raw ...[]byte) ([]asyncapi.Document, error) {
+	docs := make([]asyncapi.Document, len(raw))
+	for i, d := range raw {
+		doc := new(v2.Document)
+		if err := v2.Decode(d, doc); err != nil {
+			return nil, errors.Wrap(err, "error decoding AsyncAPI json doc to Document struct")
+		}
+
+		docs[i] = doc
+	}
+
+	return docs, nil
 }
 
 type pipeSeparatedValues struct {
@@ -40,3 +238,28 @@ func (b *pipeSeparatedValues) Set(value string) error {
 	b.Values = strings.Split(value, "|")
 	return nil
 }
+
+// UnmarshalYAML accepts either a list of values or a pipe-separated string.
+func (b *pipeSeparatedValues) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var values []string
+	if err := unmarshal(&values); err == nil {
+		b.Values = values
+		return nil
+	}
+
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	return b.Set(value)
+}
+
+// MarshalYAML marshals the values as a list. No values are marshaled as null.
+func (b pipeSeparatedValues) MarshalYAML() (interface{}, error) {
+	if len(b.Values) == 0 {
+		return nil, nil
+	}
+
+	return b.Values, nil
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/asyncapi/event-gateway/kafka"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApp_LoadFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		expected    func() *App
+		expectedErr string
+	}{
+		{
+			name: "YAML file",
+			file: "testdata/config/config.yaml",
+			expected: func() *App {
+				c := NewApp()
+				c.Debug = true
+				c.AsyncAPIDocs = pipeSeparatedValues{Values: []string{"testdata/simple-kafka.yaml", "testdata/another-service-kafka.yaml"}}
+				c.WSServerPort = 6000
+				c.KafkaProxy.Address = "event-gateway.mycompany.org"
+				c.KafkaProxy.BrokerFromServer = "test"
+				c.KafkaProxy.MessageValidation.Enabled = false
+				c.KafkaProxy.TLS = &kafka.TLSConfig{Enable: true, InsecureSkipVerify: true}
+				c.KafkaProxy.ExtraFlags = pipeSeparatedValues{Values: []string{"arg1=arg1value", "arg2=arg2value"}}
+				return c
+			},
+		},
+		{
+			name: "JSON file. Pipe separated values",
+			file: "testdata/config/config.json",
+			expected: func() *App {
+				c := NewApp()
+				c.AsyncAPIDoc = "testdata/simple-kafka.yaml"
+				c.AdminPort = 0
+				c.KafkaProxy.ExtraFlags = pipeSeparatedValues{Values: []string{"arg1=arg1value", "arg2=arg2value"}}
+				return c
+			},
+		},
+		{
+			name:        "Unknown keys are rejected",
+			file:        "testdata/config/unknown-key.yaml",
+			expectedErr: "error decoding config file testdata/config/unknown-key.yaml: yaml: unmarshal errors:\n  line 3: field brokerFromSever not found in type config.KafkaProxy",
+		},
+		{
+			name:        "File not found",
+			file:        "testdata/config/not-found.yaml",
+			expectedErr: "error reading config file testdata/config/not-found.yaml: open testdata/config/not-found.yaml: no such file or directory",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewApp()
+			err := c.LoadFile(test.file)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected(), c)
+		})
+	}
+}
+
+func TestApp_LoadFileEnvOverride(t *testing.T) {
+	require.NoError(t, os.Setenv("EVENTGATEWAY_WS_SERVER_PORT", "7000"))
+	require.NoError(t, os.Setenv("EVENTGATEWAY_KAFKA_PROXY_EXTRA_FLAGS", "arg3=arg3value"))
+	require.NoError(t, os.Setenv("EVENTGATEWAY_MQTT_PROXY_MESSAGE_VALIDATION_QUEUE_SIZE", "500"))
+	defer os.Unsetenv("EVENTGATEWAY_WS_SERVER_PORT")
+	defer os.Unsetenv("EVENTGATEWAY_KAFKA_PROXY_EXTRA_FLAGS")
+	defer os.Unsetenv("EVENTGATEWAY_MQTT_PROXY_MESSAGE_VALIDATION_QUEUE_SIZE")
+
+	c := NewApp()
+	require.NoError(t, c.LoadFile("testdata/config/config.yaml"))
+	require.NoError(t, envconfig.Process("eventgateway", c))
+
+	assert.Equal(t, 7000, c.WSServerPort)
+	assert.Equal(t, []string{"arg3=arg3value"}, c.KafkaProxy.ExtraFlags.Values)
+	assert.Equal(t, 500, c.MQTTProxy.MessageValidation.QueueSize)
+
+	// Values not set via env vars remain the ones from the file or defaults.
+	assert.True(t, c.Debug)
+	assert.Equal(t, 0, c.AdminPort)
+	assert.Equal(t, "test", c.KafkaProxy.BrokerFromServer)
+	assert.False(t, c.KafkaProxy.MessageValidation.Enabled)
+	assert.True(t, c.KafkaProxy.TLS.InsecureSkipVerify)
+}
+
+func TestApp_YAML(t *testing.T) {
+	loaded := NewApp()
+	require.NoError(t, loaded.LoadFile("testdata/config/config.yaml"))
+
+	out, err := loaded.YAML()
+	require.NoError(t, err)
+
+	// Printed config can be loaded back.
+	fromOutput := NewApp()
+	f, err := os.CreateTemp(t.TempDir(), "config-*.yaml")
+	require.NoError(t, err)
+	_, err = f.Write(out)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, fromOutput.LoadFile(f.Name()))
+
+	assert.Equal(t, loaded, fromOutput)
+}
+
+func TestApp_YAMLRedactsSecrets(t *testing.T) {
+	c := NewApp()
+	c.KafkaProxy.SASL = &SASL{Username: "user", Password: "s3cr3t"}
+	c.KafkaProxy.ListenerTLS = &ListenerTLS{CertFile: "/etc/certs/server.crt", KeyFile: "/etc/certs/server.key", KeyPassword: "k3y"}
+
+	out, err := c.YAML()
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "password: <redacted>")
+	assert.Contains(t, string(out), "keyPassword: <redacted>")
+	assert.NotContains(t, string(out), "s3cr3t")
+	assert.NotContains(t, string(out), "k3y")
+	assert.Equal(t, "s3cr3t", c.KafkaProxy.SASL.Password)
+	assert.Equal(t, "k3y", c.KafkaProxy.ListenerTLS.KeyPassword)
+}
+
+func TestApp_Servers(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/simple-kafka.yaml`), []byte(`testdata/another-server-kafka.yaml`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		brokerFromSever string
+		expected        []string
+		expectedErr     string
+	}{
+		{
+			name:     "All servers",
+			expected: []string{"test", "other"},
+		},
+		{
+			name:            "Only one server",
+			brokerFromSever: "other",
+			expected:        []string{"other"},
+		},
+		{
+			name:            "Unknown server",
+			brokerFromSever: "unknown",
+			expectedErr:     "server unknown not found in the provided AsyncAPI docs",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewApp()
+			c.KafkaProxy.BrokerFromServer = test.brokerFromSever
+
+			servers, err := c.Servers(docs)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			names := make([]string, len(servers))
+			for i, s := range servers {
+				names[i] = s.Name()
+			}
+			assert.Equal(t, test.expected, names)
+		})
+	}
+}
@@ -2,70 +2,143 @@ package config
 
 import (
 	"fmt"
-	"net"
+	"io/ioutil"
+	"reflect"
 	"strings"
 
+	"github.com/Shopify/sarama"
 	watermillkafka "github.com/ThreeDotsLabs/watermill-kafka/v2/pkg/kafka"
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
 	"github.com/asyncapi/event-gateway/asyncapi"
 	v2 "github.com/asyncapi/event-gateway/asyncapi/v2"
 	"github.com/asyncapi/event-gateway/kafka"
 	"github.com/asyncapi/event-gateway/message"
 	"github.com/asyncapi/event-gateway/message/handler"
+	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 // KafkaProxy holds the config for later configuring a Kafka proxy.
 type KafkaProxy struct {
-	Address           string            `desc:"Address for this proxy. Should be reachable by your clients. Most probably a domain."`
-	BrokerFromServer  string            `split_words:"true" desc:"When configuring from an AsyncAPI doc, this allows the user to only configure one server instead of all"`
-	MessageValidation MessageValidation `split_words:"true"`
-	TLS               *kafka.TLSConfig
-	ExtraFlags        pipeSeparatedValues `split_words:"true" desc:"Advanced configuration. Configure any flag from https://github.com/grepplabs/kafka-proxy/blob/4f3b89fbaecb3eb82426f5dcff5f76188ea9a9dc/cmd/kafka-proxy/server.go#L85-L195. Multiple values can be configured by using pipe separation (|)"`
+	Address            string              `yaml:"address" desc:"Address for this proxy. Should be reachable by your clients. Most probably a domain."`
+	BrokerFromServer   string              `yaml:"brokerFromServer" split_words:"true" desc:"When configuring from an AsyncAPI doc, this allows the user to only configure one server instead of all"`
+	MessageValidation  MessageValidation   `yaml:"messageValidation" split_words:"true"`
+	TLS                *kafka.TLSConfig    `yaml:"tls"`
+	SASL               *SASL               `yaml:"sasl"`
+	ListenerTLS        *ListenerTLS        `yaml:"listenerTLS" split_words:"true"`
+	StrictChannels     kafka.PolicyMode    `yaml:"strictChannels" split_words:"true" desc:"Produce requests to topics not declared as channels in the AsyncAPI docs are reported (observe) or rejected (enforce). Valid values are off, observe and enforce. Default is off"`
+	OperationDirection kafka.PolicyMode    `yaml:"operationDirection" split_words:"true" desc:"Produce requests to channels the AsyncAPI docs only declare for the application to publish are reported (observe) or rejected (enforce). Valid values are off, observe and enforce. Default is off"`
+	ProduceQuotas      ProduceQuotas       `yaml:"produceQuotas" split_words:"true"`
+	ExtraFlags         pipeSeparatedValues `yaml:"extraFlags" split_words:"true" desc:"Advanced configuration. Supported flags are default-listener-ip, dynamic-advertised-listener, dynamic-sequential-min-port, forbidden-api-keys, dial-address-mapping, tls-enable, tls-insecure-skip-verify, tls-client-cert-file, tls-client-key-file and tls-ca-chain-cert-file. Unsupported flags are ignored, logging a warning. Multiple values can be configured by using pipe separation (|)"`
 }
 
 // MessageValidation holds the config about message validation.
 type MessageValidation struct {
-	Enabled             bool   `default:"true" desc:"Enable or disable validation of Kafka messages"`
-	PublishToKafkaTopic string `split_words:"true"`
+	Enabled             bool   `yaml:"enabled" desc:"Enable or disable validation of Kafka messages. Default is true"`
+	PublishToKafkaTopic string `yaml:"publishToKafkaTopic" split_words:"true"`
+	ValidationQueue     `yaml:",inline"`
+}
+
+// SASL holds the credentials for SASL authentication against the brokers.
+// The mechanism is derived from the security requirements of the AsyncAPI servers unless explicitly set.
+// It applies to all servers, unless overridden per server by the x-eventgateway-sasl extension.
+type SASL struct {
+	Mechanism    string `yaml:"mechanism" mapstructure:"mechanism" desc:"SASL mechanism: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512 or OAUTHBEARER. Derived from the security requirements of the AsyncAPI servers if not set"`
+	Username     string `yaml:"username" mapstructure:"username" desc:"SASL username"`
+	Password     string `yaml:"password" mapstructure:"password" desc:"SASL password"`
+	PasswordFile string `yaml:"passwordFile" mapstructure:"passwordFile" split_words:"true" desc:"Path to a file containing the SASL password. Takes precedence over Password"`
+	TokenFile    string `yaml:"tokenFile" mapstructure:"tokenFile" split_words:"true" desc:"Path to a file containing the OAUTHBEARER token. It is read on every authentication"`
+}
+
+// ListenerTLS holds the config for TLS termination on the proxy listeners.
+// It applies to all servers, unless overridden per server by the x-eventgateway-listener-tls extension.
+type ListenerTLS struct {
+	CertFile     string `yaml:"certFile" split_words:"true" desc:"PEM encoded file with the certificate presented to clients"`
+	KeyFile      string `yaml:"keyFile" split_words:"true" desc:"PEM encoded file with the private key of the certificate"`
+	KeyPassword  string `yaml:"keyPassword" split_words:"true" desc:"Password for decrypting the private key"`
+	ClientCAFile string `yaml:"clientCAFile" split_words:"true" desc:"PEM encoded CA certificate file. If set, clients should present a certificate signed by this CA (mTLS)"`
+}
+
+func (t *ListenerTLS) isSet() bool {
+	return t != nil && (t.CertFile != "" || t.KeyFile != "")
 }
 
 // NewKafkaProxy creates a KafkaProxy with defaults.
 func NewKafkaProxy() *KafkaProxy {
 	return &KafkaProxy{MessageValidation: MessageValidation{
-		Enabled: true,
+		Enabled:         true,
+		ValidationQueue: NewValidationQueue(),
 	}}
 }
 
-// ProxyConfig creates a config struct for the Kafka Proxy based on a given AsyncAPI doc (if provided).
-func (c *KafkaProxy) ProxyConfig(d []byte, debug bool) (*kafka.ProxyConfig, error) {
-	if len(d) == 0 {
-		return nil, errors.New("AsyncAPIDoc config should be provided")
-	}
-
-	doc := new(v2.Document)
-	if err := v2.Decode(d, doc); err != nil {
-		return nil, errors.Wrap(err, "error decoding AsyncAPI json doc to Document struct")
+// ProxyConfig creates a config struct for the Kafka Proxy based on the given AsyncAPI docs.
+// Servers and channels of all docs are merged. Invalid messages are published to the configured topic, if any.
+func (c *KafkaProxy) ProxyConfig(docs []asyncapi.Document, debug bool) (*kafka.ProxyConfig, error) {
+	conf, err := c.proxyConfig(docs, debug)
+	if err != nil {
+		return nil, err
 	}
 
-	servers := doc.Servers()
-	if c.BrokerFromServer != "" {
-		// Pick up only the specified server
-		s, ok := doc.Server(c.BrokerFromServer)
-		if !ok {
-			return nil, fmt.Errorf("server %s not found in the provided AsyncAPI doc", s.Name())
+	if conf.MessageHandler != nil {
+		conf.MessagePublisher, conf.MessageSubscriber, err = c.ValidationErrorsPubSub(docs)
+		if err != nil {
+			return nil, errors.Wrap(err, "error configuring message validation")
 		}
 
-		if !isValidKafkaProtocol(s) {
-			return nil, fmt.Errorf("server %s has no kafka protocol configured but '%s'", s.Name(), s.Protocol())
+		if conf.MessagePublisher != nil {
+			conf.PublishToTopic = c.MessageValidation.PublishToKafkaTopic
 		}
+	}
 
-		servers = []asyncapi.Server{s}
+	return conf, nil
+}
+
+// proxyConfig creates a config struct for the Kafka Proxy based on the given AsyncAPI docs, without publishing invalid messages.
+func (c *KafkaProxy) proxyConfig(docs []asyncapi.Document, debug bool) (*kafka.ProxyConfig, error) {
+	if len(docs) == 0 {
+		return nil, errors.New("at least one AsyncAPI doc should be provided")
+	}
+
+	servers, err := c.servers(docs)
+	if err != nil {
+		return nil, err
 	}
 
-	opts := []kafka.ProxyOption{kafka.WithExtra(c.ExtraFlags.Values), kafka.WithDebug(debug)}
+	saslConfig, saslServers, err := c.sharedSASLConfig(docs, servers)
+	if err != nil {
+		return nil, errors.Wrap(err, "error configuring SASL")
+	}
+
+	if len(saslServers) < countKafkaServers(servers) {
+		logrus.Warnf("Brokers of all servers are authenticated the same as the ones of server %s. Run one proxy per server for authenticating them differently", saslServers[0].Name())
+	}
+
+	listenerTLSConfig, err := c.listenerTLSConfig(servers)
+	if err != nil {
+		return nil, errors.Wrap(err, "error configuring listener TLS")
+	}
+
+	opts := []kafka.ProxyOption{
+		kafka.WithExtra(c.ExtraFlags.Values),
+		kafka.WithDebug(debug),
+		kafka.WithSASL(saslConfig),
+		kafka.WithListenerTLS(listenerTLSConfig),
+	}
+	policyOpts, err := c.producePolicyOptions(docs)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, policyOpts...)
+
+	quotasOpts, err := c.produceQuotasOptions(docs)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, quotasOpts...)
+
 	if c.MessageValidation.Enabled {
-		messageValidationOpts, err := c.generateMessageValidatorOptions(doc, servers)
+		messageValidationOpts, err := c.generateMessageValidatorOptions(docs)
 		if err != nil {
 			return nil, errors.Wrap(err, "error configuring message validation")
 		}
@@ -84,61 +157,430 @@ func (c *KafkaProxy) ProxyConfig(d []byte, debug bool) (*kafka.ProxyConfig, erro
 	return conf, nil
 }
 
-func (c *KafkaProxy) generateMessageValidatorOptions(doc asyncapi.Document, servers []asyncapi.Server) ([]kafka.ProxyOption, error) {
-	validator, err := v2.FromDocJSONSchemaMessageValidator(doc)
+// producePolicyOptions returns the options for configuring the enabled produce policies.
+func (c *KafkaProxy) producePolicyOptions(docs []asyncapi.Document) ([]kafka.ProxyOption, error) {
+	policies := []struct {
+		name    string
+		mode    kafka.PolicyMode
+		factory func([]asyncapi.Document) (kafka.ProducePolicy, error)
+		errMsg  string
+	}{
+		{name: strictChannelsPolicyName, mode: c.StrictChannels, factory: declaredChannelsPolicy, errMsg: "error configuring strict channels"},
+		{name: operationDirectionPolicyName, mode: c.OperationDirection, factory: operationDirectionPolicy, errMsg: "error configuring operation direction"},
+	}
+
+	var opts []kafka.ProxyOption
+	for _, p := range policies {
+		if err := p.mode.Validate(); err != nil {
+			return nil, errors.Wrap(err, p.errMsg)
+		}
+
+		if !p.mode.IsEnabled() {
+			continue
+		}
+
+		policy, err := p.factory(docs)
+		if err != nil {
+			return nil, errors.Wrap(err, p.errMsg)
+		}
+
+		opts = append(opts, kafka.WithProducePolicy(p.name, p.mode, policy))
+	}
+
+	return opts, nil
+}
+
+// servers returns the servers the proxy should be configured for.
+func (c *KafkaProxy) servers(docs []asyncapi.Document) ([]asyncapi.Server, error) {
+	servers, err := servers(docs, c.BrokerFromServer)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.BrokerFromServer != "" && !isValidKafkaProtocol(servers[0]) {
+		return nil, fmt.Errorf("server %s has no kafka protocol configured but '%s'", servers[0].Name(), servers[0].Protocol())
+	}
+
+	return servers, nil
+}
+
+// ServerProxyConfig creates a config struct for the Kafka Proxy of the given server.
+// Invalid messages are not published, as the proxies of all servers are expected to share the same publisher and subscriber.
+// See ValidationErrorsPubSub.
+func (c *KafkaProxy) ServerProxyConfig(docs []asyncapi.Document, server string, debug bool) (*kafka.ProxyConfig, error) {
+	serverConf := *c
+	serverConf.BrokerFromServer = server
+
+	conf, err := serverConf.proxyConfig(docs, debug)
+	if err != nil {
+		return nil, err
+	}
+
+	conf.Name = server
+
+	return conf, nil
+}
+
+// saslConfig returns the SASL config for authenticating against the brokers of the given server, or nil if SASL is not needed.
+// The mechanism is derived from the security requirements of the server, unless explicitly configured.
+func (c *KafkaProxy) saslConfig(docs []asyncapi.Document, s asyncapi.Server) (*kafka.SASLConfig, error) {
+	creds, err := c.serverSASL(s)
+	if err != nil {
+		return nil, err
+	}
+
+	mechanism := creds.Mechanism
+	if mechanism == "" {
+		if mechanism, err = serverSASLMechanism(docs, s); err != nil {
+			return nil, err
+		}
+	}
+
+	if mechanism == "" {
+		return nil, nil
+	}
+
+	conf := &kafka.SASLConfig{Mechanism: mechanism, Username: creds.Username, Password: creds.Password, TokenFile: creds.TokenFile}
+	if creds.PasswordFile != "" {
+		raw, err := ioutil.ReadFile(creds.PasswordFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading SASL password file")
+		}
+
+		conf.Password = strings.TrimSpace(string(raw))
+	}
+
+	return conf, conf.Validate()
+}
+
+// serverSASL returns the SASL credentials of the given server. The configured ones apply, unless overridden by the
+// x-eventgateway-sasl extension of the server.
+func (c *KafkaProxy) serverSASL(s asyncapi.Server) (SASL, error) {
+	var creds SASL
+	if c.SASL != nil {
+		creds = *c.SASL
+	}
+
+	ext := s.Extension(asyncapi.ExtensionEventGatewaySASL)
+	if ext == nil {
+		return creds, nil
+	}
+
+	var override SASL
+	if err := mapstructure.Decode(ext, &override); err != nil {
+		return creds, errors.Wrapf(err, "error decoding %s extension of server %s", asyncapi.ExtensionEventGatewaySASL, s.Name())
+	}
+
+	if override.Password == "" && override.PasswordFile == "" {
+		// The password is a secret. It is not expected to be in the doc.
+		override.Password, override.PasswordFile = creds.Password, creds.PasswordFile
+	}
+
+	return override, nil
+}
+
+// sharedSASLConfig returns the SASL config of the first of the given Kafka servers, along with the Kafka servers whose brokers
+// are authenticated the same way. Servers are expected to belong to the same cluster when sharing a proxy or a client.
+func (c *KafkaProxy) sharedSASLConfig(docs []asyncapi.Document, servers []asyncapi.Server) (*kafka.SASLConfig, []asyncapi.Server, error) {
+	var shared *kafka.SASLConfig
+	var sharing []asyncapi.Server
+	for _, s := range servers {
+		if !isValidKafkaProtocol(s) {
+			continue
+		}
+
+		conf, err := c.saslConfig(docs, s)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(sharing) > 0 && !reflect.DeepEqual(conf, shared) {
+			logrus.Debugf("Server %s is authenticated differently than server %s. Skipping", s.Name(), sharing[0].Name())
+			continue
+		}
+
+		shared = conf
+		sharing = append(sharing, s)
+	}
+
+	return shared, sharing, nil
+}
+
+// serverSASLMechanism returns the SASL mechanism required by the security requirements of the server, if any.
+// The first requirement with a security scheme that maps to a SASL mechanism is used.
+func serverSASLMechanism(docs []asyncapi.Document, s asyncapi.Server) (string, error) {
+	for _, r := range s.SecurityRequirements() {
+		scheme, ok := securityScheme(docs, r.SchemeName())
+		if !ok {
+			return "", fmt.Errorf("security scheme %s required by server %s not found in the provided AsyncAPI docs", r.SchemeName(), s.Name())
+		}
+
+		switch scheme.Type() {
+		case v2.SecuritySchemeTypePlain, v2.SecuritySchemeTypeUserPassword:
+			return kafka.SASLMechanismPlain, nil
+		case v2.SecuritySchemeTypeScramSha256:
+			return kafka.SASLMechanismScramSHA256, nil
+		case v2.SecuritySchemeTypeScramSha512:
+			return kafka.SASLMechanismScramSHA512, nil
+		case v2.SecuritySchemeTypeOAuth2:
+			return kafka.SASLMechanismOAuthBearer, nil
+		default:
+			logrus.Debugf("Security scheme %s of type %s required by server %s does not map to any supported SASL mechanism. Skipping", scheme.Name(), scheme.Type(), s.Name())
+		}
+	}
+
+	return "", nil
+}
+
+func securityScheme(docs []asyncapi.Document, name string) (asyncapi.SecurityScheme, bool) {
+	for _, doc := range docs {
+		if scheme, ok := doc.SecurityScheme(name); ok {
+			return scheme, true
+		}
+	}
+
+	return nil, false
+}
+
+// listenerTLSConfig returns the config for TLS termination on the proxy listeners, or nil if clients connect through plaintext.
+// A proxy shares one config across all its listeners, so the one of the first Kafka server applies to all of them.
+func (c *KafkaProxy) listenerTLSConfig(servers []asyncapi.Server) (*kafka.ListenerTLSConfig, error) {
+	var result *kafka.ListenerTLSConfig
+	var resultServer string
+	for _, s := range servers {
+		if !isValidKafkaProtocol(s) {
+			continue
+		}
+
+		conf, err := c.serverListenerTLSConfig(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if resultServer == "" {
+			result, resultServer = conf, s.Name()
+		} else if !reflect.DeepEqual(conf, result) {
+			logrus.Warnf("Listeners of server %s terminate TLS the same as the ones of server %s. Run one proxy per server for terminating TLS differently", s.Name(), resultServer)
+		}
+	}
+
+	if result != nil {
+		if err := result.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// serverListenerTLSConfig returns the listener TLS config of the given server. The configured one applies, unless overridden
+// by the x-eventgateway-listener-tls extension of the server.
+func (c *KafkaProxy) serverListenerTLSConfig(s asyncapi.Server) (*kafka.ListenerTLSConfig, error) {
+	ext := s.Extension(asyncapi.ExtensionEventGatewayListenerTLS)
+	if ext == nil {
+		if !c.ListenerTLS.isSet() {
+			return nil, nil
+		}
+
+		return &kafka.ListenerTLSConfig{
+			CertFile:     c.ListenerTLS.CertFile,
+			KeyFile:      c.ListenerTLS.KeyFile,
+			KeyPassword:  c.ListenerTLS.KeyPassword,
+			ClientCAFile: c.ListenerTLS.ClientCAFile,
+		}, nil
+	}
+
+	conf := new(kafka.ListenerTLSConfig)
+	if err := mapstructure.Decode(ext, conf); err != nil {
+		return nil, errors.Wrapf(err, "error decoding %s extension of server %s", asyncapi.ExtensionEventGatewayListenerTLS, s.Name())
+	}
+
+	if conf.KeyPassword == "" && c.ListenerTLS != nil {
+		// The password is a secret. It is not expected to be in the doc.
+		conf.KeyPassword = c.ListenerTLS.KeyPassword
+	}
+
+	return conf, nil
+}
+
+func (c *KafkaProxy) generateMessageValidatorOptions(docs []asyncapi.Document) ([]kafka.ProxyOption, error) {
+	validator, err := v2.FromDocsJSONSchemaMessageValidator(docs...)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating message validator")
 	}
 
-	opts := []kafka.ProxyOption{kafka.WithMessageHandler(handler.ValidateMessage(validator, false))}
+	return []kafka.ProxyOption{
+		kafka.WithMessageHandler(handler.ValidateMessage(validator, false)),
+		kafka.WithValidationQueue(c.MessageValidation.ValidationQueue.config()),
+	}, nil
+}
+
+// ValidationErrorsPubSub creates the publisher producing invalid messages to the configured topic and the subscriber
+// consuming them back, or nil if message validation is disabled or no topic is set. The subscriber uses no consumer group.
+// Both connect to the brokers of the Kafka servers the proxy is configured for (see clientConfig), so they should be created
+// once and shared by the proxies of all servers. Otherwise, every invalid message would be consumed once per proxy.
+func (c *KafkaProxy) ValidationErrorsPubSub(docs []asyncapi.Document) (watermillmessage.Publisher, watermillmessage.Subscriber, error) {
+	if !c.MessageValidation.Enabled {
+		return nil, nil, nil
+	}
 
 	if c.MessageValidation.PublishToKafkaTopic == "" {
 		logrus.Warn("No topic set for invalid messages. Invalid messages will be discarded")
-		return opts, nil
+		return nil, nil, nil
+	}
+
+	brokers, saramaConf, err := c.clientConfig(docs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publisher, err := newKafkaPublisher(brokers, saramaConf, watermillkafka.DefaultMarshaler{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subscriber, err := newKafkaSubscriber(brokers, saramaConf, "")
+	if err != nil {
+		_ = publisher.Close()
+		return nil, nil, err
+	}
+
+	return publisher, subscriber, nil
+}
+
+// Publisher creates a publisher producing messages to the brokers of the Kafka servers the proxy is configured for.
+// The message key (see message.MetadataKey) is produced as record key. TLS and SASL configs apply.
+func (c *KafkaProxy) Publisher(docs []asyncapi.Document) (watermillmessage.Publisher, error) {
+	brokers, saramaConf, err := c.clientConfig(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	return newKafkaPublisher(brokers, saramaConf, keyMarshaler{})
+}
+
+// Subscriber creates a subscriber consuming messages from the brokers of the Kafka servers the proxy is configured for,
+// as part of the given consumer group. TLS and SASL configs apply.
+func (c *KafkaProxy) Subscriber(docs []asyncapi.Document, consumerGroup string) (watermillmessage.Subscriber, error) {
+	brokers, saramaConf, err := c.clientConfig(docs)
+	if err != nil {
+		return nil, err
 	}
 
-	// Configure Kafka Producer
+	return newKafkaSubscriber(brokers, saramaConf, consumerGroup)
+}
+
+// clientConfig returns the brokers and config for Kafka clients of the Kafka servers the proxy is configured for.
+// Clients bootstrap from the brokers of the servers authenticated the same as the first Kafka server (see sharedSASLConfig).
+func (c *KafkaProxy) clientConfig(docs []asyncapi.Document) ([]string, *sarama.Config, error) {
+	all, err := c.servers(docs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	saslConfig, servers, err := c.sharedSASLConfig(docs, all)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(servers) == 0 {
+		return nil, nil, errors.New("No Kafka brokers were found when configuring")
+	}
+
+	saramaConf, err := c.saramaConfig(saslConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return kafkaBrokers(servers), saramaConf, nil
+}
+
+// saramaConfig creates the config for Kafka clients connecting to the brokers, such as publishers and subscribers.
+func (c *KafkaProxy) saramaConfig(saslConfig *kafka.SASLConfig) (*sarama.Config, error) {
 	saramaConf := watermillkafka.DefaultSaramaSyncPublisherConfig()
 	if c.TLS != nil && c.TLS.Enable {
 		tlsConfig, err := c.TLS.Config()
 		if err != nil {
-			return opts, fmt.Errorf("tls config is invalid. %w", err)
+			return nil, fmt.Errorf("tls config is invalid. %w", err)
 		}
 
 		saramaConf.Net.TLS.Enable = true
 		saramaConf.Net.TLS.Config = tlsConfig
 	}
 
-	brokers := make([]string, len(servers))
-	for i := 0; i < len(servers); i++ {
-		brokers[i] = servers[i].URL()
+	if saslConfig != nil {
+		saslConfig.ConfigureSarama(saramaConf)
 	}
-	marshaler := watermillkafka.DefaultMarshaler{}
+
+	return saramaConf, nil
+}
+
+func newKafkaPublisher(brokers []string, saramaConf *sarama.Config, marshaler watermillkafka.Marshaler) (watermillmessage.Publisher, error) {
 	publisherConf := watermillkafka.PublisherConfig{
 		Brokers:               brokers,
 		Marshaler:             marshaler,
 		OverwriteSaramaConfig: saramaConf,
 	}
-	logger := message.NewWatermillLogrusLogger(logrus.StandardLogger())
-	publisher, err := watermillkafka.NewPublisher(publisherConf, logger)
+
+	return watermillkafka.NewPublisher(publisherConf, message.NewWatermillLogrusLogger(logrus.StandardLogger()))
+}
+
+// keyMarshaler marshals messages the same as watermillkafka.DefaultMarshaler, but producing their key (see message.MetadataKey)
+// as record key instead of as header. Messages without key are produced with null key.
+type keyMarshaler struct {
+	watermillkafka.DefaultMarshaler
+}
+
+// Marshal marshals the given message into a record of the given topic.
+func (m keyMarshaler) Marshal(topic string, msg *watermillmessage.Message) (*sarama.ProducerMessage, error) {
+	key, ok := msg.Metadata[message.MetadataKey]
+	if ok {
+		msg = msg.Copy()
+		delete(msg.Metadata, message.MetadataKey)
+	}
+
+	record, err := m.DefaultMarshaler.Marshal(topic, msg)
 	if err != nil {
-		return opts, err
+		return nil, err
 	}
 
+	if ok {
+		record.Key = sarama.StringEncoder(key)
+	}
+
+	return record, nil
+}
+
+// newKafkaSubscriber creates a subscriber consuming messages from the given brokers. No consumer group is used if empty.
+func newKafkaSubscriber(brokers []string, saramaConf *sarama.Config, consumerGroup string) (watermillmessage.Subscriber, error) {
 	subscriberConf := watermillkafka.SubscriberConfig{
 		Brokers:               brokers,
 		OverwriteSaramaConfig: saramaConf,
-		Unmarshaler:           marshaler,
+		Unmarshaler:           watermillkafka.DefaultMarshaler{},
+		ConsumerGroup:         consumerGroup,
 	}
 
-	subscriber, err := watermillkafka.NewSubscriber(subscriberConf, logger)
-	if err != nil {
-		return opts, err
+	return watermillkafka.NewSubscriber(subscriberConf, message.NewWatermillLogrusLogger(logrus.StandardLogger()))
+}
+
+func kafkaBrokers(servers []asyncapi.Server) []string {
+	brokers := make([]string, len(servers))
+	for i := 0; i < len(servers); i++ {
+		brokers[i] = servers[i].URL()
 	}
 
-	opts = append(opts, kafka.WithMessagePublisher(publisher, c.MessageValidation.PublishToKafkaTopic), kafka.WithMessageSubscriber(subscriber))
+	return brokers
+}
 
-	return opts, nil
+func countKafkaServers(servers []asyncapi.Server) int {
+	var n int
+	for _, s := range servers {
+		if isValidKafkaProtocol(s) {
+			n++
+		}
+	}
+
+	return n
 }
 
 func isValidKafkaProtocol(s asyncapi.Server) bool {
@@ -162,36 +604,63 @@ func kafkaProxyConfigFromServers(servers []asyncapi.Server, opts ...kafka.ProxyO
 	return kafka.NewProxyConfig(brokersMapping, opts...)
 }
 
+// ServerMapping holds the addresses resolved for proxying a server.
+type ServerMapping struct {
+	Server             string   `json:"server"`
+	URL                string   `json:"url"`
+	Protocol           string   `json:"protocol"`
+	ListenAt           string   `json:"listenAt"`
+	DialAddressMapping []string `json:"dialAddressMapping,omitempty"`
+}
+
+// BrokerMapping returns the mapping in the form expected by kafka.ProxyConfig.BrokersMapping.
+func (m ServerMapping) BrokerMapping() string {
+	return fmt.Sprintf("%s,%s", m.URL, m.ListenAt)
+}
+
+// ServerMappings returns the resolved address mappings for the servers the proxy is configured for.
+func (c *KafkaProxy) ServerMappings(docs []asyncapi.Document) ([]ServerMapping, error) {
+	servers, err := c.servers(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	return serverMappings(servers...)
+}
+
 func extractAddressMappingFromServers(servers ...asyncapi.Server) (brokersMapping []string, dialAddressMapping []string, err error) {
+	mappings, err := serverMappings(servers...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, m := range mappings {
+		brokersMapping = append(brokersMapping, m.BrokerMapping())
+		dialAddressMapping = append(dialAddressMapping, m.DialAddressMapping...)
+	}
+
+	return brokersMapping, dialAddressMapping, nil
+}
+
+func serverMappings(servers ...asyncapi.Server) ([]ServerMapping, error) {
+	var mappings []ServerMapping
 	for _, s := range servers {
 		if !isValidKafkaProtocol(s) {
 			continue
 		}
 
-		var listenAt string
-		// If extension is configured, it overrides the value of the port.
-		if overridePort := s.Extension(asyncapi.ExtensionEventGatewayListener); overridePort != nil {
-			if val := fmt.Sprintf("%v", overridePort); val != "" { // Convert value to string rep as can be either string or number
-				if host, _, _ := net.SplitHostPort(val); host == "" {
-					val = ":" + val // If no host, prefix with : as localhost is inferred
-				}
-				listenAt = val
-			}
-		} else {
-			// Use the same port as remote but locally.
-			_, val, err := net.SplitHostPort(s.URL())
-			if err != nil {
-				return nil, nil, errors.Wrapf(err, "error getting port from broker %s. URL:%s", s.Name(), s.URL())
-			}
-
-			listenAt = ":" + val // Prefix with : as localhost is inferred
+		listenAt, err := listenAddress(s, s.URL())
+		if err != nil {
+			return nil, err
 		}
 
-		brokersMapping = append(brokersMapping, fmt.Sprintf("%s,%s", s.URL(), listenAt))
+		m := ServerMapping{Server: s.Name(), URL: s.URL(), Protocol: s.Protocol(), ListenAt: listenAt}
 		if dialMapping := s.Extension(asyncapi.ExtensionEventGatewayDialMapping); dialMapping != nil {
-			dialAddressMapping = append(dialAddressMapping, strings.Split(dialMapping.(string), "|")...)
+			m.DialAddressMapping = strings.Split(dialMapping.(string), "|")
 		}
+
+		mappings = append(mappings, m)
 	}
 
-	return brokersMapping, dialAddressMapping, nil
+	return mappings, nil
 }
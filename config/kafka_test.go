@@ -3,16 +3,21 @@ package config
 import (
 	"testing"
 
+	"github.com/Shopify/sarama"
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
 	"github.com/asyncapi/event-gateway/kafka"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/asyncapi/event-gateway/proxy"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestKafkaProxy_ProxyConfig(t *testing.T) {
 	tests := []struct {
 		name                string
 		config              *KafkaProxy
-		doc                 []byte
+		docs                [][]byte
 		expectedProxyConfig func(*testing.T, *kafka.ProxyConfig) *kafka.ProxyConfig
 		expectedErr         error
 	}{
@@ -29,7 +34,7 @@ func TestKafkaProxy_ProxyConfig(t *testing.T) {
 					ExtraConfig:    []string{"arg1=arg1value", "arg2=arg2value"},
 				}
 			},
-			doc: []byte(`testdata/simple-kafka.yaml`),
+			docs: [][]byte{[]byte(`testdata/simple-kafka.yaml`)},
 		},
 		{
 			name: "Valid config. Only one broker + enable message validation",
@@ -44,7 +49,7 @@ func TestKafkaProxy_ProxyConfig(t *testing.T) {
 				assert.NotNil(t, c.MessageHandler)
 				return nil
 			},
-			doc: []byte(`testdata/simple-kafka.yaml`),
+			docs: [][]byte{[]byte(`testdata/simple-kafka.yaml`)},
 		},
 		{
 			name: "Valid config. Only one broker + Override listener port",
@@ -56,7 +61,7 @@ func TestKafkaProxy_ProxyConfig(t *testing.T) {
 					BrokersMapping: []string{"broker.mybrokers.org:9092,:28002"},
 				}
 			},
-			doc: []byte(`testdata/override-port-kafka.yaml`),
+			docs: [][]byte{[]byte(`testdata/override-port-kafka.yaml`)},
 		},
 		{
 			name:   "Valid config. All brokers + Override listener port",
@@ -66,7 +71,7 @@ func TestKafkaProxy_ProxyConfig(t *testing.T) {
 					BrokersMapping: []string{"broker.mybrokers.org:9092,:28002"},
 				}
 			},
-			doc: []byte(`testdata/override-port-kafka.yaml`),
+			docs: [][]byte{[]byte(`testdata/override-port-kafka.yaml`)},
 		},
 		{
 			name:   "Valid config. All brokers + multiple dial mapping",
@@ -77,18 +82,279 @@ func TestKafkaProxy_ProxyConfig(t *testing.T) {
 					DialAddressMapping: []string{"0.0.0.0:28002,kafkaproxy.myapp.org:28002", "0.0.0.0:28003,kafkaproxy.myapp.org:28003"},
 				}
 			},
-			doc: []byte(`testdata/dial-mapping-kafka.yaml`),
+			docs: [][]byte{[]byte(`testdata/dial-mapping-kafka.yaml`)},
+		},
+		{
+			name:   "Valid config. Several docs sharing the same server",
+			config: &KafkaProxy{},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				return &kafka.ProxyConfig{
+					BrokersMapping: []string{"broker.mybrokers.org:9092,:9092"},
+				}
+			},
+			docs: [][]byte{[]byte(`testdata/simple-kafka.yaml`), []byte(`testdata/another-service-kafka.yaml`)},
+		},
+		{
+			name: "Valid config. Several docs + enable message validation",
+			config: &KafkaProxy{
+				MessageValidation: MessageValidation{
+					Enabled: true,
+				},
+			},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				assert.Equal(t, []string{"broker.mybrokers.org:9092,:9092"}, c.BrokersMapping)
+				assert.NotNil(t, c.MessageHandler)
+				return nil
+			},
+			docs: [][]byte{[]byte(`testdata/simple-kafka.yaml`), []byte(`testdata/another-service-kafka.yaml`)},
+		},
+		{
+			name: "Invalid config. Several docs declaring the same channel with different messages",
+			config: &KafkaProxy{
+				MessageValidation: MessageValidation{
+					Enabled: true,
+				},
+			},
+			expectedErr: errors.New("error configuring message validation: error creating message validator: conflicting definitions for channel events. Messages event from Test 1.0.0 and messages event from Conflicting Test 1.0.0 are different"),
+			docs:        [][]byte{[]byte(`testdata/simple-kafka.yaml`), []byte(`testdata/conflicting-channel-kafka.yaml`)},
+		},
+		{
+			name: "Valid config. Message validation queue",
+			config: &KafkaProxy{
+				MessageValidation: MessageValidation{
+					Enabled: true,
+					ValidationQueue: ValidationQueue{
+						Workers:         4,
+						QueueSize:       1000,
+						QueueFullPolicy: proxy.QueueFullPolicyDropOldest,
+					},
+				},
+			},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				assert.Equal(t, proxy.ValidationQueueConfig{Workers: 4, Size: 1000, FullPolicy: proxy.QueueFullPolicyDropOldest}, c.ValidationQueue)
+				return nil
+			},
+			docs: [][]byte{[]byte(`testdata/simple-kafka.yaml`)},
+		},
+		{
+			name: "Invalid config. Unknown queue full policy",
+			config: &KafkaProxy{
+				MessageValidation: MessageValidation{
+					Enabled:         true,
+					ValidationQueue: ValidationQueue{QueueFullPolicy: "drop"},
+				},
+			},
+			expectedErr: errors.New(`invalid validation queue config: queue full policy "drop" is not valid. Valid values are block, drop-newest, drop-oldest and skip-validation`),
+			docs:        [][]byte{[]byte(`testdata/simple-kafka.yaml`)},
+		},
+		{
+			name:        "Invalid config. Server not found",
+			config:      &KafkaProxy{BrokerFromServer: "missing"},
+			expectedErr: errors.New("server missing not found in the provided AsyncAPI docs"),
+			docs:        [][]byte{[]byte(`testdata/simple-kafka.yaml`)},
+		},
+		{
+			name: "Valid config. SASL mechanism from server security requirements",
+			config: &KafkaProxy{
+				SASL: &SASL{Username: "user", Password: "pass"},
+			},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				return &kafka.ProxyConfig{
+					BrokersMapping: []string{"broker.mybrokers.org:9092,:9092"},
+					SASL:           &kafka.SASLConfig{Mechanism: kafka.SASLMechanismScramSHA512, Username: "user", Password: "pass"},
+				}
+			},
+			docs: [][]byte{[]byte(`testdata/sasl-scram-kafka.yaml`)},
+		},
+		{
+			name: "Valid config. SASL password from file",
+			config: &KafkaProxy{
+				SASL: &SASL{Username: "user", Password: "ignored", PasswordFile: "testdata/sasl-password"},
+			},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				return &kafka.ProxyConfig{
+					BrokersMapping: []string{"broker.mybrokers.org:9092,:9092"},
+					SASL:           &kafka.SASLConfig{Mechanism: kafka.SASLMechanismScramSHA512, Username: "user", Password: "s3cr3t"},
+				}
+			},
+			docs: [][]byte{[]byte(`testdata/sasl-scram-kafka.yaml`)},
+		},
+		{
+			name: "Valid config. SASL mechanism explicitly configured",
+			config: &KafkaProxy{
+				SASL: &SASL{Mechanism: kafka.SASLMechanismOAuthBearer, TokenFile: "/var/run/token"},
+			},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				return &kafka.ProxyConfig{
+					BrokersMapping: []string{"broker.mybrokers.org:9092,:9092"},
+					SASL:           &kafka.SASLConfig{Mechanism: kafka.SASLMechanismOAuthBearer, TokenFile: "/var/run/token"},
+				}
+			},
+			docs: [][]byte{[]byte(`testdata/simple-kafka.yaml`)},
+		},
+		{
+			name: "Valid config. SASL + enable message validation",
+			config: &KafkaProxy{
+				SASL: &SASL{Username: "user", Password: "pass"},
+				MessageValidation: MessageValidation{
+					Enabled: true,
+				},
+			},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				assert.Equal(t, &kafka.SASLConfig{Mechanism: kafka.SASLMechanismScramSHA512, Username: "user", Password: "pass"}, c.SASL)
+				assert.NotNil(t, c.MessageHandler)
+				return nil
+			},
+			docs: [][]byte{[]byte(`testdata/sasl-scram-kafka.yaml`)},
+		},
+		{
+			name:        "Invalid config. SASL required but no credentials",
+			config:      &KafkaProxy{},
+			expectedErr: errors.New("error configuring SASL: username and password are required for SASL mechanism SCRAM-SHA-512"),
+			docs:        [][]byte{[]byte(`testdata/sasl-scram-kafka.yaml`)},
+		},
+		{
+			name: "Valid config. Servers requiring different SASL mechanisms. The first one applies to all of them",
+			config: &KafkaProxy{
+				SASL: &SASL{Username: "user", Password: "pass"},
+			},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				assert.Equal(t, &kafka.SASLConfig{Mechanism: kafka.SASLMechanismScramSHA512, Username: "user", Password: "pass"}, c.SASL)
+				return nil
+			},
+			docs: [][]byte{[]byte(`testdata/sasl-scram-kafka.yaml`), []byte(`testdata/sasl-plain-kafka.yaml`)},
+		},
+		{
+			name: "Valid config. SASL from server extension",
+			config: &KafkaProxy{
+				SASL: &SASL{Username: "user", Password: "pass"},
+			},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				assert.Equal(t, &kafka.SASLConfig{Mechanism: kafka.SASLMechanismPlain, Username: "other-user", Password: "pass"}, c.SASL)
+				return nil
+			},
+			docs: [][]byte{[]byte(`testdata/sasl-extension-kafka.yaml`)},
+		},
+		{
+			name:        "Invalid config. Security scheme not found",
+			config:      &KafkaProxy{},
+			expectedErr: errors.New("error configuring SASL: security scheme missing required by server test not found in the provided AsyncAPI docs"),
+			docs:        [][]byte{[]byte(`testdata/sasl-missing-scheme-kafka.yaml`)},
+		},
+		{
+			name: "Valid config. Listener TLS for all servers",
+			config: &KafkaProxy{
+				ListenerTLS: &ListenerTLS{CertFile: "/etc/certs/server.crt", KeyFile: "/etc/certs/server.key", KeyPassword: "pass"},
+			},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				return &kafka.ProxyConfig{
+					BrokersMapping: []string{"broker.mybrokers.org:9092,:9092"},
+					ListenerTLS:    &kafka.ListenerTLSConfig{CertFile: "/etc/certs/server.crt", KeyFile: "/etc/certs/server.key", KeyPassword: "pass"},
+				}
+			},
+			docs: [][]byte{[]byte(`testdata/simple-kafka.yaml`)},
+		},
+		{
+			name: "Valid config. Listener TLS from server extension",
+			config: &KafkaProxy{
+				ListenerTLS: &ListenerTLS{KeyPassword: "pass"},
+			},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				return &kafka.ProxyConfig{
+					BrokersMapping: []string{"broker.mybrokers.org:9092,:9092"},
+					ListenerTLS:    &kafka.ListenerTLSConfig{CertFile: "/etc/certs/server.crt", KeyFile: "/etc/certs/server.key", KeyPassword: "pass", ClientCAFile: "/etc/certs/ca.crt"},
+				}
+			},
+			docs: [][]byte{[]byte(`testdata/listener-tls-kafka.yaml`)},
+		},
+		{
+			name:   "Valid config. Servers with different listener TLS config. The first one applies to all of them",
+			config: &KafkaProxy{},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				assert.Equal(t, &kafka.ListenerTLSConfig{CertFile: "/etc/certs/server.crt", KeyFile: "/etc/certs/server.key", ClientCAFile: "/etc/certs/ca.crt"}, c.ListenerTLS)
+				return nil
+			},
+			docs: [][]byte{[]byte(`testdata/listener-tls-kafka.yaml`), []byte(`testdata/another-server-kafka.yaml`)},
+		},
+		{
+			name: "Invalid config. Listener TLS without key file",
+			config: &KafkaProxy{
+				ListenerTLS: &ListenerTLS{CertFile: "/etc/certs/server.crt"},
+			},
+			expectedErr: errors.New("error configuring listener TLS: both cert and key files are required"),
+			docs:        [][]byte{[]byte(`testdata/simple-kafka.yaml`)},
+		},
+		{
+			name: "Valid config. Strict channels",
+			config: &KafkaProxy{
+				StrictChannels: kafka.PolicyModeEnforce,
+			},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				require.Len(t, c.ProducePolicies, 1)
+				assert.Equal(t, "strict-channels", c.ProducePolicies[0].Name)
+				assert.Equal(t, kafka.PolicyModeEnforce, c.ProducePolicies[0].Mode)
+				assert.NoError(t, c.ProducePolicies[0].Policy("client", "events"))
+				assert.Error(t, c.ProducePolicies[0].Policy("client", "undeclared"))
+				return nil
+			},
+			docs: [][]byte{[]byte(`testdata/simple-kafka.yaml`)},
+		},
+		{
+			name: "Valid config. Strict channels off",
+			config: &KafkaProxy{
+				StrictChannels: kafka.PolicyModeOff,
+			},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				assert.Empty(t, c.ProducePolicies)
+				return nil
+			},
+			docs: [][]byte{[]byte(`testdata/simple-kafka.yaml`)},
+		},
+		{
+			name: "Invalid config. Strict channels with unknown mode",
+			config: &KafkaProxy{
+				StrictChannels: "reject",
+			},
+			expectedErr: errors.New(`error configuring strict channels: policy mode "reject" is not valid. Valid values are off, observe and enforce`),
+			docs:        [][]byte{[]byte(`testdata/simple-kafka.yaml`)},
+		},
+		{
+			name: "Valid config. Strict channels + operation direction",
+			config: &KafkaProxy{
+				StrictChannels:     kafka.PolicyModeObserve,
+				OperationDirection: kafka.PolicyModeEnforce,
+			},
+			expectedProxyConfig: func(t *testing.T, c *kafka.ProxyConfig) *kafka.ProxyConfig {
+				require.Len(t, c.ProducePolicies, 2)
+				assert.Equal(t, "strict-channels", c.ProducePolicies[0].Name)
+				assert.Equal(t, kafka.PolicyModeObserve, c.ProducePolicies[0].Mode)
+				assert.Equal(t, "operation-direction", c.ProducePolicies[1].Name)
+				assert.Equal(t, kafka.PolicyModeEnforce, c.ProducePolicies[1].Mode)
+				return nil
+			},
+			docs: [][]byte{[]byte(`testdata/operation-direction-kafka.yaml`)},
+		},
+		{
+			name: "Invalid config. Operation direction with unknown mode",
+			config: &KafkaProxy{
+				OperationDirection: "reject",
+			},
+			expectedErr: errors.New(`error configuring operation direction: policy mode "reject" is not valid. Valid values are off, observe and enforce`),
+			docs:        [][]byte{[]byte(`testdata/simple-kafka.yaml`)},
 		},
 		{
 			name:        "Invalid config. Both broker and proxy are the same",
 			config:      &KafkaProxy{},
 			expectedErr: errors.New("broker and proxy can't listen to the same port on the same host. Broker is already listening at localhost:9092. Please configure a different listener port"),
-			doc:         []byte(`testdata/invalid-same-address.yaml`),
+			docs:        [][]byte{[]byte(`testdata/invalid-same-address.yaml`)},
 		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			proxyConfig, err := test.config.ProxyConfig(test.doc, false)
+			docs, err := decodeDocuments(test.docs...)
+			require.NoError(t, err)
+
+			proxyConfig, err := test.config.ProxyConfig(docs, false)
 			if test.expectedErr != nil {
 				assert.EqualError(t, err, test.expectedErr.Error())
 			} else {
@@ -103,3 +369,69 @@ func TestKafkaProxy_ProxyConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestKafkaProxy_ServerProxyConfig(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/simple-kafka.yaml`), []byte(`testdata/another-server-kafka.yaml`))
+	require.NoError(t, err)
+
+	c := &KafkaProxy{}
+	conf, err := c.ServerProxyConfig(docs, "other", false)
+	require.NoError(t, err)
+	assert.Equal(t, "other", conf.Name)
+	assert.Equal(t, []string{"another.mybrokers.org:9092,:9092"}, conf.BrokersMapping)
+	assert.Empty(t, c.BrokerFromServer, "the original config should not be modified")
+
+	_, err = c.ServerProxyConfig(docs, "unknown", false)
+	assert.EqualError(t, err, "server unknown not found in the provided AsyncAPI docs")
+}
+
+func TestKafkaProxy_ServerProxyConfig_listenerTLS(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/listener-tls-kafka.yaml`), []byte(`testdata/another-server-kafka.yaml`))
+	require.NoError(t, err)
+
+	c := &KafkaProxy{ListenerTLS: &ListenerTLS{CertFile: "/etc/certs/other.crt", KeyFile: "/etc/certs/other.key", KeyPassword: "pass"}}
+	tests := map[string]*kafka.ListenerTLSConfig{
+		"test":  {CertFile: "/etc/certs/server.crt", KeyFile: "/etc/certs/server.key", KeyPassword: "pass", ClientCAFile: "/etc/certs/ca.crt"},
+		"other": {CertFile: "/etc/certs/other.crt", KeyFile: "/etc/certs/other.key", KeyPassword: "pass"},
+	}
+	for server, expected := range tests {
+		conf, err := c.ServerProxyConfig(docs, server, false)
+		require.NoError(t, err)
+		assert.Equal(t, expected, conf.ListenerTLS, server)
+	}
+}
+
+func TestKafkaProxy_ServerProxyConfig_sasl(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/sasl-scram-kafka.yaml`), []byte(`testdata/sasl-plain-kafka.yaml`), []byte(`testdata/sasl-extension-kafka.yaml`))
+	require.NoError(t, err)
+
+	c := &KafkaProxy{SASL: &SASL{Username: "user", Password: "pass"}}
+	tests := map[string]*kafka.SASLConfig{
+		"test":     {Mechanism: kafka.SASLMechanismScramSHA512, Username: "user", Password: "pass"},
+		"plain":    {Mechanism: kafka.SASLMechanismPlain, Username: "user", Password: "pass"},
+		"override": {Mechanism: kafka.SASLMechanismPlain, Username: "other-user", Password: "pass"},
+	}
+	for server, expected := range tests {
+		conf, err := c.ServerProxyConfig(docs, server, false)
+		require.NoError(t, err)
+		assert.Equal(t, expected, conf.SASL, server)
+	}
+}
+
+func TestKeyMarshaler_Marshal(t *testing.T) {
+	msg := watermillmessage.NewMessage("uuid", []byte(`{"lumens":3}`))
+	record, err := keyMarshaler{}.Marshal("streetlights", msg)
+	require.NoError(t, err)
+	assert.Nil(t, record.Key)
+
+	msg.Metadata.Set(message.MetadataKey, "lamp-1")
+	record, err = keyMarshaler{}.Marshal("streetlights", msg)
+	require.NoError(t, err)
+	assert.Equal(t, sarama.StringEncoder("lamp-1"), record.Key)
+	for _, h := range record.Headers {
+		assert.NotEqual(t, message.MetadataKey, string(h.Key))
+	}
+
+	// The given message is left untouched.
+	assert.Equal(t, "lamp-1", msg.Metadata.Get(message.MetadataKey))
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"github.com/asyncapi/event-gateway/asyncapi"
+	v2 "github.com/asyncapi/event-gateway/asyncapi/v2"
+	"github.com/asyncapi/event-gateway/message/handler"
+	"github.com/asyncapi/event-gateway/mqtt"
+	"github.com/pkg/errors"
+)
+
+const defaultMQTTPort = "1883"
+
+// MQTTProxy holds the config for later configuring MQTT proxies.
+type MQTTProxy struct {
+	MessageValidation MQTTMessageValidation `yaml:"messageValidation" split_words:"true"`
+}
+
+// MQTTMessageValidation holds the config about validation of MQTT messages.
+type MQTTMessageValidation struct {
+	Enabled         bool `yaml:"enabled" desc:"Enable or disable validation of messages published by MQTT clients. Default is true"`
+	ValidationQueue `yaml:",inline"`
+}
+
+// NewMQTTProxy creates a MQTTProxy with defaults.
+func NewMQTTProxy() *MQTTProxy {
+	return &MQTTProxy{MessageValidation: MQTTMessageValidation{
+		Enabled:         true,
+		ValidationQueue: NewValidationQueue(),
+	}}
+}
+
+// ServerProxyConfig creates a config struct for the MQTT Proxy of the given server.
+func (c *MQTTProxy) ServerProxyConfig(docs []asyncapi.Document, server string, debug bool) (*mqtt.ProxyConfig, error) {
+	servers, err := servers(docs, server)
+	if err != nil {
+		return nil, err
+	}
+
+	s := servers[0]
+	brokerAddress, err := brokerAddress(s.URL(), defaultMQTTPort)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting address of broker %s. URL:%s", s.Name(), s.URL())
+	}
+
+	listenAt, err := listenAddress(s, brokerAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []mqtt.ProxyOption{
+		mqtt.WithName(s.Name()),
+		mqtt.WithDebug(debug),
+	}
+
+	if c.MessageValidation.Enabled {
+		validator, err := v2.FromDocsJSONSchemaMessageValidator(docs...)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating message validator")
+		}
+
+		opts = append(opts,
+			mqtt.WithMessageHandler(handler.ValidateMessage(validator, false)),
+			mqtt.WithValidationQueue(c.MessageValidation.ValidationQueue.config()),
+		)
+	}
+
+	return mqtt.NewProxyConfig(brokerAddress, listenAt, opts...)
+}
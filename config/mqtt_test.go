@@ -0,0 +1,73 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/asyncapi/event-gateway/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMQTTProxy_ServerProxyConfig(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/simple-mqtt.yaml`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name                  string
+		config                *MQTTProxy
+		server                string
+		expectedBrokerAddress string
+		expectedListenAddress string
+		expectedValidation    bool
+		expectedQueue         proxy.ValidationQueueConfig
+		expectedErr           string
+	}{
+		{
+			name:                  "Default port",
+			config:                NewMQTTProxy(),
+			server:                "mosquitto",
+			expectedBrokerAddress: "broker.mybrokers.org:1883",
+			expectedListenAddress: ":1883",
+			expectedValidation:    true,
+			expectedQueue:         proxy.ValidationQueueConfig{Workers: 1, Size: 100, FullPolicy: proxy.QueueFullPolicyBlock},
+		},
+		{
+			name: "Invalid validation queue",
+			config: &MQTTProxy{MessageValidation: MQTTMessageValidation{
+				Enabled:         true,
+				ValidationQueue: ValidationQueue{QueueFullPolicy: "drop"},
+			}},
+			server:      "mosquitto",
+			expectedErr: `invalid validation queue config: queue full policy "drop" is not valid. Valid values are block, drop-newest, drop-oldest and skip-validation`,
+		},
+		{
+			name:                  "Override listener port. Validation disabled",
+			config:                &MQTTProxy{},
+			server:                "override",
+			expectedBrokerAddress: "broker.mybrokers.org:1883",
+			expectedListenAddress: ":28883",
+		},
+		{
+			name:        "Unknown server",
+			config:      NewMQTTProxy(),
+			server:      "unknown",
+			expectedErr: "server unknown not found in the provided AsyncAPI docs",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := test.config.ServerProxyConfig(docs, test.server, false)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.server, c.Name)
+			assert.Equal(t, test.expectedBrokerAddress, c.BrokerAddress)
+			assert.Equal(t, test.expectedListenAddress, c.ListenAddress)
+			assert.Equal(t, test.expectedValidation, c.MessageHandler != nil)
+			assert.Equal(t, test.expectedQueue, c.ValidationQueue)
+		})
+	}
+}
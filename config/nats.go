@@ -0,0 +1,69 @@
+package config
+
+import (
+	"github.com/asyncapi/event-gateway/asyncapi"
+	v2 "github.com/asyncapi/event-gateway/asyncapi/v2"
+	"github.com/asyncapi/event-gateway/message/handler"
+	"github.com/asyncapi/event-gateway/nats"
+	"github.com/pkg/errors"
+)
+
+const defaultNATSPort = "4222"
+
+// NATSProxy holds the config for later configuring NATS proxies.
+type NATSProxy struct {
+	MessageValidation NATSMessageValidation `yaml:"messageValidation" split_words:"true"`
+}
+
+// NATSMessageValidation holds the config about validation of NATS messages.
+type NATSMessageValidation struct {
+	Enabled         bool `yaml:"enabled" desc:"Enable or disable validation of messages published by NATS clients. Default is true"`
+	ValidationQueue `yaml:",inline"`
+}
+
+// NewNATSProxy creates a NATSProxy with defaults.
+func NewNATSProxy() *NATSProxy {
+	return &NATSProxy{MessageValidation: NATSMessageValidation{
+		Enabled:         true,
+		ValidationQueue: NewValidationQueue(),
+	}}
+}
+
+// ServerProxyConfig creates a config struct for the NATS Proxy of the given server.
+func (c *NATSProxy) ServerProxyConfig(docs []asyncapi.Document, server string, debug bool) (*nats.ProxyConfig, error) {
+	servers, err := servers(docs, server)
+	if err != nil {
+		return nil, err
+	}
+
+	s := servers[0]
+	brokerAddress, err := brokerAddress(s.URL(), defaultNATSPort)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting address of broker %s. URL:%s", s.Name(), s.URL())
+	}
+
+	listenAt, err := listenAddress(s, brokerAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []nats.ProxyOption{
+		nats.WithName(s.Name()),
+		nats.WithDebug(debug),
+		nats.WithChannelResolver(nats.SubjectChannelResolver(channelPaths(docs)...)),
+	}
+
+	if c.MessageValidation.Enabled {
+		validator, err := v2.FromDocsJSONSchemaMessageValidator(docs...)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating message validator")
+		}
+
+		opts = append(opts,
+			nats.WithMessageHandler(handler.ValidateMessage(validator, false)),
+			nats.WithValidationQueue(c.MessageValidation.ValidationQueue.config()),
+		)
+	}
+
+	return nats.NewProxyConfig(brokerAddress, listenAt, opts...)
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNATSProxy_ServerProxyConfig(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/simple-nats.yaml`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name                  string
+		config                *NATSProxy
+		server                string
+		expectedBrokerAddress string
+		expectedListenAddress string
+		expectedValidation    bool
+		expectedErr           string
+	}{
+		{
+			name:                  "Default port",
+			config:                NewNATSProxy(),
+			server:                "demo",
+			expectedBrokerAddress: "demo.nats.io:4222",
+			expectedListenAddress: ":4222",
+			expectedValidation:    true,
+		},
+		{
+			name:                  "Override listener port. Validation disabled",
+			config:                &NATSProxy{},
+			server:                "override",
+			expectedBrokerAddress: "demo.nats.io:4222",
+			expectedListenAddress: ":24222",
+		},
+		{
+			name:        "Unknown server",
+			config:      NewNATSProxy(),
+			server:      "unknown",
+			expectedErr: "server unknown not found in the provided AsyncAPI docs",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := test.config.ServerProxyConfig(docs, test.server, false)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.server, c.Name)
+			assert.Equal(t, test.expectedBrokerAddress, c.BrokerAddress)
+			assert.Equal(t, test.expectedListenAddress, c.ListenAddress)
+			assert.Equal(t, test.expectedValidation, c.MessageHandler != nil)
+			assert.Equal(t, "smartylighting.streetlights.{streetlightId}.measured", c.ChannelResolver("smartylighting.streetlights.1.measured"))
+		})
+	}
+}
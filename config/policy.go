@@ -0,0 +1,222 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/asyncapi/event-gateway/asyncapi"
+	"github.com/asyncapi/event-gateway/kafka"
+	"github.com/pkg/errors"
+)
+
+const (
+	strictChannelsPolicyName     = "strict-channels"
+	operationDirectionPolicyName = "operation-direction"
+)
+
+var channelParameterRegex = regexp.MustCompile(`{[^{}]+}`)
+
+// channelParameterValueRegex matches the value of a channel parameter: a single segment of the topic.
+const channelParameterValueRegex = `[^./]+`
+
+// declaredChannelsPolicy creates a kafka.ProducePolicy that only allows producing to topics declared as channels in the given docs.
+// Channel parameters (i.e. `user.{userId}.signedup`) match any non-empty value.
+func declaredChannelsPolicy(docs []asyncapi.Document) (kafka.ProducePolicy, error) {
+	matcher, err := newChannelMatcher(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(_, topic string) error {
+		if _, ok := matcher.match(topic); !ok {
+			return fmt.Errorf("topic %s is not declared as channel in any AsyncAPI doc", topic)
+		}
+
+		return nil
+	}, nil
+}
+
+// channelProducers holds who is allowed to produce to a channel.
+type channelProducers struct {
+	// anyone is true if clients are allowed to produce, no matter their client ID.
+	anyone bool
+	// clientIDs allowed to produce.
+	clientIDs map[string]struct{}
+}
+
+// operationDirectionPolicy creates a kafka.ProducePolicy that only allows clients to produce to channels the docs declare
+// a publish operation for (meaning the application subscribes to them).
+// Channels the docs only declare for the application to publish can only be produced by the client IDs listed in the
+// x-eventgateway-client-ids extension of their operations. The same extension restricts which clients can produce to channels
+// with a publish operation.
+// Topics not declared as channels are allowed. See declaredChannelsPolicy for those.
+func operationDirectionPolicy(docs []asyncapi.Document) (kafka.ProducePolicy, error) {
+	matcher, err := newChannelMatcher(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	producers := make(map[string]*channelProducers)
+	for _, doc := range docs {
+		for _, c := range doc.Channels() {
+			p, ok := producers[c.ID()]
+			if !ok {
+				p = &channelProducers{clientIDs: make(map[string]struct{})}
+				producers[c.ID()] = p
+			}
+
+			for _, o := range c.Operations() {
+				clientIDs, err := operationClientIDs(o)
+				if err != nil {
+					return nil, errors.Wrapf(err, "error decoding %s extension of operation %s in channel %s", asyncapi.ExtensionEventGatewayClientIDs, o.ID(), c.ID())
+				}
+
+				for _, id := range clientIDs {
+					p.clientIDs[id] = struct{}{}
+				}
+
+				if o.IsClientPublishing() && len(clientIDs) == 0 {
+					p.anyone = true
+				}
+			}
+		}
+	}
+
+	return func(clientID, topic string) error {
+		channel, ok := matcher.match(topic)
+		if !ok {
+			return nil
+		}
+
+		p := producers[channel]
+		if p.anyone {
+			return nil
+		}
+
+		if _, ok := p.clientIDs[clientID]; ok {
+			return nil
+		}
+
+		if len(p.clientIDs) == 0 {
+			return fmt.Errorf("channel %s is only declared for the application to publish", channel)
+		}
+
+		return fmt.Errorf("client %q is not allowed to produce to channel %s. Allowed clients are %s", clientID, channel, strings.Join(p.sortedClientIDs(), ", "))
+	}, nil
+}
+
+func (p *channelProducers) sortedClientIDs() []string {
+	ids := make([]string, 0, len(p.clientIDs))
+	for id := range p.clientIDs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// operationClientIDs returns the client IDs declared in the x-eventgateway-client-ids extension of the given operation.
+// The extension value can be either a string or a list of strings.
+func operationClientIDs(o asyncapi.Operation) ([]string, error) {
+	switch v := o.Extension(asyncapi.ExtensionEventGatewayClientIDs).(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		clientIDs := make([]string, len(v))
+		for i, id := range v {
+			s, ok := id.(string)
+			if !ok {
+				return nil, fmt.Errorf("client ID %v should be a string", id)
+			}
+			clientIDs[i] = s
+		}
+		return clientIDs, nil
+	default:
+		return nil, fmt.Errorf("value should be either a string or a list of strings but is %T", v)
+	}
+}
+
+// channelMatcher finds the channel a topic belongs to.
+type channelMatcher struct {
+	channels      map[string]struct{}
+	parameterized []parameterizedChannel
+}
+
+type parameterizedChannel struct {
+	channel string
+	regex   *regexp.Regexp
+}
+
+func newChannelMatcher(docs []asyncapi.Document) (*channelMatcher, error) {
+	var channels []string
+	for _, doc := range docs {
+		for _, c := range doc.Channels() {
+			channels = append(channels, c.ID())
+		}
+	}
+
+	return channelMatcherOf(channels)
+}
+
+// channelMatcherOf creates a channelMatcher for the given channels.
+func channelMatcherOf(channels []string) (*channelMatcher, error) {
+	m := &channelMatcher{
+		channels: make(map[string]struct{}),
+	}
+
+	for _, c := range channels {
+		if !channelParameterRegex.MatchString(c) {
+			m.channels[c] = struct{}{}
+			continue
+		}
+
+		r, err := channelRegex(c)
+		if err != nil {
+			return nil, err
+		}
+
+		m.parameterized = append(m.parameterized, parameterizedChannel{channel: c, regex: r})
+	}
+
+	sort.Slice(m.parameterized, func(i, j int) bool {
+		return m.parameterized[i].channel < m.parameterized[j].channel
+	})
+
+	return m, nil
+}
+
+// match returns the channel the given topic belongs to, if any.
+// Channels without parameters take precedence.
+func (m *channelMatcher) match(topic string) (string, bool) {
+	if _, ok := m.channels[topic]; ok {
+		return topic, true
+	}
+
+	for _, p := range m.parameterized {
+		if p.regex.MatchString(topic) {
+			return p.channel, true
+		}
+	}
+
+	return "", false
+}
+
+// channelRegex creates a regex matching topics for the given channel, replacing its parameters by wildcards.
+// Each parameter matches a single segment, so it can't span the separators (`.` and `/`) between the literals.
+func channelRegex(channel string) (*regexp.Regexp, error) {
+	literals := channelParameterRegex.Split(channel, -1)
+	for i := range literals {
+		literals[i] = regexp.QuoteMeta(literals[i])
+	}
+
+	r, err := regexp.Compile("^" + strings.Join(literals, channelParameterValueRegex) + "$")
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating regex for channel %s", channel)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeclaredChannelsPolicy(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/simple-kafka.yaml`), []byte(`testdata/parameterized-channel-kafka.yaml`))
+	require.NoError(t, err)
+
+	policy, err := declaredChannelsPolicy(docs)
+	require.NoError(t, err)
+
+	tests := []struct {
+		topic       string
+		expectedErr string
+	}{
+		{topic: "events"},
+		{topic: "user.1234.signedup"},
+		{
+			topic:       "user.a.b.signedup",
+			expectedErr: "topic user.a.b.signedup is not declared as channel in any AsyncAPI doc",
+		},
+		{
+			topic:       "user.a/b.signedup",
+			expectedErr: "topic user.a/b.signedup is not declared as channel in any AsyncAPI doc",
+		},
+		{
+			topic:       "user..signedup",
+			expectedErr: "topic user..signedup is not declared as channel in any AsyncAPI doc",
+		},
+		{
+			topic:       "undeclared",
+			expectedErr: "topic undeclared is not declared as channel in any AsyncAPI doc",
+		},
+		{
+			topic:       "events-2",
+			expectedErr: "topic events-2 is not declared as channel in any AsyncAPI doc",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.topic, func(t *testing.T) {
+			err := policy("client", test.topic)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOperationDirectionPolicy(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/operation-direction-kafka.yaml`))
+	require.NoError(t, err)
+
+	policy, err := operationDirectionPolicy(docs)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		clientID    string
+		topic       string
+		expectedErr string
+	}{
+		{
+			name:     "Application producing to its own channel",
+			clientID: "orders-service",
+			topic:    "orders.created",
+		},
+		{
+			name:        "Rogue client producing to another application channel",
+			clientID:    "rogue",
+			topic:       "orders.created",
+			expectedErr: `client "rogue" is not allowed to produce to channel orders.created. Allowed clients are orders-backfill, orders-service`,
+		},
+		{
+			name:        "Any client producing to a channel only declared for the application to publish",
+			clientID:    "orders-service",
+			topic:       "notifications",
+			expectedErr: "channel notifications is only declared for the application to publish",
+		},
+		{
+			name:     "Any client producing to a channel the application subscribes to",
+			clientID: "rogue",
+			topic:    "payments.requested",
+		},
+		{
+			name:     "Allowed client producing to a restricted channel the application subscribes to",
+			clientID: "auditor",
+			topic:    "audit",
+		},
+		{
+			name:        "Not allowed client producing to a restricted channel the application subscribes to",
+			clientID:    "rogue",
+			topic:       "audit",
+			expectedErr: `client "rogue" is not allowed to produce to channel audit. Allowed clients are auditor`,
+		},
+		{
+			name:     "Application producing to its own parameterized channel",
+			clientID: "users-service",
+			topic:    "user.1234.signedup",
+		},
+		{
+			name:        "Rogue client producing to another application parameterized channel",
+			clientID:    "rogue",
+			topic:       "user.1234.signedup",
+			expectedErr: `client "rogue" is not allowed to produce to channel user.{userId}.signedup. Allowed clients are users-service`,
+		},
+		{
+			name:     "Undeclared topics are allowed",
+			clientID: "rogue",
+			topic:    "undeclared",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := policy(test.clientID, test.topic)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
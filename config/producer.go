@@ -0,0 +1,56 @@
+package config
+
+import (
+	"github.com/asyncapi/event-gateway/asyncapi"
+	v2 "github.com/asyncapi/event-gateway/asyncapi/v2"
+	"github.com/asyncapi/event-gateway/producer"
+	"github.com/pkg/errors"
+)
+
+// HTTPProducer holds the config for the HTTP API producing messages to Kafka.
+type HTTPProducer struct {
+	Port         int   `yaml:"port" desc:"Port for the HTTP produce API. Set to 0 for disabling it. Default is 0"`
+	MaxBodyBytes int64 `yaml:"maxBodyBytes" split_words:"true" desc:"Max size in bytes of the messages produced through the HTTP produce API. Default is 1048576"`
+}
+
+// NewHTTPProducer creates a HTTPProducer with defaults.
+func NewHTTPProducer() *HTTPProducer {
+	return &HTTPProducer{MaxBodyBytes: producer.DefaultMaxBodyBytes}
+}
+
+// HTTPProducerOptions creates the options for the HTTP produce API based on the given AsyncAPI docs.
+// Messages are validated against the channels of all docs and produced to the Kafka servers the Kafka proxy is configured for.
+// Only channels whose messages are validated (see v2.ValidatedChannels) are exposed, so no message is produced unvalidated.
+func (c App) HTTPProducerOptions(docs []asyncapi.Document) ([]producer.Opt, error) {
+	validator, err := v2.FromDocsJSONSchemaMessageValidator(docs...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating message validator")
+	}
+
+	validated, err := v2.ValidatedChannels(docs...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating message validator")
+	}
+
+	channels := make([]string, len(validated))
+	for i, v := range validated {
+		channels[i] = v.Channel
+	}
+
+	matcher, err := channelMatcherOf(channels)
+	if err != nil {
+		return nil, errors.Wrap(err, "error matching channels")
+	}
+
+	publisher, err := c.KafkaProxy.Publisher(docs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating Kafka publisher")
+	}
+
+	return []producer.Opt{
+		producer.WithChannelMatcher(matcher.match),
+		producer.WithValidator(validator),
+		producer.WithPublisher(publisher),
+		producer.WithMaxBodyBytes(c.HTTPProducer.MaxBodyBytes),
+	}, nil
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/producer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApp_HTTPProducerOptions(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).SetBroker(broker.Addr(), broker.BrokerID()),
+	})
+
+	doc := `
+asyncapi: '2.0.0'
+info:
+  title: Streetlights
+  version: '1.0.0'
+servers:
+  %s:
+    url: %s
+    protocol: %s
+channels:
+  streetlights:
+    publish:
+      message:
+        payload:
+          type: object`
+
+	tests := []struct {
+		name        string
+		doc         []byte
+		expectedErr string
+	}{
+		{
+			name: "Kafka server",
+			doc:  []byte(fmt.Sprintf(doc, "test", broker.Addr(), "kafka")),
+		},
+		{
+			name:        "No Kafka server",
+			doc:         []byte(fmt.Sprintf(doc, "mosquitto", "broker.mybrokers.org:1883", "mqtt")),
+			expectedErr: "error creating Kafka publisher: No Kafka brokers were found when configuring",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			docs, err := decodeDocuments(test.doc)
+			require.NoError(t, err)
+
+			opts, err := NewApp().HTTPProducerOptions(docs)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, opts, 4)
+			assert.NoError(t, producer.NewAPI(opts...).Close())
+		})
+	}
+}
+
+func TestApp_HTTPProducerOptions_channels(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).SetBroker(broker.Addr(), broker.BrokerID()),
+	})
+
+	doc := fmt.Sprintf(`
+asyncapi: '2.0.0'
+info:
+  title: Users
+  version: '1.0.0'
+servers:
+  test:
+    url: %s
+    protocol: kafka
+channels:
+  user.{userId}.signedup:
+    publish:
+      message:
+        payload:
+          type: object
+          required:
+            - email
+  user.{userId}.notified:
+    subscribe:
+      message:
+        payload:
+          type: object`, broker.Addr())
+
+	docs, err := decodeDocuments([]byte(doc))
+	require.NoError(t, err)
+
+	opts, err := NewApp().HTTPProducerOptions(docs)
+	require.NoError(t, err)
+
+	// Closing the Kafka publisher, replaced by a fake one.
+	defer func() { assert.NoError(t, producer.NewAPI(opts...).Close()) }()
+
+	publisher := &fakePublisher{}
+	api := producer.NewAPI(append(opts, producer.WithPublisher(publisher))...)
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "Topic of a parameterized channel",
+			path:           "/channels/user.1.signedup",
+			body:           `{"email":"me@example.com"}`,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "Invalid message of a parameterized channel",
+			path:           "/channels/user.1.signedup",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Channel without validated messages is not exposed",
+			path:           "/channels/user.1.notified",
+			body:           `{}`,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			api.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body)))
+			assert.Equal(t, test.expectedStatus, rec.Code)
+		})
+	}
+
+	assert.Equal(t, []string{"user.1.signedup"}, publisher.topics)
+}
+
+type fakePublisher struct {
+	topics []string
+}
+
+func (p *fakePublisher) Publish(topic string, _ ...*watermillmessage.Message) error {
+	p.topics = append(p.topics, topic)
+	return nil
+}
+
+func (p *fakePublisher) Close() error {
+	return nil
+}
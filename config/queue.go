@@ -0,0 +1,28 @@
+package config
+
+import "github.com/asyncapi/event-gateway/proxy"
+
+// ValidationQueue holds the config about the queue messages wait in until they are validated.
+// It is meant to be embedded inline in the message validation config of each proxy.
+type ValidationQueue struct {
+	Workers         int                   `yaml:"workers" desc:"Number of messages validated concurrently. Default is 1"`
+	QueueSize       int                   `yaml:"queueSize" split_words:"true" desc:"Number of messages that can wait for being validated. Default is 100"`
+	QueueFullPolicy proxy.QueueFullPolicy `yaml:"queueFullPolicy" split_words:"true" desc:"What happens to messages when the validation queue is full. Valid values are block, drop-newest, drop-oldest and skip-validation. Default is block"`
+}
+
+// NewValidationQueue creates a ValidationQueue with defaults.
+func NewValidationQueue() ValidationQueue {
+	return ValidationQueue{
+		Workers:         1,
+		QueueSize:       100,
+		QueueFullPolicy: proxy.QueueFullPolicyBlock,
+	}
+}
+
+func (q ValidationQueue) config() proxy.ValidationQueueConfig {
+	return proxy.ValidationQueueConfig{
+		Workers:    q.Workers,
+		Size:       q.QueueSize,
+		FullPolicy: q.QueueFullPolicy,
+	}
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/asyncapi/event-gateway/asyncapi"
+	"github.com/asyncapi/event-gateway/kafka"
+	"github.com/pkg/errors"
+)
+
+// ProduceQuotas holds the config about the quotas Kafka clients are subject to when producing.
+type ProduceQuotas struct {
+	Mode                      kafka.PolicyMode `yaml:"mode" desc:"Messages exceeding the max size are reported (observe) or rejected with MESSAGE_TOO_LARGE (enforce). Clients exceeding a max rate are reported (observe) or throttled (enforce). Valid values are off, observe and enforce. Default is off"`
+	MaxMessageBytes           int              `yaml:"maxMessageBytes" split_words:"true" desc:"Max size of messages produced to any topic, counting their key, value and headers. Channels can override it with the x-eventgateway-max-message-bytes extension. 0 means no limit. Default is 0"`
+	MaxRecordsPerSecond       float64          `yaml:"maxRecordsPerSecond" split_words:"true" desc:"Max number of records each client ID can produce per second to any topic. Channels can override it with the x-eventgateway-max-records-per-second extension. 0 means no limit. Default is 0"`
+	ClientMaxRecordsPerSecond float64          `yaml:"clientMaxRecordsPerSecond" split_words:"true" desc:"Max number of records each client ID can produce per second, no matter the topic. 0 means no limit. Default is 0"`
+}
+
+// produceQuotasOptions returns the options for configuring the produce quotas, if enabled.
+func (c *KafkaProxy) produceQuotasOptions(docs []asyncapi.Document) ([]kafka.ProxyOption, error) {
+	q := c.ProduceQuotas
+	if err := q.Mode.Validate(); err != nil {
+		return nil, errors.Wrap(err, "error configuring produce quotas")
+	}
+
+	if !q.Mode.IsEnabled() {
+		return nil, nil
+	}
+
+	if q.MaxMessageBytes < 0 || q.MaxRecordsPerSecond < 0 {
+		return nil, errors.New("error configuring produce quotas: max message bytes and max records per second should not be negative")
+	}
+
+	topicQuota, err := topicQuotas(docs, kafka.ProduceQuota{MaxMessageBytes: q.MaxMessageBytes, MaxRecordsPerSecond: q.MaxRecordsPerSecond})
+	if err != nil {
+		return nil, errors.Wrap(err, "error configuring produce quotas")
+	}
+
+	return []kafka.ProxyOption{kafka.WithProduceQuotas(kafka.ProduceQuotasConfig{
+		Mode:                      q.Mode,
+		TopicQuota:                topicQuota,
+		ClientMaxRecordsPerSecond: q.ClientMaxRecordsPerSecond,
+	})}, nil
+}
+
+// topicQuotas returns a function returning the quota of a topic. Channels override the given default quota with the
+// x-eventgateway-max-message-bytes and x-eventgateway-max-records-per-second extensions.
+func topicQuotas(docs []asyncapi.Document, defaultQuota kafka.ProduceQuota) (func(topic string) kafka.ProduceQuota, error) {
+	matcher, err := newChannelMatcher(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	quotas := make(map[string]kafka.ProduceQuota)
+	for _, doc := range docs {
+		for _, c := range doc.Channels() {
+			quota, err := channelQuota(c, defaultQuota)
+			if err != nil {
+				return nil, err
+			}
+
+			if existing, ok := quotas[c.ID()]; ok && existing != quota {
+				return nil, fmt.Errorf("conflicting quotas for channel %s: %+v and %+v", c.ID(), existing, quota)
+			}
+
+			quotas[c.ID()] = quota
+		}
+	}
+
+	return func(topic string) kafka.ProduceQuota {
+		if channel, ok := matcher.match(topic); ok {
+			return quotas[channel]
+		}
+
+		return defaultQuota
+	}, nil
+}
+
+func channelQuota(c asyncapi.Channel, defaultQuota kafka.ProduceQuota) (kafka.ProduceQuota, error) {
+	quota := defaultQuota
+	quota.Channel = c.ID()
+
+	maxBytes, ok, err := positiveNumberExtension(c, asyncapi.ExtensionEventGatewayMaxMessageBytes)
+	if err != nil {
+		return quota, err
+	}
+
+	if ok {
+		if maxBytes != float64(int(maxBytes)) {
+			return quota, fmt.Errorf("%s of channel %s should be an integer. Got %v", asyncapi.ExtensionEventGatewayMaxMessageBytes, c.ID(), maxBytes)
+		}
+		quota.MaxMessageBytes = int(maxBytes)
+	}
+
+	maxRecords, ok, err := positiveNumberExtension(c, asyncapi.ExtensionEventGatewayMaxRecordsPerSecond)
+	if err != nil {
+		return quota, err
+	}
+
+	if ok {
+		quota.MaxRecordsPerSecond = maxRecords
+	}
+
+	return quota, nil
+}
+
+// positiveNumberExtension returns the value of the given extension of the channel, if set.
+func positiveNumberExtension(c asyncapi.Channel, extension string) (float64, bool, error) {
+	var value float64
+	switch v := c.Extension(extension).(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		value = v
+	case int:
+		value = float64(v)
+	default:
+		return 0, false, fmt.Errorf("%s of channel %s should be a number. Got %v", extension, c.ID(), v)
+	}
+
+	if value <= 0 {
+		return 0, false, fmt.Errorf("%s of channel %s should be greater than 0. Got %v", extension, c.ID(), value)
+	}
+
+	return value, true, nil
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/asyncapi/event-gateway/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicQuotas(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/quotas-kafka.yaml`))
+	require.NoError(t, err)
+
+	topicQuota, err := topicQuotas(docs, kafka.ProduceQuota{MaxMessageBytes: 2048, MaxRecordsPerSecond: 10})
+	require.NoError(t, err)
+
+	assert.Equal(t, kafka.ProduceQuota{Channel: "clicks", MaxMessageBytes: 2048, MaxRecordsPerSecond: 100}, topicQuota("clicks"))
+	assert.Equal(t, kafka.ProduceQuota{Channel: "user.{userId}.signedup", MaxMessageBytes: 1024, MaxRecordsPerSecond: 0.5}, topicQuota("user.1234.signedup"))
+	assert.Equal(t, kafka.ProduceQuota{Channel: "events", MaxMessageBytes: 2048, MaxRecordsPerSecond: 10}, topicQuota("events"))
+	assert.Equal(t, kafka.ProduceQuota{MaxMessageBytes: 2048, MaxRecordsPerSecond: 10}, topicQuota("undeclared"))
+}
+
+func TestKafkaProxy_produceQuotasOptions(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/quotas-kafka.yaml`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		quotas       ProduceQuotas
+		expectedOpts int
+		expectedErr  string
+	}{
+		{
+			name: "Off by default",
+		},
+		{
+			name:         "Enabled",
+			quotas:       ProduceQuotas{Mode: kafka.PolicyModeEnforce, ClientMaxRecordsPerSecond: 1000},
+			expectedOpts: 1,
+		},
+		{
+			name:        "Invalid mode",
+			quotas:      ProduceQuotas{Mode: "reject"},
+			expectedErr: `error configuring produce quotas: policy mode "reject" is not valid. Valid values are off, observe and enforce`,
+		},
+		{
+			name:        "Negative limit",
+			quotas:      ProduceQuotas{Mode: kafka.PolicyModeObserve, MaxMessageBytes: -1},
+			expectedErr: "error configuring produce quotas: max message bytes and max records per second should not be negative",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewKafkaProxy()
+			c.ProduceQuotas = test.quotas
+
+			opts, err := c.produceQuotasOptions(docs)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, opts, test.expectedOpts)
+		})
+	}
+}
+
+func TestChannelQuota_invalidExtension(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/quotas-invalid-kafka.yaml`))
+	require.NoError(t, err)
+
+	_, err = topicQuotas(docs, kafka.ProduceQuota{})
+	assert.EqualError(t, err, "x-eventgateway-max-message-bytes of channel events should be an integer. Got 10.5")
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/asyncapi/event-gateway/asyncapi"
+	"github.com/asyncapi/event-gateway/message"
+)
+
+// Redaction holds the config about redaction of sensitive values of the messages included in validation error events.
+type Redaction struct {
+	Mode     message.RedactionMode `yaml:"mode" desc:"How sensitive values are redacted. Valid values are mask, hash (SHA-256) and drop (drops the whole payload, key and headers). Default is mask"`
+	Pointers pipeSeparatedValues   `yaml:"pointers" desc:"JSON pointers to sensitive values of the payload of messages of all channels, on top of the properties marked with x-eventgateway-sensitive. Token * matches any array item or property. Multiple values can be configured by using pipe separation (|)"`
+	Keys     bool                  `yaml:"keys" desc:"Redact message keys. Default is false"`
+	Headers  pipeSeparatedValues   `yaml:"headers" desc:"Names of the message headers to redact. * redacts all of them. Multiple values can be configured by using pipe separation (|)"`
+}
+
+// NewRedaction creates a Redaction with defaults.
+func NewRedaction() *Redaction {
+	return &Redaction{Mode: message.RedactionModeMask}
+}
+
+// Redactor creates a message.Redactor redacting the configured pointers and the properties marked as sensitive in the given docs,
+// plus the configured keys and headers.
+func (c App) Redactor(docs []asyncapi.Document) (*message.Redactor, error) {
+	opts := []message.RedactorOpt{message.WithHeaderRedaction(c.Redaction.Headers.Values...)}
+	if c.Redaction.Keys {
+		opts = append(opts, message.WithKeyRedaction())
+	}
+
+	return message.NewRedactor(c.Redaction.Mode, sensitivePointers(docs), c.Redaction.Pointers.Values, opts...)
+}
+
+// sensitivePointers returns the JSON pointers to the payload properties marked with the x-eventgateway-sensitive extension, indexed by channel.
+func sensitivePointers(docs []asyncapi.Document) map[string][]string {
+	pointers := make(map[string][]string)
+	for _, doc := range docs {
+		for _, c := range doc.Channels() {
+			seen := make(map[string]bool)
+			for _, m := range c.Messages() {
+				for _, p := range schemaSensitivePointers(m.Payload(), "", make(map[asyncapi.Schema]bool)) {
+					if !seen[p] {
+						seen[p] = true
+						pointers[c.ID()] = append(pointers[c.ID()], p)
+					}
+				}
+			}
+		}
+	}
+
+	return pointers
+}
+
+// schemaSensitivePointers walks the given schema, returning the pointers to the sensitive properties, prefixed by pointer.
+func schemaSensitivePointers(s asyncapi.Schema, pointer string, visited map[asyncapi.Schema]bool) []string {
+	if s == nil || visited[s] {
+		return nil
+	}
+	visited[s] = true
+	defer delete(visited, s)
+
+	if sensitive, ok := s.Extension(asyncapi.ExtensionEventGatewaySensitive).(bool); ok && sensitive {
+		return []string{pointer}
+	}
+
+	var pointers []string
+	for name, prop := range s.Properties() {
+		pointers = append(pointers, schemaSensitivePointers(prop, pointer+"/"+escapePointerToken(name), visited)...)
+	}
+
+	for _, items := range s.Items() {
+		pointers = append(pointers, schemaSensitivePointers(items, pointer+"/*", visited)...)
+	}
+
+	for _, subSchemas := range [][]asyncapi.Schema{s.AllOf(), s.AnyOf(), s.OneOf()} {
+		for _, sub := range subSchemas {
+			pointers = append(pointers, schemaSensitivePointers(sub, pointer, visited)...)
+		}
+	}
+
+	return pointers
+}
+
+func escapePointerToken(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"testing"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSensitivePointers(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/sensitive-kafka.yaml`))
+	require.NoError(t, err)
+
+	pointers := sensitivePointers(docs)
+	assert.ElementsMatch(t, []string{"/email", "/cards/*/number"}, pointers["signups"])
+	assert.Empty(t, pointers["events"])
+}
+
+func TestApp_Redactor(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/sensitive-kafka.yaml`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		redaction        *Redaction
+		channel          string
+		payload          string
+		metadata         map[string]string
+		expectedPayload  string
+		expectedMetadata map[string]string
+		expectedErr      string
+	}{
+		{
+			name:            "Sensitive properties are masked",
+			redaction:       NewRedaction(),
+			channel:         "signups",
+			payload:         `{"email":"foo@bar.com","name":"foo","cards":[{"number":"1234"}]}`,
+			expectedPayload: `{"cards":[{"number":"<redacted>"}],"email":"<redacted>","name":"foo"}`,
+		},
+		{
+			name:            "Configured pointers apply to all channels",
+			redaction:       &Redaction{Mode: message.RedactionModeMask, Pointers: pipeSeparatedValues{Values: []string{"/id"}}},
+			channel:         "events",
+			payload:         `{"id":1}`,
+			expectedPayload: `{"id":"<redacted>"}`,
+		},
+		{
+			name:             "Keys and headers are kept by default",
+			redaction:        NewRedaction(),
+			channel:          "events",
+			payload:          `{"id":1}`,
+			metadata:         map[string]string{message.MetadataKey: "user-1", "email": "foo@bar.com"},
+			expectedPayload:  `{"id":1}`,
+			expectedMetadata: map[string]string{message.MetadataKey: "user-1", "email": "foo@bar.com"},
+		},
+		{
+			name:             "Configured keys and headers are masked",
+			redaction:        &Redaction{Mode: message.RedactionModeMask, Keys: true, Headers: pipeSeparatedValues{Values: []string{"email"}}},
+			channel:          "events",
+			payload:          `{"id":1}`,
+			metadata:         map[string]string{message.MetadataKey: "user-1", "email": "foo@bar.com", "source": "web"},
+			expectedPayload:  `{"id":1}`,
+			expectedMetadata: map[string]string{message.MetadataKey: message.Redacted, "email": message.Redacted, "source": "web"},
+		},
+		{
+			name:        "Unknown mode",
+			redaction:   &Redaction{Mode: "encrypt"},
+			expectedErr: `unknown redaction mode "encrypt". Valid values are mask, hash and drop`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewApp()
+			app.Redaction = test.redaction
+
+			redactor, err := app.Redactor(docs)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			msg := watermillmessage.NewMessage("test", []byte(test.payload))
+			msg.Metadata.Set(message.MetadataChannel, test.channel)
+			for k, v := range test.metadata {
+				msg.Metadata.Set(k, v)
+			}
+
+			redacted := redactor.Redact(msg)
+			assert.JSONEq(t, test.expectedPayload, string(redacted.Payload))
+			for k, v := range test.expectedMetadata {
+				assert.Equal(t, v, redacted.Metadata.Get(k))
+			}
+		})
+	}
+}
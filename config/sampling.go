@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/asyncapi/event-gateway/asyncapi"
+	"github.com/asyncapi/event-gateway/message"
+)
+
+// ValidationSampling holds the config about sampling of the messages validated by the proxies.
+type ValidationSampling struct {
+	Rate  float64 `yaml:"rate" desc:"Fraction of the messages of each channel to be validated, from 0 (none) to 1 (all). Channels can override it with the x-eventgateway-validation-sample-rate extension. Default is 1"`
+	ByKey bool    `yaml:"byKey" split_words:"true" desc:"Sample messages deterministically by key, so messages with the same key are either all validated or all skipped. Messages without key are sampled randomly. Default is false"`
+}
+
+// NewValidationSampling creates a ValidationSampling with defaults.
+func NewValidationSampling() *ValidationSampling {
+	return &ValidationSampling{Rate: 1}
+}
+
+// Sampler creates a message.Sampler with the configured rate, overridden by the rates set in the channels of the given docs.
+func (c App) Sampler(docs []asyncapi.Document) (*message.Sampler, error) {
+	rates, err := channelSampleRates(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	return message.NewSampler(c.ValidationSampling.Rate, message.WithChannelSampleRates(rates), message.WithSamplingByKey(c.ValidationSampling.ByKey))
+}
+
+// channelSampleRates returns the sampling rates set with the x-eventgateway-validation-sample-rate extension, indexed by channel.
+func channelSampleRates(docs []asyncapi.Document) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	for _, doc := range docs {
+		for _, c := range doc.Channels() {
+			raw := c.Extension(asyncapi.ExtensionEventGatewayValidationSampleRate)
+			if raw == nil {
+				continue
+			}
+
+			var rate float64
+			switch v := raw.(type) {
+			case float64:
+				rate = v
+			case int:
+				rate = float64(v)
+			default:
+				return nil, fmt.Errorf("%s of channel %s should be a number. Got %v", asyncapi.ExtensionEventGatewayValidationSampleRate, c.ID(), raw)
+			}
+
+			if existing, ok := rates[c.ID()]; ok && existing != rate {
+				return nil, fmt.Errorf("conflicting %s for channel %s: %v and %v", asyncapi.ExtensionEventGatewayValidationSampleRate, c.ID(), existing, rate)
+			}
+
+			rates[c.ID()] = rate
+		}
+	}
+
+	return rates, nil
+}
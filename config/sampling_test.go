@@ -0,0 +1,31 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelSampleRates(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/sampling-kafka.yaml`))
+	require.NoError(t, err)
+
+	rates, err := channelSampleRates(docs)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"clicks": 0.01, "orders": 1}, rates)
+}
+
+func TestApp_Sampler(t *testing.T) {
+	docs, err := decodeDocuments([]byte(`testdata/sampling-kafka.yaml`))
+	require.NoError(t, err)
+
+	app := NewApp()
+	app.ValidationSampling.Rate = 0.5
+	_, err = app.Sampler(docs)
+	assert.NoError(t, err)
+
+	app.ValidationSampling.Rate = 2
+	_, err = app.Sampler(docs)
+	assert.EqualError(t, err, "sampling rate 2 should be between 0 and 1")
+}
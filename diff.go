@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/asyncapi/event-gateway/asyncapi"
+	"github.com/asyncapi/event-gateway/asyncapi/diff"
+	v2 "github.com/asyncapi/event-gateway/asyncapi/v2"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// runDiff compares two versions of an AsyncAPI document, printing their changes.
+// It fails if any change breaks the producers or consumers given by the -fail-on flag.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	format := fs.String("format", "text", "Output format. Valid values are text and json")
+	failOn := fs.String("fail-on", "any", "Fail if there are changes breaking them. Valid values are producers, consumers, any and none")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "Usage: event-gateway diff [flags] <old doc> <new doc>")
+		_, _ = fmt.Fprintln(fs.Output(), "Compares two versions of an AsyncAPI doc, classifying their changes as breaking or compatible for producers and consumers.")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() != 2 || (*format != "text" && *format != "json") {
+		fs.Usage()
+		return exitUsage
+	}
+
+	breaks, ok := map[string]func(diff.Change) bool{
+		"producers": func(c diff.Change) bool { return c.Producers == diff.ImpactBreaking },
+		"consumers": func(c diff.Change) bool { return c.Consumers == diff.ImpactBreaking },
+		"any":       diff.Change.IsBreaking,
+		"none":      func(diff.Change) bool { return false },
+	}[*failOn]
+	if !ok {
+		fs.Usage()
+		return exitUsage
+	}
+
+	from, err := decodeDocument(fs.Arg(0))
+	if err != nil {
+		logrus.WithError(err).Error()
+		return exitUsage
+	}
+
+	to, err := decodeDocument(fs.Arg(1))
+	if err != nil {
+		logrus.WithError(err).Error()
+		return exitUsage
+	}
+
+	changes := diff.Documents(from, to)
+	if err := printChanges(changes, *format); err != nil {
+		logrus.WithError(err).Error()
+		return exitFailure
+	}
+
+	for _, c := range changes {
+		if breaks(c) {
+			return exitFailure
+		}
+	}
+
+	return exitOK
+}
+
+func printChanges(changes diff.Changes, format string) error {
+	if format == "json" {
+		if changes == nil {
+			changes = diff.Changes{}
+		}
+
+		out, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "error marshaling changes")
+		}
+
+		_, err = fmt.Fprintln(os.Stdout, string(out))
+		return err
+	}
+
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(os.Stdout, "No changes")
+		return err
+	}
+
+	for _, c := range changes {
+		if _, err := fmt.Fprintln(os.Stdout, c.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeDocument decodes the AsyncAPI doc at the given path or URL.
+func decodeDocument(pathOrURL string) (asyncapi.Document, error) {
+	doc := new(v2.Document)
+	if err := v2.Decode([]byte(pathOrURL), doc); err != nil {
+		return nil, errors.Wrapf(err, "error decoding AsyncAPI doc %s", pathOrURL)
+	}
+
+	return doc, nil
+}
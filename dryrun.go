@@ -0,0 +1,193 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/asyncapi/event-gateway/amqp"
+	"github.com/asyncapi/event-gateway/asyncapi"
+	"github.com/asyncapi/event-gateway/config"
+	"github.com/asyncapi/event-gateway/kafka"
+	"github.com/asyncapi/event-gateway/mqtt"
+	"github.com/asyncapi/event-gateway/nats"
+	"github.com/asyncapi/event-gateway/proxy"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// runDryRun resolves the config of the proxies the gateway would run, printing their broker mappings, listeners and
+// advertised addresses. No socket is opened, so no broker is needed. It fails if the config is invalid.
+func runDryRun(args []string) int {
+	fs := flag.NewFlagSet("dry-run", flag.ContinueOnError)
+	configFile := configFlag(fs)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "Usage: event-gateway dry-run [flags]")
+		_, _ = fmt.Fprintln(fs.Output(), "Prints the proxies the Event-Gateway would run for the current config, without opening any socket.")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	c, err := loadConfig(*configFile)
+	if err != nil {
+		logrus.WithError(err).Error()
+		return exitUsage
+	}
+
+	if !c.Debug {
+		// Warnings about the config are meant for running the gateway. Errors are still logged.
+		logrus.SetLevel(logrus.ErrorLevel)
+	}
+
+	if err := dryRun(os.Stdout, c); err != nil {
+		logrus.WithError(err).Error()
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+// dryRun writes to w the proxies the gateway would run for the given config.
+func dryRun(w io.Writer, c *config.App) error {
+	docs, err := c.Documents()
+	if err != nil {
+		return err
+	}
+
+	servers, err := c.Servers(docs)
+	if err != nil {
+		return err
+	}
+
+	printers := make(map[string]func(asyncapi.Server) ([]string, error))
+	register := func(printer func(asyncapi.Server) ([]string, error), protocols ...string) {
+		for _, p := range protocols {
+			printers[p] = printer
+		}
+	}
+
+	register(func(s asyncapi.Server) ([]string, error) {
+		return dryRunKafka(c, docs, s)
+	}, kafka.Protocols...)
+	register(func(s asyncapi.Server) ([]string, error) {
+		conf, err := c.MQTTProxy.ServerProxyConfig(docs, s.Name(), c.Debug)
+		if err != nil {
+			return nil, err
+		}
+		return tcpProxyLines(conf.BrokerAddress, conf.ListenAddress, conf.Messages()), nil
+	}, mqtt.Protocols...)
+	register(func(s asyncapi.Server) ([]string, error) {
+		conf, err := c.AMQPProxy.ServerProxyConfig(docs, s.Name(), c.Debug)
+		if err != nil {
+			return nil, err
+		}
+		return tcpProxyLines(conf.BrokerAddress, conf.ListenAddress, conf.Messages()), nil
+	}, amqp.Protocols...)
+	register(func(s asyncapi.Server) ([]string, error) {
+		conf, err := c.NATSProxy.ServerProxyConfig(docs, s.Name(), c.Debug)
+		if err != nil {
+			return nil, err
+		}
+		return tcpProxyLines(conf.BrokerAddress, conf.ListenAddress, conf.Messages()), nil
+	}, nats.Protocols...)
+
+	for _, s := range servers {
+		lines := []string{fmt.Sprintf("Server %s (%s)", s.Name(), s.Protocol())}
+		printer, ok := printers[strings.ToLower(s.Protocol())]
+		if !ok {
+			lines = append(lines, "  not proxied: protocol is not supported")
+		} else {
+			serverLines, err := printer(s)
+			if err != nil {
+				return errors.Wrapf(err, "error configuring proxy for server %s", s.Name())
+			}
+			lines = append(lines, serverLines...)
+		}
+
+		if err := writeLines(w, lines...); err != nil {
+			return err
+		}
+	}
+
+	return writeLines(w, httpServerLines(c)...)
+}
+
+func dryRunKafka(c *config.App, docs []asyncapi.Document, s asyncapi.Server) ([]string, error) {
+	conf, err := c.KafkaProxy.ServerProxyConfig(docs, s.Name(), c.Debug)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, l := range conf.BrokerListeners() {
+		lines = append(lines, fmt.Sprintf("  broker %s: listening at %s, advertised as %s", l.Broker, l.ListenAt, l.AdvertisedAs))
+	}
+
+	for _, m := range conf.DialAddressMapping {
+		lines = append(lines, fmt.Sprintf("  dial address mapping: %s", strings.Replace(m, ",", " -> ", 1)))
+	}
+
+	lines = append(lines, messageValidationLines(conf.MessageHandler != nil, conf.ValidationQueue)...)
+
+	if errorsTopic := c.KafkaProxy.MessageValidation.PublishToKafkaTopic; conf.MessageHandler != nil && errorsTopic != "" {
+		lines = append(lines, fmt.Sprintf("  invalid messages produced to topic %s", errorsTopic))
+	}
+
+	for _, p := range conf.ProducePolicies {
+		lines = append(lines, fmt.Sprintf("  produce policy %s: %s", p.Name, p.Mode))
+	}
+
+	if conf.ProduceQuotas != nil {
+		lines = append(lines, fmt.Sprintf("  produce quotas: %s", conf.ProduceQuotas.Mode))
+	}
+
+	return lines, nil
+}
+
+func tcpProxyLines(brokerAddress, listenAddress string, m *proxy.MessageConfig) []string {
+	lines := []string{fmt.Sprintf("  broker %s: listening at %s", brokerAddress, listenAddress)}
+	return append(lines, messageValidationLines(m.MessageHandler != nil, m.ValidationQueue)...)
+}
+
+func messageValidationLines(enabled bool, q proxy.ValidationQueueConfig) []string {
+	if !enabled {
+		return []string{"  message validation: disabled"}
+	}
+
+	return []string{
+		"  message validation: enabled",
+		fmt.Sprintf("  validation queue: %d workers, %d messages, %s when full", q.Workers, q.Size, q.FullPolicy),
+	}
+}
+
+func httpServerLines(c *config.App) []string {
+	lines := []string{fmt.Sprintf("Websocket server listening at :%d", c.WSServerPort)}
+	if c.WSBridge.Enabled {
+		lines = append(lines, fmt.Sprintf("  subscriptions to channels at :%d/ws/channels", c.WSServerPort))
+	}
+
+	if c.AdminPort > 0 {
+		lines = append(lines, fmt.Sprintf("Admin API listening at :%d", c.AdminPort))
+	}
+
+	if c.HTTPProducer.Port > 0 {
+		lines = append(lines, fmt.Sprintf("HTTP produce API listening at :%d", c.HTTPProducer.Port))
+	}
+
+	return lines
+}
+
+func writeLines(w io.Writer, lines ...string) error {
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(w, l); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
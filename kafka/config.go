@@ -3,21 +3,36 @@ package kafka
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"regexp"
+	"strconv"
 	"strings"
 
 	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/asyncapi/event-gateway/proxy"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 var localHostIpv4 = regexp.MustCompile(`127\.0\.0\.\d+`)
 
+// errUnsupportedFlag is the error returned when setting an extra flag the proxy doesn't know about.
+var errUnsupportedFlag = errors.New("flag is not supported")
+
+// supportedFlags lists the extra flags the proxy knows about. See extraConfig.set.
+var supportedFlags = []string{
+	"default-listener-ip", "dynamic-advertised-listener", "dynamic-sequential-min-port", "forbidden-api-keys", "dial-address-mapping",
+	"tls-enable", "tls-insecure-skip-verify", "tls-client-cert-file", "tls-client-key-file", "tls-ca-chain-cert-file",
+}
+
 // ProxyConfig holds the configuration for the Kafka Proxy.
 type ProxyConfig struct {
+	// Name of the proxy. Usually the name of the AsyncAPI server it proxies. Default is kafka.
+	Name string
 	// Address for this proxy. Should be reachable by your clients. Most probably a domain name.
 	// If not set, 0.0.0.0 will be used.
 	Address            string
@@ -28,17 +43,34 @@ type ProxyConfig struct {
 	MessagePublisher   watermillmessage.Publisher
 	PublishToTopic     string
 	MessageSubscriber  watermillmessage.Subscriber
-	TLS                *TLSConfig
-	Debug              bool
+	// ValidationQueue configures the queue produced messages wait in until being handled by MessageHandler.
+	ValidationQueue proxy.ValidationQueueConfig
+	// Sampler decides which produced messages are handled by MessageHandler. All of them if not set.
+	// Records are sampled before being turned into messages, so skipped ones never reach the ValidationQueue.
+	Sampler         *message.Sampler
+	TLS             *TLSConfig
+	SASL            *SASLConfig
+	ListenerTLS     *ListenerTLSConfig
+	ProducePolicies []ProducePolicyConfig
+	ProduceQuotas   *ProduceQuotasConfig
+	// ProduceRates tracks the rates of ProduceQuotas. Proxies running side by side should share it.
+	// If not set, the proxy uses its own.
+	ProduceRates *ProduceRates
+	// PolicyViolationHandler is called for every policy violation, no matter if the request is rejected or not.
+	PolicyViolationHandler PolicyViolationHandler
+	// DynamicPorts hands out the ports of dynamic listeners. Proxies running side by side should share it.
+	// If not set, the proxy uses its own.
+	DynamicPorts *DynamicPorts
+	Debug        bool
 }
 
 // TLSConfig holds configuration for TLS.
 type TLSConfig struct {
-	Enable             bool
-	InsecureSkipVerify bool   `split_words:"true"`
-	ClientCertFile     string `split_words:"true"`
-	ClientKeyFile      string `split_words:"true"`
-	CAChainCertFile    string `split_words:"true"`
+	Enable             bool   `yaml:"enable"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify" split_words:"true"`
+	ClientCertFile     string `yaml:"clientCertFile" split_words:"true"`
+	ClientKeyFile      string `yaml:"clientKeyFile" split_words:"true"`
+	CAChainCertFile    string `yaml:"caChainCertFile" split_words:"true"`
 }
 
 // Config returns a *tls.Config based on current config.
@@ -69,9 +101,116 @@ func (c *TLSConfig) Config() (*tls.Config, error) {
 	return cfg, nil
 }
 
+// ListenerTLSConfig holds configuration for TLS termination on the proxy listeners, meaning the connection from clients to the proxy.
+type ListenerTLSConfig struct {
+	CertFile    string `mapstructure:"certFile"`
+	KeyFile     string `mapstructure:"keyFile"`
+	KeyPassword string `mapstructure:"keyPassword"`
+	// ClientCAFile enables mTLS. If set, clients should present a certificate signed by this CA.
+	ClientCAFile string `mapstructure:"clientCAFile"`
+}
+
+// Validate validates ListenerTLSConfig.
+func (c *ListenerTLSConfig) Validate() error {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.New("both cert and key files are required")
+	}
+
+	return nil
+}
+
+// Config returns a *tls.Config for the listeners based on current config.
+// Files are reloaded on handshakes whenever they change, meaning certificates can be rotated without restarting the proxy.
+// They are checked at most once per second.
+func (c *ListenerTLSConfig) Config() (*tls.Config, error) {
+	r, err := newListenerTLSReloader(c, listenerTLSCheckInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{MinVersion: tls.VersionTLS12, GetConfigForClient: r.configForClient}, nil
+}
+
+// files returns the files the TLS config is built from.
+func (c *ListenerTLSConfig) files() []string {
+	files := []string{c.CertFile, c.KeyFile}
+	if c.ClientCAFile != "" {
+		files = append(files, c.ClientCAFile)
+	}
+
+	return files
+}
+
+// load reads the files and builds the TLS config from them.
+func (c *ListenerTLSConfig) load() (*tls.Config, error) {
+	certPEMBlock, err := ioutil.ReadFile(c.CertFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading cert file")
+	}
+
+	keyPEMBlock, err := ioutil.ReadFile(c.KeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading key file")
+	}
+
+	if c.KeyPassword != "" {
+		keyPEMBlock, err = decryptPEM(keyPEMBlock, c.KeyPassword)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decrypting key")
+		}
+	}
+
+	cert, err := tls.X509KeyPair(certPEMBlock, keyPEMBlock)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading key pair")
+	}
+
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.ClientCAFile != "" {
+		caCertPEMBlock, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading client CA file")
+		}
+
+		clientCAs := x509.NewCertPool()
+		if ok := clientCAs.AppendCertsFromPEM(caCertPEMBlock); !ok {
+			return nil, errors.New("Failed to parse client CA certificate")
+		}
+
+		cfg.ClientCAs = clientCAs
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// decryptPEM decrypts a password protected PEM encoded private key.
+func decryptPEM(pemData []byte, password string) ([]byte, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	//nolint:staticcheck // Legacy PEM encryption is the format supported by the Kafka ecosystem tooling.
+	der, err := x509.DecryptPEMBlock(block, []byte(password))
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+}
+
 // ProxyOption represents a functional configuration for the Proxy.
 type ProxyOption func(*ProxyConfig) error
 
+// WithName configures the name of the proxy.
+func WithName(name string) ProxyOption {
+	return func(c *ProxyConfig) error {
+		c.Name = name
+		return nil
+	}
+}
+
 // WithMessageHandler configures a handler that will handle all incoming messages.
 func WithMessageHandler(handler watermillmessage.HandlerFunc) ProxyOption {
 	return func(c *ProxyConfig) error {
@@ -97,6 +236,42 @@ func WithMessageSubscriber(subscriber watermillmessage.Subscriber) ProxyOption {
 	}
 }
 
+// WithValidationQueue configures the queue produced messages wait in until being handled.
+func WithValidationQueue(queue proxy.ValidationQueueConfig) ProxyOption {
+	return func(c *ProxyConfig) error {
+		if err := queue.Validate(); err != nil {
+			return errors.Wrap(err, "invalid validation queue config")
+		}
+
+		c.ValidationQueue = queue
+		return nil
+	}
+}
+
+// WithDynamicPorts configures the allocator handing out the ports of dynamic listeners.
+func WithDynamicPorts(ports *DynamicPorts) ProxyOption {
+	return func(c *ProxyConfig) error {
+		c.DynamicPorts = ports
+		return nil
+	}
+}
+
+// WithProduceRates configures the tracker of the rates clients produce at.
+func WithProduceRates(rates *ProduceRates) ProxyOption {
+	return func(c *ProxyConfig) error {
+		c.ProduceRates = rates
+		return nil
+	}
+}
+
+// WithSampler configures the sampler deciding which produced messages are handled.
+func WithSampler(sampler *message.Sampler) ProxyOption {
+	return func(c *ProxyConfig) error {
+		c.Sampler = sampler
+		return nil
+	}
+}
+
 // WithDebug enables/disables debug.
 func WithDebug(enabled bool) ProxyOption {
 	return func(c *ProxyConfig) error {
@@ -113,6 +288,46 @@ func WithDialAddressMapping(mapping []string) ProxyOption {
 	}
 }
 
+// WithSASL configures SASL authentication against the brokers.
+func WithSASL(sasl *SASLConfig) ProxyOption {
+	return func(c *ProxyConfig) error {
+		c.SASL = sasl
+		return nil
+	}
+}
+
+// WithListenerTLS configures TLS termination on the proxy listeners.
+func WithListenerTLS(tls *ListenerTLSConfig) ProxyOption {
+	return func(c *ProxyConfig) error {
+		c.ListenerTLS = tls
+		return nil
+	}
+}
+
+// WithProducePolicy configures a policy checked on every Produce request.
+func WithProducePolicy(name string, mode PolicyMode, policy ProducePolicy) ProxyOption {
+	return func(c *ProxyConfig) error {
+		if err := mode.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid mode for policy %s", name)
+		}
+
+		c.ProducePolicies = append(c.ProducePolicies, ProducePolicyConfig{Name: name, Mode: mode, Policy: policy})
+		return nil
+	}
+}
+
+// WithProduceQuotas configures the quotas clients are subject to when producing.
+func WithProduceQuotas(quotas ProduceQuotasConfig) ProxyOption {
+	return func(c *ProxyConfig) error {
+		if err := quotas.Validate(); err != nil {
+			return errors.Wrap(err, "invalid produce quotas")
+		}
+
+		c.ProduceQuotas = &quotas
+		return nil
+	}
+}
+
 // WithExtra configures extra parameters.
 func WithExtra(extra []string) ProxyOption {
 	return func(c *ProxyConfig) error {
@@ -133,6 +348,44 @@ func NewProxyConfig(brokersMapping []string, opts ...ProxyOption) (*ProxyConfig,
 	return c, c.Validate()
 }
 
+// BrokerListener holds the addresses the proxy uses for a bootstrap broker.
+type BrokerListener struct {
+	Broker string `json:"broker"`
+	// ListenAt is the address the proxy listens at for clients of the broker.
+	ListenAt string `json:"listenAt"`
+	// AdvertisedAs is the address the broker is advertised as to clients, so they reach it through the proxy.
+	AdvertisedAs string `json:"advertisedAs"`
+}
+
+// BrokerListeners resolves the listeners of the bootstrap brokers without opening any socket.
+// Listeners of brokers discovered at runtime are not included.
+func (c *ProxyConfig) BrokerListeners() []BrokerListener {
+	reachableAddress := c.Address
+	if reachableAddress == "" {
+		reachableAddress = defaultLocalAddress
+	}
+
+	listeners := make([]BrokerListener, 0, len(c.BrokersMapping))
+	for _, v := range c.BrokersMapping {
+		values := strings.Split(v, ",")
+		l := BrokerListener{
+			Broker:       strings.TrimSpace(values[0]),
+			ListenAt:     strings.TrimSpace(values[1]),
+			AdvertisedAs: strings.TrimSpace(values[1]),
+		}
+
+		// Advertise brokers using the proxy address so Kafka clients can reach the brokers through the proxy.
+		host, port, _ := net.SplitHostPort(l.ListenAt)
+		if reachableAddress != defaultLocalAddress || host == "" {
+			l.AdvertisedAs = net.JoinHostPort(reachableAddress, port)
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	return listeners
+}
+
 // Validate validates ProxyConfig.
 func (c *ProxyConfig) Validate() error {
 	if len(c.BrokersMapping) == 0 {
@@ -161,6 +414,28 @@ func (c *ProxyConfig) Validate() error {
 		}
 	}
 
+	if c.SASL != nil {
+		if err := c.SASL.Validate(); err != nil {
+			return errors.Wrap(err, "invalid SASL config")
+		}
+	}
+
+	if c.ListenerTLS != nil {
+		if err := c.ListenerTLS.Validate(); err != nil {
+			return errors.Wrap(err, "invalid listener TLS config")
+		}
+	}
+
+	if err := c.ValidationQueue.Validate(); err != nil {
+		return errors.Wrap(err, "invalid validation queue config")
+	}
+
+	if c.ProduceQuotas != nil {
+		if err := c.ProduceQuotas.Validate(); err != nil {
+			return errors.Wrap(err, "invalid produce quotas")
+		}
+	}
+
 	if c.MessageHandler == nil {
 		logrus.Warn("There is no message handler configured")
 		return nil
@@ -178,3 +453,101 @@ func isLocalHost(host string) bool {
 		localHostIpv4.MatchString(host) ||
 		host == "localhost"
 }
+
+// extraConfig holds the advanced configuration set through ProxyConfig.ExtraConfig.
+// Flags are named after the kafka-proxy ones (https://github.com/grepplabs/kafka-proxy) for backwards compatibility.
+type extraConfig struct {
+	// defaultListenerIP is the IP dynamic listeners bind to.
+	defaultListenerIP string
+	// dynamicAdvertisedListener is the host dynamic listeners are advertised with.
+	dynamicAdvertisedListener string
+	// dynamicSequentialMinPort is the first port dynamic listeners bind to. Random ports are used if 0.
+	dynamicSequentialMinPort int
+	forbiddenAPIKeys         map[int16]struct{}
+	dialAddressMapping       []string
+	tls                      *TLSConfig
+}
+
+// extraConfig parses c.ExtraConfig. Some config (i.e. TLS) can be overridden there. It is intentional.
+// Unsupported flags are ignored, logging a warning, so configs written for other versions of the proxy keep working.
+func (c *ProxyConfig) extraConfig() (*extraConfig, error) {
+	reachableAddress := c.Address
+	if reachableAddress == "" {
+		reachableAddress = defaultLocalAddress
+	}
+
+	conf := &extraConfig{
+		defaultListenerIP:         defaultLocalAddress,
+		dynamicAdvertisedListener: reachableAddress,
+		forbiddenAPIKeys:          make(map[int16]struct{}),
+		dialAddressMapping:        c.DialAddressMapping,
+	}
+
+	if c.TLS != nil {
+		tlsConf := *c.TLS
+		conf.tls = &tlsConf
+	}
+
+	for _, v := range c.ExtraConfig {
+		f := strings.SplitN(v, "=", 2)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("extra flag %s should be in the form flag=value", v)
+		}
+
+		err := conf.set(f[0], f[1])
+		if errors.Is(err, errUnsupportedFlag) {
+			logrus.WithField("flag", f[0]).Warnf("Ignoring unsupported extra flag. Supported flags are %s", strings.Join(supportedFlags, ", "))
+			continue
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid extra flag %s", f[0])
+		}
+	}
+
+	return conf, nil
+}
+
+func (c *extraConfig) set(flag, value string) error { //nolint:gocyclo
+	var err error
+	switch flag {
+	case "default-listener-ip":
+		c.defaultListenerIP = value
+	case "dynamic-advertised-listener":
+		c.dynamicAdvertisedListener = value
+	case "dynamic-sequential-min-port":
+		c.dynamicSequentialMinPort, err = strconv.Atoi(value)
+	case "forbidden-api-keys":
+		for _, k := range strings.Split(value, ",") {
+			key, err := strconv.ParseInt(strings.TrimSpace(k), 10, 16)
+			if err != nil {
+				return err
+			}
+			c.forbiddenAPIKeys[int16(key)] = struct{}{}
+		}
+	case "dial-address-mapping":
+		c.dialAddressMapping = append(c.dialAddressMapping, value)
+	case "tls-enable":
+		c.tlsConfig().Enable, err = strconv.ParseBool(value)
+	case "tls-insecure-skip-verify":
+		c.tlsConfig().InsecureSkipVerify, err = strconv.ParseBool(value)
+	case "tls-client-cert-file":
+		c.tlsConfig().ClientCertFile = value
+	case "tls-client-key-file":
+		c.tlsConfig().ClientKeyFile = value
+	case "tls-ca-chain-cert-file":
+		c.tlsConfig().CAChainCertFile = value
+	default:
+		return errUnsupportedFlag
+	}
+
+	return err
+}
+
+func (c *extraConfig) tlsConfig() *TLSConfig {
+	if c.tls == nil {
+		c.tls = new(TLSConfig)
+	}
+
+	return c.tls
+}
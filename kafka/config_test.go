@@ -1,11 +1,28 @@
 package kafka
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	messagetest "github.com/asyncapi/event-gateway/message/test"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestProxyConfig_Validate(t *testing.T) {
@@ -45,6 +62,14 @@ func TestProxyConfig_Validate(t *testing.T) {
 			},
 			expectedErr: errors.New("MessagePublisher and PublishToTopic should be set together"),
 		},
+		{
+			name: "Invalid config. Listener TLS without cert file",
+			config: ProxyConfig{
+				BrokersMapping: []string{"broker.mybrokers.org:9092,:9092"},
+				ListenerTLS:    &ListenerTLSConfig{KeyFile: "/etc/certs/server.key"},
+			},
+			expectedErr: errors.New("invalid listener TLS config: both cert and key files are required"),
+		},
 		{
 			name:        "Invalid config. No broker mapping",
 			expectedErr: errors.New("BrokersMapping is mandatory"),
@@ -75,3 +100,253 @@ func TestProxyConfig_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestListenerTLSConfig_Config(t *testing.T) {
+	certFile, keyFile := generateCert(t, "localhost")
+
+	conf, err := (&ListenerTLSConfig{CertFile: certFile, KeyFile: keyFile}).Config()
+	require.NoError(t, err)
+	clientConf, err := conf.GetConfigForClient(nil)
+	require.NoError(t, err)
+	assert.Len(t, clientConf.Certificates, 1)
+	assert.Equal(t, tls.NoClientCert, clientConf.ClientAuth)
+
+	conf, err = (&ListenerTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile}).Config()
+	require.NoError(t, err)
+	clientConf, err = conf.GetConfigForClient(nil)
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, clientConf.ClientAuth)
+	assert.NotNil(t, clientConf.ClientCAs)
+
+	_, err = (&ListenerTLSConfig{CertFile: certFile, KeyFile: "missing.key"}).Config()
+	assert.EqualError(t, err, "error reading key file: open missing.key: no such file or directory")
+}
+
+func TestListenerTLSReloader_configForClient(t *testing.T) {
+	certFile, keyFile := generateCert(t, "localhost")
+	r, err := newListenerTLSReloader(&ListenerTLSConfig{CertFile: certFile, KeyFile: keyFile}, 0)
+	require.NoError(t, err)
+
+	initial, err := r.configForClient(nil)
+	require.NoError(t, err)
+
+	// Files being rotated. Only the cert was written so far, so the previous config is kept.
+	rotatedCertFile, rotatedKeyFile := generateCert(t, "localhost")
+	replaceFile(t, rotatedCertFile, certFile, time.Now().Add(time.Minute))
+	current, err := r.configForClient(nil)
+	require.NoError(t, err)
+	assert.Same(t, initial, current)
+
+	replaceFile(t, rotatedKeyFile, keyFile, time.Now().Add(time.Minute))
+	current, err = r.configForClient(nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, initial.Certificates[0].Certificate, current.Certificates[0].Certificate)
+
+	unchanged, err := r.configForClient(nil)
+	require.NoError(t, err)
+	assert.Same(t, current, unchanged)
+}
+
+func TestListenerTLSReloader_configForClient_interval(t *testing.T) {
+	certFile, keyFile := generateCert(t, "localhost")
+	r, err := newListenerTLSReloader(&ListenerTLSConfig{CertFile: certFile, KeyFile: keyFile}, time.Hour)
+	require.NoError(t, err)
+
+	initial, err := r.configForClient(nil)
+	require.NoError(t, err)
+
+	// Files are not checked again until the interval elapses.
+	rotatedCertFile, rotatedKeyFile := generateCert(t, "localhost")
+	replaceFile(t, rotatedCertFile, certFile, time.Now().Add(time.Minute))
+	replaceFile(t, rotatedKeyFile, keyFile, time.Now().Add(time.Minute))
+	current, err := r.configForClient(nil)
+	require.NoError(t, err)
+	assert.Same(t, initial, current)
+
+	atomic.StoreInt64(&r.nextCheck, time.Now().UnixNano())
+	current, err = r.configForClient(nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, initial.Certificates[0].Certificate, current.Certificates[0].Certificate)
+}
+
+func TestListenerTLSReloader_configForClient_concurrent(t *testing.T) {
+	certFile, keyFile := generateCert(t, "localhost")
+	r, err := newListenerTLSReloader(&ListenerTLSConfig{CertFile: certFile, KeyFile: keyFile}, 0)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conf, err := r.configForClient(nil)
+			assert.NoError(t, err)
+			assert.NotNil(t, conf)
+		}()
+	}
+	wg.Wait()
+}
+
+func replaceFile(t *testing.T, src, dst string, modTime time.Time) {
+	raw, err := ioutil.ReadFile(src)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(dst, raw, 0600))
+	require.NoError(t, os.Chtimes(dst, modTime, modTime))
+}
+
+func TestProxyConfig_BrokerListeners(t *testing.T) {
+	tests := []struct {
+		name              string
+		address           string
+		brokersMapping    []string
+		expectedListeners []BrokerListener
+	}{
+		{
+			name:           "Listening at all interfaces",
+			brokersMapping: []string{"broker-1:9092,:20001", "broker-2:9092, :20002"},
+			expectedListeners: []BrokerListener{
+				{Broker: "broker-1:9092", ListenAt: ":20001", AdvertisedAs: "0.0.0.0:20001"},
+				{Broker: "broker-2:9092", ListenAt: ":20002", AdvertisedAs: "0.0.0.0:20002"},
+			},
+		},
+		{
+			name:           "Listening at a given host",
+			brokersMapping: []string{"broker:9092,localhost:20001"},
+			expectedListeners: []BrokerListener{
+				{Broker: "broker:9092", ListenAt: "localhost:20001", AdvertisedAs: "localhost:20001"},
+			},
+		},
+		{
+			name:           "Advertised as the proxy address",
+			address:        "proxy.example.com",
+			brokersMapping: []string{"broker:9092,localhost:20001"},
+			expectedListeners: []BrokerListener{
+				{Broker: "broker:9092", ListenAt: "localhost:20001", AdvertisedAs: "proxy.example.com:20001"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &ProxyConfig{Address: test.address, BrokersMapping: test.brokersMapping}
+			assert.Equal(t, test.expectedListeners, c.BrokerListeners())
+		})
+	}
+}
+
+func TestProxyConfig_extraConfig(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          ProxyConfig
+		expected        *extraConfig
+		expectedErr     string
+		expectedWarning string
+	}{
+		{
+			name:   "Defaults",
+			config: ProxyConfig{DialAddressMapping: []string{"broker:9092,other:9092"}},
+			expected: &extraConfig{
+				defaultListenerIP:         "0.0.0.0",
+				dynamicAdvertisedListener: "0.0.0.0",
+				forbiddenAPIKeys:          map[int16]struct{}{},
+				dialAddressMapping:        []string{"broker:9092,other:9092"},
+			},
+		},
+		{
+			name: "Flags",
+			config: ProxyConfig{
+				Address: "proxy.myapp.org",
+				TLS:     &TLSConfig{Enable: true, CAChainCertFile: "/etc/ca.crt"},
+				ExtraConfig: []string{
+					"default-listener-ip=127.0.0.1",
+					"dynamic-sequential-min-port=30000",
+					"forbidden-api-keys=19,20",
+					"dial-address-mapping=broker:9092,other:9092",
+					"tls-insecure-skip-verify=true",
+				},
+			},
+			expected: &extraConfig{
+				defaultListenerIP:         "127.0.0.1",
+				dynamicAdvertisedListener: "proxy.myapp.org",
+				dynamicSequentialMinPort:  30000,
+				forbiddenAPIKeys:          map[int16]struct{}{19: {}, 20: {}},
+				dialAddressMapping:        []string{"broker:9092,other:9092"},
+				tls:                       &TLSConfig{Enable: true, InsecureSkipVerify: true, CAChainCertFile: "/etc/ca.crt"},
+			},
+		},
+		{
+			name:   "Unsupported flags are ignored",
+			config: ProxyConfig{ExtraConfig: []string{"log-format=json", "default-listener-ip=127.0.0.1"}},
+			expected: &extraConfig{
+				defaultListenerIP:         "127.0.0.1",
+				dynamicAdvertisedListener: "0.0.0.0",
+				forbiddenAPIKeys:          map[int16]struct{}{},
+			},
+			expectedWarning: "Ignoring unsupported extra flag. Supported flags are default-listener-ip, dynamic-advertised-listener, dynamic-sequential-min-port, forbidden-api-keys, dial-address-mapping, tls-enable, tls-insecure-skip-verify, tls-client-cert-file, tls-client-key-file, tls-ca-chain-cert-file",
+		},
+		{
+			name:        "Invalid value",
+			config:      ProxyConfig{ExtraConfig: []string{"tls-enable=maybe"}},
+			expectedErr: `invalid extra flag tls-enable: strconv.ParseBool: parsing "maybe": invalid syntax`,
+		},
+		{
+			name:        "Invalid format",
+			config:      ProxyConfig{ExtraConfig: []string{"tls-enable"}},
+			expectedErr: "extra flag tls-enable should be in the form flag=value",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hook := logrustest.NewGlobal()
+			t.Cleanup(hook.Reset)
+
+			conf, err := test.config.extraConfig()
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, conf)
+
+			if test.expectedWarning != "" {
+				require.NotNil(t, hook.LastEntry())
+				assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+				assert.Equal(t, test.expectedWarning, hook.LastEntry().Message)
+			} else {
+				assert.Empty(t, hook.AllEntries())
+			}
+		})
+	}
+}
+
+// generateCert generates a self-signed certificate for the given host, returning the paths to the PEM encoded cert and key files.
+func generateCert(t *testing.T, host string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: host},
+		DNSNames:              []string{host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return certFile, keyFile
+}
@@ -0,0 +1,380 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	kafkaprotocol "github.com/grepplabs/kafka-proxy/proxy/protocol"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dialTimeout = 15 * time.Second
+	// maxOpenRequests is the max number of requests sent to the broker still waiting for a response. Clients are not read meanwhile.
+	maxOpenRequests = 256
+)
+
+// brokerDialer connects to the brokers.
+type brokerDialer struct {
+	tls         *tls.Config
+	sasl        *SASLConfig
+	dialMapping map[string]string
+}
+
+func newBrokerDialer(tlsConf *TLSConfig, sasl *SASLConfig, dialAddressMapping []string) (*brokerDialer, error) {
+	d := &brokerDialer{sasl: sasl, dialMapping: make(map[string]string, len(dialAddressMapping))}
+	for _, m := range dialAddressMapping {
+		v := strings.Split(m, ",")
+		if len(v) != 2 {
+			return nil, fmt.Errorf("dial address mapping %s should be in form 'remotehost:remoteport,new-remotehost:new-remoteport'", m)
+		}
+		d.dialMapping[v[0]] = v[1]
+	}
+
+	if tlsConf != nil && tlsConf.Enable {
+		conf, err := tlsConf.Config()
+		if err != nil {
+			return nil, errors.Wrap(err, "error configuring TLS")
+		}
+		d.tls = conf
+	}
+
+	return d, nil
+}
+
+// dial connects and authenticates (if SASL is configured) against the given broker.
+func (d *brokerDialer) dial(ctx context.Context, brokerAddress string) (net.Conn, error) {
+	address := brokerAddress
+	if mapped, ok := d.dialMapping[brokerAddress]; ok {
+		address = mapped
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.tls != nil {
+		conf := d.tls.Clone()
+		if conf.ServerName == "" {
+			conf.ServerName, _, _ = net.SplitHostPort(address)
+		}
+
+		tlsConn := tls.Client(conn, conf)
+		if err := tlsConn.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, errors.Wrap(err, "error during TLS handshake")
+		}
+		conn = tlsConn
+	}
+
+	if d.sasl != nil {
+		_ = conn.SetDeadline(time.Now().Add(dialTimeout))
+		if err := d.sasl.authenticate(conn); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		_ = conn.SetDeadline(time.Time{})
+	}
+
+	return conn, nil
+}
+
+// pendingResponse is a response the client is waiting for. Responses are sent in the same order requests were received.
+type pendingResponse struct {
+	req *Request
+	// response is set if the request has been answered by the proxy. Otherwise, the response is read from the broker.
+	response []byte
+}
+
+// connection relays requests from a client to a broker and responses back.
+type connection struct {
+	client        net.Conn
+	broker        net.Conn
+	brokerAddress string
+	handlers      map[int16]RequestHandler
+	forbidden     map[int16]struct{}
+	// addressMapping maps broker addresses to the addresses advertised to clients.
+	addressMapping func(brokerHost string, brokerPort int32) (string, int32, error)
+	pending        chan pendingResponse
+	done           chan struct{}
+	closeOnce      sync.Once
+}
+
+func newConnection(client, broker net.Conn, brokerAddress string, p *Proxy) *connection {
+	return &connection{
+		client:         client,
+		broker:         broker,
+		brokerAddress:  brokerAddress,
+		handlers:       p.handlers,
+		forbidden:      p.extra.forbiddenAPIKeys,
+		addressMapping: p.advertisedAddress,
+		pending:        make(chan pendingResponse, maxOpenRequests),
+		done:           make(chan struct{}),
+	}
+}
+
+// serve relays requests and responses until any of both connections is closed.
+func (c *connection) serve() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer close(c.pending)
+		c.logError(c.requestsLoop(), "requests")
+	}()
+	go func() {
+		defer wg.Done()
+		c.logError(c.responsesLoop(), "responses")
+	}()
+	wg.Wait()
+}
+
+func (c *connection) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		_ = c.client.Close()
+		_ = c.broker.Close()
+	})
+}
+
+func (c *connection) logError(err error, loop string) {
+	c.close()
+	if err == nil || errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		return
+	}
+
+	logrus.WithError(err).WithFields(logrus.Fields{
+		"client": c.client.RemoteAddr().String(),
+		"broker": c.brokerAddress,
+	}).Warnf("Closing connection due to an error in the %s loop", loop)
+}
+
+func (c *connection) requestsLoop() error {
+	for {
+		req, err := readRequest(c.client)
+		if err != nil {
+			return err
+		}
+
+		logrus.Debugf("Kafka request key %v, version %v, length %v", req.APIKey, req.APIVersion, len(req.raw)-4)
+		if _, ok := c.forbidden[req.APIKey]; ok {
+			return fmt.Errorf("api key %d is forbidden", req.APIKey)
+		}
+
+		var response []byte
+		if h, ok := c.handlers[req.APIKey]; ok {
+			if response, err = h.Handle(req); err != nil {
+				return err
+			}
+		}
+
+		if err := c.relayRequest(req, response); err != nil {
+			return err
+		}
+
+		if err := c.mute(req.throttleTime); err != nil {
+			return err
+		}
+	}
+}
+
+// relayRequest sends the given request to the broker, unless it has been answered by the proxy with the given response.
+func (c *connection) relayRequest(req *Request, response []byte) error {
+	if response != nil {
+		// Answered by the proxy.
+		if req.ExpectsResponse() {
+			return c.enqueue(pendingResponse{req: req, response: response})
+		}
+		return nil
+	}
+
+	if req.ExpectsResponse() {
+		// Enqueued before sending the request, so the response is expected by the time it arrives.
+		if err := c.enqueue(pendingResponse{req: req}); err != nil {
+			return err
+		}
+	}
+
+	_, err := c.broker.Write(req.raw)
+	return err
+}
+
+// mute stops reading requests from the client for the given time, same as brokers do with throttled clients.
+func (c *connection) mute(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-c.done:
+		return net.ErrClosed
+	}
+}
+
+func (c *connection) enqueue(p pendingResponse) error {
+	select {
+	case c.pending <- p:
+		return nil
+	case <-c.done:
+		return net.ErrClosed
+	}
+}
+
+func (c *connection) responsesLoop() error {
+	for p := range c.pending {
+		if p.response != nil {
+			if err := writeResponse(c.client, p.req, p.response); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := c.relayResponse(p.req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// relayResponse relays the response of the given request from the broker to the client.
+// Broker addresses are rewritten in those responses advertising brokers, so clients keep connecting through the proxy.
+func (c *connection) relayResponse(req *Request) error {
+	header := make([]byte, 8) // Size => int32, CorrelationId => int32
+	if _, err := io.ReadFull(c.broker, header); err != nil {
+		return err
+	}
+
+	size := int32(binary.BigEndian.Uint32(header[:4]))
+	correlationID := int32(binary.BigEndian.Uint32(header[4:]))
+	if correlationID != req.CorrelationID {
+		return fmt.Errorf("unexpected correlation id %d in response. Expected %d", correlationID, req.CorrelationID)
+	}
+
+	if size < 4 {
+		return fmt.Errorf("invalid response size %d", size)
+	}
+
+	if req.APIKey == requestAPIKeyAPIVersions {
+		return c.relayAPIVersionsResponse(req, header, size)
+	}
+
+	if req.APIKey == RequestAPIKeyProduce && req.throttleTime > 0 {
+		return c.relayThrottledProduceResponse(req, header, size)
+	}
+
+	modifier, err := kafkaprotocol.GetResponseModifier(req.APIKey, req.APIVersion, c.addressMapping)
+	if err != nil {
+		return err
+	}
+
+	if modifier == nil {
+		if _, err := c.client.Write(header); err != nil {
+			return err
+		}
+
+		_, err = io.CopyN(c.client, c.broker, int64(size-4))
+		return err
+	}
+
+	if size > kafkaprotocol.MaxResponseSize {
+		return fmt.Errorf("response of length %d too large", size)
+	}
+
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(c.broker, resp); err != nil {
+		return err
+	}
+
+	keyVersion := &kafkaprotocol.RequestKeyVersion{ApiKey: req.APIKey, ApiVersion: req.APIVersion}
+	taggedFields, err := kafkaprotocol.NewResponseHeaderTaggedFields(keyVersion)
+	if err != nil {
+		return err
+	}
+
+	body := bytes.NewReader(resp)
+	rawTaggedFields, err := taggedFields.MaybeRead(body)
+	if err != nil {
+		return err
+	}
+
+	modified, err := modifier.Apply(resp[len(rawTaggedFields):])
+	if err != nil {
+		return errors.Wrapf(err, "error rewriting broker addresses in response with api key %d", req.APIKey)
+	}
+
+	out := &packetEncoder{}
+	out.int32(int32(4 + len(rawTaggedFields) + len(modified)))
+	out.int32(correlationID)
+	_, _ = out.Write(rawTaggedFields)
+	_, _ = out.Write(modified)
+
+	_, err = c.client.Write(out.Bytes())
+	return err
+}
+
+// relayAPIVersionsResponse relays an ApiVersions response, capping the advertised Produce versions to those the proxy can decode.
+// The response header is always v0, meaning no tagged fields follow the correlation id.
+func (c *connection) relayAPIVersionsResponse(req *Request, header []byte, size int32) error {
+	if size > kafkaprotocol.MaxResponseSize {
+		return fmt.Errorf("response of length %d too large", size)
+	}
+
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(c.broker, resp); err != nil {
+		return err
+	}
+
+	if err := capAPIVersions(req.APIVersion, resp); err != nil {
+		// Relaying the response as it is, so the client can still connect. Produce requests might not be inspected though.
+		logrus.WithError(err).WithField("version", req.APIVersion).Warn("Error capping Produce versions in ApiVersions response")
+	}
+
+	if _, err := c.client.Write(header); err != nil {
+		return err
+	}
+
+	_, err := c.client.Write(resp)
+	return err
+}
+
+// relayThrottledProduceResponse relays a Produce response, setting the throttle time of the client if it exceeded a quota.
+func (c *connection) relayThrottledProduceResponse(req *Request, header []byte, size int32) error {
+	if size > kafkaprotocol.MaxResponseSize {
+		return fmt.Errorf("response of length %d too large", size)
+	}
+
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(c.broker, resp); err != nil {
+		return err
+	}
+
+	// The response header tagged fields, if any, come before the body. The throttle time is found from the end of the body.
+	if err := setProduceThrottleTime(req.APIVersion, resp, req.throttleTime); err != nil {
+		// Relaying the response as it is. The client is still throttled by not reading its requests.
+		logrus.WithError(err).WithField("version", req.APIVersion).Warn("Error setting throttle time in Produce response")
+	}
+
+	if _, err := c.client.Write(header); err != nil {
+		return err
+	}
+
+	_, err := c.client.Write(resp)
+	return err
+}
@@ -0,0 +1,211 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// PolicyMode sets how a policy is applied.
+type PolicyMode string
+
+// Policy modes.
+const (
+	// PolicyModeOff disables the policy.
+	PolicyModeOff PolicyMode = "off"
+	// PolicyModeObserve reports violations but lets requests go through.
+	PolicyModeObserve PolicyMode = "observe"
+	// PolicyModeEnforce reports violations and rejects the violating requests.
+	PolicyModeEnforce PolicyMode = "enforce"
+)
+
+// Validate validates PolicyMode.
+func (m PolicyMode) Validate() error {
+	switch m {
+	case "", PolicyModeOff, PolicyModeObserve, PolicyModeEnforce:
+		return nil
+	default:
+		return fmt.Errorf("policy mode %q is not valid. Valid values are %s, %s and %s", m, PolicyModeOff, PolicyModeObserve, PolicyModeEnforce)
+	}
+}
+
+// IsEnabled returns true if the policy should be applied.
+func (m PolicyMode) IsEnabled() bool {
+	return m == PolicyModeObserve || m == PolicyModeEnforce
+}
+
+// ProducePolicy checks if a client is allowed to produce to a topic. A non-nil error means the policy is violated.
+type ProducePolicy func(clientID, topic string) error
+
+// ProducePolicyConfig holds a ProducePolicy and how it is applied.
+type ProducePolicyConfig struct {
+	Name   string
+	Mode   PolicyMode
+	Policy ProducePolicy
+}
+
+// PolicyViolation describes a request violating a policy.
+type PolicyViolation struct {
+	Policy   string `json:"policy"`
+	ClientID string `json:"clientId,omitempty"`
+	Topic    string `json:"topic"`
+	Reason   string `json:"reason"`
+	Rejected bool   `json:"rejected"`
+	// ThrottleTimeMs is set if the client is throttled due to the violation.
+	ThrottleTimeMs int64 `json:"throttleTimeMs,omitempty"`
+
+	// errCode is the error rejected requests are answered with. Default is TOPIC_AUTHORIZATION_FAILED.
+	errCode sarama.KError
+}
+
+func (v PolicyViolation) Error() string {
+	return fmt.Sprintf("policy %s violated by client %q producing to topic %s: %s", v.Policy, v.ClientID, v.Topic, v.Reason)
+}
+
+// PolicyViolationHandler handles policy violations. I.e. notifying them.
+type PolicyViolationHandler func(PolicyViolation)
+
+// checkProducePolicies checks all the topics against the given policies.
+// Violations are logged and passed to the handler, if any. The violations of enforced policies are returned, indexed by topic.
+func checkProducePolicies(policies []ProducePolicyConfig, handler PolicyViolationHandler, clientID string, topics []string) map[string]PolicyViolation {
+	var violations []PolicyViolation
+	for _, p := range policies {
+		if !p.Mode.IsEnabled() {
+			continue
+		}
+
+		for _, topic := range topics {
+			err := p.Policy(clientID, topic)
+			if err == nil {
+				continue
+			}
+
+			violations = append(violations, PolicyViolation{
+				Policy:   p.Name,
+				ClientID: clientID,
+				Topic:    topic,
+				Reason:   err.Error(),
+				Rejected: p.Mode == PolicyModeEnforce,
+			})
+		}
+	}
+
+	return reportViolations(handler, violations)
+}
+
+// reportViolations logs the given violations and passes them to the handler, if any. The rejected ones are returned,
+// indexed by topic.
+func reportViolations(handler PolicyViolationHandler, violations []PolicyViolation) map[string]PolicyViolation {
+	rejected := make(map[string]PolicyViolation)
+	for _, violation := range violations {
+		logrus.WithError(violation).WithField("rejected", violation.Rejected).Warn("Policy violation")
+		if handler != nil {
+			handler(violation)
+		}
+
+		if _, ok := rejected[violation.Topic]; !ok && violation.Rejected {
+			rejected[violation.Topic] = violation
+		}
+	}
+
+	return rejected
+}
+
+// produceRejectedResponse creates the body of a Produce response rejecting the given request.
+// Topics violating an enforced policy are answered with the error of the violation, TOPIC_AUTHORIZATION_FAILED by default.
+// The rest of topics are answered with OPERATION_NOT_ATTEMPTED, as requests can not be partially forwarded.
+// The throttle time tells the client how long to wait before sending more requests.
+func produceRejectedResponse(version int16, req sarama.ProduceRequest, rejected map[string]PolicyViolation, throttle time.Duration) ([]byte, error) {
+	if version > maxProduceVersion {
+		return nil, fmt.Errorf("produce response version %d is not supported", version)
+	}
+
+	flexible := version >= firstFlexibleProduceVersion
+	topics := make([]string, 0, len(req.Records))
+	for topic := range req.Records {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	e := &packetEncoder{}
+	encodeArrayLength(e, flexible, len(topics))
+	for _, topic := range topics {
+		errCode := sarama.ErrOperationNotAttempted
+		var errMsg *string
+		if violation, ok := rejected[topic]; ok {
+			errCode = violation.errCode
+			if errCode == sarama.ErrNoError {
+				errCode = sarama.ErrTopicAuthorizationFailed
+			}
+			msg := violation.Error()
+			errMsg = &msg
+		}
+
+		partitions := make([]int32, 0, len(req.Records[topic]))
+		for partition := range req.Records[topic] {
+			partitions = append(partitions, partition)
+		}
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+
+		if flexible {
+			e.compactString(topic)
+		} else {
+			e.string(topic)
+		}
+
+		encodeArrayLength(e, flexible, len(partitions))
+		for _, partition := range partitions {
+			encodeRejectedPartition(e, version, partition, errCode, errMsg)
+		}
+
+		if flexible {
+			e.emptyTaggedFields()
+		}
+	}
+
+	if version >= 1 {
+		e.int32(int32(throttle.Milliseconds())) // throttle_time_ms
+	}
+
+	if flexible {
+		e.emptyTaggedFields()
+	}
+
+	return e.Bytes(), nil
+}
+
+func encodeRejectedPartition(e *packetEncoder, version int16, partition int32, errCode sarama.KError, errMsg *string) {
+	flexible := version >= firstFlexibleProduceVersion
+	e.int32(partition)
+	e.int16(int16(errCode))
+	e.int64(-1) // base_offset
+	if version >= 2 {
+		e.int64(-1) // log_append_time_ms
+	}
+	if version >= 5 {
+		e.int64(-1) // log_start_offset
+	}
+	if version >= 8 {
+		encodeArrayLength(e, flexible, 0) // record_errors
+		if flexible {
+			e.compactNullableString(errMsg)
+		} else {
+			e.nullableString(errMsg)
+		}
+	}
+	if flexible {
+		e.emptyTaggedFields()
+	}
+}
+
+func encodeArrayLength(e *packetEncoder, compact bool, n int) {
+	if compact {
+		e.compactArrayLength(n)
+		return
+	}
+
+	e.int32(int32(n))
+}
@@ -0,0 +1,15 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyMode_Validate(t *testing.T) {
+	assert.NoError(t, PolicyMode("").Validate())
+	assert.NoError(t, PolicyModeOff.Validate())
+	assert.NoError(t, PolicyModeObserve.Validate())
+	assert.NoError(t, PolicyModeEnforce.Validate())
+	assert.EqualError(t, PolicyMode("reject").Validate(), `policy mode "reject" is not valid. Valid values are off, observe and enforce`)
+}
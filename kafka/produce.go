@@ -0,0 +1,184 @@
+package kafka
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+)
+
+// maxProduceVersion is the latest Produce request version the proxy can decode.
+// Clients are told (see capAPIVersions) not to use later versions, so their requests can always be inspected.
+// Responses of versions 10+ carry the addresses of the actual brokers in the NodeEndpoints and CurrentLeader tagged
+// fields, which the proxy doesn't rewrite, so those versions are not allowed.
+const maxProduceVersion = 9
+
+// firstFlexibleProduceVersion is the first Produce request version using flexible (compact and tagged fields) encoding.
+const firstFlexibleProduceVersion = 9
+
+// ProduceRequestStats holds the count of Produce requests that were inspected, meaning their messages were extracted, and
+// the ones that could not be. Uninspected requests are forwarded to the brokers as they are, without validating their messages.
+type ProduceRequestStats struct {
+	Inspected   uint64 `json:"inspected"`
+	Uninspected uint64 `json:"uninspected"`
+}
+
+func (s *ProduceRequestStats) inspected() {
+	atomic.AddUint64(&s.Inspected, 1)
+}
+
+func (s *ProduceRequestStats) uninspected() {
+	atomic.AddUint64(&s.Uninspected, 1)
+}
+
+func (s *ProduceRequestStats) load() ProduceRequestStats {
+	return ProduceRequestStats{
+		Inspected:   atomic.LoadUint64(&s.Inspected),
+		Uninspected: atomic.LoadUint64(&s.Uninspected),
+	}
+}
+
+// decodeProduceRequest decodes the body of a Produce request of any version up to maxProduceVersion.
+// See https://kafka.apache.org/protocol#The_Messages_Produce.
+func decodeProduceRequest(version int16, body []byte) (*sarama.ProduceRequest, error) {
+	if version < 0 || version > maxProduceVersion {
+		return nil, fmt.Errorf("produce request version %d is not supported", version)
+	}
+
+	req := new(sarama.ProduceRequest)
+	if version < firstFlexibleProduceVersion {
+		if err := sarama.DoVersionedDecode(body, req, version); err != nil {
+			return nil, err
+		}
+
+		return req, nil
+	}
+
+	req.Version = version
+	d := &packetDecoder{b: body}
+	if err := d.taggedFields(); err != nil { // request header tagged fields
+		return nil, err
+	}
+
+	transactionalID, err := d.compactNullableString()
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding transactional id")
+	}
+
+	if transactionalID != "" {
+		req.TransactionalID = &transactionalID
+	}
+
+	acks, err := d.int16()
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding acks")
+	}
+
+	req.RequiredAcks = sarama.RequiredAcks(acks)
+	if req.Timeout, err = d.int32(); err != nil {
+		return nil, errors.Wrap(err, "error decoding timeout")
+	}
+
+	if req.Records, err = decodeFlexibleProduceTopics(d); err != nil {
+		return nil, err
+	}
+
+	if err := d.taggedFields(); err != nil {
+		return nil, err
+	}
+
+	if len(d.remaining()) > 0 {
+		return nil, fmt.Errorf("%d unexpected bytes after produce request", len(d.remaining()))
+	}
+
+	return req, nil
+}
+
+func decodeFlexibleProduceTopics(d *packetDecoder) (map[string]map[int32]sarama.Records, error) {
+	topicCount, err := d.compactArrayLength()
+	if err != nil || topicCount <= 0 {
+		return nil, err
+	}
+
+	topics := make(map[string]map[int32]sarama.Records, topicCount)
+	for i := 0; i < topicCount; i++ {
+		topic, err := d.compactString()
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding topic name")
+		}
+
+		partitionCount, err := d.compactArrayLength()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding partitions of topic %s", topic)
+		}
+
+		partitions := make(map[int32]sarama.Records, partitionCount)
+		for j := 0; j < partitionCount; j++ {
+			partition, err := d.int32()
+			if err != nil {
+				return nil, errors.Wrapf(err, "error decoding partitions of topic %s", topic)
+			}
+
+			raw, err := d.compactNullableBytes()
+			if err != nil {
+				return nil, errors.Wrapf(err, "error decoding records of topic %s, partition %d", topic, partition)
+			}
+
+			var records sarama.Records
+			if len(raw) > 0 {
+				if err := sarama.DoDecode(raw, &records); err != nil {
+					return nil, errors.Wrapf(err, "error decoding records of topic %s, partition %d", topic, partition)
+				}
+			}
+
+			partitions[partition] = records
+			if err := d.taggedFields(); err != nil {
+				return nil, err
+			}
+		}
+
+		topics[topic] = partitions
+		if err := d.taggedFields(); err != nil {
+			return nil, err
+		}
+	}
+
+	return topics, nil
+}
+
+// unwrapMessageSet returns the messages of a legacy (v0 and v1) message set, replacing compressed wrapper messages by
+// the messages they wrap, recursively. Inner messages get the same offsets and timestamps consumers would see.
+// Offsets of messages wrapped by a v1 wrapper are relative, the wrapper offset being the offset of the last one, and
+// they get the wrapper timestamp if its timestamp type is LogAppendTime. The given message set is not modified.
+func unwrapMessageSet(set *sarama.MessageSet) []*sarama.MessageBlock {
+	var blocks []*sarama.MessageBlock
+	for _, mb := range set.Messages {
+		if mb.Msg == nil {
+			continue
+		}
+
+		if mb.Msg.Set == nil || len(mb.Msg.Set.Messages) == 0 {
+			blocks = append(blocks, mb)
+			continue
+		}
+
+		inner := unwrapMessageSet(mb.Msg.Set)
+		var baseOffset int64
+		if mb.Msg.Version >= 1 && len(inner) > 0 {
+			baseOffset = mb.Offset - inner[len(inner)-1].Offset
+		}
+
+		for _, ib := range inner {
+			msg := *ib.Msg
+			if mb.Msg.Version >= 1 && mb.Msg.LogAppendTime {
+				msg.Timestamp = mb.Msg.Timestamp
+				msg.LogAppendTime = true
+			}
+
+			blocks = append(blocks, &sarama.MessageBlock{Offset: ib.Offset + baseOffset, Msg: &msg})
+		}
+	}
+
+	return blocks
+}
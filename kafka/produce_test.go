@@ -0,0 +1,522 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	messagetest "github.com/asyncapi/event-gateway/message/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeProduceRequest(t *testing.T) {
+	transactionalID := "my-transaction"
+	tests := []struct {
+		name                    string
+		version                 int16
+		body                    func(t *testing.T) []byte
+		expectedTransactionalID *string
+		expectedErr             string
+	}{
+		{
+			name:    "Version 8",
+			version: 8,
+			body: func(t *testing.T) []byte {
+				return newRequest(t, RequestAPIKeyProduce, 8, generateProduceRequestV8("valid message")).Body
+			},
+		},
+		{
+			name:    "Flexible version 9",
+			version: 9,
+			body: func(t *testing.T) []byte {
+				return generateFlexibleProduceRequestBody(t, nil, "valid message")
+			},
+		},
+		{
+			name:    "Flexible version 9 with transactional id",
+			version: 9,
+			body: func(t *testing.T) []byte {
+				return generateFlexibleProduceRequestBody(t, &transactionalID, "valid message")
+			},
+			expectedTransactionalID: &transactionalID,
+		},
+		{
+			name:    "Version 10 is not supported",
+			version: 10,
+			body: func(t *testing.T) []byte {
+				return generateFlexibleProduceRequestBody(t, nil, "valid message")
+			},
+			expectedErr: "produce request version 10 is not supported",
+		},
+		{
+			name:    "Version 11 is not supported",
+			version: 11,
+			body: func(t *testing.T) []byte {
+				return generateFlexibleProduceRequestBody(t, nil, "valid message")
+			},
+			expectedErr: "produce request version 11 is not supported",
+		},
+		{
+			name:    "Truncated flexible request",
+			version: 9,
+			body: func(t *testing.T) []byte {
+				body := generateFlexibleProduceRequestBody(t, nil, "valid message")
+				return body[:len(body)-10]
+			},
+			expectedErr: "error decoding records of topic demo, partition 0: insufficient data to decode packet",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := decodeProduceRequest(test.version, test.body(t))
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.version, req.Version)
+			assert.Equal(t, test.expectedTransactionalID, req.TransactionalID)
+			assert.Equal(t, sarama.WaitForLocal, req.RequiredAcks)
+			require.Contains(t, req.Records, "demo")
+			require.Contains(t, req.Records["demo"], int32(0))
+			require.NotNil(t, req.Records["demo"][0].RecordBatch)
+			require.Len(t, req.Records["demo"][0].RecordBatch.Records, 1)
+			assert.Equal(t, []byte("valid message"), req.Records["demo"][0].RecordBatch.Records[0].Value)
+		})
+	}
+}
+
+func TestProduceRequestHandler_HandleFlexible(t *testing.T) {
+	received := make(chan *watermillmessage.Message, 1)
+	handler := func(msg *watermillmessage.Message) ([]*watermillmessage.Message, error) {
+		received <- msg
+		return nil, nil
+	}
+
+	r := messagetest.NewRouter(t)
+	h := NewProduceRequestHandler(r, handler, nil, "")
+	go func() {
+		require.NoError(t, r.Run(context.Background()))
+	}()
+	<-r.Running()
+
+	response, err := h.Handle(newFlexibleProduceRequest(t, 9, generateFlexibleProduceRequestBody(t, nil, "valid message")))
+	assert.NoError(t, err)
+	assert.Nil(t, response)
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, []byte("valid message"), []byte(msg.Payload))
+	case <-time.After(time.Second):
+		require.Fail(t, "message of flexible produce request should be handled")
+	}
+
+	// Requests that can't be decoded are forwarded as they are, but counted.
+	response, err = h.Handle(newFlexibleProduceRequest(t, 10, generateFlexibleProduceRequestBody(t, nil, "valid message")))
+	assert.NoError(t, err)
+	assert.Nil(t, response)
+	assert.Equal(t, ProduceRequestStats{Inspected: 1, Uninspected: 1}, h.stats.load())
+}
+
+func TestProduceRejectedResponse_flexible(t *testing.T) {
+	req, err := decodeProduceRequest(9, generateFlexibleProduceRequestBody(t, nil, "valid message"))
+	require.NoError(t, err)
+
+	response, err := produceRejectedResponse(9, *req, map[string]PolicyViolation{
+		"demo": {Policy: "test", Topic: "demo", Reason: "not allowed", Rejected: true},
+	}, 0)
+	require.NoError(t, err)
+
+	d := &packetDecoder{b: response}
+	topics, err := d.compactArrayLength()
+	require.NoError(t, err)
+	assert.Equal(t, 1, topics)
+
+	topic, err := d.compactString()
+	require.NoError(t, err)
+	assert.Equal(t, "demo", topic)
+
+	partitions, err := d.compactArrayLength()
+	require.NoError(t, err)
+	assert.Equal(t, 1, partitions)
+
+	partition, err := d.int32()
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), partition)
+
+	errCode, err := d.int16()
+	require.NoError(t, err)
+	assert.Equal(t, int16(sarama.ErrTopicAuthorizationFailed), errCode)
+
+	_, err = d.read(3 * 8) // base_offset, log_append_time_ms and log_start_offset
+	require.NoError(t, err)
+
+	recordErrors, err := d.compactArrayLength()
+	require.NoError(t, err)
+	assert.Equal(t, 0, recordErrors)
+
+	errMsg, err := d.compactNullableString()
+	require.NoError(t, err)
+	assert.Equal(t, `policy test violated by client "" producing to topic demo: not allowed`, errMsg)
+
+	require.NoError(t, d.taggedFields()) // partition
+	require.NoError(t, d.taggedFields()) // topic
+
+	throttleTime, err := d.int32()
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), throttleTime)
+
+	require.NoError(t, d.taggedFields())
+	assert.Empty(t, d.remaining())
+}
+
+func TestCapAPIVersions(t *testing.T) {
+	for _, version := range []int16{0, 2, 3} {
+		flexible := version >= 3
+		e := &packetEncoder{}
+		e.int16(0) // error_code
+		encodeArrayLength(e, flexible, 2)
+		for _, api := range [][3]int16{{RequestAPIKeyProduce, 0, 11}, {1, 0, 15}} {
+			e.int16(api[0])
+			e.int16(api[1])
+			e.int16(api[2])
+			if flexible {
+				e.emptyTaggedFields()
+			}
+		}
+		e.int32(0) // throttle_time_ms
+		if flexible {
+			e.emptyTaggedFields()
+		}
+
+		body := e.Bytes()
+		require.NoError(t, capAPIVersions(version, body))
+
+		d := &packetDecoder{b: body}
+		_, _ = d.int16()
+		if flexible {
+			_, _ = d.uvarint()
+		} else {
+			_, _ = d.int32()
+		}
+
+		maxVersions := make(map[int16]int16)
+		for i := 0; i < 2; i++ {
+			key, _ := d.int16()
+			_, _ = d.int16()
+			maxVersions[key], _ = d.int16()
+			if flexible {
+				require.NoError(t, d.taggedFields())
+			}
+		}
+
+		assert.Equal(t, map[int16]int16{RequestAPIKeyProduce: 9, 1: 15}, maxVersions, "version %d", version)
+	}
+}
+
+func TestCapAPIVersions_error(t *testing.T) {
+	// UNSUPPORTED_VERSION responses are always v0, so they are left untouched.
+	body := []byte{0, 35, 0, 0, 0, 1, 0, 18, 0, 0, 0, 3}
+	require.NoError(t, capAPIVersions(3, body))
+	assert.Equal(t, []byte{0, 35, 0, 0, 0, 1, 0, 18, 0, 0, 0, 3}, body)
+}
+
+// generateFlexibleProduceRequestBody generates the body of a flexible (v9+) Produce request with one record to topic demo, partition 0.
+func generateFlexibleProduceRequestBody(t *testing.T, transactionalID *string, payload string) []byte {
+	records, err := sarama.DoEncode(&sarama.Records{RecordBatch: &sarama.RecordBatch{
+		Version:        2,
+		FirstTimestamp: time.Unix(1625097600, 0),
+		MaxTimestamp:   time.Unix(1625097600, 0),
+		ProducerID:     -1,
+		ProducerEpoch:  -1,
+		FirstSequence:  -1,
+		Records:        []*sarama.Record{{Key: []byte("key"), Value: []byte(payload)}},
+	}}, nil)
+	require.NoError(t, err)
+
+	e := &packetEncoder{}
+	e.emptyTaggedFields() // request header tagged fields
+	e.compactNullableString(transactionalID)
+	e.int16(int16(sarama.WaitForLocal))
+	e.int32(1500) // timeout
+	e.compactArrayLength(1)
+	e.compactString("demo")
+	e.compactArrayLength(1)
+	e.int32(0) // partition
+	e.uvarint(uint64(len(records) + 1))
+	_, _ = e.Write(records)
+	e.emptyTaggedFields() // partition
+	e.emptyTaggedFields() // topic
+	e.emptyTaggedFields()
+
+	return e.Bytes()
+}
+
+func newFlexibleProduceRequest(t *testing.T, version int16, body []byte) *Request {
+	payload := &packetEncoder{}
+	payload.int32(6) // correlation_id
+	clientID := "console-producer"
+	payload.nullableString(&clientID)
+	_, _ = payload.Write(body)
+
+	return newRequest(t, RequestAPIKeyProduce, version, payload.Bytes())
+}
+
+func TestProduceRequestHandler_extractMessages(t *testing.T) {
+	transactionalID := "my-transaction"
+	firstTimestamp := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name             string
+		transactionalID  *string
+		records          sarama.Records
+		expectedMetadata []map[string]string
+	}{
+		{
+			name:            "Record batch of transactional producer",
+			transactionalID: &transactionalID,
+			records: sarama.Records{RecordBatch: &sarama.RecordBatch{
+				Version:        2,
+				FirstTimestamp: firstTimestamp,
+				ProducerID:     4000,
+				ProducerEpoch:  3,
+				FirstSequence:  10,
+				Records: []*sarama.Record{
+					{Key: []byte("key1"), Value: []byte("first")},
+					{Key: []byte("key2"), Value: []byte("second"), TimestampDelta: 1500 * time.Millisecond, OffsetDelta: 1},
+				},
+			}},
+			expectedMetadata: []map[string]string{
+				{
+					message.MetadataChannel:              "demo",
+					message.MetadataKey:                  "key1",
+					message.MetadataTimestamp:            "2021-07-01T00:00:00Z",
+					message.MetadataKafkaAcks:            "-1",
+					message.MetadataKafkaTransactionalID: "my-transaction",
+					message.MetadataKafkaProducerID:      "4000",
+					message.MetadataKafkaProducerEpoch:   "3",
+					message.MetadataKafkaBaseSequence:    "10",
+				},
+				{
+					message.MetadataChannel:              "demo",
+					message.MetadataKey:                  "key2",
+					message.MetadataTimestamp:            "2021-07-01T00:00:01.5Z",
+					message.MetadataKafkaAcks:            "-1",
+					message.MetadataKafkaTransactionalID: "my-transaction",
+					message.MetadataKafkaProducerID:      "4000",
+					message.MetadataKafkaProducerEpoch:   "3",
+					message.MetadataKafkaBaseSequence:    "10",
+				},
+			},
+		},
+		{
+			name: "Record batch of non idempotent producer",
+			records: sarama.Records{RecordBatch: &sarama.RecordBatch{
+				Version:        2,
+				FirstTimestamp: firstTimestamp,
+				ProducerID:     -1,
+				ProducerEpoch:  -1,
+				FirstSequence:  -1,
+				Records:        []*sarama.Record{{Key: []byte("key1"), Value: []byte("first")}},
+			}},
+			expectedMetadata: []map[string]string{
+				{
+					message.MetadataChannel:   "demo",
+					message.MetadataKey:       "key1",
+					message.MetadataTimestamp: "2021-07-01T00:00:00Z",
+					message.MetadataKafkaAcks: "-1",
+				},
+			},
+		},
+		{
+			name: "Null keys are not set",
+			records: sarama.Records{RecordBatch: &sarama.RecordBatch{
+				Version:        2,
+				FirstTimestamp: firstTimestamp,
+				ProducerID:     -1,
+				Records:        []*sarama.Record{{Value: []byte("first")}, {Key: []byte{}, Value: []byte("second")}},
+			}},
+			expectedMetadata: []map[string]string{
+				{
+					message.MetadataChannel:   "demo",
+					message.MetadataTimestamp: "2021-07-01T00:00:00Z",
+					message.MetadataKafkaAcks: "-1",
+				},
+				{
+					message.MetadataChannel:   "demo",
+					message.MetadataKey:       "",
+					message.MetadataTimestamp: "2021-07-01T00:00:00Z",
+					message.MetadataKafkaAcks: "-1",
+				},
+			},
+		},
+		{
+			name: "Legacy message set",
+			records: sarama.Records{MsgSet: &sarama.MessageSet{Messages: []*sarama.MessageBlock{
+				{Msg: &sarama.Message{Version: 1, Key: []byte("key1"), Value: []byte("first"), Timestamp: firstTimestamp}},
+				{Msg: &sarama.Message{Key: []byte("key2"), Value: []byte("second")}}, // v0 messages have no timestamp.
+			}}},
+			expectedMetadata: []map[string]string{
+				{
+					message.MetadataChannel:   "demo",
+					message.MetadataKey:       "key1",
+					message.MetadataTimestamp: "2021-07-01T00:00:00Z",
+					message.MetadataKafkaAcks: "-1",
+				},
+				{
+					message.MetadataChannel:   "demo",
+					message.MetadataKey:       "key2",
+					message.MetadataKafkaAcks: "-1",
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := sarama.ProduceRequest{
+				TransactionalID: test.transactionalID,
+				RequiredAcks:    sarama.WaitForAll,
+				Records:         map[string]map[int32]sarama.Records{"demo": {0: test.records}},
+			}
+
+			msgs, err := new(ProduceRequestHandler).extractMessages(req)
+			require.NoError(t, err)
+			require.Len(t, msgs, len(test.expectedMetadata))
+			for i, msg := range msgs {
+				assert.Equal(t, test.expectedMetadata[i], map[string]string(msg.Metadata))
+			}
+		})
+	}
+}
+
+func TestProduceRequestHandler_extractMessages_compressedMessageSet(t *testing.T) {
+	for _, codec := range []sarama.CompressionCodec{sarama.CompressionGZIP, sarama.CompressionSnappy, sarama.CompressionLZ4} {
+		for _, version := range []int16{0, 2} {
+			t.Run(fmt.Sprintf("%s codec, produce request version %d", codec, version), func(t *testing.T) {
+				magic := int8(0)
+				if version >= 2 {
+					magic = 1
+				}
+
+				wrapper := compressedMessage(t, codec, magic, &sarama.MessageSet{Messages: []*sarama.MessageBlock{
+					{Offset: 0, Msg: &sarama.Message{Version: magic, Key: []byte("key1"), Value: []byte("first")}},
+					{Offset: 1, Msg: &sarama.Message{Version: magic, Key: []byte("key2"), Value: []byte("second")}},
+				}})
+
+				req := &sarama.ProduceRequest{Version: version, RequiredAcks: sarama.WaitForLocal}
+				req.AddSet("demo", 0, &sarama.MessageSet{Messages: []*sarama.MessageBlock{{Offset: 1, Msg: wrapper}}})
+				body, err := sarama.DoEncode(req, nil)
+				require.NoError(t, err)
+
+				decoded, err := decodeProduceRequest(version, body)
+				require.NoError(t, err)
+
+				msgs, err := new(ProduceRequestHandler).extractMessages(*decoded)
+				require.NoError(t, err)
+				require.Len(t, msgs, 2)
+				assert.Equal(t, "key1", msgs[0].Metadata.Get(message.MetadataKey))
+				assert.Equal(t, []byte("first"), []byte(msgs[0].Payload))
+				assert.Equal(t, "key2", msgs[1].Metadata.Get(message.MetadataKey))
+				assert.Equal(t, []byte("second"), []byte(msgs[1].Payload))
+			})
+		}
+	}
+}
+
+func TestUnwrapMessageSet(t *testing.T) {
+	createTime := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	appendTime := createTime.Add(time.Minute)
+	tests := []struct {
+		name               string
+		set                *sarama.MessageSet
+		expectedOffsets    []int64
+		expectedValues     []string
+		expectedTimestamps []time.Time
+	}{
+		{
+			name: "Uncompressed messages are kept",
+			set: &sarama.MessageSet{Messages: []*sarama.MessageBlock{
+				{Offset: 0, Msg: &sarama.Message{Version: 1, Value: []byte("first"), Timestamp: createTime}},
+				{Offset: 1, Msg: &sarama.Message{Version: 1, Value: []byte("second"), Timestamp: createTime}},
+			}},
+			expectedOffsets:    []int64{0, 1},
+			expectedValues:     []string{"first", "second"},
+			expectedTimestamps: []time.Time{createTime, createTime},
+		},
+		{
+			name: "v1 wrapper offset is the offset of the last inner message",
+			set: &sarama.MessageSet{Messages: []*sarama.MessageBlock{
+				{Offset: 10, Msg: &sarama.Message{Version: 1, Codec: sarama.CompressionGZIP, Timestamp: appendTime, Set: &sarama.MessageSet{Messages: []*sarama.MessageBlock{
+					{Offset: 0, Msg: &sarama.Message{Version: 1, Value: []byte("first"), Timestamp: createTime}},
+					{Offset: 1, Msg: &sarama.Message{Version: 1, Value: []byte("second"), Timestamp: createTime}},
+				}}}},
+			}},
+			expectedOffsets:    []int64{9, 10},
+			expectedValues:     []string{"first", "second"},
+			expectedTimestamps: []time.Time{createTime, createTime},
+		},
+		{
+			name: "v1 wrapper with LogAppendTime overrides inner timestamps",
+			set: &sarama.MessageSet{Messages: []*sarama.MessageBlock{
+				{Offset: 1, Msg: &sarama.Message{Version: 1, Codec: sarama.CompressionGZIP, LogAppendTime: true, Timestamp: appendTime, Set: &sarama.MessageSet{Messages: []*sarama.MessageBlock{
+					{Offset: 0, Msg: &sarama.Message{Version: 1, Value: []byte("first"), Timestamp: createTime}},
+					{Offset: 1, Msg: &sarama.Message{Version: 1, Value: []byte("second"), Timestamp: createTime}},
+				}}}},
+			}},
+			expectedOffsets:    []int64{0, 1},
+			expectedValues:     []string{"first", "second"},
+			expectedTimestamps: []time.Time{appendTime, appendTime},
+		},
+		{
+			name: "v0 wrapper keeps inner offsets",
+			set: &sarama.MessageSet{Messages: []*sarama.MessageBlock{
+				{Offset: 7, Msg: &sarama.Message{Codec: sarama.CompressionSnappy, Set: &sarama.MessageSet{Messages: []*sarama.MessageBlock{
+					{Offset: 3, Msg: &sarama.Message{Value: []byte("first")}},
+					{Offset: 4, Msg: &sarama.Message{Value: []byte("second")}},
+				}}}},
+			}},
+			expectedOffsets:    []int64{3, 4},
+			expectedValues:     []string{"first", "second"},
+			expectedTimestamps: []time.Time{{}, {}},
+		},
+		{
+			name: "Nested wrappers are unwrapped recursively",
+			set: &sarama.MessageSet{Messages: []*sarama.MessageBlock{
+				{Offset: 0, Msg: &sarama.Message{Version: 1, Value: []byte("first"), Timestamp: createTime}},
+				{Offset: 2, Msg: &sarama.Message{Version: 1, Codec: sarama.CompressionLZ4, Set: &sarama.MessageSet{Messages: []*sarama.MessageBlock{
+					{Offset: 0, Msg: &sarama.Message{Version: 1, Codec: sarama.CompressionGZIP, Set: &sarama.MessageSet{Messages: []*sarama.MessageBlock{
+						{Offset: 0, Msg: &sarama.Message{Version: 1, Value: []byte("second"), Timestamp: createTime}},
+					}}}},
+					{Offset: 1, Msg: &sarama.Message{Version: 1, Value: []byte("third"), Timestamp: createTime}},
+				}}}},
+			}},
+			expectedOffsets:    []int64{0, 1, 2},
+			expectedValues:     []string{"first", "second", "third"},
+			expectedTimestamps: []time.Time{createTime, createTime, createTime},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blocks := unwrapMessageSet(test.set)
+			require.Len(t, blocks, len(test.expectedValues))
+			for i, b := range blocks {
+				assert.Equal(t, test.expectedOffsets[i], b.Offset)
+				assert.Equal(t, test.expectedValues[i], string(b.Msg.Value))
+				assert.Equal(t, test.expectedTimestamps[i], b.Msg.Timestamp)
+			}
+		})
+	}
+}
+
+// compressedMessage creates a wrapper message holding the given message set compressed with the given codec.
+func compressedMessage(t *testing.T, codec sarama.CompressionCodec, version int8, set *sarama.MessageSet) *sarama.Message {
+	raw, err := sarama.DoEncode(set, nil)
+	require.NoError(t, err)
+
+	return &sarama.Message{Version: version, Codec: codec, Value: raw}
+}
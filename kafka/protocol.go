@@ -0,0 +1,402 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	kafkaprotocol "github.com/grepplabs/kafka-proxy/proxy/protocol"
+	"github.com/pkg/errors"
+)
+
+// Kafka request API Keys. See https://kafka.apache.org/protocol#protocol_api_keys.
+const (
+	// RequestAPIKeyProduce is the Kafka request API Key for the Produce Request.
+	RequestAPIKeyProduce = 0
+
+	requestAPIKeySASLHandshake    = 17
+	requestAPIKeyAPIVersions      = 18
+	requestAPIKeySASLAuthenticate = 36
+)
+
+// maxRequestSize is the max size of a request read by the proxy. Same as the default `socket.request.max.bytes` broker config.
+const maxRequestSize = 100 * 1024 * 1024
+
+// Request is a Kafka request sent by a client.
+type Request struct {
+	APIKey        int16
+	APIVersion    int16
+	CorrelationID int32
+	ClientID      string
+	// Body holds the request payload following the client ID. For flexible versions, it starts with the header tagged fields.
+	Body []byte
+
+	// raw holds the whole request as read from the client, including the size.
+	raw []byte
+	// throttleTime is set by handlers if the client exceeded a quota. No further requests are read from the client meanwhile.
+	throttleTime time.Duration
+}
+
+// ExpectsResponse returns true if the client waits for a response. Only Produce requests with acks=0 are not answered.
+func (r *Request) ExpectsResponse() bool {
+	if r.APIKey != RequestAPIKeyProduce {
+		return true
+	}
+
+	acks, err := produceAcks(r.APIVersion, r.Body)
+	return err != nil || acks != 0
+}
+
+// responseHeaderVersion returns the version of the response header for this request. 1 means flexible header.
+func (r *Request) responseHeaderVersion() int16 {
+	if r.APIKey == RequestAPIKeyProduce && r.APIVersion >= firstFlexibleProduceVersion {
+		return 1
+	}
+
+	return (&kafkaprotocol.RequestKeyVersion{ApiKey: r.APIKey, ApiVersion: r.APIVersion}).ResponseHeaderVersion()
+}
+
+// readRequest reads a request from r.
+func readRequest(r io.Reader) (*Request, error) {
+	sizeBuf := make([]byte, 4)
+	if _, err := io.ReadFull(r, sizeBuf); err != nil {
+		return nil, err
+	}
+
+	size := int32(binary.BigEndian.Uint32(sizeBuf))
+	if size < 8 || size > maxRequestSize {
+		return nil, fmt.Errorf("invalid request size %d", size)
+	}
+
+	raw := make([]byte, 4+size)
+	copy(raw, sizeBuf)
+	if _, err := io.ReadFull(r, raw[4:]); err != nil {
+		return nil, err
+	}
+
+	d := &packetDecoder{b: raw[4:]}
+	req := &Request{raw: raw}
+	req.APIKey, _ = d.int16()
+	req.APIVersion, _ = d.int16()
+	req.CorrelationID, _ = d.int32()
+
+	clientID, err := d.nullableString()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decoding client id of request with api key %d", req.APIKey)
+	}
+
+	req.ClientID = clientID
+	req.Body = d.remaining()
+
+	return req, nil
+}
+
+// writeResponse writes a response with the given body for the given request.
+func writeResponse(w io.Writer, req *Request, body []byte) error {
+	header := &packetEncoder{}
+	size := 4 + len(body)
+	if req.responseHeaderVersion() == 1 {
+		size++ // empty tagged fields
+	}
+
+	header.int32(int32(size))
+	header.int32(req.CorrelationID)
+	if req.responseHeaderVersion() == 1 {
+		header.uvarint(0)
+	}
+
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+
+	_, err := w.Write(body)
+	return err
+}
+
+// produceAcks returns the acks of a Produce request given its body.
+func produceAcks(version int16, body []byte) (int16, error) {
+	d := &packetDecoder{b: body}
+	switch {
+	case version < 3:
+	case version < 9:
+		if _, err := d.nullableString(); err != nil { // transactional_id
+			return 0, err
+		}
+	default:
+		if err := d.taggedFields(); err != nil {
+			return 0, err
+		}
+		if _, err := d.compactNullableString(); err != nil { // transactional_id
+			return 0, err
+		}
+	}
+
+	return d.int16()
+}
+
+// capAPIVersions lowers the max Produce version advertised by the given ApiVersions response body to maxProduceVersion,
+// so clients never send Produce requests the proxy can't decode. The body is modified in place.
+// See https://kafka.apache.org/protocol#The_Messages_ApiVersions.
+func capAPIVersions(version int16, body []byte) error {
+	d := &packetDecoder{b: body}
+	errCode, err := d.int16()
+	if err != nil || errCode != 0 {
+		// Brokers answer unsupported versions with an error, so the client retries with a lower version.
+		return err
+	}
+
+	var count int
+	if version >= 3 {
+		count, err = d.compactArrayLength()
+	} else {
+		var n int32
+		n, err = d.int32()
+		count = int(n)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		key, err := d.int16()
+		if err != nil {
+			return err
+		}
+
+		if _, err := d.int16(); err != nil { // min_version
+			return err
+		}
+
+		maxVersionOffset := d.off
+		maxVersion, err := d.int16()
+		if err != nil {
+			return err
+		}
+
+		if key == RequestAPIKeyProduce && maxVersion > maxProduceVersion {
+			binary.BigEndian.PutUint16(body[maxVersionOffset:], maxProduceVersion)
+		}
+
+		if version >= 3 {
+			if err := d.taggedFields(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// packetEncoder encodes Kafka protocol primitive types. See https://kafka.apache.org/protocol#protocol_types.
+type packetEncoder struct {
+	bytes.Buffer
+}
+
+func (e *packetEncoder) int16(v int16) {
+	_ = binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *packetEncoder) int32(v int32) {
+	_ = binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *packetEncoder) int64(v int64) {
+	_ = binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *packetEncoder) uvarint(v uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, v)
+	_, _ = e.Write(buf[:n])
+}
+
+func (e *packetEncoder) string(v string) {
+	e.int16(int16(len(v)))
+	_, _ = e.WriteString(v)
+}
+
+func (e *packetEncoder) nullableString(v *string) {
+	if v == nil {
+		e.int16(-1)
+		return
+	}
+	e.string(*v)
+}
+
+func (e *packetEncoder) compactArrayLength(n int) {
+	e.uvarint(uint64(n + 1))
+}
+
+func (e *packetEncoder) compactString(v string) {
+	e.uvarint(uint64(len(v) + 1))
+	_, _ = e.WriteString(v)
+}
+
+func (e *packetEncoder) compactNullableString(v *string) {
+	if v == nil {
+		e.uvarint(0)
+		return
+	}
+	e.compactString(*v)
+}
+
+// emptyTaggedFields encodes no tagged fields.
+func (e *packetEncoder) emptyTaggedFields() {
+	e.uvarint(0)
+}
+
+func (e *packetEncoder) bytes(v []byte) {
+	e.int32(int32(len(v)))
+	_, _ = e.Write(v)
+}
+
+// packetDecoder decodes Kafka protocol primitive types. See https://kafka.apache.org/protocol#protocol_types.
+type packetDecoder struct {
+	b   []byte
+	off int
+}
+
+var errInsufficientData = errors.New("insufficient data to decode packet")
+
+func (d *packetDecoder) read(n int) ([]byte, error) {
+	if n < 0 || d.off+n > len(d.b) {
+		return nil, errInsufficientData
+	}
+
+	v := d.b[d.off : d.off+n]
+	d.off += n
+	return v, nil
+}
+
+func (d *packetDecoder) remaining() []byte {
+	return d.b[d.off:]
+}
+
+func (d *packetDecoder) int16() (int16, error) {
+	v, err := d.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return int16(binary.BigEndian.Uint16(v)), nil
+}
+
+func (d *packetDecoder) int32() (int32, error) {
+	v, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(v)), nil
+}
+
+func (d *packetDecoder) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(d.remaining())
+	if n <= 0 {
+		return 0, errInsufficientData
+	}
+	d.off += n
+	return v, nil
+}
+
+// nullableString decodes a nullable string. Null is decoded as an empty string.
+func (d *packetDecoder) nullableString() (string, error) {
+	n, err := d.int16()
+	if err != nil || n < 0 {
+		return "", err
+	}
+
+	v, err := d.read(int(n))
+	if err != nil {
+		return "", err
+	}
+	return string(v), nil
+}
+
+// compactNullableString decodes a compact nullable string. Null is decoded as an empty string.
+func (d *packetDecoder) compactNullableString() (string, error) {
+	n, err := d.uvarint()
+	if err != nil || n == 0 {
+		return "", err
+	}
+
+	v, err := d.read(int(n - 1))
+	if err != nil {
+		return "", err
+	}
+	return string(v), nil
+}
+
+// compactString decodes a compact string.
+func (d *packetDecoder) compactString() (string, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return "", err
+	}
+
+	if n == 0 {
+		return "", errors.New("compact string should not be null")
+	}
+
+	v, err := d.read(int(n - 1))
+	if err != nil {
+		return "", err
+	}
+	return string(v), nil
+}
+
+// compactNullableBytes decodes compact nullable bytes. Null is decoded as nil.
+func (d *packetDecoder) compactNullableBytes() ([]byte, error) {
+	n, err := d.uvarint()
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	return d.read(int(n - 1))
+}
+
+// compactArrayLength decodes the length of a compact array. Null is decoded as -1.
+func (d *packetDecoder) compactArrayLength() (int, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return 0, err
+	}
+
+	if n > uint64(len(d.remaining())) {
+		return 0, errInsufficientData
+	}
+	return int(n) - 1, nil
+}
+
+func (d *packetDecoder) bytes() ([]byte, error) {
+	n, err := d.int32()
+	if err != nil || n < 0 {
+		return nil, err
+	}
+	return d.read(int(n))
+}
+
+// taggedFields skips tagged fields.
+func (d *packetDecoder) taggedFields() error {
+	n, err := d.uvarint()
+	if err != nil {
+		return err
+	}
+
+	for i := uint64(0); i < n; i++ {
+		if _, err := d.uvarint(); err != nil { // tag
+			return err
+		}
+
+		size, err := d.uvarint()
+		if err != nil {
+			return err
+		}
+
+		if _, err := d.read(int(size)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,42 +1,81 @@
 package kafka
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
-	"io"
 	"net"
-	"strings"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	watermillkafka "github.com/ThreeDotsLabs/watermill-kafka/v2/pkg/kafka"
 	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
-	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
 	"github.com/asyncapi/event-gateway/message"
 	"github.com/asyncapi/event-gateway/proxy"
-	server "github.com/grepplabs/kafka-proxy/cmd/kafka-proxy"
-	kafkaproxy "github.com/grepplabs/kafka-proxy/proxy"
-	kafkaprotocol "github.com/grepplabs/kafka-proxy/proxy/protocol"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
-// Kafka request API Keys. See https://kafka.apache.org/protocol#protocol_api_keys.
 const (
-	// RequestAPIKeyProduce is the Kafka request API Key for the Produce Request.
-	RequestAPIKeyProduce = 0
+	messagesChannelName = "kafka-produced-messages"
 )
 
 const (
-	messagesChannelName = "kafka-produced-messages"
+	defaultLocalAddress = "0.0.0.0"
+	defaultProxyName    = "kafka"
 )
 
-const defaultLocalAddress = "0.0.0.0"
+// Protocols are the AsyncAPI server protocols supported by the Kafka proxy.
+var Protocols = []string{"kafka", "kafka-secure"}
 
 var defaultMarshaler = watermillkafka.DefaultMarshaler{}
 
+// RequestHandler handles the requests of a given API key before they are forwarded to the brokers.
+type RequestHandler interface {
+	// Handle handles the given request. If a response is returned, the request is answered with it instead of being forwarded to the broker.
+	// The response should not include the response header. Returning an error closes the connection with the client.
+	Handle(req *Request) (response []byte, err error)
+}
+
+// Proxy is a Kafka proxy. Kafka clients connect to the brokers through its listeners, one per broker.
+// Broker addresses are rewritten in the responses, so clients keep connecting through the proxy. Listeners for those brokers
+// not configured in ProxyConfig.BrokersMapping are created on the fly (dynamic listeners).
+type Proxy struct {
+	config      *ProxyConfig
+	extra       *extraConfig
+	handlers    map[int16]RequestHandler
+	dialer      *brokerDialer
+	listenerTLS *tls.Config
+	bootstrap   []*brokerListener
+
+	lock sync.RWMutex
+	// listeners indexed by broker address.
+	listeners    map[string]*brokerListener
+	conns        map[*connection]struct{}
+	dynamicPorts *DynamicPorts
+	ctx          context.Context
+	running      bool
+	stopped      bool
+	wg           sync.WaitGroup
+	ready        chan struct{}
+	// done is closed once the proxy is stopped.
+	done chan struct{}
+}
+
+var _ proxy.Proxy = (*Proxy)(nil)
+
+type brokerListener struct {
+	brokerAddress     string
+	listenerAddress   string
+	advertisedAddress string
+	listener          net.Listener
+}
+
 // NewProxy creates a new Kafka Proxy based on a given configuration.
-func NewProxy(c *ProxyConfig, r *watermillmessage.Router) (proxy.Proxy, error) {
+func NewProxy(c *ProxyConfig, r *watermillmessage.Router) (*Proxy, error) {
 	if c == nil {
 		return nil, errors.New("config should be provided")
 	}
@@ -45,183 +84,456 @@ func NewProxy(c *ProxyConfig, r *watermillmessage.Router) (proxy.Proxy, error) {
 		return nil, err
 	}
 
-	kafkaproxy.ActualDefaultRequestHandler.RequestKeyHandlers.Set(RequestAPIKeyProduce, NewProduceRequestHandler(r, c.MessageHandler, c.MessagePublisher, c.PublishToTopic))
+	extra, err := c.extraConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := newBrokerDialer(extra.tls, c.SASL, extra.dialAddressMapping)
+	if err != nil {
+		return nil, err
+	}
 
-	// Binding to all local network interfaces instead of 127.0.0.1. Sometimes needed for external calls such as health checks.
-	_ = server.Server.Flags().Set("default-listener-ip", defaultLocalAddress)
+	p := &Proxy{
+		config:       c,
+		extra:        extra,
+		handlers:     make(map[int16]RequestHandler),
+		dialer:       dialer,
+		listeners:    make(map[string]*brokerListener),
+		conns:        make(map[*connection]struct{}),
+		dynamicPorts: c.DynamicPorts,
+		ready:        make(chan struct{}),
+		done:         make(chan struct{}),
+	}
 
-	reachableAddress := c.Address
-	if reachableAddress == "" {
-		reachableAddress = defaultLocalAddress
+	if p.dynamicPorts == nil {
+		p.dynamicPorts = new(DynamicPorts)
 	}
 
-	for _, v := range c.BrokersMapping {
-		values := strings.Split(v, ",")
-		if len(values) == 2 && reachableAddress != defaultLocalAddress {
-			// If there is no advertisedAddress set in the mapping (there is no third value) but an address has been set for the proxy,
-			// then advertise brokers using that given proxy address so Kafka clients can reach the brokers through the proxy.
-			_, localBindingPort, _ := net.SplitHostPort(values[1])
-			v += fmt.Sprintf(",%s:%s", reachableAddress, localBindingPort)
+	if c.ListenerTLS != nil {
+		if p.listenerTLS, err = c.ListenerTLS.Config(); err != nil {
+			return nil, errors.Wrap(err, "error configuring listener TLS")
 		}
+	}
 
-		_ = server.Server.Flags().Set("bootstrap-server-mapping", v)
+	produceHandler := newProduceRequestHandler("on-produce-request-"+p.Name(), r, c.MessageHandler, c.MessagePublisher, c.PublishToTopic, c.ValidationQueue)
+	produceHandler.sampler = c.Sampler
+	produceHandler.policies = c.ProducePolicies
+	produceHandler.violationHandler = c.PolicyViolationHandler
+	if c.ProduceQuotas != nil && c.ProduceQuotas.Mode.IsEnabled() {
+		produceHandler.quotas = newProduceQuotas(*c.ProduceQuotas, c.ProduceRates)
+	}
+	p.handlers[RequestAPIKeyProduce] = produceHandler
+
+	for _, l := range c.BrokerListeners() {
+		p.bootstrap = append(p.bootstrap, &brokerListener{
+			brokerAddress:     l.Broker,
+			listenerAddress:   l.ListenAt,
+			advertisedAddress: l.AdvertisedAs,
+		})
 	}
 
-	// As previously done for bootstrap brokers, all dynamic listeners created when brokers are discovered
-	// will be advertised to Kafka clients using the configured address or a default.
-	_ = server.Server.Flags().Set("dynamic-advertised-listener", reachableAddress)
+	return p, nil
+}
 
-	for _, v := range c.DialAddressMapping {
-		_ = server.Server.Flags().Set("dial-address-mapping", v)
+// Name returns the name of the proxy.
+func (p *Proxy) Name() string {
+	if p.config.Name == "" {
+		return defaultProxyName
 	}
 
-	if c.TLS != nil && c.TLS.Enable {
-		_ = server.Server.Flags().Set("tls-enable", "true")
-		_ = server.Server.Flags().Set("tls-insecure-skip-verify", fmt.Sprintf("%v", c.TLS.InsecureSkipVerify))
-		_ = server.Server.Flags().Set("tls-client-cert-file", c.TLS.ClientCertFile)
-		_ = server.Server.Flags().Set("tls-client-key-file", c.TLS.ClientKeyFile)
-		_ = server.Server.Flags().Set("tls-ca-chain-cert-file", c.TLS.CAChainCertFile)
+	return p.config.Name
+}
+
+// Start starts listening for Kafka clients without blocking. The proxy is stopped once the given context is done.
+func (p *Proxy) Start(ctx context.Context) error {
+	if err := p.start(ctx); err != nil {
+		_ = p.Stop()
+		return err
 	}
 
-	if c.Debug {
-		_ = server.Server.Flags().Set("log-level", "debug")
+	close(p.ready)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = p.Stop()
+		case <-p.done:
+		}
+	}()
+
+	return nil
+}
+
+// Stop closes all listeners and connections, blocking until they are closed.
+func (p *Proxy) Stop() error {
+	p.lock.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.done)
+	}
+	for _, l := range p.listeners {
+		_ = l.listener.Close()
+	}
+	for c := range p.conns {
+		c.close()
 	}
+	p.lock.Unlock()
+
+	p.wg.Wait()
+
+	return nil
+}
+
+// Ready is closed once the proxy is listening for Kafka clients.
+func (p *Proxy) Ready() <-chan struct{} {
+	return p.ready
+}
 
-	// Some config can be overridden here. It is intentional.
-	for _, v := range c.ExtraConfig {
-		f := strings.Split(v, "=")
-		_ = server.Server.Flags().Set(f[0], f[1])
+// ValidationQueueStats returns the count of produced messages per outcome of the validation queue.
+func (p *Proxy) ValidationQueueStats() proxy.ValidationQueueStats {
+	produceHandler, ok := p.handlers[RequestAPIKeyProduce].(*ProduceRequestHandler)
+	if !ok || produceHandler.queue == nil {
+		return proxy.ValidationQueueStats{}
 	}
 
-	return func(ctx context.Context) error {
-		return server.Server.Execute()
-	}, nil
+	return produceHandler.queue.Stats()
 }
 
-// NewProduceRequestHandler creates a new request key handler for the Produce Request.
-func NewProduceRequestHandler(r *watermillmessage.Router, handler watermillmessage.HandlerFunc, publisher watermillmessage.Publisher, publishToTopic string) kafkaproxy.KeyHandler {
-	if handler == nil {
-		return &produceRequestHandler{}
+// ProduceRequestStats returns the count of Produce requests that were inspected and the ones that could not be.
+func (p *Proxy) ProduceRequestStats() ProduceRequestStats {
+	produceHandler, ok := p.handlers[RequestAPIKeyProduce].(*ProduceRequestHandler)
+	if !ok {
+		return ProduceRequestStats{}
 	}
 
-	chanConfig := gochannel.Config{
-		OutputChannelBuffer: 100, // TODO consider making this configurable
+	return produceHandler.stats.load()
+}
+
+// Listeners returns the address of the listener of each broker, indexed by broker address. Dynamic listeners are included.
+func (p *Proxy) Listeners() map[string]string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	listeners := make(map[string]string, len(p.listeners))
+	for broker, l := range p.listeners {
+		listeners[broker] = l.listener.Addr().String()
 	}
 
-	goChannelPubSub := gochannel.NewGoChannel(chanConfig, message.NewWatermillLogrusLogger(logrus.StandardLogger()))
+	return listeners
+}
+
+func (p *Proxy) start(ctx context.Context) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.running {
+		return errors.New("proxy is already running")
+	}
+
+	p.running = true
+	p.ctx = ctx
+	for _, l := range p.bootstrap {
+		if err := p.listen(l); err != nil {
+			return err
+		}
+
+		logrus.Infof("Bootstrap server %s advertised as %s", l.brokerAddress, l.advertisedAddress)
+	}
+
+	return nil
+}
+
+// listen starts listening for clients of the given broker. Lock should be held.
+func (p *Proxy) listen(l *brokerListener) error {
+	listener, err := net.Listen("tcp", l.listenerAddress)
+	if err != nil {
+		return errors.Wrapf(err, "error listening at %s for broker %s", l.listenerAddress, l.brokerAddress)
+	}
+
+	if p.listenerTLS != nil {
+		listener = tls.NewListener(listener, p.listenerTLS)
+	}
+
+	// Listening on port 0 means a random port.
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	if host, advertisedPort, _ := net.SplitHostPort(l.advertisedAddress); advertisedPort == "0" {
+		l.advertisedAddress = net.JoinHostPort(host, port)
+	}
+
+	l.listener = listener
+	p.listeners[l.brokerAddress] = l
+
+	p.wg.Add(1)
+	go p.accept(l)
+
+	return nil
+}
+
+func (p *Proxy) accept(l *brokerListener) {
+	defer p.wg.Done()
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logrus.WithError(err).Errorf("Error accepting connections at %s for broker %s", l.listenerAddress, l.brokerAddress)
+			}
+			return
+		}
+
+		p.wg.Add(1)
+		go p.handleConn(conn, l.brokerAddress)
+	}
+}
+
+func (p *Proxy) handleConn(client net.Conn, brokerAddress string) {
+	defer p.wg.Done()
+
+	broker, err := p.dialer.dial(p.ctx, brokerAddress)
+	if err != nil {
+		logrus.WithError(err).Errorf("Error connecting to broker %s", brokerAddress)
+		_ = client.Close()
+		return
+	}
+
+	c := newConnection(client, broker, brokerAddress, p)
+
+	p.lock.Lock()
+	if p.stopped {
+		p.lock.Unlock()
+		c.close()
+		return
+	}
+	p.conns[c] = struct{}{}
+	p.lock.Unlock()
+
+	c.serve()
+
+	p.lock.Lock()
+	delete(p.conns, c)
+	p.lock.Unlock()
+}
+
+// advertisedAddress returns the address advertised to clients for the given broker.
+// A dynamic listener is created if the broker has none.
+func (p *Proxy) advertisedAddress(brokerHost string, brokerPort int32) (string, int32, error) {
+	if brokerHost == "" || brokerPort <= 0 {
+		return "", 0, fmt.Errorf("broker address '%s:%d' is invalid", brokerHost, brokerPort)
+	}
+
+	brokerAddress := net.JoinHostPort(brokerHost, strconv.Itoa(int(brokerPort)))
+
+	p.lock.RLock()
+	l, ok := p.listeners[brokerAddress]
+	p.lock.RUnlock()
+
+	if !ok {
+		var err error
+		if l, err = p.listenDynamic(brokerAddress); err != nil {
+			return "", 0, err
+		}
+	}
+
+	host, port, err := net.SplitHostPort(l.advertisedAddress)
+	if err != nil {
+		return "", 0, err
+	}
+
+	portNumber, err := strconv.Atoi(port)
+	return host, int32(portNumber), err
+}
+
+func (p *Proxy) listenDynamic(brokerAddress string) (*brokerListener, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// Double check as the listener could have been created meanwhile.
+	if l, ok := p.listeners[brokerAddress]; ok {
+		return l, nil
+	}
+
+	if p.stopped {
+		return nil, errors.New("proxy is stopped")
+	}
+
+	l := &brokerListener{
+		brokerAddress:     brokerAddress,
+		listenerAddress:   net.JoinHostPort(p.extra.defaultListenerIP, strconv.Itoa(p.dynamicPorts.next(p.extra.dynamicSequentialMinPort))),
+		advertisedAddress: net.JoinHostPort(p.extra.dynamicAdvertisedListener, "0"),
+	}
+
+	if err := p.listen(l); err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Dynamic listener %s for broker %s advertised as %s", l.listener.Addr(), brokerAddress, l.advertisedAddress)
+
+	return l, nil
+}
+
+// NewProduceRequestHandler creates a new request key handler for the Produce Request.
+// Produced messages are validated by the default validation queue (see proxy.ValidationQueueConfig).
+func NewProduceRequestHandler(r *watermillmessage.Router, handler watermillmessage.HandlerFunc, publisher watermillmessage.Publisher, publishToTopic string) *ProduceRequestHandler {
+	return newProduceRequestHandler("on-produce-request", r, handler, publisher, publishToTopic, proxy.ValidationQueueConfig{})
+}
+
+// newProduceRequestHandler creates a new request key handler for the Produce Request. The name of the router handler should be unique.
+// Produced messages wait in a queue until being handled by one of the workers of the router handler.
+func newProduceRequestHandler(name string, r *watermillmessage.Router, handler watermillmessage.HandlerFunc, publisher watermillmessage.Publisher, publishToTopic string, queueConfig proxy.ValidationQueueConfig) *ProduceRequestHandler {
+	if handler == nil {
+		return &ProduceRequestHandler{}
+	}
+
+	queue := proxy.NewValidationQueue(queueConfig)
 	if publisher == nil {
 		// This time we use a noPublisher handler, so converting the given handler.
 		h := func(msg *watermillmessage.Message) error {
 			_, err := handler(msg)
 			return err
 		}
-		r.AddNoPublisherHandler("on-produce-request", messagesChannelName, goChannelPubSub, h)
+		r.AddNoPublisherHandler(name, messagesChannelName, queue, h)
 	} else {
-		r.AddHandler("on-produce-request", messagesChannelName, goChannelPubSub, publishToTopic, publisher, handler)
+		r.AddHandler(name, messagesChannelName, queue, publishToTopic, publisher, handler)
 	}
 
-	return &produceRequestHandler{
-		publisher: goChannelPubSub,
+	return &ProduceRequestHandler{
+		publisher: queue,
+		queue:     queue,
 	}
 }
 
-type produceRequestHandler struct {
-	publisher watermillmessage.Publisher
+// ProduceRequestHandler is a RequestHandler for Produce requests.
+// Produced messages are published for being handled and requests are checked against the configured policies.
+type ProduceRequestHandler struct {
+	// stats is the first field, so its counters are 64-bit aligned for atomic operations.
+	stats            ProduceRequestStats
+	publisher        watermillmessage.Publisher
+	queue            *proxy.ValidationQueue
+	sampler          *message.Sampler
+	policies         []ProducePolicyConfig
+	quotas           *produceQuotas
+	violationHandler PolicyViolationHandler
 }
 
-func (h *produceRequestHandler) Handle(requestKeyVersion *kafkaprotocol.RequestKeyVersion, src io.Reader, ctx *kafkaproxy.RequestsLoopContext, bufferRead *bytes.Buffer) (shouldReply bool, err error) {
-	if h.publisher == nil {
+// Handle handles a Produce request. Requests violating any enforced policy are answered with TOPIC_AUTHORIZATION_FAILED
+// instead of being forwarded to the broker. Same for requests with messages exceeding the max size of an enforced quota,
+// answered with MESSAGE_TOO_LARGE. Clients exceeding the rate of an enforced quota are throttled.
+func (h *ProduceRequestHandler) Handle(r *Request) ([]byte, error) {
+	if h.publisher == nil && len(h.policies) == 0 && h.quotas == nil {
 		logrus.Infoln("No message publisher is set. Skipping produceRequestHandler")
-		return true, nil
+		return nil, nil
 	}
 
-	if requestKeyVersion.ApiKey != RequestAPIKeyProduce {
-		return true, nil
+	if r.APIKey != RequestAPIKeyProduce {
+		return nil, nil
 	}
 
-	// TODO error handling should be responsibility of an error handler instead of being just logged.
-	shouldReply, err = kafkaproxy.DefaultProduceKeyHandlerFunc(requestKeyVersion, src, ctx, bufferRead)
+	decoded, err := decodeProduceRequest(r.APIVersion, r.Body)
 	if err != nil {
-		return
+		// The request is forwarded as it is. Neither policies are checked nor messages are validated.
+		h.stats.uninspected()
+		logrus.WithError(err).WithFields(logrus.Fields{"version": r.APIVersion, "clientId": r.ClientID}).Warn("Produce request could not be inspected")
+		return nil, nil
 	}
 
-	msg := make([]byte, int64(requestKeyVersion.Length-int32(4+bufferRead.Len())))
-	if _, err = io.ReadFull(io.TeeReader(src, bufferRead), msg); err != nil {
-		return
+	h.stats.inspected()
+	req := *decoded
+
+	topics := make([]string, 0, len(req.Records))
+	for topic := range req.Records {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	rejected := checkProducePolicies(h.policies, h.violationHandler, r.ClientID, topics)
+	if len(rejected) == 0 && h.quotas != nil {
+		var violations []PolicyViolation
+		violations, r.throttleTime = h.quotas.check(r.ClientID, topics, req.Records)
+		rejected = reportViolations(h.violationHandler, violations)
 	}
 
-	// Hack for making compatible greplabs/kafka-proxy processor with Shopify/sarama ProduceRequest.
-	// As both Transactional ID and ACKs has been read already by the processor, we fake them here because the Sarama decoder expects them to be present.
-	// This information is not going to be used later on, as this is a read-only message.
-	// transactional_id_size: 255, 255 | acks: 0, 1
-	// TODO is there a way this info can be subtracted from kafka-proxy?
-	msg = append([]byte{255, 255, 0, 1}, msg...)
+	if len(rejected) > 0 {
+		return produceRejectedResponse(r.APIVersion, req, rejected, r.throttleTime)
+	}
 
-	var req sarama.ProduceRequest
-	if err = sarama.DoVersionedDecode(msg, &req, requestKeyVersion.ApiVersion); err != nil {
-		logrus.WithError(err).Error("error decoding ProduceRequest")
-		return shouldReply, nil
+	if h.publisher == nil {
+		return nil, nil
 	}
 
 	msgs, err := h.extractMessages(req)
 	if err != nil {
 		logrus.WithError(err).Error("error extracting messages")
-		return shouldReply, nil
+		return nil, nil
 	}
 
 	if len(msgs) == 0 {
-		logrus.Error("Unexpected error: The produce request has no messages")
-		return
+		if h.sampler == nil {
+			logrus.Error("Unexpected error: The produce request has no messages")
+		}
+
+		return nil, nil
 	}
 
 	if err := h.publisher.Publish(messagesChannelName, msgs...); err != nil {
 		logrus.WithError(err).Error("error handling message")
-		return shouldReply, nil
+		return nil, nil
 	}
 
-	return shouldReply, nil
+	return nil, nil
 }
 
-func (h *produceRequestHandler) extractMessages(req sarama.ProduceRequest) ([]*watermillmessage.Message, error) {
+func (h *ProduceRequestHandler) extractMessages(req sarama.ProduceRequest) ([]*watermillmessage.Message, error) {
+	requestMetadata := map[string]string{
+		message.MetadataKafkaAcks: strconv.Itoa(int(req.RequiredAcks)),
+	}
+
+	if req.TransactionalID != nil {
+		requestMetadata[message.MetadataKafkaTransactionalID] = *req.TransactionalID
+	}
+
 	var msgs []*watermillmessage.Message
 	for topic, records := range req.Records {
 		for partition, s := range records {
 			if s.RecordBatch != nil {
+				batchMetadata := recordBatchMetadata(s.RecordBatch)
 				for _, r := range s.RecordBatch.Records {
-					msg, err := defaultMarshaler.Unmarshal(&sarama.ConsumerMessage{
+					if !h.sample(topic, r.Key) {
+						continue
+					}
+
+					msg, err := newMessage(&sarama.ConsumerMessage{
 						Headers:   r.Headers,
 						Key:       r.Key,
 						Value:     r.Value,
 						Topic:     topic,
 						Partition: partition,
-					})
+						Timestamp: s.RecordBatch.FirstTimestamp.Add(r.TimestampDelta),
+					}, requestMetadata, batchMetadata)
 					if err != nil {
 						return nil, err
 					}
 
-					// Injecting the current Channel (kafka topic here) into the message Metadata (where Kafka headers are stored as well).
-					msg.Metadata.Set(message.MetadataChannel, topic)
-					msg.UUID = string(r.Key)
 					msgs = append(msgs, msg)
 				}
 			}
 			if s.MsgSet != nil {
-				for _, mb := range s.MsgSet.Messages {
-					msg, err := defaultMarshaler.Unmarshal(&sarama.ConsumerMessage{
+				for _, mb := range unwrapMessageSet(s.MsgSet) {
+					if !h.sample(topic, mb.Msg.Key) {
+						continue
+					}
+
+					msg, err := newMessage(&sarama.ConsumerMessage{
 						Key:       mb.Msg.Key,
 						Value:     mb.Msg.Value,
 						Timestamp: mb.Msg.Timestamp,
 						Topic:     topic,
 						Partition: partition,
 						Offset:    mb.Offset,
-					})
+					}, requestMetadata)
 					if err != nil {
 						return nil, err
 					}
 
-					// Injecting the current Channel (kafka topic here) into the message Metadata (where Kafka headers are stored as well).
-					msg.Metadata.Set(message.MetadataChannel, topic)
-					msg.UUID = string(mb.Msg.Key)
 					msgs = append(msgs, msg)
 				}
 			}
@@ -229,3 +541,78 @@ func (h *produceRequestHandler) extractMessages(req sarama.ProduceRequest) ([]*w
 	}
 	return msgs, nil
 }
+
+// sample tells if the record of the given topic and key should be handled.
+func (h *ProduceRequestHandler) sample(topic string, key []byte) bool {
+	return h.sampler == nil || h.sampler.SampleRecord(topic, string(key))
+}
+
+// recordBatchMetadata returns the metadata of the producer of the given batch. Only idempotent and transactional producers
+// have a producer ID.
+func recordBatchMetadata(b *sarama.RecordBatch) map[string]string {
+	if b.ProducerID < 0 {
+		return nil
+	}
+
+	return map[string]string{
+		message.MetadataKafkaProducerID:    strconv.FormatInt(b.ProducerID, 10),
+		message.MetadataKafkaProducerEpoch: strconv.Itoa(int(b.ProducerEpoch)),
+		message.MetadataKafkaBaseSequence:  strconv.Itoa(int(b.FirstSequence)),
+	}
+}
+
+// newMessage creates a message from the given record, setting the given metadata.
+func newMessage(r *sarama.ConsumerMessage, metadata ...map[string]string) (*watermillmessage.Message, error) {
+	msg, err := defaultMarshaler.Unmarshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record headers are stored as metadata, so clients can't be allowed to set the metadata of the gateway through them.
+	message.RemoveInternalMetadata(msg.Metadata)
+
+	// Injecting the current Channel (kafka topic here) into the message Metadata (where Kafka headers are stored as well).
+	msg.Metadata.Set(message.MetadataChannel, r.Topic)
+	if r.Key != nil {
+		// Null keys are left unset, so they can be told apart from empty ones.
+		msg.Metadata.Set(message.MetadataKey, string(r.Key))
+	}
+	if !r.Timestamp.IsZero() && r.Timestamp.Unix() > 0 {
+		msg.Metadata.Set(message.MetadataTimestamp, r.Timestamp.UTC().Format(time.RFC3339Nano))
+	}
+
+	for _, m := range metadata {
+		for k, v := range m {
+			msg.Metadata.Set(k, v)
+		}
+	}
+
+	msg.UUID = string(r.Key)
+
+	return msg, nil
+}
+
+// DynamicPorts hands out the ports dynamic listeners bind to. Ports are sequential from dynamic-sequential-min-port,
+// or random if not set. Proxies sharing it never try to bind the same port. The zero value is ready to use.
+type DynamicPorts struct {
+	lock sync.Mutex
+	last int
+}
+
+// next returns the port the next dynamic listener should bind to. 0 means a random port.
+func (d *DynamicPorts) next(minPort int) int {
+	if minPort == 0 {
+		return 0
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.last < minPort {
+		d.last = minPort
+	} else {
+		d.last++
+	}
+
+	return d.last
+}
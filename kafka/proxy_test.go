@@ -4,15 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"fmt"
 	"hash/crc32"
+	"net"
 	"testing"
 	"time"
 
+	"github.com/Shopify/sarama"
 	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
 	messagetest "github.com/asyncapi/event-gateway/message/test"
 	"github.com/asyncapi/event-gateway/proxy"
-	kafkaproxy "github.com/grepplabs/kafka-proxy/proxy"
-	kafkaprotocol "github.com/grepplabs/kafka-proxy/proxy/protocol"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	logrustest "github.com/sirupsen/logrus/hooks/test"
@@ -58,7 +60,7 @@ func TestNewKafka(t *testing.T) {
 				assert.Nil(t, p)
 			} else {
 				assert.NoError(t, err)
-				assert.IsType(t, (proxy.Proxy)(nil), p)
+				assert.IsType(t, &Proxy{}, p)
 			}
 		})
 	}
@@ -68,25 +70,24 @@ func TestProduceRequestHandler_Handle(t *testing.T) {
 	tests := []struct {
 		name              string
 		request           []byte
-		shouldReply       bool
 		apiKey            int16
-		shouldSkipRequest bool
 		extraCheck        func(t *testing.T, handlerCalledTimes int)
 		expectedLoggedErr string
 		sleepBeforeCheck  time.Duration
 		handler           func(t *testing.T) (watermillmessage.HandlerFunc, chan struct{})
 		publisher         func(t *testing.T, topic string) (watermillmessage.Publisher, chan struct{})
 		publishToTopic    string
+		policies          []ProducePolicyConfig
+		expectedRejection bool
+		expectedViolation *PolicyViolation
 	}{
 		{
-			name:        "Handler success. No publisher is set.",
-			request:     generateProduceRequestV8("valid message"),
-			shouldReply: true,
+			name:    "Handler success. No publisher is set.",
+			request: generateProduceRequestV8("valid message"),
 		},
 		{
-			name:        "Handler success. Publisher is set.",
-			request:     generateProduceRequestV8("valid message"),
-			shouldReply: true,
+			name:    "Handler success. Publisher is set.",
+			request: generateProduceRequestV8("valid message"),
 			publisher: func(t *testing.T, topic string) (watermillmessage.Publisher, chan struct{}) {
 				return messagetest.ReliablePublisher(t, topic, 1, time.Second*2) // at least 1 message during max 2 seconds
 			},
@@ -94,7 +95,6 @@ func TestProduceRequestHandler_Handle(t *testing.T) {
 		{
 			name:              "Handler error means Nack. Message is resent infinitely.",
 			request:           generateProduceRequestV8("something is gonna make it fail!"),
-			shouldReply:       true,
 			expectedLoggedErr: "message is invalid, meaning Nack will be sent and message will be resent infinitely",
 			extraCheck: func(t *testing.T, handlerCalls int) {
 				assert.Greater(t, handlerCalls, 1)
@@ -108,11 +108,40 @@ func TestProduceRequestHandler_Handle(t *testing.T) {
 			sleepBeforeCheck: time.Millisecond, // letting the handlers be called several times due to Nack produced by returning an error.
 		},
 		{
-			name:              "Other Requests (different than Produce type) are skipped",
-			request:           []byte{0, 0, 0, 1}, // fake payload that should not be read.
-			apiKey:            int16(42),
-			shouldReply:       true,
-			shouldSkipRequest: true,
+			name:    "Policy is not violated.",
+			request: generateProduceRequestV8("valid message"),
+			policies: []ProducePolicyConfig{
+				{Name: "test", Mode: PolicyModeEnforce, Policy: topicPolicy("demo")},
+			},
+		},
+		{
+			name:    "Policy violation is reported in observe mode.",
+			request: generateProduceRequestV8("valid message"),
+			policies: []ProducePolicyConfig{
+				{Name: "test", Mode: PolicyModeObserve, Policy: topicPolicy("another-topic")},
+			},
+			expectedViolation: &PolicyViolation{Policy: "test", ClientID: "console-producer", Topic: "demo", Reason: "topic demo is not allowed"},
+		},
+		{
+			name:    "Policy violation is rejected in enforce mode.",
+			request: generateProduceRequestV8("valid message"),
+			policies: []ProducePolicyConfig{
+				{Name: "test", Mode: PolicyModeEnforce, Policy: topicPolicy("another-topic")},
+			},
+			expectedRejection: true,
+			expectedViolation: &PolicyViolation{Policy: "test", ClientID: "console-producer", Topic: "demo", Reason: "topic demo is not allowed", Rejected: true},
+		},
+		{
+			name:    "Policy in off mode is ignored.",
+			request: generateProduceRequestV8("valid message"),
+			policies: []ProducePolicyConfig{
+				{Name: "test", Mode: PolicyModeOff, Policy: topicPolicy("another-topic")},
+			},
+		},
+		{
+			name:    "Other Requests (different than Produce type) are skipped",
+			request: []byte{0, 0, 0, 1, 255, 255}, // fake payload that should not be decoded.
+			apiKey:  int16(42),
 			handler: func(_ *testing.T) (watermillmessage.HandlerFunc, chan struct{}) {
 				return func(msg *watermillmessage.Message) ([]*watermillmessage.Message, error) {
 					return nil, errors.New("this handler should never be called")
@@ -153,6 +182,12 @@ func TestProduceRequestHandler_Handle(t *testing.T) {
 
 			r := messagetest.NewRouterWithLogs(t, log)
 			h := NewProduceRequestHandler(r, handler, pub, t.Name())
+			h.policies = test.policies
+
+			var violations []PolicyViolation
+			h.violationHandler = func(v PolicyViolation) {
+				violations = append(violations, v)
+			}
 
 			go func() {
 				require.NoError(t, r.Run(context.Background()))
@@ -160,20 +195,20 @@ func TestProduceRequestHandler_Handle(t *testing.T) {
 
 			<-r.Running() // Do not start test until the router is fully up and running.
 
-			kv := &kafkaprotocol.RequestKeyVersion{
-				ApiVersion: 8,                            // All test data was grabbed from a Produce Request version 8.
-				ApiKey:     test.apiKey,                  // default is 0, which is a Produce Request
-				Length:     int32(len(test.request) + 4), // 4 bytes are ApiKey + Version located in all request headers (already read by the time of validating the msg).
-			}
-			readBytes := bytes.NewBuffer(nil)
-			shouldReply, err := h.Handle(kv, bytes.NewReader(test.request), &kafkaproxy.RequestsLoopContext{}, readBytes)
+			// All test data was grabbed from a Produce Request version 8. Default api key is 0, which is a Produce Request.
+			req := newRequest(t, test.apiKey, 8, test.request)
+			response, err := h.Handle(req)
 			assert.NoError(t, err)
-			assert.Equal(t, test.shouldReply, shouldReply)
+			if test.expectedRejection {
+				assert.NotEmpty(t, response)
+			} else {
+				assert.Nil(t, response)
+			}
 
-			if test.shouldSkipRequest {
-				assert.Empty(t, readBytes.Bytes()) // Payload is never read.
+			if test.expectedViolation != nil {
+				assert.Equal(t, []PolicyViolation{*test.expectedViolation}, violations)
 			} else {
-				assert.Equal(t, readBytes.Len(), len(test.request))
+				assert.Empty(t, violations)
 			}
 
 			if test.sleepBeforeCheck > 0 {
@@ -194,6 +229,29 @@ func TestProduceRequestHandler_Handle(t *testing.T) {
 	}
 }
 
+func topicPolicy(allowed string) ProducePolicy {
+	return func(_, topic string) error {
+		if topic != allowed {
+			return fmt.Errorf("topic %s is not allowed", topic)
+		}
+		return nil
+	}
+}
+
+// newRequest creates a Request as read from a client. The given payload starts with the correlation ID.
+func newRequest(t *testing.T, apiKey, apiVersion int16, payload []byte) *Request {
+	raw := &packetEncoder{}
+	raw.int32(int32(4 + len(payload)))
+	raw.int16(apiKey)
+	raw.int16(apiVersion)
+	_, _ = raw.Write(payload)
+
+	req, err := readRequest(raw)
+	require.NoError(t, err)
+
+	return req
+}
+
 func noopHandler(msg *watermillmessage.Message) ([]*watermillmessage.Message, error) {
 	return []*watermillmessage.Message{msg}, nil
 }
@@ -288,3 +346,220 @@ func generateProduceRequestV8(payload string) []byte {
 
 	return buf.Bytes()
 }
+
+func TestProduceRequestHandler_Handle_sampling(t *testing.T) {
+	r := messagetest.NewRouter(t)
+	h := NewProduceRequestHandler(r, func(msg *watermillmessage.Message) ([]*watermillmessage.Message, error) {
+		return nil, errors.New("this handler should never be called")
+	}, nil, "")
+
+	sampler, err := message.NewSampler(0)
+	require.NoError(t, err)
+	h.sampler = sampler
+
+	// Skipped records never reach the queue.
+	response, err := h.Handle(newRequest(t, RequestAPIKeyProduce, 8, generateProduceRequestV8("skipped message")))
+	require.NoError(t, err)
+	assert.Nil(t, response)
+	assert.Equal(t, proxy.ValidationQueueStats{}, h.queue.Stats())
+	assert.Equal(t, map[string]message.SamplingStats{"demo": {Skipped: 1}}, sampler.Stats())
+}
+
+func TestProxy_Run(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      ProducePolicy
+		mode        PolicyMode
+		expectedErr error
+	}{
+		{
+			name: "Messages are produced through the proxy",
+		},
+		{
+			name:   "Messages violating an observed policy are produced through the proxy",
+			policy: func(_, _ string) error { return errors.New("not allowed") },
+			mode:   PolicyModeObserve,
+		},
+		{
+			name:        "Messages violating an enforced policy are rejected",
+			policy:      func(_, _ string) error { return errors.New("not allowed") },
+			mode:        PolicyModeEnforce,
+			expectedErr: sarama.ErrTopicAuthorizationFailed,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := sarama.NewMockBroker(t, 1)
+			defer broker.Close()
+
+			broker.SetHandlerByMap(map[string]sarama.MockResponse{
+				"MetadataRequest": sarama.NewMockMetadataResponse(t).
+					SetBroker(broker.Addr(), broker.BrokerID()).
+					SetLeader("demo", 0, broker.BrokerID()),
+				"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3),
+			})
+
+			var opts []ProxyOption
+			if test.policy != nil {
+				opts = append(opts, WithProducePolicy("test", test.mode, test.policy))
+			}
+
+			c, err := NewProxyConfig([]string{broker.Addr() + ",127.0.0.1:0"}, opts...)
+			require.NoError(t, err)
+
+			p, err := NewProxy(c, messagetest.NewRouter(t))
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() {
+				done <- proxy.Run(ctx, p)
+			}()
+			<-p.Ready()
+
+			listener := p.Listeners()[broker.Addr()]
+			producer := newTestSyncProducer(t, listener)
+			_, _, err = producer.SendMessage(&sarama.ProducerMessage{Topic: "demo", Value: sarama.StringEncoder("hello")})
+			assert.Equal(t, test.expectedErr, errors.Cause(err))
+			assert.NoError(t, producer.Close())
+
+			var produced bool
+			for _, r := range broker.History() {
+				_, ok := r.Request.(*sarama.ProduceRequest)
+				produced = produced || ok
+			}
+			assert.Equal(t, test.expectedErr == nil, produced)
+
+			cancel()
+			assert.NoError(t, <-done)
+
+			_, err = net.Dial("tcp", listener)
+			assert.Error(t, err, "listeners should be closed once the proxy stops")
+		})
+	}
+}
+
+func newTestSyncProducer(t *testing.T, address string) sarama.SyncProducer {
+	conf := sarama.NewConfig()
+	conf.Version = sarama.V1_0_0_0
+	conf.Producer.Return.Successes = true
+	conf.Producer.Retry.Max = 0
+	conf.Metadata.Retry.Max = 0
+
+	producer, err := sarama.NewSyncProducer([]string{address}, conf)
+	require.NoError(t, err)
+
+	return producer
+}
+
+func TestProxy_Run_severalProxies(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("demo", 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Only the first proxy rejects messages. Handlers and policies should not leak between proxies.
+	reject := WithProducePolicy("test", PolicyModeEnforce, func(_, _ string) error { return errors.New("not allowed") })
+	proxies := make([]*Proxy, 2)
+	for i, opts := range [][]ProxyOption{{reject}, nil} {
+		c, err := NewProxyConfig([]string{broker.Addr() + ",127.0.0.1:0"}, opts...)
+		require.NoError(t, err)
+
+		proxies[i], err = NewProxy(c, messagetest.NewRouter(t))
+		require.NoError(t, err)
+
+		go func(p *Proxy) {
+			assert.NoError(t, proxy.Run(ctx, p))
+		}(proxies[i])
+		<-proxies[i].Ready()
+	}
+
+	for i, expectedErr := range []error{sarama.ErrTopicAuthorizationFailed, nil} {
+		producer := newTestSyncProducer(t, proxies[i].Listeners()[broker.Addr()])
+		_, _, err := producer.SendMessage(&sarama.ProducerMessage{Topic: "demo", Value: sarama.StringEncoder("hello")})
+		assert.Equal(t, expectedErr, errors.Cause(err))
+		assert.NoError(t, producer.Close())
+	}
+}
+
+func TestProxy_dynamicListeners_sharedPorts(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	minPort := freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Both proxies create a dynamic listener for the same broker, starting from the same port.
+	ports := new(DynamicPorts)
+	advertisedPorts := make(map[int32]struct{})
+	for i := 0; i < 2; i++ {
+		c, err := NewProxyConfig([]string{broker.Addr() + ",127.0.0.1:0"}, WithExtra([]string{fmt.Sprintf("dynamic-sequential-min-port=%d", minPort)}), WithDynamicPorts(ports))
+		require.NoError(t, err)
+
+		p, err := NewProxy(c, messagetest.NewRouter(t))
+		require.NoError(t, err)
+
+		go func() {
+			assert.NoError(t, proxy.Run(ctx, p))
+		}()
+		<-p.Ready()
+
+		_, port, err := p.advertisedAddress("dynamic.mybrokers.org", 9092)
+		require.NoError(t, err)
+		advertisedPorts[port] = struct{}{}
+	}
+
+	assert.Len(t, advertisedPorts, 2)
+}
+
+func TestDynamicPorts_next(t *testing.T) {
+	ports := new(DynamicPorts)
+	assert.Equal(t, 0, ports.next(0))
+	assert.Equal(t, 30000, ports.next(30000))
+	assert.Equal(t, 30001, ports.next(30000))
+	assert.Equal(t, 30002, ports.next(30000))
+}
+
+func TestNewMessage_hostileHeaders(t *testing.T) {
+	r := &sarama.ConsumerMessage{
+		Topic: "signups",
+		Key:   []byte("user-1"),
+		Value: []byte(`{"ssn":"123-45-6789"}`),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("_asyncapi_eg_redacted"), Value: []byte("true")},
+			{Key: []byte(message.MetadataChannel), Value: []byte("events")},
+			{Key: []byte(message.MetadataKey), Value: []byte("admin")},
+			{Key: []byte("traceparent"), Value: []byte("00-abc-01")},
+		},
+	}
+
+	msg, err := newMessage(r)
+	require.NoError(t, err)
+	assert.Equal(t, watermillmessage.Metadata{
+		message.MetadataChannel: "signups",
+		message.MetadataKey:     "user-1",
+		"traceparent":           "00-abc-01",
+	}, msg.Metadata)
+
+	// Clients can't skip redaction through headers.
+	redactor, err := message.NewRedactor(message.RedactionModeDrop, nil, []string{"/ssn"})
+	require.NoError(t, err)
+	assert.Empty(t, redactor.Redact(msg).Payload)
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
@@ -0,0 +1,302 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+)
+
+// Names of the policies quota violations are reported as.
+const (
+	MaxMessageBytesPolicyName           = "max-message-bytes"
+	MaxRecordsPerSecondPolicyName       = "max-records-per-second"
+	ClientMaxRecordsPerSecondPolicyName = "client-max-records-per-second"
+)
+
+// ProduceQuota limits what clients can produce to a topic. Zero values mean no limit.
+type ProduceQuota struct {
+	// Channel is the channel the topic belongs to, if any. Rates are tracked per client ID and channel, so the topics
+	// of a parameterized channel share them.
+	Channel string
+	// MaxMessageBytes is the max size of each message, counting its key, value and headers.
+	MaxMessageBytes int
+	// MaxRecordsPerSecond is the max number of records each client ID can produce per second.
+	MaxRecordsPerSecond float64
+}
+
+// ProduceQuotasConfig holds the quotas clients are subject to when producing, and how they are applied.
+// Messages too large are rejected with MESSAGE_TOO_LARGE, while clients exceeding a rate are throttled, same as Kafka
+// brokers do: the request goes through, but the client is told to wait by the throttle_time_ms of the response, and the
+// proxy doesn't read further requests from it meanwhile.
+type ProduceQuotasConfig struct {
+	Mode PolicyMode
+	// TopicQuota returns the quota of the given topic. Nil means no quota per topic.
+	TopicQuota func(topic string) ProduceQuota
+	// ClientMaxRecordsPerSecond is the max number of records each client ID can produce per second, no matter the topic.
+	// Zero means no limit.
+	ClientMaxRecordsPerSecond float64
+}
+
+// Validate validates ProduceQuotasConfig.
+func (c ProduceQuotasConfig) Validate() error {
+	if err := c.Mode.Validate(); err != nil {
+		return err
+	}
+
+	if c.ClientMaxRecordsPerSecond < 0 || math.IsNaN(c.ClientMaxRecordsPerSecond) {
+		return errors.New("client max records per second should not be negative")
+	}
+
+	return nil
+}
+
+// ProduceRates tracks the rate each client produces at. Proxies sharing it apply the rates of their quotas across all of
+// them, so a client can't exceed a rate by spreading its records over several servers. The zero value is ready to use.
+type ProduceRates struct {
+	lock sync.Mutex
+	// buckets indexed by client ID, and by client ID and channel.
+	buckets map[string]*rateBucket
+}
+
+// bucket returns the rate bucket with the given key, creating it if needed. Lock should be held.
+func (r *ProduceRates) bucket(key string, rate float64, now time.Time) *rateBucket {
+	b, ok := r.buckets[key]
+	if !ok {
+		if r.buckets == nil {
+			r.buckets = make(map[string]*rateBucket)
+		}
+		b = &rateBucket{rate: rate, tokens: rate, last: now}
+		r.buckets[key] = b
+	}
+
+	return b
+}
+
+// produceQuotas checks Produce requests against the configured quotas, tracking the rate of each client.
+type produceQuotas struct {
+	config ProduceQuotasConfig
+	now    func() time.Time
+	rates  *ProduceRates
+}
+
+func newProduceQuotas(c ProduceQuotasConfig, rates *ProduceRates) *produceQuotas {
+	if rates == nil {
+		rates = new(ProduceRates)
+	}
+
+	return &produceQuotas{
+		config: c,
+		now:    time.Now,
+		rates:  rates,
+	}
+}
+
+// topicRecords holds the records of a topic in a Produce request.
+type topicRecords struct {
+	topic string
+	quota ProduceQuota
+	count int
+	// maxBytes is the size of the largest message.
+	maxBytes int
+}
+
+// check checks the given topics of a Produce request against the quotas. It returns the violations, and for how long
+// the client should be throttled if the mode is enforce.
+// Rates are not tracked for requests rejected due to their message size, as their messages are not produced.
+func (q *produceQuotas) check(clientID string, topics []string, records map[string]map[int32]sarama.Records) ([]PolicyViolation, time.Duration) {
+	enforce := q.config.Mode == PolicyModeEnforce
+	stats := make([]topicRecords, 0, len(topics))
+	var violations []PolicyViolation
+	for _, topic := range topics {
+		s := countRecords(topic, records[topic])
+		if q.config.TopicQuota != nil {
+			s.quota = q.config.TopicQuota(topic)
+		}
+		stats = append(stats, s)
+
+		if s.quota.MaxMessageBytes > 0 && s.maxBytes > s.quota.MaxMessageBytes {
+			violations = append(violations, PolicyViolation{
+				Policy:   MaxMessageBytesPolicyName,
+				ClientID: clientID,
+				Topic:    topic,
+				Reason:   fmt.Sprintf("message of %d bytes exceeds the max of %d bytes", s.maxBytes, s.quota.MaxMessageBytes),
+				Rejected: enforce,
+				errCode:  sarama.ErrMessageSizeTooLarge,
+			})
+		}
+	}
+
+	if enforce && len(violations) > 0 {
+		return violations, 0
+	}
+
+	rateViolations, throttle := q.recordRates(clientID, stats)
+	if !enforce {
+		throttle = 0
+	}
+
+	return append(violations, rateViolations...), throttle
+}
+
+// recordRates records the produced records into the rates of the client, returning the violations of the rates exceeded
+// and the longest throttle time.
+func (q *produceQuotas) recordRates(clientID string, stats []topicRecords) ([]PolicyViolation, time.Duration) {
+	q.rates.lock.Lock()
+	defer q.rates.lock.Unlock()
+
+	now := q.now()
+	var violations []PolicyViolation
+	var throttle time.Duration
+	var total int
+	for _, s := range stats {
+		total += s.count
+		if s.quota.MaxRecordsPerSecond <= 0 {
+			continue
+		}
+
+		scope := s.quota.Channel
+		if scope == "" {
+			scope = s.topic
+		}
+
+		t := q.rates.bucket(clientID+"\x00"+scope, s.quota.MaxRecordsPerSecond, now).record(now, s.count)
+		if t > 0 {
+			violations = append(violations, rateViolation(MaxRecordsPerSecondPolicyName, clientID, s.topic, s.quota.MaxRecordsPerSecond, t))
+			throttle = maxDuration(throttle, t)
+		}
+	}
+
+	if q.config.ClientMaxRecordsPerSecond > 0 && len(stats) > 0 {
+		t := q.rates.bucket(clientID, q.config.ClientMaxRecordsPerSecond, now).record(now, total)
+		if t > 0 {
+			for _, s := range stats {
+				violations = append(violations, rateViolation(ClientMaxRecordsPerSecondPolicyName, clientID, s.topic, q.config.ClientMaxRecordsPerSecond, t))
+			}
+			throttle = maxDuration(throttle, t)
+		}
+	}
+
+	return violations, throttle
+}
+
+func rateViolation(policy, clientID, topic string, rate float64, throttle time.Duration) PolicyViolation {
+	return PolicyViolation{
+		Policy:         policy,
+		ClientID:       clientID,
+		Topic:          topic,
+		Reason:         fmt.Sprintf("rate of %v records per second exceeded", rate),
+		ThrottleTimeMs: throttle.Milliseconds(),
+	}
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+// countRecords counts the records of a topic and the size of the largest message. The size of a message is the size of
+// its key, value and headers, leaving out the framing of the record.
+func countRecords(topic string, partitions map[int32]sarama.Records) topicRecords {
+	s := topicRecords{topic: topic}
+	count := func(size int) {
+		s.count++
+		if size > s.maxBytes {
+			s.maxBytes = size
+		}
+	}
+
+	for _, records := range partitions {
+		if records.RecordBatch != nil {
+			for _, r := range records.RecordBatch.Records {
+				count(recordSize(r))
+			}
+		}
+		if records.MsgSet != nil {
+			for _, mb := range unwrapMessageSet(records.MsgSet) {
+				count(len(mb.Msg.Key) + len(mb.Msg.Value))
+			}
+		}
+	}
+
+	return s
+}
+
+func recordSize(r *sarama.Record) int {
+	size := len(r.Key) + len(r.Value)
+	for _, h := range r.Headers {
+		if h != nil {
+			size += len(h.Key) + len(h.Value)
+		}
+	}
+
+	return size
+}
+
+// rateBucket is a token bucket holding up to one second worth of records. Records are always recorded, even if they exceed
+// the available tokens, leaving the bucket in debt. The client is throttled until the debt is paid back.
+type rateBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// record takes n tokens from the bucket, returning how long the client should be throttled.
+func (b *rateBucket) record(now time.Time, n int) time.Duration {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.rate, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// setProduceThrottleTime sets the throttle_time_ms of the given Produce response body to the given throttle time, unless
+// the broker already throttles the client for longer. The body should not include the response header.
+// Produce responses v0 have no throttle time, so they are left untouched.
+func setProduceThrottleTime(version int16, body []byte, throttle time.Duration) error {
+	if version < 1 {
+		return nil
+	}
+
+	if version > maxProduceVersion {
+		// Tagged fields, such as NodeEndpoints, can't be told apart from the throttle time without decoding the whole body.
+		return fmt.Errorf("produce response version %d is not supported", version)
+	}
+
+	pos := len(body) - 4
+	if version >= firstFlexibleProduceVersion {
+		// The throttle time is followed by the tagged fields, which are expected to be empty.
+		if len(body) == 0 || body[len(body)-1] != 0 {
+			return errors.New("produce response has tagged fields after the throttle time")
+		}
+		pos--
+	}
+
+	if pos < 0 {
+		return fmt.Errorf("produce response of %d bytes is too short", len(body))
+	}
+
+	ms := throttle.Milliseconds()
+	if ms > math.MaxInt32 {
+		ms = math.MaxInt32
+	}
+
+	if current := int32(binary.BigEndian.Uint32(body[pos:])); int64(current) < ms {
+		binary.BigEndian.PutUint32(body[pos:], uint32(ms))
+	}
+
+	return nil
+}
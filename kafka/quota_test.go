@@ -0,0 +1,365 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProduceQuotasConfig_Validate(t *testing.T) {
+	assert.NoError(t, ProduceQuotasConfig{Mode: PolicyModeEnforce, ClientMaxRecordsPerSecond: 10}.Validate())
+	assert.EqualError(t, ProduceQuotasConfig{Mode: "reject"}.Validate(), `policy mode "reject" is not valid. Valid values are off, observe and enforce`)
+	assert.EqualError(t, ProduceQuotasConfig{ClientMaxRecordsPerSecond: -1}.Validate(), "client max records per second should not be negative")
+}
+
+func TestProduceQuotas_check(t *testing.T) {
+	topicQuota := func(topic string) ProduceQuota {
+		switch topic {
+		case "user.1.signedup", "user.2.signedup":
+			return ProduceQuota{Channel: "user.{userId}.signedup", MaxRecordsPerSecond: 2}
+		case "small":
+			return ProduceQuota{Channel: "small", MaxMessageBytes: 5}
+		default:
+			return ProduceQuota{}
+		}
+	}
+
+	tests := []struct {
+		name               string
+		mode               PolicyMode
+		clientMaxRecords   float64
+		requests           []map[string]int // records per topic of each request
+		value              string
+		expectedViolations []PolicyViolation
+		expectedThrottle   time.Duration
+	}{
+		{
+			name:     "Requests within quotas",
+			mode:     PolicyModeEnforce,
+			requests: []map[string]int{{"user.1.signedup": 2, "small": 1, "unlimited": 100}},
+			value:    "12345",
+		},
+		{
+			name:     "Message too large is rejected in enforce mode",
+			mode:     PolicyModeEnforce,
+			requests: []map[string]int{{"small": 1, "user.1.signedup": 10}},
+			value:    "123456",
+			expectedViolations: []PolicyViolation{
+				{Policy: MaxMessageBytesPolicyName, ClientID: "client", Topic: "small", Reason: "message of 6 bytes exceeds the max of 5 bytes", Rejected: true, errCode: sarama.ErrMessageSizeTooLarge},
+			},
+		},
+		{
+			name:     "Message too large is reported in observe mode",
+			mode:     PolicyModeObserve,
+			requests: []map[string]int{{"small": 1}},
+			value:    "123456",
+			expectedViolations: []PolicyViolation{
+				{Policy: MaxMessageBytesPolicyName, ClientID: "client", Topic: "small", Reason: "message of 6 bytes exceeds the max of 5 bytes", errCode: sarama.ErrMessageSizeTooLarge},
+			},
+		},
+		{
+			name:     "Topics of a parameterized channel share the rate",
+			mode:     PolicyModeEnforce,
+			requests: []map[string]int{{"user.1.signedup": 2}, {"user.2.signedup": 1}},
+			expectedViolations: []PolicyViolation{
+				{Policy: MaxRecordsPerSecondPolicyName, ClientID: "client", Topic: "user.2.signedup", Reason: "rate of 2 records per second exceeded", ThrottleTimeMs: 500},
+			},
+			expectedThrottle: 500 * time.Millisecond,
+		},
+		{
+			name:     "Rate exceeded is not throttled in observe mode",
+			mode:     PolicyModeObserve,
+			requests: []map[string]int{{"user.1.signedup": 4}},
+			expectedViolations: []PolicyViolation{
+				{Policy: MaxRecordsPerSecondPolicyName, ClientID: "client", Topic: "user.1.signedup", Reason: "rate of 2 records per second exceeded", ThrottleTimeMs: 1000},
+			},
+		},
+		{
+			name:             "Client rate applies to all topics",
+			mode:             PolicyModeEnforce,
+			clientMaxRecords: 10,
+			requests:         []map[string]int{{"unlimited": 8, "another": 4}},
+			expectedViolations: []PolicyViolation{
+				{Policy: ClientMaxRecordsPerSecondPolicyName, ClientID: "client", Topic: "another", Reason: "rate of 10 records per second exceeded", ThrottleTimeMs: 200},
+				{Policy: ClientMaxRecordsPerSecondPolicyName, ClientID: "client", Topic: "unlimited", Reason: "rate of 10 records per second exceeded", ThrottleTimeMs: 200},
+			},
+			expectedThrottle: 200 * time.Millisecond,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newProduceQuotas(ProduceQuotasConfig{Mode: test.mode, TopicQuota: topicQuota, ClientMaxRecordsPerSecond: test.clientMaxRecords}, nil)
+			now := time.Now()
+			q.now = func() time.Time { return now }
+
+			var violations []PolicyViolation
+			var throttle time.Duration
+			for _, r := range test.requests {
+				topics, records := produceRecords(r, test.value)
+				violations, throttle = q.check("client", topics, records)
+			}
+
+			assert.Equal(t, test.expectedViolations, violations)
+			assert.Equal(t, test.expectedThrottle, throttle)
+		})
+	}
+}
+
+func TestProduceQuotas_check_refill(t *testing.T) {
+	q := newProduceQuotas(ProduceQuotasConfig{Mode: PolicyModeEnforce, ClientMaxRecordsPerSecond: 10}, nil)
+	now := time.Now()
+	q.now = func() time.Time { return now }
+
+	topics, records := produceRecords(map[string]int{"demo": 15}, "")
+	_, throttle := q.check("client", topics, records)
+	assert.Equal(t, 500*time.Millisecond, throttle)
+
+	// Other clients have their own rate.
+	_, throttle = q.check("another-client", topics, records)
+	assert.Equal(t, 500*time.Millisecond, throttle)
+
+	now = now.Add(500 * time.Millisecond)
+	topics, records = produceRecords(map[string]int{"demo": 1}, "")
+	_, throttle = q.check("client", topics, records)
+	assert.Equal(t, 100*time.Millisecond, throttle)
+
+	// The bucket holds up to one second worth of records.
+	now = now.Add(time.Hour)
+	topics, records = produceRecords(map[string]int{"demo": 10}, "")
+	_, throttle = q.check("client", topics, records)
+	assert.Zero(t, throttle)
+}
+
+func TestProduceQuotas_check_sharedRates(t *testing.T) {
+	rates := new(ProduceRates)
+	config := ProduceQuotasConfig{Mode: PolicyModeEnforce, ClientMaxRecordsPerSecond: 10}
+	q1, q2 := newProduceQuotas(config, rates), newProduceQuotas(config, rates)
+	now := time.Now()
+	q1.now = func() time.Time { return now }
+	q2.now = q1.now
+
+	topics, records := produceRecords(map[string]int{"demo": 10}, "")
+	_, throttle := q1.check("client", topics, records)
+	assert.Zero(t, throttle)
+
+	// The client produced its whole rate through the other proxy.
+	topics, records = produceRecords(map[string]int{"demo": 5}, "")
+	_, throttle = q2.check("client", topics, records)
+	assert.Equal(t, 500*time.Millisecond, throttle)
+}
+
+func TestCountRecords(t *testing.T) {
+	batch := &sarama.RecordBatch{Version: 2, Records: []*sarama.Record{
+		{Value: []byte("1234567890")},
+		{Key: []byte("key"), Value: []byte("12345"), Headers: []*sarama.RecordHeader{{Key: []byte("h1"), Value: []byte("v1")}, {Key: []byte("h2")}}},
+	}}
+	msgSet := &sarama.MessageSet{Messages: []*sarama.MessageBlock{
+		{Msg: &sarama.Message{Key: []byte("a-long-key"), Value: []byte("12345")}},
+	}}
+
+	s := countRecords("demo", map[int32]sarama.Records{0: {RecordBatch: batch}})
+	assert.Equal(t, topicRecords{topic: "demo", count: 2, maxBytes: 14}, s)
+
+	s = countRecords("demo", map[int32]sarama.Records{0: {RecordBatch: batch}, 1: {MsgSet: msgSet}})
+	assert.Equal(t, topicRecords{topic: "demo", count: 3, maxBytes: 15}, s)
+}
+
+func TestProduceRequestHandler_Handle_quotas(t *testing.T) {
+	h := NewProduceRequestHandler(nil, nil, nil, "")
+	h.quotas = newProduceQuotas(ProduceQuotasConfig{
+		Mode: PolicyModeEnforce,
+		TopicQuota: func(string) ProduceQuota {
+			return ProduceQuota{MaxMessageBytes: 5, MaxRecordsPerSecond: 1}
+		},
+	}, nil)
+
+	var violations []PolicyViolation
+	h.violationHandler = func(v PolicyViolation) {
+		violations = append(violations, v)
+	}
+
+	req := newRequest(t, RequestAPIKeyProduce, 8, generateProduceRequestV8("valid message"))
+	response, err := h.Handle(req)
+	require.NoError(t, err)
+	require.NotEmpty(t, response)
+	require.Len(t, violations, 1)
+	assert.Equal(t, MaxMessageBytesPolicyName, violations[0].Policy)
+
+	// topics => [name => partitions => [partition => error_code]]
+	d := &packetDecoder{b: response}
+	_, _ = d.int32()
+	topicLength, _ := d.int16()
+	_, _ = d.read(int(topicLength))
+	_, _ = d.int32()
+	_, _ = d.int32()
+	errCode, err := d.int16()
+	require.NoError(t, err)
+	assert.Equal(t, int16(sarama.ErrMessageSizeTooLarge), errCode)
+
+	// Small messages go through, but the client is throttled once exceeding the rate.
+	req = newRequest(t, RequestAPIKeyProduce, 8, generateProduceRequestV8("ok"))
+	response, err = h.Handle(req)
+	require.NoError(t, err)
+	assert.Nil(t, response)
+	assert.Zero(t, req.throttleTime)
+
+	req = newRequest(t, RequestAPIKeyProduce, 8, generateProduceRequestV8("ok"))
+	response, err = h.Handle(req)
+	require.NoError(t, err)
+	assert.Nil(t, response)
+	assert.InDelta(t, time.Second, req.throttleTime, float64(100*time.Millisecond))
+}
+
+func TestSetProduceThrottleTime(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     int16
+		body        []byte
+		throttle    time.Duration
+		expected    []byte
+		expectedErr string
+	}{
+		{
+			name:     "v0 has no throttle time",
+			body:     []byte{1, 2, 3, 4},
+			throttle: time.Second,
+			expected: []byte{1, 2, 3, 4},
+		},
+		{
+			name:     "Non flexible version",
+			version:  8,
+			body:     []byte{9, 9, 0, 0, 0, 0},
+			throttle: time.Second,
+			expected: []byte{9, 9, 0, 0, 3, 232},
+		},
+		{
+			name:     "Flexible version",
+			version:  9,
+			body:     []byte{9, 9, 0, 0, 0, 0, 0},
+			throttle: time.Second,
+			expected: []byte{9, 9, 0, 0, 3, 232, 0},
+		},
+		{
+			name:     "Broker throttle time is kept if longer",
+			version:  8,
+			body:     []byte{9, 9, 0, 0, 7, 208},
+			throttle: time.Second,
+			expected: []byte{9, 9, 0, 0, 7, 208},
+		},
+		{
+			name:        "Flexible version with tagged fields",
+			version:     9,
+			body:        []byte{9, 9, 0, 0, 0, 0, 1},
+			throttle:    time.Second,
+			expected:    []byte{9, 9, 0, 0, 0, 0, 1},
+			expectedErr: "produce response has tagged fields after the throttle time",
+		},
+		{
+			name:        "Version 10 with node endpoints",
+			version:     10,
+			body:        nodeEndpointsProduceResponse(),
+			throttle:    time.Second,
+			expected:    nodeEndpointsProduceResponse(),
+			expectedErr: "produce response version 10 is not supported",
+		},
+		{
+			name:        "Version 11 with node endpoints",
+			version:     11,
+			body:        nodeEndpointsProduceResponse(),
+			throttle:    time.Second,
+			expected:    nodeEndpointsProduceResponse(),
+			expectedErr: "produce response version 11 is not supported",
+		},
+		{
+			name:        "Too short",
+			version:     8,
+			body:        []byte{0, 0},
+			throttle:    time.Second,
+			expected:    []byte{0, 0},
+			expectedErr: "produce response of 2 bytes is too short",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := setProduceThrottleTime(test.version, test.body, test.throttle)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expected, test.body)
+		})
+	}
+}
+
+// nodeEndpointsProduceResponse returns the end of a Produce response v10+ whose NodeEndpoints tagged field holds the address
+// of broker 1 (b1:9092). Its last byte is 0, same as if there were no tagged fields.
+func nodeEndpointsProduceResponse() []byte {
+	return []byte{
+		9, 9, // end of the responses
+		0, 0, 0, 0, // throttle_time_ms
+		1, 0, 14, // one tagged field: NodeEndpoints (tag 0) of 14 bytes
+		2,          // one node endpoint
+		0, 0, 0, 1, // node_id
+		3, 'b', '1', // host
+		0, 0, 0x23, 0x84, // port
+		0, // null rack
+		0, // no tagged fields
+	}
+}
+
+func TestConnection_relayThrottledProduceResponse(t *testing.T) {
+	client, clientPeer := net.Pipe()
+	broker, brokerPeer := net.Pipe()
+	c := &connection{client: client, broker: broker, done: make(chan struct{})}
+	defer c.close()
+
+	req := &Request{APIKey: RequestAPIKeyProduce, APIVersion: 8, CorrelationID: 6, throttleTime: 1500 * time.Millisecond}
+	response := []byte{0, 0, 0, 10, 0, 0, 0, 6, 9, 9, 0, 0, 0, 0}
+	go func() {
+		_, _ = brokerPeer.Write(response)
+	}()
+
+	relayed := make(chan []byte)
+	go func() {
+		b := make([]byte, len(response))
+		_, _ = io.ReadFull(clientPeer, b)
+		relayed <- b
+	}()
+
+	require.NoError(t, c.relayResponse(req))
+
+	expected := bytes.NewBuffer([]byte{0, 0, 0, 10, 0, 0, 0, 6, 9, 9})
+	require.NoError(t, binary.Write(expected, binary.BigEndian, int32(1500)))
+	select {
+	case b := <-relayed:
+		assert.Equal(t, expected.Bytes(), b)
+	case <-time.After(time.Second):
+		require.Fail(t, "response should be relayed")
+	}
+}
+
+// produceRecords creates the records of a Produce request with the given number of records per topic, each with the given value.
+func produceRecords(counts map[string]int, value string) ([]string, map[string]map[int32]sarama.Records) {
+	topics := make([]string, 0, len(counts))
+	records := make(map[string]map[int32]sarama.Records, len(counts))
+	for topic, n := range counts {
+		batch := &sarama.RecordBatch{Version: 2}
+		for i := 0; i < n; i++ {
+			batch.Records = append(batch.Records, &sarama.Record{Value: []byte(value)})
+		}
+		topics = append(topics, topic)
+		records[topic] = map[int32]sarama.Records{0: {RecordBatch: batch}}
+	}
+	sort.Strings(topics)
+
+	return topics, records
+}
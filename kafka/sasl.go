@@ -0,0 +1,291 @@
+package kafka
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/xdg/scram"
+)
+
+// SASL mechanisms supported for authenticating against the brokers.
+const (
+	SASLMechanismPlain       = "PLAIN"
+	SASLMechanismScramSHA256 = "SCRAM-SHA-256"
+	SASLMechanismScramSHA512 = "SCRAM-SHA-512"
+	SASLMechanismOAuthBearer = "OAUTHBEARER"
+)
+
+// saslClientID is the client ID used by the proxy when authenticating against the brokers.
+const saslClientID = "asyncapi-event-gateway"
+
+// scramSHA512 is not provided by the scram package.
+var scramSHA512 scram.HashGeneratorFcn = sha512.New
+
+// SASLConfig holds configuration for SASL authentication against the brokers.
+type SASLConfig struct {
+	Mechanism string
+	Username  string
+	Password  string
+	// TokenFile is the path to a file containing the OAUTHBEARER token.
+	// It is read on every authentication, so tokens can be rotated without restarting.
+	TokenFile string
+}
+
+// Validate validates SASLConfig.
+func (c *SASLConfig) Validate() error {
+	switch c.Mechanism {
+	case SASLMechanismPlain, SASLMechanismScramSHA256, SASLMechanismScramSHA512:
+		if c.Username == "" || c.Password == "" {
+			return fmt.Errorf("username and password are required for SASL mechanism %s", c.Mechanism)
+		}
+	case SASLMechanismOAuthBearer:
+		if c.TokenFile == "" {
+			return fmt.Errorf("token file is required for SASL mechanism %s", c.Mechanism)
+		}
+	default:
+		return fmt.Errorf("SASL mechanism %q is not supported. Supported mechanisms are %s", c.Mechanism, strings.Join([]string{SASLMechanismPlain, SASLMechanismScramSHA256, SASLMechanismScramSHA512, SASLMechanismOAuthBearer}, ", "))
+	}
+
+	return nil
+}
+
+// ConfigureSarama configures SASL authentication on the given sarama config.
+func (c *SASLConfig) ConfigureSarama(conf *sarama.Config) {
+	conf.Net.SASL.Enable = true
+	conf.Net.SASL.Handshake = true
+
+	switch c.Mechanism {
+	case SASLMechanismPlain:
+		conf.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case SASLMechanismScramSHA256:
+		conf.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		conf.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{HashGeneratorFcn: scram.SHA256}
+		}
+	case SASLMechanismScramSHA512:
+		conf.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		conf.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{HashGeneratorFcn: scramSHA512}
+		}
+	case SASLMechanismOAuthBearer:
+		conf.Net.SASL.Mechanism = sarama.SASLTypeOAuth
+		conf.Net.SASL.TokenProvider = tokenFileProvider{path: c.TokenFile}
+	}
+
+	conf.Net.SASL.User = c.Username
+	conf.Net.SASL.Password = c.Password
+}
+
+// authenticate authenticates against a broker through the given connection.
+// See https://kafka.apache.org/protocol#sasl_handshake.
+func (c *SASLConfig) authenticate(conn io.ReadWriter) error {
+	a := &saslAuthenticator{conn: conn}
+	if err := a.handshake(c.Mechanism); err != nil {
+		return err
+	}
+
+	switch c.Mechanism {
+	case SASLMechanismPlain:
+		_, err := a.authenticate([]byte("\x00" + c.Username + "\x00" + c.Password))
+		return err
+	case SASLMechanismScramSHA256, SASLMechanismScramSHA512:
+		return a.scram(c.Mechanism, c.Username, c.Password)
+	case SASLMechanismOAuthBearer:
+		token, err := tokenFileProvider{path: c.TokenFile}.read()
+		if err != nil {
+			return err
+		}
+
+		_, err = a.authenticate([]byte("n,,\x01auth=Bearer " + token + "\x01\x01"))
+		return err
+	default:
+		return fmt.Errorf("SASL mechanism %q is not supported", c.Mechanism)
+	}
+}
+
+// saslAuthenticator performs the SASL exchange with a broker.
+type saslAuthenticator struct {
+	conn          io.ReadWriter
+	correlationID int32
+}
+
+func (a *saslAuthenticator) handshake(mechanism string) error {
+	req := &packetEncoder{}
+	req.string(mechanism)
+
+	resp, err := a.roundTrip(requestAPIKeySASLHandshake, 1, req.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "error during SASL handshake")
+	}
+
+	d := &packetDecoder{b: resp}
+	errCode, err := d.int16()
+	if err != nil {
+		return errors.Wrap(err, "error decoding SASL handshake response")
+	}
+
+	if errCode != 0 {
+		return fmt.Errorf("SASL handshake failed. Mechanism %s is not enabled in the broker: %s", mechanism, sarama.KError(errCode).Error())
+	}
+
+	return nil
+}
+
+func (a *saslAuthenticator) authenticate(authBytes []byte) ([]byte, error) {
+	req := &packetEncoder{}
+	req.bytes(authBytes)
+
+	resp, err := a.roundTrip(requestAPIKeySASLAuthenticate, 0, req.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "error during SASL authentication")
+	}
+
+	d := &packetDecoder{b: resp}
+	errCode, err := d.int16()
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding SASL authenticate response")
+	}
+
+	errMsg, err := d.nullableString()
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding SASL authenticate response")
+	}
+
+	if errCode != 0 {
+		if errMsg == "" {
+			errMsg = sarama.KError(errCode).Error()
+		}
+		return nil, fmt.Errorf("SASL authentication failed: %s", errMsg)
+	}
+
+	return d.bytes()
+}
+
+func (a *saslAuthenticator) scram(mechanism, username, password string) error {
+	hash := scram.SHA256
+	if mechanism == SASLMechanismScramSHA512 {
+		hash = scramSHA512
+	}
+
+	client, err := hash.NewClient(username, password, "")
+	if err != nil {
+		return errors.Wrap(err, "error creating SCRAM client")
+	}
+
+	conv := client.NewConversation()
+	var challenge string
+	for {
+		msg, err := conv.Step(challenge)
+		if err != nil {
+			return errors.Wrap(err, "error during SCRAM exchange")
+		}
+
+		if conv.Done() {
+			return nil
+		}
+
+		resp, err := a.authenticate([]byte(msg))
+		if err != nil {
+			return err
+		}
+
+		challenge = string(resp)
+	}
+}
+
+// roundTrip sends a request with the given API key, version and body, returning the body of the response.
+// Only requests with non-flexible headers are supported.
+func (a *saslAuthenticator) roundTrip(apiKey, apiVersion int16, body []byte) ([]byte, error) {
+	a.correlationID++
+
+	req := &packetEncoder{}
+	req.int32(int32(2 + 2 + 4 + 2 + len(saslClientID) + len(body)))
+	req.int16(apiKey)
+	req.int16(apiVersion)
+	req.int32(a.correlationID)
+	req.string(saslClientID)
+	_, _ = req.Write(body)
+
+	if _, err := a.conn.Write(req.Bytes()); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(a.conn, header); err != nil {
+		return nil, err
+	}
+
+	d := &packetDecoder{b: header}
+	size, _ := d.int32()
+	correlationID, _ := d.int32()
+	if correlationID != a.correlationID {
+		return nil, fmt.Errorf("unexpected correlation id %d. Expected %d", correlationID, a.correlationID)
+	}
+
+	if size < 4 || size > maxRequestSize {
+		return nil, fmt.Errorf("invalid response size %d", size)
+	}
+
+	resp := make([]byte, size-4)
+	_, err := io.ReadFull(a.conn, resp)
+	return resp, err
+}
+
+// scramClient implements sarama.SCRAMClient.
+type scramClient struct {
+	*scram.Client
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) (err error) {
+	c.Client, err = c.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+
+	c.ClientConversation = c.Client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.ClientConversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.ClientConversation.Done()
+}
+
+// tokenFileProvider provides OAUTHBEARER tokens read from a file.
+// It implements sarama.AccessTokenProvider.
+type tokenFileProvider struct {
+	path string
+}
+
+func (p tokenFileProvider) read() (string, error) {
+	raw, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading token file %s", p.path)
+	}
+
+	token := strings.TrimSpace(string(raw))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", p.path)
+	}
+
+	return token, nil
+}
+
+func (p tokenFileProvider) Token() (*sarama.AccessToken, error) {
+	token, err := p.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return &sarama.AccessToken{Token: token}, nil
+}
@@ -0,0 +1,190 @@
+package kafka
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSASLConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      SASLConfig
+		expectedErr string
+	}{
+		{
+			name:   "Valid PLAIN",
+			config: SASLConfig{Mechanism: SASLMechanismPlain, Username: "user", Password: "pass"},
+		},
+		{
+			name:   "Valid SCRAM-SHA-256",
+			config: SASLConfig{Mechanism: SASLMechanismScramSHA256, Username: "user", Password: "pass"},
+		},
+		{
+			name:   "Valid OAUTHBEARER",
+			config: SASLConfig{Mechanism: SASLMechanismOAuthBearer, TokenFile: "/var/run/token"},
+		},
+		{
+			name:        "Invalid SCRAM-SHA-512. Missing password",
+			config:      SASLConfig{Mechanism: SASLMechanismScramSHA512, Username: "user"},
+			expectedErr: "username and password are required for SASL mechanism SCRAM-SHA-512",
+		},
+		{
+			name:        "Invalid OAUTHBEARER. Missing token file",
+			config:      SASLConfig{Mechanism: SASLMechanismOAuthBearer},
+			expectedErr: "token file is required for SASL mechanism OAUTHBEARER",
+		},
+		{
+			name:        "Unsupported mechanism",
+			config:      SASLConfig{Mechanism: "GSSAPI"},
+			expectedErr: `SASL mechanism "GSSAPI" is not supported. Supported mechanisms are PLAIN, SCRAM-SHA-256, SCRAM-SHA-512, OAUTHBEARER`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSASLConfig_ConfigureSarama(t *testing.T) {
+	tests := []struct {
+		config            SASLConfig
+		expectedMechanism sarama.SASLMechanism
+	}{
+		{config: SASLConfig{Mechanism: SASLMechanismPlain, Username: "user", Password: "pass"}, expectedMechanism: sarama.SASLTypePlaintext},
+		{config: SASLConfig{Mechanism: SASLMechanismScramSHA256, Username: "user", Password: "pass"}, expectedMechanism: sarama.SASLTypeSCRAMSHA256},
+		{config: SASLConfig{Mechanism: SASLMechanismScramSHA512, Username: "user", Password: "pass"}, expectedMechanism: sarama.SASLTypeSCRAMSHA512},
+		{config: SASLConfig{Mechanism: SASLMechanismOAuthBearer, TokenFile: "/var/run/token"}, expectedMechanism: sarama.SASLTypeOAuth},
+	}
+	for _, test := range tests {
+		t.Run(test.config.Mechanism, func(t *testing.T) {
+			conf := sarama.NewConfig()
+			conf.Version = sarama.V1_0_0_0
+			test.config.ConfigureSarama(conf)
+
+			assert.True(t, conf.Net.SASL.Enable)
+			assert.Equal(t, test.expectedMechanism, conf.Net.SASL.Mechanism)
+			assert.Equal(t, test.config.Username, conf.Net.SASL.User)
+			assert.Equal(t, test.config.Password, conf.Net.SASL.Password)
+			assert.NoError(t, conf.Validate())
+
+			if conf.Net.SASL.SCRAMClientGeneratorFunc != nil {
+				client := conf.Net.SASL.SCRAMClientGeneratorFunc()
+				require.NoError(t, client.Begin("user", "pass", ""))
+				first, err := client.Step("")
+				require.NoError(t, err)
+				assert.Contains(t, first, "n=user")
+				assert.False(t, client.Done())
+			}
+		})
+	}
+}
+
+func TestTokenFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, ioutil.WriteFile(path, []byte("my-token\n"), 0600))
+
+	token, err := tokenFileProvider{path: path}.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "my-token", token.Token)
+
+	// Tokens are read on every call, so they can be rotated.
+	require.NoError(t, ioutil.WriteFile(path, []byte("rotated-token"), 0600))
+	token, err = tokenFileProvider{path: path}.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "rotated-token", token.Token)
+
+	require.NoError(t, ioutil.WriteFile(path, nil, 0600))
+	_, err = tokenFileProvider{path: path}.Token()
+	assert.EqualError(t, err, "token file "+path+" is empty")
+}
+
+func TestSASLConfig_authenticate(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("my-token"), 0600))
+
+	tests := []struct {
+		name              string
+		config            SASLConfig
+		authErrCode       int16
+		expectedAuthBytes string
+		expectedErr       string
+	}{
+		{
+			name:              "PLAIN",
+			config:            SASLConfig{Mechanism: SASLMechanismPlain, Username: "user", Password: "pass"},
+			expectedAuthBytes: "\x00user\x00pass",
+		},
+		{
+			name:              "OAUTHBEARER",
+			config:            SASLConfig{Mechanism: SASLMechanismOAuthBearer, TokenFile: tokenFile},
+			expectedAuthBytes: "n,,\x01auth=Bearer my-token\x01\x01",
+		},
+		{
+			name:              "Authentication failed",
+			config:            SASLConfig{Mechanism: SASLMechanismPlain, Username: "user", Password: "wrong"},
+			authErrCode:       int16(sarama.ErrSASLAuthenticationFailed),
+			expectedAuthBytes: "\x00user\x00wrong",
+			expectedErr:       "SASL authentication failed: kafka server: SASL Authentication failed.",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, broker := net.Pipe()
+			defer client.Close()
+
+			authBytes := make(chan []byte, 1)
+			go func() {
+				defer broker.Close()
+				fakeSASLBroker(t, broker, test.config.Mechanism, test.authErrCode, authBytes)
+			}()
+
+			err := test.config.authenticate(client)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expectedAuthBytes, string(<-authBytes))
+		})
+	}
+}
+
+// fakeSASLBroker answers a SASL handshake and a SASL authenticate request, sending the received auth bytes to the given channel.
+func fakeSASLBroker(t *testing.T, conn net.Conn, mechanism string, authErrCode int16, authBytes chan<- []byte) {
+	req, err := readRequest(conn)
+	require.NoError(t, err)
+	require.EqualValues(t, requestAPIKeySASLHandshake, req.APIKey)
+
+	resp := &packetEncoder{}
+	resp.int16(0)
+	resp.int32(1)
+	resp.string(mechanism)
+	require.NoError(t, writeResponse(conn, req, resp.Bytes()))
+
+	req, err = readRequest(conn)
+	require.NoError(t, err)
+	require.EqualValues(t, requestAPIKeySASLAuthenticate, req.APIKey)
+
+	d := &packetDecoder{b: req.Body}
+	b, err := d.bytes()
+	require.NoError(t, err)
+	authBytes <- b
+
+	resp = &packetEncoder{}
+	resp.int16(authErrCode)
+	resp.nullableString(nil)
+	resp.bytes(nil)
+	require.NoError(t, writeResponse(conn, req, resp.Bytes()))
+}
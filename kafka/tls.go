@@ -0,0 +1,117 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// listenerTLSCheckInterval is the minimum time between checks of the files the listener TLS config is built from.
+const listenerTLSCheckInterval = time.Second
+
+// listenerTLSReloader holds the TLS config of the listeners, reloading it whenever the files it is built from change.
+// Handshakes never wait for a reload, except the one checking the files.
+type listenerTLSReloader struct {
+	conf     *ListenerTLSConfig
+	interval time.Duration
+	// loaded holds the *tls.Config served to clients.
+	loaded atomic.Value
+	// nextCheck holds the time, in Unix nanoseconds, the files can be checked again at.
+	nextCheck int64
+	// mu guards modTimes, in case a reload takes longer than the interval.
+	mu       sync.Mutex
+	modTimes []time.Time
+}
+
+// newListenerTLSReloader creates a listenerTLSReloader whose files are checked at most once per interval.
+func newListenerTLSReloader(conf *ListenerTLSConfig, interval time.Duration) (*listenerTLSReloader, error) {
+	loaded, err := conf.load()
+	if err != nil {
+		return nil, err
+	}
+
+	modTimes, err := fileModTimes(conf.files())
+	if err != nil {
+		return nil, err
+	}
+
+	r := &listenerTLSReloader{conf: conf, interval: interval, modTimes: modTimes, nextCheck: time.Now().Add(interval).UnixNano()}
+	r.loaded.Store(loaded)
+
+	return r, nil
+}
+
+// configForClient is meant to be used as tls.Config.GetConfigForClient. The files are checked on the first handshake
+// after the interval elapsed. If reloading fails, for example because the key pair is being rotated and only one of them
+// was written, the previous config keeps being served and the reload is retried on the next check.
+func (r *listenerTLSReloader) configForClient(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+	now := time.Now().UnixNano()
+	next := atomic.LoadInt64(&r.nextCheck)
+	// Only the handshake updating the time of the next check checks the files.
+	if now >= next && atomic.CompareAndSwapInt64(&r.nextCheck, next, now+int64(r.interval)) {
+		if err := r.reload(); err != nil {
+			logrus.WithError(err).Warn("error reloading listener TLS config. Keeping the previous one")
+		}
+	}
+
+	return r.loaded.Load().(*tls.Config), nil
+}
+
+// reload loads the TLS config if any of its files changed since the last load.
+func (r *listenerTLSReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTimes, err := fileModTimes(r.conf.files())
+	if err != nil {
+		return err
+	}
+
+	if equalTimes(modTimes, r.modTimes) {
+		return nil
+	}
+
+	loaded, err := r.conf.load()
+	if err != nil {
+		return err
+	}
+
+	r.loaded.Store(loaded)
+	r.modTimes = modTimes
+	logrus.Infof("Listener TLS config reloaded from %s", r.conf.CertFile)
+
+	return nil
+}
+
+func fileModTimes(files []string) ([]time.Time, error) {
+	modTimes := make([]time.Time, len(files))
+	for i, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error checking file %s", f)
+		}
+
+		modTimes[i] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,30 +13,88 @@ import (
 	"time"
 
 	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/asyncapi/event-gateway/admin"
+	"github.com/asyncapi/event-gateway/amqp"
+	"github.com/asyncapi/event-gateway/asyncapi"
+	v2 "github.com/asyncapi/event-gateway/asyncapi/v2"
+	"github.com/asyncapi/event-gateway/bridge"
 	"github.com/asyncapi/event-gateway/config"
 	"github.com/asyncapi/event-gateway/kafka"
 	"github.com/asyncapi/event-gateway/message"
+	"github.com/asyncapi/event-gateway/message/handler"
+	"github.com/asyncapi/event-gateway/mqtt"
+	"github.com/asyncapi/event-gateway/nats"
+	"github.com/asyncapi/event-gateway/producer"
+	"github.com/asyncapi/event-gateway/proxy"
 	"github.com/go-chi/chi/v5"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/olahol/melody"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 )
 
-const configPrefix = "eventgateway"
+const (
+	configPrefix  = "eventgateway"
+	configFileEnv = "EVENTGATEWAY_CONFIG_FILE"
+	// validatedMessagesTopic is the topic messages validated by the MQTT, AMQP and NATS proxies are published to.
+	validatedMessagesTopic = "validated-messages"
+)
+
+// Exit codes of subcommands.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// subcommands run instead of the gateway when given as first argument. They return the exit code.
+var subcommands = map[string]func(args []string) int{
+	"diff":             runDiff,
+	"validate-doc":     runValidateDoc,
+	"validate-message": runValidateMessage,
+	"dry-run":          runDryRun,
+}
 
 func main() {
-	c := config.NewApp()
-	if err := envconfig.Process(configPrefix, c); err != nil {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+
+	configFile := configFlag(flag.CommandLine)
+	printConfig := flag.Bool("print-config", false, "Print the effective config and exit")
+	flag.Parse()
+
+	c, err := loadConfig(*configFile)
+	if err != nil {
 		_ = envconfig.Usage(configPrefix, c)
 		logrus.WithError(err).Fatal()
 	}
 
+	if *printConfig {
+		out, err := c.YAML()
+		if err != nil {
+			logrus.WithError(err).Fatal("error printing config")
+		}
+
+		_, _ = fmt.Fprintln(os.Stdout, string(out))
+		return
+	}
+
 	if c.Debug {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 
-	kafkaProxyConfig, err := c.ProxyConfig()
+	docs, err := c.Documents()
+	if err != nil {
+		_ = envconfig.Usage(configPrefix, c)
+		logrus.WithError(err).Fatal()
+	}
+
+	servers, err := c.Servers(docs)
 	if err != nil {
 		_ = envconfig.Usage(configPrefix, c)
 		logrus.WithError(err).Fatal()
@@ -51,32 +111,91 @@ func main() {
 	defer cancel()
 
 	m := melody.New()
+	sessions := admin.NewSessions()
+	m.HandleConnect(sessions.Connect)
+	m.HandleDisconnect(sessions.Disconnect)
+
+	// bridgeWS holds the sessions subscribed to the traffic of channels, so they don't receive validation errors.
+	bridgeWS := melody.New()
+	bridgeWS.HandleConnect(sessions.Connect)
+	bridgeWS.HandleDisconnect(sessions.Disconnect)
+
 	handleInterruptions(cancel, func() error {
 		return m.CloseWithMsg(melody.FormatCloseMessage(1000, "The server says goodbye :)"))
+	}, func() error {
+		return bridgeWS.CloseWithMsg(melody.FormatCloseMessage(1000, "The server says goodbye :)"))
 	})
 
-	if kafkaProxyConfig.MessageSubscriber != nil {
-		defer kafkaProxyConfig.MessageSubscriber.Close()
-		defer kafkaProxyConfig.MessagePublisher.Close()
-		messageRouter.AddNoPublisherHandler("consume-validation-errors-from-kafka", c.KafkaProxy.MessageValidation.PublishToKafkaTopic, kafkaProxyConfig.MessageSubscriber, validationErrorsHandler(m))
+	redactor, err := c.Redactor(docs)
+	if err != nil {
+		_ = envconfig.Usage(configPrefix, c)
+		logrus.WithError(err).Fatal()
 	}
 
-	kafkaProxy, err := kafka.NewProxy(kafkaProxyConfig, messageRouter)
+	sampler, err := c.Sampler(docs)
 	if err != nil {
 		_ = envconfig.Usage(configPrefix, c)
 		logrus.WithError(err).Fatal()
 	}
 
-	runWebsocketServer(c.WSServerPort, "/ws", m)
+	kafkaProxies := &kafkaProxyFactory{app: c, docs: docs, router: messageRouter, ws: m, redactor: redactor, sampler: sampler}
+	defer kafkaProxies.Close()
+
+	sink := &validatedMessagesSink{router: messageRouter, ws: m, redactor: redactor, kafka: kafkaProxies}
+	defer sink.Close()
+
+	registry := proxy.NewRegistry()
+	registry.Register(kafkaProxies.newProxy, kafka.Protocols...)
+	messageProxies := registerMessageProxies(registry, c, messageProxyFactory{docs: docs, router: messageRouter, sink: sink, sampler: sampler})
+	proxies, err := registry.Proxies(servers...)
+	if err != nil {
+		_ = envconfig.Usage(configPrefix, c)
+		logrus.WithError(err).Fatal()
+	}
+
+	var channelsBridge *bridge.Bridge
+	if c.WSBridge.Enabled {
+		channelsBridge, err = c.Bridge(docs, bridgeWS, redactor)
+		if err != nil {
+			logrus.WithError(err).Fatal()
+		}
+		defer channelsBridge.Close()
+	}
+
+	runWebsocketServer(c.WSServerPort, "/ws", m, channelsBridge)
 	runHealthCheckServer(80, "/")
 
+	if c.AdminPort > 0 {
+		adminAPI, err := newAdminAPI(c, docs, kafkaProxies, messageProxies, sessions, sampler)
+		if err != nil {
+			logrus.WithError(err).Fatal()
+		}
+
+		runAdminServer(c.AdminPort, adminAPI)
+	}
+
+	if c.HTTPProducer.Port > 0 {
+		opts, err := c.HTTPProducerOptions(docs)
+		if err != nil {
+			logrus.WithError(err).Fatal()
+		}
+
+		producerAPI := producer.NewAPI(opts...)
+		defer producerAPI.Close()
+
+		runProducerServer(c.HTTPProducer.Port, producerAPI)
+	}
+
 	group, ctx := errgroup.WithContext(ctx)
 	group.Go(func() error {
 		return messageRouter.Run(ctx) // Note: Can not be called until fully configured.
 	})
-	group.Go(func() error {
-		return kafkaProxy(ctx)
-	})
+	for _, p := range proxies {
+		p := p
+		group.Go(func() error {
+			return proxy.Run(ctx, p)
+		})
+	}
 
 	if err := group.Wait(); err != nil {
 		logrus.WithError(err).Fatal()
@@ -98,12 +217,338 @@ func runHealthCheckServer(port int, path string) {
 	}()
 }
 
-func runWebsocketServer(port int, path string, m *melody.Melody) {
+// configFlag defines the flag for the path to the config file.
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", os.Getenv(configFileEnv), "Path to a YAML or JSON config file. Environment variables override its values. Can be set via "+configFileEnv)
+}
+
+// loadConfig loads the config from defaults, then from the config file (if any) and finally from environment variables.
+func loadConfig(configFile string) (*config.App, error) {
+	c := config.NewApp()
+	if configFile != "" {
+		if err := c.LoadFile(configFile); err != nil {
+			return c, err
+		}
+	}
+
+	return c, envconfig.Process(configPrefix, c)
+}
+
+// kafkaProxyFactory creates Kafka proxies, keeping track of their config and the resources to be released on shutdown.
+// Resources not bound to a server, such as the ports of dynamic listeners and the validation errors publisher and subscriber,
+// are shared by all the proxies.
+type kafkaProxyFactory struct {
+	app          *config.App
+	docs         []asyncapi.Document
+	router       *watermillmessage.Router
+	ws           *melody.Melody
+	redactor     *message.Redactor
+	sampler      *message.Sampler
+	dynamicPorts kafka.DynamicPorts
+	produceRates kafka.ProduceRates
+	errorsPubSub *kafkaPubSub
+	configs      []*kafka.ProxyConfig
+	proxies      []*kafka.Proxy
+	closers      []io.Closer
+}
+
+// kafkaPubSub holds the publisher and subscriber of a Kafka topic.
+type kafkaPubSub struct {
+	publisher  watermillmessage.Publisher
+	subscriber watermillmessage.Subscriber
+}
+
+func (f *kafkaProxyFactory) newProxy(s asyncapi.Server) (proxy.Proxy, error) {
+	conf, err := f.app.KafkaProxy.ServerProxyConfig(f.docs, s.Name(), f.app.Debug)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.MessageHandler != nil {
+		conf.Sampler = f.sampler
+
+		errorsPubSub, err := f.validationErrorsPubSub()
+		if err != nil {
+			return nil, errors.Wrap(err, "error configuring message validation")
+		}
+
+		if errorsPubSub.publisher != nil {
+			conf.MessagePublisher, conf.PublishToTopic = errorsPubSub.publisher, f.app.KafkaProxy.MessageValidation.PublishToKafkaTopic
+			// Messages are redacted before being produced, as they leave the gateway.
+			conf.MessageHandler = handler.RedactMessages(conf.MessageHandler, f.redactor)
+		}
+	}
+
+	conf.PolicyViolationHandler = policyViolationsHandler(f.ws)
+	conf.DynamicPorts = &f.dynamicPorts
+	conf.ProduceRates = &f.produceRates
+	f.configs = append(f.configs, conf)
+
+	p, err := kafka.NewProxy(conf, f.router)
+	if err != nil {
+		return nil, err
+	}
+
+	f.proxies = append(f.proxies, p)
+
+	return p, nil
+}
+
+// validationErrorsPubSub returns the publisher and subscriber of the topic invalid messages are produced to.
+// They are created on first use, along with the router handler broadcasting validation errors, so every invalid message
+// is broadcasted once no matter the number of proxies.
+func (f *kafkaProxyFactory) validationErrorsPubSub() (*kafkaPubSub, error) {
+	if f.errorsPubSub != nil {
+		return f.errorsPubSub, nil
+	}
+
+	publisher, subscriber, err := f.app.KafkaProxy.ValidationErrorsPubSub(f.docs)
+	if err != nil {
+		return nil, err
+	}
+
+	f.errorsPubSub = &kafkaPubSub{publisher: publisher, subscriber: subscriber}
+	if subscriber != nil {
+		f.closers = append(f.closers, subscriber, publisher)
+		// Messages were redacted before being produced, so they are not redacted again.
+		f.router.AddNoPublisherHandler("consume-validation-errors-from-kafka", f.app.KafkaProxy.MessageValidation.PublishToKafkaTopic, subscriber, validationErrorsHandler(f.ws, nil))
+	}
+
+	return f.errorsPubSub, nil
+}
+
+// adminProxies returns the created proxies, so their stats can be exposed by the admin API.
+func (f *kafkaProxyFactory) adminProxies() []admin.KafkaProxy {
+	proxies := make([]admin.KafkaProxy, len(f.proxies))
+	for i, p := range f.proxies {
+		proxies[i] = p
+	}
+
+	return proxies
+}
+
+// Close releases the resources of all the created proxies.
+func (f *kafkaProxyFactory) Close() {
+	for _, c := range f.closers {
+		if err := c.Close(); err != nil {
+			logrus.WithError(err).Error("error closing Kafka proxy resources")
+		}
+	}
+}
+
+// validatedMessagesSink receives the messages handled by the MQTT, AMQP and NATS proxies, so validation errors can be broadcasted.
+type validatedMessagesSink struct {
+	router   *watermillmessage.Router
+	ws       *melody.Melody
+	redactor *message.Redactor
+	// kafka provides the publisher of the Kafka topic invalid messages are produced to, if any.
+	kafka  *kafkaProxyFactory
+	pubSub *gochannel.GoChannel
+}
+
+// configure sets where the given config publishes messages to after being handled. If a Kafka topic for invalid messages
+// is set, messages are redacted and produced to it, same as the ones handled by the Kafka proxies. Otherwise, they are
+// published in memory and broadcasted from there.
+func (s *validatedMessagesSink) configure(c *proxy.MessageConfig) error {
+	errorsPubSub, err := s.kafka.validationErrorsPubSub()
+	if err != nil {
+		return errors.Wrap(err, "error configuring message validation")
+	}
+
+	if errorsPubSub.publisher != nil {
+		c.MessagePublisher, c.PublishToTopic = errorsPubSub.publisher, s.kafka.app.KafkaProxy.MessageValidation.PublishToKafkaTopic
+		// Messages are redacted before being produced, as they leave the gateway.
+		c.MessageHandler = handler.RedactMessages(c.MessageHandler, s.redactor)
+
+		return nil
+	}
+
+	c.MessagePublisher, c.PublishToTopic = s.publisher()
+
+	return nil
+}
+
+// publisher returns the in memory publisher and topic messages should be published to after being handled.
+// The router handler broadcasting validation errors is added on first use.
+func (s *validatedMessagesSink) publisher() (watermillmessage.Publisher, string) {
+	if s.pubSub == nil {
+		s.pubSub = gochannel.NewGoChannel(gochannel.Config{}, message.NewWatermillLogrusLogger(logrus.StandardLogger()))
+		s.router.AddNoPublisherHandler("consume-validation-errors", validatedMessagesTopic, s.pubSub, validationErrorsHandler(s.ws, s.redactor))
+	}
+
+	return s.pubSub, validatedMessagesTopic
+}
+
+// Close releases the resources of the sink.
+func (s *validatedMessagesSink) Close() {
+	if s.pubSub == nil {
+		return
+	}
+
+	if err := s.pubSub.Close(); err != nil {
+		logrus.WithError(err).Error("error closing validated messages sink")
+	}
+}
+
+// messageProxyConfig is the config of a proxy handling messages, such as the MQTT, AMQP and NATS ones.
+type messageProxyConfig interface {
+	Messages() *proxy.MessageConfig
+}
+
+// messageProxyFactory creates the proxies of a protocol whose handled messages are published as configured by the validated messages sink.
+// The created proxies are kept track of, so they can be exposed by the admin API.
+type messageProxyFactory struct {
+	protocol string
+	docs     []asyncapi.Document
+	router   *watermillmessage.Router
+	sink     *validatedMessagesSink
+	sampler  *message.Sampler
+	// config returns the config for the proxy of the given server.
+	config func(docs []asyncapi.Document, server string) (messageProxyConfig, error)
+	// create creates a proxy out of the given config.
+	create  func(conf messageProxyConfig, r *watermillmessage.Router) (proxy.Proxy, error)
+	servers []config.ServerMapping
+	proxies []admin.TCPProxy
+}
+
+// registerMessageProxies registers the factories of the MQTT, AMQP and NATS proxies. All of them are copies of base.
+func registerMessageProxies(registry *proxy.Registry, c *config.App, base messageProxyFactory) []*messageProxyFactory {
+	factories := []struct {
+		protocols []string
+		config    func(docs []asyncapi.Document, server string) (messageProxyConfig, error)
+		create    func(conf messageProxyConfig, r *watermillmessage.Router) (proxy.Proxy, error)
+	}{
+		{
+			protocols: mqtt.Protocols,
+			config: func(docs []asyncapi.Document, server string) (messageProxyConfig, error) {
+				return c.MQTTProxy.ServerProxyConfig(docs, server, c.Debug)
+			},
+			create: func(conf messageProxyConfig, r *watermillmessage.Router) (proxy.Proxy, error) {
+				return mqtt.NewProxy(conf.(*mqtt.ProxyConfig), r)
+			},
+		},
+		{
+			protocols: amqp.Protocols,
+			config: func(docs []asyncapi.Document, server string) (messageProxyConfig, error) {
+				return c.AMQPProxy.ServerProxyConfig(docs, server, c.Debug)
+			},
+			create: func(conf messageProxyConfig, r *watermillmessage.Router) (proxy.Proxy, error) {
+				return amqp.NewProxy(conf.(*amqp.ProxyConfig), r)
+			},
+		},
+		{
+			protocols: nats.Protocols,
+			config: func(docs []asyncapi.Document, server string) (messageProxyConfig, error) {
+				return c.NATSProxy.ServerProxyConfig(docs, server, c.Debug)
+			},
+			create: func(conf messageProxyConfig, r *watermillmessage.Router) (proxy.Proxy, error) {
+				return nats.NewProxy(conf.(*nats.ProxyConfig), r)
+			},
+		},
+	}
+
+	registered := make([]*messageProxyFactory, len(factories))
+	for i, f := range factories {
+		factory := base
+		factory.protocol, factory.config, factory.create = f.protocols[0], f.config, f.create
+		registry.Register(factory.newProxy, f.protocols...)
+		registered[i] = &factory
+	}
+
+	return registered
+}
+
+func (f *messageProxyFactory) newProxy(s asyncapi.Server) (proxy.Proxy, error) {
+	conf, err := f.config(f.docs, s.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	if c := conf.Messages(); c.MessageHandler != nil {
+		c.Sampler = f.sampler
+		if err := f.sink.configure(c); err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := f.create(conf, f.router)
+	if err != nil {
+		return nil, err
+	}
+
+	if tcp, ok := p.(admin.TCPProxy); ok {
+		f.proxies = append(f.proxies, tcp)
+		f.servers = append(f.servers, config.ServerMapping{Server: s.Name(), URL: s.URL(), Protocol: s.Protocol(), ListenAt: tcp.ListenAddress()})
+	}
+
+	return p, nil
+}
+
+// newAdminAPI creates the admin API exposing the proxies created by the given factories.
+func newAdminAPI(c *config.App, docs []asyncapi.Document, kafkaProxies *kafkaProxyFactory, messageProxies []*messageProxyFactory, sessions *admin.Sessions, sampler *message.Sampler) (*admin.API, error) {
+	servers, err := c.KafkaProxy.ServerMappings(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []admin.Opt{
+		admin.WithKafkaProxyConfigs(kafkaProxies.configs...),
+		admin.WithKafkaProxies(kafkaProxies.adminProxies()...),
+		admin.WithSessions(sessions),
+		admin.WithSampler(sampler),
+	}
+
+	for _, f := range messageProxies {
+		servers = append(servers, f.servers...)
+		opts = append(opts, admin.WithTCPProxies(f.protocol, f.proxies...))
+	}
+
+	opts = append(opts, admin.WithServers(servers...))
+
+	if c.KafkaProxy.MessageValidation.Enabled {
+		channels, err := v2.ValidatedChannels(docs...)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, admin.WithValidatedChannels(channels...))
+	}
+
+	return admin.NewAPI(opts...), nil
+}
+
+func runAdminServer(port int, api *admin.API) {
+	go func() {
+		address := fmt.Sprintf(":%v", port)
+		logrus.Infof("Admin API listening on %s", address)
+		if err := http.ListenAndServe(address, api.Router()); err != nil {
+			logrus.WithError(err).Fatal("error running admin API server")
+		}
+	}()
+}
+
+func runProducerServer(port int, api *producer.API) {
+	go func() {
+		address := fmt.Sprintf(":%v", port)
+		logrus.Infof("HTTP produce API listening on %s", address)
+		if err := http.ListenAndServe(address, api.Router()); err != nil {
+			logrus.WithError(err).Fatal("error running HTTP produce API server")
+		}
+	}()
+}
+
+// runWebsocketServer runs the Websocket server broadcasting validation errors at path.
+// Sessions subscribe to the traffic of channels at path/channels/{channel} if a bridge is set.
+func runWebsocketServer(port int, path string, m *melody.Melody, b *bridge.Bridge) {
 	r := chi.NewRouter()
 	r.Get(path, func(w http.ResponseWriter, r *http.Request) {
 		_ = m.HandleRequest(w, r)
 	})
 
+	if b != nil {
+		r.Mount(path+"/channels", b.Router())
+	}
+
 	go func() {
 		address := fmt.Sprintf(":%v", port)
 		logrus.Infof("Websocket server listening on %s", address)
@@ -113,7 +558,9 @@ func runWebsocketServer(port int, path string, m *melody.Melody) {
 	}()
 }
 
-func validationErrorsHandler(m *melody.Melody) watermillmessage.NoPublishHandlerFunc {
+// validationErrorsHandler broadcasts the invalid messages to all ws sessions. Their sensitive values are redacted first,
+// unless the redactor is nil because they were redacted already.
+func validationErrorsHandler(m *melody.Melody, redactor *message.Redactor) watermillmessage.NoPublishHandlerFunc {
 	return func(msg *watermillmessage.Message) error {
 		validationError, err := message.ValidationErrorFromMessage(msg)
 		if err != nil {
@@ -125,6 +572,10 @@ func validationErrorsHandler(m *melody.Melody) watermillmessage.NoPublishHandler
 			return nil
 		}
 
+		if redactor != nil {
+			msg = redactor.Redact(msg)
+		}
+
 		content, err := json.Marshal(msg)
 		if err != nil {
 			logrus.WithError(err).Error("error marshaling message")
@@ -145,6 +596,20 @@ func validationErrorsHandler(m *melody.Melody) watermillmessage.NoPublishHandler
 	}
 }
 
+func policyViolationsHandler(m *melody.Melody) kafka.PolicyViolationHandler {
+	return func(violation kafka.PolicyViolation) {
+		content, err := json.Marshal(violation)
+		if err != nil {
+			logrus.WithError(err).Error("error marshaling policy violation")
+			content = []byte(violation.Error())
+		}
+
+		if err := m.Broadcast(content); err != nil {
+			logrus.WithError(err).Error("error broadcasting policy violation to all ws sessions")
+		}
+	}
+}
+
 func handleInterruptions(cancel context.CancelFunc, funcs ...func() error) {
 	c := make(chan os.Signal, 2)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
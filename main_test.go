@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/asyncapi/event-gateway/config"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/asyncapi/event-gateway/proxy"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatedMessagesSink_configure(t *testing.T) {
+	kafkaPublisher := gochannel.NewGoChannel(gochannel.Config{}, message.NewWatermillLogrusLogger(logrus.StandardLogger()))
+	t.Cleanup(func() {
+		assert.NoError(t, kafkaPublisher.Close())
+	})
+
+	tests := []struct {
+		name              string
+		errorsPubSub      *kafkaPubSub
+		expectedPublisher watermillmessage.Publisher
+		expectedTopic     string
+		expectedPayload   string
+	}{
+		{
+			name:              "Messages are redacted and produced to the Kafka topic for invalid messages",
+			errorsPubSub:      &kafkaPubSub{publisher: kafkaPublisher},
+			expectedPublisher: kafkaPublisher,
+			expectedTopic:     "invalid-messages",
+			expectedPayload:   `{"email":"<redacted>"}`,
+		},
+		{
+			name:            "Messages are published in memory if no Kafka topic for invalid messages is set",
+			errorsPubSub:    &kafkaPubSub{},
+			expectedTopic:   validatedMessagesTopic,
+			expectedPayload: `{"email":"foo@bar.com"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router, err := watermillmessage.NewRouter(watermillmessage.RouterConfig{}, message.NewWatermillLogrusLogger(logrus.StandardLogger()))
+			require.NoError(t, err)
+
+			redactor, err := message.NewRedactor(message.RedactionModeMask, nil, []string{"/email"})
+			require.NoError(t, err)
+
+			app := config.NewApp()
+			app.KafkaProxy.MessageValidation.PublishToKafkaTopic = "invalid-messages"
+			sink := &validatedMessagesSink{
+				router:   router,
+				redactor: redactor,
+				kafka:    &kafkaProxyFactory{app: app, errorsPubSub: test.errorsPubSub},
+			}
+			t.Cleanup(sink.Close)
+
+			c := &proxy.MessageConfig{MessageHandler: func(msg *watermillmessage.Message) ([]*watermillmessage.Message, error) {
+				return []*watermillmessage.Message{msg}, nil
+			}}
+			require.NoError(t, sink.configure(c))
+
+			assert.Equal(t, test.expectedTopic, c.PublishToTopic)
+			if test.expectedPublisher != nil {
+				assert.Same(t, test.expectedPublisher, c.MessagePublisher)
+			} else {
+				assert.Same(t, sink.pubSub, c.MessagePublisher)
+			}
+
+			msgs, err := c.MessageHandler(message.New([]byte(`{"email":"foo@bar.com"}`), "signups"))
+			require.NoError(t, err)
+			require.Len(t, msgs, 1)
+			assert.JSONEq(t, test.expectedPayload, string(msgs[0].Payload))
+		})
+	}
+}
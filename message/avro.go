@@ -0,0 +1,372 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// maxAvroDepth is the max nesting of the values decoded, so recursive schemas can't exhaust the stack.
+const maxAvroDepth = 100
+
+// confluentHeaderSize is the size of the Confluent wire format header: magic byte 0 and a 4 bytes schema ID.
+const confluentHeaderSize = 5
+
+var avroPrimitives = map[string]struct{}{
+	"null": {}, "boolean": {}, "int": {}, "long": {}, "float": {}, "double": {}, "bytes": {}, "string": {},
+}
+
+// AvroSchemaCompiler is a SchemaCompiler for Avro schemas (https://avro.apache.org/docs/current/spec.html).
+// Payloads are valid if they hold the Avro binary encoding of a value of the schema, optionally framed in the Confluent
+// wire format (magic byte 0 followed by a 4 bytes schema ID). Logical types are validated as their underlying type.
+func AvroSchemaCompiler(schema []byte) (SchemaValidator, error) {
+	var raw interface{}
+	if err := json.Unmarshal(schema, &raw); err != nil {
+		return nil, errors.Wrap(err, "error decoding Avro schema")
+	}
+
+	p := &avroParser{names: make(map[string]*avroType)}
+	t, err := p.parse(raw, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid Avro schema")
+	}
+
+	return func(payload []byte) ([]string, error) {
+		err := decodeAvro(t, payload)
+		if err != nil && len(payload) > confluentHeaderSize && payload[0] == 0 && decodeAvro(t, payload[confluentHeaderSize:]) == nil {
+			return nil, nil
+		}
+
+		if err != nil {
+			return []string{err.Error()}, nil
+		}
+
+		return nil, nil
+	}, nil
+}
+
+// avroType is a compiled Avro schema.
+type avroType struct {
+	// kind is either a primitive type name or record, enum, array, map, fixed or union.
+	kind    string
+	name    string
+	fields  []avroField
+	symbols int
+	// items holds the type of array items or map values.
+	items    *avroType
+	branches []*avroType
+	size     int
+}
+
+type avroField struct {
+	name string
+	typ  *avroType
+}
+
+// avroParser compiles Avro schemas, resolving references to named types.
+type avroParser struct {
+	names map[string]*avroType
+}
+
+func (p *avroParser) parse(s interface{}, namespace string) (*avroType, error) {
+	switch v := s.(type) {
+	case string:
+		return p.reference(v, namespace)
+	case []interface{}:
+		union := &avroType{kind: "union"}
+		for _, b := range v {
+			branch, err := p.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			union.branches = append(union.branches, branch)
+		}
+		return union, nil
+	case map[string]interface{}:
+		return p.parseComplex(v, namespace)
+	default:
+		return nil, fmt.Errorf("unexpected schema %v", s)
+	}
+}
+
+func (p *avroParser) reference(name, namespace string) (*avroType, error) {
+	if _, ok := avroPrimitives[name]; ok {
+		return &avroType{kind: name}, nil
+	}
+
+	if t, ok := p.names[name]; ok {
+		return t, nil
+	}
+
+	if t, ok := p.names[namespace+"."+name]; ok && namespace != "" {
+		return t, nil
+	}
+
+	return nil, fmt.Errorf("unknown type %s", name)
+}
+
+func (p *avroParser) parseComplex(s map[string]interface{}, namespace string) (*avroType, error) {
+	kind, ok := s["type"].(string)
+	if !ok {
+		return p.parse(s["type"], namespace)
+	}
+
+	t := &avroType{kind: kind}
+	switch kind {
+	case "record", "error", "enum", "fixed":
+		if err := p.register(t, s, namespace); err != nil {
+			return nil, err
+		}
+	}
+
+	switch kind {
+	case "record", "error":
+		t.kind = "record"
+		return t, p.parseFields(t, s)
+	case "enum":
+		symbols, _ := s["symbols"].([]interface{})
+		t.symbols = len(symbols)
+	case "array", "map":
+		key := "items"
+		if kind == "map" {
+			key = "values"
+		}
+
+		items, err := p.parse(s[key], namespace)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s of %s", key, kind)
+		}
+		t.items = items
+	case "fixed":
+		size, ok := s["size"].(float64)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("fixed %s should have a size", t.name)
+		}
+		t.size = int(size)
+	default:
+		// Primitive types can be declared as objects, i.e. when having a logical type.
+		return p.parse(kind, namespace)
+	}
+
+	return t, nil
+}
+
+// register registers a named type, so it can be referenced by its name. Types are registered before parsing their
+// fields, so records can reference themselves.
+func (p *avroParser) register(t *avroType, s map[string]interface{}, namespace string) error {
+	name, _ := s["name"].(string)
+	if name == "" {
+		return fmt.Errorf("%s should have a name", t.kind)
+	}
+
+	if ns, ok := s["namespace"].(string); ok {
+		namespace = ns
+	}
+
+	t.name = name
+	if !strings.Contains(name, ".") && namespace != "" {
+		t.name = namespace + "." + name
+	}
+
+	p.names[t.name] = t
+	return nil
+}
+
+func (p *avroParser) parseFields(t *avroType, s map[string]interface{}) error {
+	namespace := ""
+	if i := strings.LastIndex(t.name, "."); i > 0 {
+		namespace = t.name[:i]
+	}
+
+	fields, _ := s["fields"].([]interface{})
+	for _, f := range fields {
+		field, ok := f.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid field %v of record %s", f, t.name)
+		}
+
+		name, _ := field["name"].(string)
+		typ, err := p.parse(field["type"], namespace)
+		if err != nil {
+			return errors.Wrapf(err, "invalid field %s of record %s", name, t.name)
+		}
+
+		t.fields = append(t.fields, avroField{name: name, typ: typ})
+	}
+
+	return nil
+}
+
+// decodeAvro decodes a value of the given type, failing if the payload is not exactly one value.
+func decodeAvro(t *avroType, payload []byte) error {
+	d := &avroDecoder{b: payload}
+	if err := d.decode(t, 0); err != nil {
+		return err
+	}
+
+	if remaining := len(d.b) - d.pos; remaining > 0 {
+		return fmt.Errorf("%d unexpected bytes after Avro value", remaining)
+	}
+
+	return nil
+}
+
+type avroDecoder struct {
+	b   []byte
+	pos int
+}
+
+func (d *avroDecoder) decode(t *avroType, depth int) error {
+	if depth > maxAvroDepth {
+		return errors.New("Avro value is nested too deeply")
+	}
+
+	switch t.kind {
+	case "union":
+		i, err := d.long()
+		if err != nil {
+			return err
+		}
+		if i < 0 || i >= int64(len(t.branches)) {
+			return fmt.Errorf("union branch %d out of range", i)
+		}
+		return d.decode(t.branches[i], depth+1)
+	case "record":
+		for _, f := range t.fields {
+			if err := d.decode(f.typ, depth+1); err != nil {
+				return errors.Wrapf(err, "error decoding field %s of record %s", f.name, t.name)
+			}
+		}
+		return nil
+	case "array", "map":
+		return d.blocks(t, depth)
+	case "enum":
+		i, err := d.long()
+		if err == nil && (i < 0 || i >= int64(t.symbols)) {
+			err = fmt.Errorf("symbol %d of enum %s out of range", i, t.name)
+		}
+		return err
+	case "fixed":
+		_, err := d.read(t.size)
+		return err
+	default:
+		return d.primitive(t.kind)
+	}
+}
+
+func (d *avroDecoder) primitive(kind string) error {
+	var err error
+	switch kind {
+	case "null":
+	case "boolean":
+		var b []byte
+		if b, err = d.read(1); err == nil && b[0] > 1 {
+			err = fmt.Errorf("invalid boolean %d", b[0])
+		}
+	case "int":
+		var v int64
+		if v, err = d.long(); err == nil && int64(int32(v)) != v {
+			err = fmt.Errorf("int %d out of range", v)
+		}
+	case "long":
+		_, err = d.long()
+	case "float":
+		_, err = d.read(4)
+	case "double":
+		_, err = d.read(8)
+	case "bytes":
+		_, err = d.bytes()
+	case "string":
+		var b []byte
+		if b, err = d.bytes(); err == nil && !utf8.Valid(b) {
+			err = errors.New("string is not valid UTF-8")
+		}
+	default:
+		err = fmt.Errorf("unsupported type %s", kind)
+	}
+
+	return err
+}
+
+// blocks decodes the blocks of items of an array or map.
+func (d *avroDecoder) blocks(t *avroType, depth int) error {
+	for {
+		count, err := d.long()
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return nil
+		}
+
+		if count < 0 {
+			// Negative counts are followed by the block size in bytes.
+			count = -count
+			if _, err := d.long(); err != nil {
+				return err
+			}
+		}
+
+		for i := int64(0); i < count; i++ {
+			if t.kind == "map" {
+				if _, err := d.bytes(); err != nil {
+					return err
+				}
+			}
+
+			if err := d.decode(t.items, depth+1); err != nil {
+				return errors.Wrapf(err, "error decoding %s item %d", t.kind, i)
+			}
+		}
+	}
+}
+
+// long decodes a zig-zag encoded variable-length integer.
+func (d *avroDecoder) long() (int64, error) {
+	var u uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := d.read(1)
+		if err != nil {
+			return 0, err
+		}
+
+		u |= uint64(b[0]&0x7f) << shift
+		if b[0]&0x80 == 0 {
+			return int64(u>>1) ^ -int64(u&1), nil
+		}
+	}
+
+	return 0, errors.New("variable-length integer is too long")
+}
+
+func (d *avroDecoder) bytes() ([]byte, error) {
+	n, err := d.long()
+	if err != nil {
+		return nil, err
+	}
+
+	if n < 0 {
+		return nil, fmt.Errorf("negative length %d", n)
+	}
+
+	if n > int64(len(d.b)-d.pos) {
+		return nil, errors.New("unexpected end of Avro data")
+	}
+
+	return d.read(int(n))
+}
+
+func (d *avroDecoder) read(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.b) {
+		return nil, errors.New("unexpected end of Avro data")
+	}
+
+	b := d.b[d.pos : d.pos+n]
+	d.pos += n
+
+	return b, nil
+}
@@ -0,0 +1,139 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvroSchemaCompiler(t *testing.T) {
+	schema := `{
+  "type": "record",
+  "name": "User",
+  "namespace": "com.example",
+  "fields": [
+    {"name": "id", "type": "long"},
+    {"name": "name", "type": "string"},
+    {"name": "email", "type": ["null", "string"]},
+    {"name": "role", "type": {"type": "enum", "name": "Role", "symbols": ["ADMIN", "USER"]}},
+    {"name": "tags", "type": {"type": "array", "items": "string"}},
+    {"name": "attributes", "type": {"type": "map", "values": "int"}},
+    {"name": "hash", "type": {"type": "fixed", "name": "Hash", "size": 2}},
+    {"name": "createdAt", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "manager", "type": ["null", "User"]}
+  ]
+}`
+
+	validate, err := AvroSchemaCompiler([]byte(schema))
+	require.NoError(t, err)
+
+	// id 1, name "ab", null email, role USER, tags ["x"], attributes {"k": 1}, hash, createdAt 2, no manager.
+	user := []byte{0x02, 0x04, 'a', 'b', 0x00, 0x02, 0x02, 0x02, 'x', 0x00, 0x02, 0x02, 'k', 0x02, 0x00, 0xff, 0xff, 0x04, 0x00}
+
+	tests := []struct {
+		name           string
+		payload        []byte
+		expectedErrors []string
+	}{
+		{
+			name:    "Valid record",
+			payload: user,
+		},
+		{
+			name:    "Valid record in Confluent wire format",
+			payload: append([]byte{0x00, 0x00, 0x00, 0x00, 0x2a}, user...),
+		},
+		{
+			name:    "Valid recursive record",
+			payload: append(append(user[:len(user)-1:len(user)-1], 0x02), user...),
+		},
+		{
+			name:    "Array in blocks with size",
+			payload: append(append(user[:6:6], 0x01, 0x04, 0x02, 'x', 0x00), user[10:]...),
+		},
+		{
+			name:           "Union branch out of range",
+			payload:        append(append(user[:4:4], 0x04), user[5:]...),
+			expectedErrors: []string{"error decoding field email of record com.example.User: union branch 2 out of range"},
+		},
+		{
+			name:           "Enum symbol out of range",
+			payload:        append(append(user[:5:5], 0x04), user[6:]...),
+			expectedErrors: []string{"error decoding field role of record com.example.User: symbol 2 of enum com.example.Role out of range"},
+		},
+		{
+			name:           "Invalid UTF-8 string",
+			payload:        append(append(user[:2:2], 0x04, 0xff, 0xfe), user[4:]...),
+			expectedErrors: []string{"error decoding field name of record com.example.User: string is not valid UTF-8"},
+		},
+		{
+			name:           "Truncated",
+			payload:        user[:len(user)-3],
+			expectedErrors: []string{"error decoding field hash of record com.example.User: unexpected end of Avro data"},
+		},
+		{
+			name:           "Trailing bytes",
+			payload:        append(user[:len(user):len(user)], 0x00),
+			expectedErrors: []string{"1 unexpected bytes after Avro value"},
+		},
+		{
+			name:           "Not Avro",
+			payload:        []byte(`{"id": 1}`),
+			expectedErrors: []string{"error decoding field name of record com.example.User: unexpected end of Avro data"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs, err := validate(test.payload)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedErrors, errs)
+		})
+	}
+}
+
+func TestAvroSchemaCompiler_primitives(t *testing.T) {
+	tests := []struct {
+		schema  string
+		payload []byte
+		valid   bool
+	}{
+		{schema: `"null"`, payload: []byte{}, valid: true},
+		{schema: `"boolean"`, payload: []byte{0x01}, valid: true},
+		{schema: `"boolean"`, payload: []byte{0x02}},
+		{schema: `"int"`, payload: []byte{0xfe, 0xff, 0xff, 0xff, 0x0f}, valid: true},
+		{schema: `"int"`, payload: []byte{0x80, 0x80, 0x80, 0x80, 0x10}},
+		{schema: `"long"`, payload: []byte{0x80, 0x80, 0x80, 0x80, 0x10}, valid: true},
+		{schema: `"long"`, payload: []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80}},
+		{schema: `"float"`, payload: []byte{0, 0, 0x80, 0x3f}, valid: true},
+		{schema: `"double"`, payload: []byte{0, 0, 0x80, 0x3f}},
+		{schema: `"bytes"`, payload: []byte{0x04, 0xff, 0xfe}, valid: true},
+		{schema: `"bytes"`, payload: []byte{0x01}},
+		{schema: `{"type": "string"}`, payload: []byte{0x02, 'a'}, valid: true},
+	}
+	for _, test := range tests {
+		validate, err := AvroSchemaCompiler([]byte(test.schema))
+		require.NoError(t, err)
+
+		errs, err := validate(test.payload)
+		assert.NoError(t, err)
+		assert.Equal(t, test.valid, errs == nil, "schema %s and payload %v", test.schema, test.payload)
+	}
+}
+
+func TestAvroSchemaCompiler_invalidSchema(t *testing.T) {
+	tests := map[string]string{
+		`not json`:                                       "error decoding Avro schema: invalid character 'o' in literal null (expecting 'u')",
+		`"uuid"`:                                         "invalid Avro schema: unknown type uuid",
+		`{"type": "record", "fields": []}`:               "invalid Avro schema: record should have a name",
+		`{"type": "fixed", "name": "Hash"}`:              "invalid Avro schema: fixed Hash should have a size",
+		`{"type": "array", "items": "unknown"}`:          "invalid Avro schema: invalid items of array: unknown type unknown",
+		`{"type": "record", "name": "R", "fields": [1]}`: "invalid Avro schema: invalid field 1 of record R",
+		`{"type": "record", "name": "R", "fields": [{"name": "f", "type": "Other"}]}`: "invalid Avro schema: invalid field f of record R: unknown type Other",
+		`1`: "invalid Avro schema: unexpected schema 1",
+	}
+	for schema, expectedErr := range tests {
+		_, err := AvroSchemaCompiler([]byte(schema))
+		assert.EqualError(t, err, expectedErr, schema)
+	}
+}
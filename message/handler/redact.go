@@ -0,0 +1,18 @@
+package handler
+
+import (
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+)
+
+// RedactMessages redacts the sensitive values of the messages produced by the given handler, so they can leave the gateway.
+func RedactMessages(h watermillmessage.HandlerFunc, redactor *message.Redactor) watermillmessage.HandlerFunc {
+	return func(msg *watermillmessage.Message) ([]*watermillmessage.Message, error) {
+		msgs, err := h(msg)
+		for i, m := range msgs {
+			msgs[i] = redactor.Redact(m)
+		}
+
+		return msgs, err
+	}
+}
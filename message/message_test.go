@@ -3,6 +3,7 @@ package message
 import (
 	"testing"
 
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,3 +15,14 @@ func TestNew(t *testing.T) {
 	assert.Equal(t, payload, []byte(msg.Payload))
 	assert.Equal(t, channel, msg.Metadata.Get(MetadataChannel))
 }
+
+func TestRemoveInternalMetadata(t *testing.T) {
+	metadata := watermillmessage.Metadata{
+		MetadataChannel:         "hacked",
+		"_asyncapi_eg_redacted": "true",
+		"traceparent":           "00-abc-01",
+	}
+
+	RemoveInternalMetadata(metadata)
+	assert.Equal(t, watermillmessage.Metadata{"traceparent": "00-abc-01"}, metadata)
+}
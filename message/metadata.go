@@ -2,12 +2,16 @@ package message
 
 import (
 	"encoding/json"
+	"strings"
 
 	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
 )
 
+// MetadataPrefix is the prefix of the keys of the metadata set by the gateway.
+const MetadataPrefix = "_asyncapi_eg_"
+
 // The following constants are the keys on a watermill.Message Metadata where we store valuable and needed domain metadata.
-// All contain the prefix `_asyncapi_eg_` so they can be unique-ish and human-readable.
+// All contain the prefix `_asyncapi_eg_` (see MetadataPrefix) so they can be unique-ish and human-readable.
 // As a note: The term `eg` is a short version of Event-Gateway.
 const (
 	// MetadataChannel is the key used for storing the Channel in the message Metadata.
@@ -15,8 +19,49 @@ const (
 
 	// MetadataValidationError is the key used for storing the Validation Error if applies.
 	MetadataValidationError = "_asyncapi_eg_validation_error"
+
+	// MetadataKey is the key used for storing the message key (e.g. Kafka record key) if any. Unset for null keys.
+	MetadataKey = "_asyncapi_eg_key"
+
+	// MetadataTimestamp is the key used for storing the time the message was created by the producer (RFC 3339 format), if known.
+	MetadataTimestamp = "_asyncapi_eg_timestamp"
 )
 
+// Metadata keys of messages produced through the Kafka proxy, describing the producer and the Produce request.
+const (
+	// MetadataKafkaTransactionalID is the key used for storing the transactional ID of transactional producers.
+	MetadataKafkaTransactionalID = "_asyncapi_eg_kafka_transactional_id"
+
+	// MetadataKafkaAcks is the key used for storing the acks required by the producer: 0, 1 or -1 (all).
+	MetadataKafkaAcks = "_asyncapi_eg_kafka_acks"
+
+	// MetadataKafkaProducerID is the key used for storing the producer ID of idempotent and transactional producers.
+	MetadataKafkaProducerID = "_asyncapi_eg_kafka_producer_id"
+
+	// MetadataKafkaProducerEpoch is the key used for storing the producer epoch of idempotent and transactional producers.
+	MetadataKafkaProducerEpoch = "_asyncapi_eg_kafka_producer_epoch"
+
+	// MetadataKafkaBaseSequence is the key used for storing the sequence number of the first record of the record batch
+	// the message belongs to. Only set for idempotent and transactional producers.
+	MetadataKafkaBaseSequence = "_asyncapi_eg_kafka_base_sequence"
+)
+
+// IsInternalMetadata returns whether the given metadata key is reserved for the metadata set by the gateway.
+func IsInternalMetadata(key string) bool {
+	return strings.HasPrefix(key, MetadataPrefix)
+}
+
+// RemoveInternalMetadata removes the keys reserved for the metadata set by the gateway from the given metadata.
+// Proxies store the headers sent by clients as metadata, so they should remove those keys before setting their own.
+// Otherwise, clients could pass their headers off as metadata set by the gateway.
+func RemoveInternalMetadata(metadata watermillmessage.Metadata) {
+	for k := range metadata {
+		if IsInternalMetadata(k) {
+			delete(metadata, k)
+		}
+	}
+}
+
 // UnmarshalMetadata extracts a value from the Message Metadata and unmarshals it to the given object.
 func UnmarshalMetadata(msg *watermillmessage.Message, key string, unmarshalTo interface{}) error {
 	raw := msg.Metadata.Get(key)
@@ -0,0 +1,235 @@
+package message
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+)
+
+// RedactionMode is the way sensitive values are redacted.
+type RedactionMode string
+
+// Redaction modes.
+const (
+	// RedactionModeMask replaces sensitive values by a fixed placeholder.
+	RedactionModeMask RedactionMode = "mask"
+	// RedactionModeHash replaces sensitive values by the SHA-256 hash of their JSON representation, so they can still be correlated.
+	RedactionModeHash RedactionMode = "hash"
+	// RedactionModeDrop drops the whole payload.
+	RedactionModeDrop RedactionMode = "drop"
+)
+
+// Redacted is the placeholder sensitive values are replaced by in RedactionModeMask mode.
+const Redacted = "<redacted>"
+
+// pointerWildcard matches any array item or object property in a JSON pointer. It matches any header as well.
+const pointerWildcard = "*"
+
+// Redactor redacts the sensitive values of messages before they leave the gateway.
+// Sensitive values of payloads are located by JSON pointers (RFC 6901). Token `*` matches any array item or object property.
+// Keys and headers are only redacted if configured. See WithKeyRedaction and WithHeaderRedaction.
+type Redactor struct {
+	mode RedactionMode
+	// pointers holds the pointers applying to all channels.
+	pointers [][]string
+	// channelPointers holds the pointers applying to each channel.
+	channelPointers map[string][][]string
+	keys            bool
+	headers         map[string]struct{}
+}
+
+// RedactorOpt is a functional option used for configuring a Redactor.
+type RedactorOpt func(*Redactor)
+
+// WithKeyRedaction makes the Redactor redact message keys (see MetadataKey).
+func WithKeyRedaction() RedactorOpt {
+	return func(r *Redactor) {
+		r.keys = true
+	}
+}
+
+// WithHeaderRedaction makes the Redactor redact the given headers, e.g. Kafka record headers. `*` redacts all of them.
+// Metadata set by the gateway (e.g. MetadataChannel) is not considered a header. See IsInternalMetadata.
+func WithHeaderRedaction(headers ...string) RedactorOpt {
+	return func(r *Redactor) {
+		for _, h := range headers {
+			r.headers[h] = struct{}{}
+		}
+	}
+}
+
+// NewRedactor creates a Redactor. Pointers apply to all channels, while channelPointers only apply to the channel they are indexed by.
+func NewRedactor(mode RedactionMode, channelPointers map[string][]string, pointers []string, opts ...RedactorOpt) (*Redactor, error) {
+	switch mode {
+	case RedactionModeMask, RedactionModeHash, RedactionModeDrop:
+	case "":
+		mode = RedactionModeMask
+	default:
+		return nil, fmt.Errorf("unknown redaction mode %q. Valid values are %s, %s and %s", mode, RedactionModeMask, RedactionModeHash, RedactionModeDrop)
+	}
+
+	r := &Redactor{mode: mode, channelPointers: make(map[string][][]string, len(channelPointers)), headers: make(map[string]struct{})}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	for _, p := range pointers {
+		tokens, err := parsePointer(p)
+		if err != nil {
+			return nil, err
+		}
+		r.pointers = append(r.pointers, tokens)
+	}
+
+	for channel, ps := range channelPointers {
+		for _, p := range ps {
+			tokens, err := parsePointer(p)
+			if err != nil {
+				return nil, err
+			}
+			r.channelPointers[channel] = append(r.channelPointers[channel], tokens)
+		}
+	}
+
+	return r, nil
+}
+
+// Redact returns a copy of the given message whose payload, key and headers have been redacted.
+// Payloads are dropped if they are not JSON, as their sensitive values can't be located.
+// Messages should be redacted once, as hashed values would be hashed again otherwise.
+func (r *Redactor) Redact(msg *watermillmessage.Message) *watermillmessage.Message {
+	redacted := msg.Copy()
+	r.redactMetadata(redacted.Metadata)
+
+	if r.mode == RedactionModeDrop {
+		redacted.Payload = nil
+		return redacted
+	}
+
+	pointers := append(r.pointers[:len(r.pointers):len(r.pointers)], r.channelPointers[msg.Metadata.Get(MetadataChannel)]...)
+	if len(pointers) == 0 || len(msg.Payload) == 0 {
+		return redacted
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		redacted.Payload = nil
+		return redacted
+	}
+
+	for _, p := range pointers {
+		payload = r.redact(payload, p)
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		redacted.Payload = nil
+		return redacted
+	}
+
+	redacted.Payload = raw
+
+	return redacted
+}
+
+// redactMetadata redacts the key and headers held by the given metadata. In RedactionModeDrop mode, they are removed.
+func (r *Redactor) redactMetadata(metadata watermillmessage.Metadata) {
+	for k, v := range metadata {
+		if !r.isSensitiveMetadata(k) {
+			continue
+		}
+
+		if r.mode == RedactionModeDrop {
+			delete(metadata, k)
+			continue
+		}
+
+		metadata[k] = r.redactString(v)
+	}
+}
+
+func (r *Redactor) isSensitiveMetadata(key string) bool {
+	if key == MetadataKey {
+		return r.keys
+	}
+
+	// Clients can't set metadata with such keys, as proxies remove them from their headers. See RemoveInternalMetadata.
+	if IsInternalMetadata(key) {
+		return false
+	}
+
+	_, all := r.headers[pointerWildcard]
+	_, ok := r.headers[key]
+
+	return all || ok
+}
+
+// redactString redacts the given key or header value. Values are hashed as they are, since they are not JSON.
+func (r *Redactor) redactString(v string) string {
+	if r.mode != RedactionModeHash {
+		return Redacted
+	}
+
+	sum := sha256.Sum256([]byte(v))
+
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// redact redacts the values located by the given pointer tokens in v, returning the result.
+func (r *Redactor) redact(v interface{}, tokens []string) interface{} {
+	if len(tokens) == 0 {
+		return r.redactValue(v)
+	}
+
+	token, rest := tokens[0], tokens[1:]
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, child := range value {
+			if token == pointerWildcard || token == k {
+				value[k] = r.redact(child, rest)
+			}
+		}
+	case []interface{}:
+		for i, child := range value {
+			if token == pointerWildcard || token == strconv.Itoa(i) {
+				value[i] = r.redact(child, rest)
+			}
+		}
+	}
+
+	return v
+}
+
+func (r *Redactor) redactValue(v interface{}) interface{} {
+	if r.mode != RedactionModeHash {
+		return Redacted
+	}
+
+	raw, _ := json.Marshal(v)
+	sum := sha256.Sum256(raw)
+
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// parsePointer parses a JSON pointer into its unescaped tokens. See https://datatracker.ietf.org/doc/html/rfc6901.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q. It should start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+
+	return tokens, nil
+}
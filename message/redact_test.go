@@ -0,0 +1,162 @@
+package message
+
+import (
+	"testing"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor_Redact(t *testing.T) {
+	channelPointers := map[string][]string{"signups": {"/email", "/cards/*/number"}}
+	tests := []struct {
+		name            string
+		mode            RedactionMode
+		pointers        []string
+		channel         string
+		metadata        map[string]string
+		payload         string
+		expectedPayload string
+	}{
+		{
+			name:            "Channel pointers are masked",
+			channel:         "signups",
+			payload:         `{"email":"foo@bar.com","name":"foo","cards":[{"number":"1234"},{"number":"5678"}]}`,
+			expectedPayload: `{"email":"<redacted>","name":"foo","cards":[{"number":"<redacted>"},{"number":"<redacted>"}]}`,
+		},
+		{
+			name:            "Channel pointers don't apply to other channels",
+			channel:         "events",
+			payload:         `{"email":"foo@bar.com"}`,
+			expectedPayload: `{"email":"foo@bar.com"}`,
+		},
+		{
+			name:            "Pointers apply to all channels",
+			pointers:        []string{"/a~1b/0", "/user/*"},
+			channel:         "events",
+			payload:         `{"a/b":["x","y"],"user":{"name":"foo","phone":"123"},"id":1}`,
+			expectedPayload: `{"a/b":["<redacted>","y"],"user":{"name":"<redacted>","phone":"<redacted>"},"id":1}`,
+		},
+		{
+			name:            "Values are hashed",
+			mode:            RedactionModeHash,
+			channel:         "signups",
+			payload:         `{"email":"foo@bar.com"}`,
+			expectedPayload: `{"email":"sha256:46add8364baeb596336b4251bf1462f2056ff8350bf81e31bd23131dab674bb2"}`,
+		},
+		{
+			name:            "Payloads are dropped",
+			mode:            RedactionModeDrop,
+			channel:         "events",
+			payload:         `{"id":1}`,
+			expectedPayload: ``,
+		},
+		{
+			name:            "Non JSON payloads are dropped",
+			channel:         "signups",
+			payload:         `email=foo@bar.com`,
+			expectedPayload: ``,
+		},
+		{
+			name:            "Metadata can't skip redaction",
+			channel:         "signups",
+			metadata:        map[string]string{"_asyncapi_eg_redacted": "true"},
+			payload:         `{"email":"foo@bar.com"}`,
+			expectedPayload: `{"email":"<redacted>"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := NewRedactor(test.mode, channelPointers, test.pointers)
+			require.NoError(t, err)
+
+			msg := watermillmessage.NewMessage("test", []byte(test.payload))
+			msg.Metadata.Set(MetadataChannel, test.channel)
+			for k, v := range test.metadata {
+				msg.Metadata.Set(k, v)
+			}
+
+			redacted := r.Redact(msg)
+			assert.Equal(t, test.payload, string(msg.Payload), "Original message should be kept untouched")
+			if test.expectedPayload == "" {
+				assert.Empty(t, redacted.Payload)
+			} else {
+				assert.JSONEq(t, test.expectedPayload, string(redacted.Payload))
+			}
+		})
+	}
+}
+
+func TestRedactor_Redact_keysAndHeaders(t *testing.T) {
+	tests := []struct {
+		name             string
+		mode             RedactionMode
+		opts             []RedactorOpt
+		expectedMetadata map[string]string
+	}{
+		{
+			name: "Keys and headers are kept by default",
+			expectedMetadata: map[string]string{
+				MetadataKey:   "user-1",
+				"traceparent": "00-abc-01",
+				"email":       "foo@bar.com",
+			},
+		},
+		{
+			name: "Key and configured headers are masked",
+			opts: []RedactorOpt{WithKeyRedaction(), WithHeaderRedaction("email")},
+			expectedMetadata: map[string]string{
+				MetadataKey:   Redacted,
+				"traceparent": "00-abc-01",
+				"email":       Redacted,
+			},
+		},
+		{
+			name: "All headers are hashed",
+			mode: RedactionModeHash,
+			opts: []RedactorOpt{WithHeaderRedaction("*")},
+			expectedMetadata: map[string]string{
+				MetadataKey:   "user-1",
+				"traceparent": "sha256:586a1a7cb7e953c0987f90c3022ea9a73ac5909b4ecbc725364abe39d281f47c",
+				"email":       "sha256:0c7e6a405862e402eb76a70f8a26fc732d07c32931e9fae9ab1582911d2e8a3b",
+			},
+		},
+		{
+			name:             "Key and headers are dropped",
+			mode:             RedactionModeDrop,
+			opts:             []RedactorOpt{WithKeyRedaction(), WithHeaderRedaction("*")},
+			expectedMetadata: map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := NewRedactor(test.mode, nil, nil, test.opts...)
+			require.NoError(t, err)
+
+			msg := watermillmessage.NewMessage("test", []byte(`{}`))
+			msg.Metadata.Set(MetadataChannel, "signups")
+			msg.Metadata.Set(MetadataKey, "user-1")
+			msg.Metadata.Set("traceparent", "00-abc-01")
+			msg.Metadata.Set("email", "foo@bar.com")
+
+			redacted := r.Redact(msg)
+			assert.Equal(t, "user-1", msg.Metadata.Get(MetadataKey), "Original message should be kept untouched")
+
+			// Metadata set by the gateway is never redacted.
+			expected := map[string]string{MetadataChannel: "signups"}
+			for k, v := range test.expectedMetadata {
+				expected[k] = v
+			}
+			assert.Equal(t, watermillmessage.Metadata(expected), redacted.Metadata)
+		})
+	}
+}
+
+func TestNewRedactor(t *testing.T) {
+	_, err := NewRedactor("encrypt", nil, nil)
+	assert.EqualError(t, err, `unknown redaction mode "encrypt". Valid values are mask, hash and drop`)
+
+	_, err = NewRedactor(RedactionModeMask, nil, []string{"email"})
+	assert.EqualError(t, err, `invalid JSON pointer "email". It should start with /`)
+}
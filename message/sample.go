@@ -0,0 +1,165 @@
+package message
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// SamplingStats holds the count of messages of a channel that were sampled for validation and the ones that were skipped.
+type SamplingStats struct {
+	Sampled uint64 `json:"sampled"`
+	Skipped uint64 `json:"skipped"`
+}
+
+// Sampler decides which messages are validated, based on the sampling rate of their channel.
+// A rate is the fraction of messages to be validated, from 0 (none) to 1 (all).
+type Sampler struct {
+	defaultRate float64
+	rates       map[string]float64
+	// byKey makes the decision deterministic by message key, so messages of the same entity are consistently validated or skipped.
+	byKey  bool
+	random func() float64
+
+	lock  sync.RWMutex
+	stats map[string]*SamplingStats
+}
+
+// SamplerOpt is a functional option used for configuring a Sampler.
+type SamplerOpt func(*Sampler)
+
+// WithChannelSampleRates configures the sampling rate of the given channels, overriding the default one.
+func WithChannelSampleRates(rates map[string]float64) SamplerOpt {
+	return func(s *Sampler) {
+		for channel, rate := range rates {
+			s.rates[channel] = rate
+		}
+	}
+}
+
+// WithSamplingByKey makes sampling deterministic by message key (see MetadataKey).
+// Messages with the same key are either all validated or all skipped. Messages without key are sampled randomly.
+func WithSamplingByKey(enabled bool) SamplerOpt {
+	return func(s *Sampler) {
+		s.byKey = enabled
+	}
+}
+
+// NewSampler creates a Sampler sampling messages at the given default rate.
+func NewSampler(defaultRate float64, opts ...SamplerOpt) (*Sampler, error) {
+	s := &Sampler{
+		defaultRate: defaultRate,
+		rates:       make(map[string]float64),
+		random:      rand.Float64, //nolint:gosec
+		stats:       make(map[string]*SamplingStats),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := validateSampleRate(s.defaultRate); err != nil {
+		return nil, err
+	}
+
+	for channel, rate := range s.rates {
+		if err := validateSampleRate(rate); err != nil {
+			return nil, errors.Wrapf(err, "invalid sampling rate of channel %s", channel)
+		}
+	}
+
+	return s, nil
+}
+
+func validateSampleRate(rate float64) error {
+	if rate < 0 || rate > 1 || math.IsNaN(rate) {
+		return fmt.Errorf("sampling rate %v should be between 0 and 1", rate)
+	}
+
+	return nil
+}
+
+// Sample tells if the given message should be validated, counting the decision into the stats of its channel.
+func (s *Sampler) Sample(msg *watermillmessage.Message) bool {
+	return s.SampleRecord(msg.Metadata.Get(MetadataChannel), msg.Metadata.Get(MetadataKey))
+}
+
+// SampleRecord tells if a message of the given channel and key should be validated, counting the decision into the stats
+// of the channel. It allows deciding before the message is even created. An empty key means no key.
+func (s *Sampler) SampleRecord(channel, key string) bool {
+	rate, ok := s.rates[channel]
+	if !ok {
+		rate = s.defaultRate
+	}
+
+	var sampled bool
+	switch rate {
+	case 0:
+	case 1:
+		sampled = true
+	default:
+		sampled = s.point(key) < rate
+	}
+
+	stats := s.channelStats(channel)
+	if sampled {
+		atomic.AddUint64(&stats.Sampled, 1)
+	} else {
+		atomic.AddUint64(&stats.Skipped, 1)
+	}
+
+	return sampled
+}
+
+// point returns a number in [0, 1) the rate is compared to. It is derived from the message key when sampling by key.
+func (s *Sampler) point(key string) float64 {
+	if !s.byKey || key == "" {
+		return s.random()
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+
+	return float64(h.Sum64()&(1<<53-1)) / (1 << 53)
+}
+
+func (s *Sampler) channelStats(channel string) *SamplingStats {
+	s.lock.RLock()
+	stats, ok := s.stats[channel]
+	s.lock.RUnlock()
+	if ok {
+		return stats
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if stats, ok = s.stats[channel]; !ok {
+		stats = new(SamplingStats)
+		s.stats[channel] = stats
+	}
+
+	return stats
+}
+
+// Stats returns the sampling stats of each channel, indexed by channel.
+func (s *Sampler) Stats() map[string]SamplingStats {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	stats := make(map[string]SamplingStats, len(s.stats))
+	for channel, st := range s.stats {
+		stats[channel] = SamplingStats{
+			Sampled: atomic.LoadUint64(&st.Sampled),
+			Skipped: atomic.LoadUint64(&st.Skipped),
+		}
+	}
+
+	return stats
+}
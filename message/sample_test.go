@@ -0,0 +1,116 @@
+package message
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampler_Sample(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultRate   float64
+		opts          []SamplerOpt
+		channel       string
+		key           string
+		random        float64
+		expectSampled bool
+	}{
+		{
+			name:          "All messages are sampled by default",
+			defaultRate:   1,
+			channel:       "events",
+			random:        0.99,
+			expectSampled: true,
+		},
+		{
+			name:          "No message is sampled",
+			defaultRate:   0,
+			channel:       "events",
+			expectSampled: false,
+		},
+		{
+			name:          "Sampled randomly",
+			defaultRate:   0.5,
+			channel:       "events",
+			random:        0.4,
+			expectSampled: true,
+		},
+		{
+			name:          "Skipped randomly",
+			defaultRate:   0.5,
+			channel:       "events",
+			random:        0.6,
+			expectSampled: false,
+		},
+		{
+			name:          "Channel rate overrides the default one",
+			defaultRate:   1,
+			opts:          []SamplerOpt{WithChannelSampleRates(map[string]float64{"events": 0})},
+			channel:       "events",
+			expectSampled: false,
+		},
+		{
+			name:          "Messages without key are sampled randomly when sampling by key",
+			defaultRate:   0.5,
+			opts:          []SamplerOpt{WithSamplingByKey(true)},
+			channel:       "events",
+			random:        0.4,
+			expectSampled: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := NewSampler(test.defaultRate, test.opts...)
+			require.NoError(t, err)
+			s.random = func() float64 { return test.random }
+
+			msg := New([]byte(`{}`), test.channel)
+			if test.key != "" {
+				msg.Metadata.Set(MetadataKey, test.key)
+			}
+
+			assert.Equal(t, test.expectSampled, s.Sample(msg))
+
+			expectedStats := SamplingStats{Skipped: 1}
+			if test.expectSampled {
+				expectedStats = SamplingStats{Sampled: 1}
+			}
+			assert.Equal(t, map[string]SamplingStats{test.channel: expectedStats}, s.Stats())
+		})
+	}
+}
+
+func TestSampler_SampleByKey(t *testing.T) {
+	s, err := NewSampler(0.5, WithSamplingByKey(true))
+	require.NoError(t, err)
+	s.random = func() float64 {
+		require.Fail(t, "messages with key should not be sampled randomly")
+		return 0
+	}
+
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		msg := New([]byte(`{}`), "events")
+		msg.Metadata.Set(MetadataKey, key)
+
+		sampled := s.Sample(msg)
+		for j := 0; j < 3; j++ {
+			assert.Equal(t, sampled, s.Sample(msg), "messages with key %s should be consistently sampled", key)
+		}
+	}
+
+	stats := s.Stats()["events"]
+	assert.EqualValues(t, 400, stats.Sampled+stats.Skipped)
+	assert.InDelta(t, 200, stats.Sampled, 60, "about half of the keys should be sampled")
+}
+
+func TestNewSampler(t *testing.T) {
+	_, err := NewSampler(1.5)
+	assert.EqualError(t, err, "sampling rate 1.5 should be between 0 and 1")
+
+	_, err = NewSampler(1, WithChannelSampleRates(map[string]float64{"events": -1}))
+	assert.EqualError(t, err, "invalid sampling rate of channel events: sampling rate -1 should be between 0 and 1")
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
 	"github.com/pkg/errors"
@@ -19,10 +20,19 @@ type Validator func(*watermillmessage.Message) (*ValidationError, error)
 type ValidationError struct {
 	Timestamp time.Time `json:"ts"`
 	Errors    []string  `json:"errors"`
+	// KeyErrors holds the errors of the message key (see MetadataKey), reported separately from the payload ones.
+	KeyErrors []string `json:"keyErrors,omitempty"`
+	// Documents holds the name of the AsyncAPI docs declaring the validated channel, if known.
+	Documents []string `json:"documents,omitempty"`
 }
 
 func (v ValidationError) Error() string {
-	return strings.Join(v.Errors, " | ")
+	errs := v.Errors
+	for _, e := range v.KeyErrors {
+		errs = append(errs[:len(errs):len(errs)], "key: "+e)
+	}
+
+	return strings.Join(errs, " | ")
 }
 
 // NewValidationError creates a new ValidationError.
@@ -48,30 +58,233 @@ func ValidationErrorToMessage(msg *watermillmessage.Message, validationErr *Vali
 	return nil
 }
 
+// SchemaValidator validates a payload against a compiled schema, returning the validation errors if the payload is invalid.
+// The returned error is an error during validating process, such as a payload that is not JSON.
+type SchemaValidator func(payload []byte) ([]string, error)
+
+// SchemaCompiler compiles a JSON Schema into a SchemaValidator. Schemas are compiled once when creating message validators,
+// so compiling can be expensive but validating should be cheap.
+// It is the extension point for plugging other JSON Schema implementations in. See GoJSONSchemaCompiler.
+type SchemaCompiler func(schema []byte) (SchemaValidator, error)
+
+// GoJSONSchemaCompiler is the default SchemaCompiler, based on github.com/xeipuuv/gojsonschema.
+func GoJSONSchemaCompiler(schema []byte) (SchemaValidator, error) {
+	return compileJSONSchema(gojsonschema.NewBytesLoader(schema))
+}
+
+func compileJSONSchema(loader gojsonschema.JSONLoader) (SchemaValidator, error) {
+	compiled, err := gojsonschema.NewSchema(loader)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(payload []byte) ([]string, error) {
+		result, err := compiled.Validate(gojsonschema.NewBytesLoader(payload))
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Valid() {
+			return nil, nil
+		}
+
+		errs := make([]string, len(result.Errors()))
+		for i, e := range result.Errors() {
+			errs[i] = e.String()
+		}
+
+		return errs, nil
+	}, nil
+}
+
+// SchemaMessageValidator validates a message payload based on a map of JSON Schema, where the key can be any identifier (depends on who implements it).
+// For example, the identifier can be its channel name, message ID, etc. Schemas are compiled once by the given compiler.
+func SchemaMessageValidator(messageSchemas map[string][]byte, idProvider func(msg *watermillmessage.Message) string, compiler SchemaCompiler) (Validator, error) {
+	validators := make(map[string]SchemaValidator, len(messageSchemas))
+	for id, schema := range messageSchemas {
+		v, err := compiler(schema)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error compiling JSON Schema for message %s", id)
+		}
+
+		validators[id] = v
+	}
+
+	return compiledSchemaMessageValidator(validators, idProvider), nil
+}
+
 // JSONSchemaMessageValidator validates a message payload based on a map of Json Schema, where the key can be any identifier  (depends on who implements it).
-// For example, the identifier can be its channel name, message ID, etc.
+// For example, the identifier can be its channel name, message ID, etc. Schemas are compiled once by gojsonschema.
 func JSONSchemaMessageValidator(messageSchemas map[string]gojsonschema.JSONLoader, idProvider func(msg *watermillmessage.Message) string) (Validator, error) {
+	validators := make(map[string]SchemaValidator, len(messageSchemas))
+	for id, loader := range messageSchemas {
+		v, err := compileJSONSchema(loader)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error compiling JSON Schema for message %s", id)
+		}
+
+		validators[id] = v
+	}
+
+	return compiledSchemaMessageValidator(validators, idProvider), nil
+}
+
+func compiledSchemaMessageValidator(validators map[string]SchemaValidator, idProvider func(msg *watermillmessage.Message) string) Validator {
 	return func(msg *watermillmessage.Message) (*ValidationError, error) {
 		msgID := idProvider(msg)
-		msgSchema, ok := messageSchemas[msgID]
+		validate, ok := validators[msgID]
 		if !ok {
 			return nil, nil
 		}
 
-		result, err := gojsonschema.Validate(msgSchema, gojsonschema.NewBytesLoader(msg.Payload))
+		errs, err := validate(msg.Payload)
 		if err != nil {
 			return nil, errors.Wrap(err, fmt.Sprintf("error validating JSON Schema for message %s", msgID))
 		}
 
-		if !result.Valid() {
-			errs := make([]string, len(result.Errors()))
-			for i := 0; i < len(result.Errors()); i++ {
-				errs[i] = result.Errors()[i].String()
+		if len(errs) > 0 {
+			return NewValidationError(time.Now(), errs...), nil
+		}
+
+		return nil, nil
+	}
+}
+
+// KeyEncoding is how message keys are encoded.
+type KeyEncoding string
+
+// Key encodings.
+const (
+	// KeyEncodingString means keys are plain UTF-8 strings. Keys are validated as JSON strings, so schemas can restrict
+	// their format, pattern, length, etc.
+	KeyEncodingString KeyEncoding = "string"
+	// KeyEncodingJSON means keys are JSON values.
+	KeyEncodingJSON KeyEncoding = "json"
+	// KeyEncodingAvro means keys are Avro binary encoded, optionally in the Confluent wire format. See AvroSchemaCompiler.
+	KeyEncodingAvro KeyEncoding = "avro"
+)
+
+// Validate validates KeyEncoding.
+func (e KeyEncoding) Validate() error {
+	switch e {
+	case KeyEncodingString, KeyEncodingJSON, KeyEncodingAvro:
+		return nil
+	default:
+		return fmt.Errorf("key encoding %q is not valid. Valid values are %s, %s and %s", e, KeyEncodingString, KeyEncodingJSON, KeyEncodingAvro)
+	}
+}
+
+// KeySchema describes the keys of a set of messages.
+type KeySchema struct {
+	// Schema is the JSON Schema of the keys, or their Avro schema if the encoding is avro. Nil means any key is valid.
+	Schema []byte
+	// Encoding is mandatory if Schema is set.
+	Encoding KeyEncoding
+	// Required means messages should have a non-null key.
+	Required bool
+}
+
+// KeyMessageValidator validates message keys (see MetadataKey) based on a map of KeySchema, where the key can be any
+// identifier (depends on who implements it). Key errors are reported in ValidationError.KeyErrors.
+// JSON Schemas are compiled once by the given compiler. Avro schemas are compiled by AvroSchemaCompiler.
+func KeyMessageValidator(keySchemas map[string]KeySchema, idProvider func(msg *watermillmessage.Message) string, compiler SchemaCompiler) (Validator, error) {
+	type keyValidator struct {
+		KeySchema
+		validate SchemaValidator
+	}
+
+	validators := make(map[string]keyValidator, len(keySchemas))
+	for id, k := range keySchemas {
+		v := keyValidator{KeySchema: k}
+		if k.Schema != nil {
+			if err := k.Encoding.Validate(); err != nil {
+				return nil, errors.Wrapf(err, "invalid key of message %s", id)
+			}
+
+			keyCompiler := compiler
+			if k.Encoding == KeyEncodingAvro {
+				keyCompiler = AvroSchemaCompiler
+			}
+
+			var err error
+			if v.validate, err = keyCompiler(k.Schema); err != nil {
+				return nil, errors.Wrapf(err, "error compiling key schema for message %s", id)
+			}
+		}
+
+		validators[id] = v
+	}
+
+	return func(msg *watermillmessage.Message) (*ValidationError, error) {
+		v, ok := validators[idProvider(msg)]
+		if !ok {
+			return nil, nil
+		}
+
+		key, ok := msg.Metadata[MetadataKey]
+		if !ok {
+			if v.Required {
+				return &ValidationError{Timestamp: time.Now(), KeyErrors: []string{"key is required"}}, nil
 			}
 
-			return NewValidationError(time.Now(), errs...), nil
+			return nil, nil
+		}
+
+		if v.validate == nil {
+			return nil, nil
+		}
+
+		if errs := validateKey(v.validate, v.Encoding, key); len(errs) > 0 {
+			return &ValidationError{Timestamp: time.Now(), KeyErrors: errs}, nil
 		}
 
 		return nil, nil
 	}, nil
 }
+
+// validateKey validates the given key, returning its errors. Keys that can't be decoded are invalid as well.
+func validateKey(validate SchemaValidator, encoding KeyEncoding, key string) []string {
+	raw := []byte(key)
+	if encoding == KeyEncodingString {
+		if !utf8.ValidString(key) {
+			return []string{"key is not a valid UTF-8 string"}
+		}
+
+		raw, _ = json.Marshal(key)
+	}
+
+	errs, err := validate(raw)
+	if err != nil {
+		return []string{fmt.Sprintf("key can not be decoded as %s: %s", encoding, err)}
+	}
+
+	return errs
+}
+
+// ComposeValidators creates a Validator running all the given validators, merging their errors into one ValidationError.
+// The first error during the validating process is returned.
+func ComposeValidators(validators ...Validator) Validator {
+	return func(msg *watermillmessage.Message) (*ValidationError, error) {
+		var result *ValidationError
+		for _, validate := range validators {
+			validationErr, err := validate(msg)
+			if err != nil {
+				return nil, err
+			}
+
+			if validationErr == nil {
+				continue
+			}
+
+			if result == nil {
+				result = validationErr
+				continue
+			}
+
+			result.Errors = append(result.Errors, validationErr.Errors...)
+			result.KeyErrors = append(result.KeyErrors, validationErr.KeyErrors...)
+		}
+
+		return result, nil
+	}
+}
@@ -0,0 +1,103 @@
+package message
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const benchmarkSchema = `{
+  "type": "object",
+  "required": ["id", "items"],
+  "properties": {
+    "id": {"type": "string", "format": "uuid"},
+    "customer": {
+      "type": "object",
+      "properties": {
+        "email": {"type": "string", "pattern": "^\\S+@\\S+$"},
+        "tier": {"type": "string", "enum": ["free", "pro", "enterprise"]}
+      }
+    },
+    "items": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["sku", "quantity"],
+        "properties": {
+          "sku": {"type": "string", "maxLength": 32},
+          "quantity": {"type": "integer", "minimum": 1},
+          "price": {"type": "number", "minimum": 0}
+        }
+      }
+    }
+  }
+}`
+
+// benchmarkPayloadSizes are the number of items of the benchmarked payloads.
+var benchmarkPayloadSizes = []int{1, 10, 100, 1000}
+
+// BenchmarkSchemaMessageValidator measures the throughput and allocations of validating payloads of several sizes
+// with schemas compiled once.
+func BenchmarkSchemaMessageValidator(b *testing.B) {
+	validator, err := SchemaMessageValidator(map[string][]byte{"orders": []byte(benchmarkSchema)}, channelID, GoJSONSchemaCompiler)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, items := range benchmarkPayloadSizes {
+		msg := New(benchmarkPayload(items), "orders")
+		b.Run(fmt.Sprintf("%d bytes", len(msg.Payload)), func(b *testing.B) {
+			benchmarkValidator(b, validator, msg)
+		})
+	}
+}
+
+// BenchmarkUncompiledSchemaMessageValidator is the baseline of BenchmarkSchemaMessageValidator, compiling the schema on
+// every message.
+func BenchmarkUncompiledSchemaMessageValidator(b *testing.B) {
+	schema := gojsonschema.NewStringLoader(benchmarkSchema)
+	validator := func(msg *watermillmessage.Message) (*ValidationError, error) {
+		result, err := gojsonschema.Validate(schema, gojsonschema.NewBytesLoader(msg.Payload))
+		if err != nil || result.Valid() {
+			return nil, err
+		}
+
+		return NewValidationError(time.Now(), result.Errors()[0].String()), nil
+	}
+
+	for _, items := range benchmarkPayloadSizes {
+		msg := New(benchmarkPayload(items), "orders")
+		b.Run(fmt.Sprintf("%d bytes", len(msg.Payload)), func(b *testing.B) {
+			benchmarkValidator(b, validator, msg)
+		})
+	}
+}
+
+func benchmarkValidator(b *testing.B, validator Validator, msg *watermillmessage.Message) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(msg.Payload)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		validationErr, err := validator(msg)
+		if err != nil || validationErr != nil {
+			b.Fatalf("payload should be valid. Validation error: %v. Error: %v", validationErr, err)
+		}
+	}
+}
+
+func benchmarkPayload(items int) []byte {
+	item := `{"sku": "SKU-0001", "quantity": 2, "price": 9.99}`
+	return []byte(fmt.Sprintf(
+		`{"id": "1b4e28ba-2fa1-11d2-883f-0016cb2f1c65", "customer": {"email": "jane@example.org", "tier": "pro"}, "items": [%s]}`,
+		strings.TrimSuffix(strings.Repeat(item+",", items), ","),
+	))
+}
+
+func channelID(msg *watermillmessage.Message) string {
+	return msg.Metadata.Get(MetadataChannel)
+}
@@ -5,7 +5,9 @@ import (
 
 	"github.com/ThreeDotsLabs/watermill"
 	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/xeipuuv/gojsonschema"
 )
 
@@ -68,6 +70,53 @@ func TestJsonSchemaMessageValidator(t *testing.T) {
 	}
 }
 
+func TestSchemaMessageValidator(t *testing.T) {
+	var compiled [][]byte
+	compiler := func(schema []byte) (SchemaValidator, error) {
+		compiled = append(compiled, schema)
+		return func(payload []byte) ([]string, error) {
+			if string(payload) == "invalid" {
+				return []string{"payload is invalid"}, nil
+			}
+			if string(payload) == "broken" {
+				return nil, errors.New("payload is broken")
+			}
+			return nil, nil
+		}, nil
+	}
+
+	validator, err := SchemaMessageValidator(map[string][]byte{"the-channel": []byte(`{"type":"string"}`)}, func(msg *watermillmessage.Message) string {
+		return msg.Metadata.Get(MetadataChannel)
+	}, compiler)
+	require.NoError(t, err)
+
+	for _, payload := range []string{"valid", "invalid", "broken"} {
+		_, _ = validator(New([]byte(payload), "the-channel"))
+	}
+
+	assert.Equal(t, [][]byte{[]byte(`{"type":"string"}`)}, compiled, "schemas should be compiled once")
+
+	validationErr, err := validator(New([]byte("invalid"), "the-channel"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"payload is invalid"}, validationErr.Errors)
+
+	validationErr, err = validator(New([]byte("broken"), "the-channel"))
+	assert.EqualError(t, err, "error validating JSON Schema for message the-channel: payload is broken")
+	assert.Nil(t, validationErr)
+
+	validationErr, err = validator(New([]byte("invalid"), "another-channel"))
+	assert.NoError(t, err)
+	assert.Nil(t, validationErr, "messages of channels without schema should not be validated")
+}
+
+func TestSchemaMessageValidator_invalidSchema(t *testing.T) {
+	_, err := SchemaMessageValidator(map[string][]byte{"the-channel": []byte(`{"type":"unknown"}`)}, func(msg *watermillmessage.Message) string {
+		return msg.Metadata.Get(MetadataChannel)
+	}, GoJSONSchemaCompiler)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "error compiling JSON Schema for message the-channel")
+}
+
 func TestValidationErrorFromMessage(t *testing.T) {
 	msg := New([]byte{}, "channel")
 
@@ -84,3 +133,101 @@ func generateTestMessage() *watermillmessage.Message {
 	msg.Metadata.Set(MetadataChannel, "the-channel")
 	return msg
 }
+
+func TestKeyMessageValidator(t *testing.T) {
+	avroKey := `{"type":"record","name":"UserKey","fields":[{"name":"id","type":"long"}]}`
+	keySchemas := map[string]KeySchema{
+		"string":   {Schema: []byte(`{"type":"string","pattern":"^user-[0-9]+$"}`), Encoding: KeyEncodingString},
+		"json":     {Schema: []byte(`{"type":"object","required":["id"]}`), Encoding: KeyEncodingJSON},
+		"avro":     {Schema: []byte(avroKey), Encoding: KeyEncodingAvro},
+		"required": {Required: true},
+	}
+
+	validator, err := KeyMessageValidator(keySchemas, func(msg *watermillmessage.Message) string {
+		return msg.Metadata.Get(MetadataChannel)
+	}, GoJSONSchemaCompiler)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		channel           string
+		key               *string
+		expectedKeyErrors []string
+	}{
+		{name: "Valid string key", channel: "string", key: stringPtr("user-1")},
+		{name: "Invalid string key", channel: "string", key: stringPtr("admin"), expectedKeyErrors: []string{`(root): Does not match pattern '^user-[0-9]+$'`}},
+		{name: "Null key is valid if not required", channel: "string"},
+		{name: "Valid JSON key", channel: "json", key: stringPtr(`{"id": 1}`)},
+		{name: "Invalid JSON key", channel: "json", key: stringPtr(`{}`), expectedKeyErrors: []string{"(root): id is required"}},
+		{name: "Undecodable JSON key", channel: "json", key: stringPtr(`not json`), expectedKeyErrors: []string{"key can not be decoded as json: invalid character 'o' in literal null (expecting 'u')"}},
+		{name: "Valid Avro key", channel: "avro", key: stringPtr("\x02")},
+		{name: "Valid Avro key in Confluent wire format", channel: "avro", key: stringPtr("\x00\x00\x00\x00\x07\x02")},
+		{name: "Invalid Avro key", channel: "avro", key: stringPtr("\x02\x02"), expectedKeyErrors: []string{"1 unexpected bytes after Avro value"}},
+		{name: "Required key", channel: "required", expectedKeyErrors: []string{"key is required"}},
+		{name: "Any key is valid without schema", channel: "required", key: stringPtr("anything")},
+		{name: "Channels without key schema", channel: "another", key: stringPtr("anything")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := New([]byte(`{}`), test.channel)
+			if test.key != nil {
+				msg.Metadata.Set(MetadataKey, *test.key)
+			}
+
+			validationErr, err := validator(msg)
+			require.NoError(t, err)
+			if test.expectedKeyErrors == nil {
+				assert.Nil(t, validationErr)
+				return
+			}
+
+			require.NotNil(t, validationErr)
+			assert.Empty(t, validationErr.Errors)
+			assert.Equal(t, test.expectedKeyErrors, validationErr.KeyErrors)
+		})
+	}
+}
+
+func TestKeyMessageValidator_invalidSchema(t *testing.T) {
+	idProvider := func(msg *watermillmessage.Message) string {
+		return msg.Metadata.Get(MetadataChannel)
+	}
+
+	_, err := KeyMessageValidator(map[string]KeySchema{"the-channel": {Schema: []byte(`{"type":"string"}`), Encoding: "xml"}}, idProvider, GoJSONSchemaCompiler)
+	assert.EqualError(t, err, `invalid key of message the-channel: key encoding "xml" is not valid. Valid values are string, json and avro`)
+
+	_, err = KeyMessageValidator(map[string]KeySchema{"the-channel": {Schema: []byte(`{"type":"unknown"}`), Encoding: KeyEncodingAvro}}, idProvider, GoJSONSchemaCompiler)
+	assert.EqualError(t, err, "error compiling key schema for message the-channel: invalid Avro schema: unknown type unknown")
+}
+
+func TestComposeValidators(t *testing.T) {
+	invalid := func(errs, keyErrs []string) Validator {
+		return func(*watermillmessage.Message) (*ValidationError, error) {
+			return &ValidationError{Errors: errs, KeyErrors: keyErrs}, nil
+		}
+	}
+	valid := func(*watermillmessage.Message) (*ValidationError, error) {
+		return nil, nil
+	}
+
+	validationErr, err := ComposeValidators(valid, valid)(New(nil, "channel"))
+	assert.NoError(t, err)
+	assert.Nil(t, validationErr)
+
+	validationErr, err = ComposeValidators(invalid([]string{"payload error"}, nil), valid, invalid(nil, []string{"key error"}))(New(nil, "channel"))
+	assert.NoError(t, err)
+	require.NotNil(t, validationErr)
+	assert.Equal(t, []string{"payload error"}, validationErr.Errors)
+	assert.Equal(t, []string{"key error"}, validationErr.KeyErrors)
+	assert.Equal(t, "payload error | key: key error", validationErr.Error())
+
+	broken := func(*watermillmessage.Message) (*ValidationError, error) {
+		return nil, errors.New("broken")
+	}
+	_, err = ComposeValidators(invalid([]string{"payload error"}, nil), broken)(New(nil, "channel"))
+	assert.EqualError(t, err, "broken")
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,246 @@
+package mqtt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// MQTT control packet types. See https://docs.oasis-open.org/mqtt/mqtt/v5.0/os/mqtt-v5.0-os.html#_Toc3901022.
+const (
+	packetTypeConnect = 1
+	packetTypePublish = 3
+)
+
+// protocolLevel5 is the protocol level of MQTT 5. MQTT 3.1.1 is 4.
+const protocolLevel5 = 5
+
+// maxRemainingLength is the max remaining length an MQTT packet can have (256 MB).
+const maxRemainingLength = 268435455
+
+// propertyTopicAlias is the identifier of the Topic Alias property (MQTT 5).
+const propertyTopicAlias = 0x23
+
+var errMalformedPacket = errors.New("malformed packet")
+
+// packet is an MQTT control packet.
+type packet struct {
+	// header is the first byte of the fixed header, holding the packet type and flags.
+	header byte
+	// body holds the variable header and the payload.
+	body []byte
+	// raw holds the whole packet as read, including the fixed header.
+	raw []byte
+}
+
+func (p *packet) packetType() byte {
+	return p.header >> 4
+}
+
+// readPacket reads an MQTT control packet from r.
+func readPacket(r io.Reader) (*packet, error) {
+	// Fixed header is 1 byte + up to 4 bytes of remaining length.
+	raw := make([]byte, 1, 5)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, err
+	}
+
+	var remaining, multiplier int
+	for i := 0; ; i++ {
+		if i == 4 {
+			return nil, errors.New("malformed remaining length")
+		}
+
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		raw = append(raw, b[0])
+
+		remaining += int(b[0]&0x7f) << multiplier
+		multiplier += 7
+		if b[0]&0x80 == 0 {
+			break
+		}
+	}
+
+	if remaining > maxRemainingLength {
+		return nil, fmt.Errorf("packet of length %d too large", remaining)
+	}
+
+	headerLen := len(raw)
+	raw = append(raw, make([]byte, remaining)...)
+	if _, err := io.ReadFull(r, raw[headerLen:]); err != nil {
+		return nil, err
+	}
+
+	return &packet{header: raw[0], body: raw[headerLen:], raw: raw}, nil
+}
+
+// decoder decodes MQTT data types. See https://docs.oasis-open.org/mqtt/mqtt/v5.0/os/mqtt-v5.0-os.html#_Toc3901006.
+type decoder struct {
+	b   []byte
+	off int
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if n < 0 || d.off+n > len(d.b) {
+		return nil, errMalformedPacket
+	}
+
+	v := d.b[d.off : d.off+n]
+	d.off += n
+	return v, nil
+}
+
+func (d *decoder) byte() (byte, error) {
+	v, err := d.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return v[0], nil
+}
+
+func (d *decoder) uint16() (uint16, error) {
+	v, err := d.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(v), nil
+}
+
+func (d *decoder) varint() (int, error) {
+	var v, multiplier int
+	for i := 0; i < 4; i++ {
+		b, err := d.byte()
+		if err != nil {
+			return 0, err
+		}
+
+		v += int(b&0x7f) << multiplier
+		multiplier += 7
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+
+	return 0, errMalformedPacket
+}
+
+// binary decodes Binary Data and UTF-8 Encoded Strings.
+func (d *decoder) binary() ([]byte, error) {
+	n, err := d.uint16()
+	if err != nil {
+		return nil, err
+	}
+	return d.read(int(n))
+}
+
+func (d *decoder) string() (string, error) {
+	v, err := d.binary()
+	return string(v), err
+}
+
+// connect holds the fields of a CONNECT packet needed by the proxy.
+type connect struct {
+	protocolLevel byte
+}
+
+func decodeConnect(p *packet) (*connect, error) {
+	d := &decoder{b: p.body}
+	if _, err := d.string(); err != nil { // Protocol name
+		return nil, err
+	}
+
+	level, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	return &connect{protocolLevel: level}, nil
+}
+
+// publish holds the fields of a PUBLISH packet needed by the proxy.
+type publish struct {
+	topic string
+	// topicAlias is set if the Topic Alias property is present (MQTT 5). Zero means no alias.
+	topicAlias uint16
+	payload    []byte
+}
+
+func decodePublish(p *packet, protocolLevel byte) (*publish, error) {
+	d := &decoder{b: p.body}
+	topic, err := d.string()
+	if err != nil {
+		return nil, err
+	}
+
+	pub := &publish{topic: topic}
+	if qos := (p.header >> 1) & 0x03; qos > 0 {
+		if _, err := d.uint16(); err != nil { // Packet Identifier
+			return nil, err
+		}
+	}
+
+	if protocolLevel >= protocolLevel5 {
+		if pub.topicAlias, err = decodePublishProperties(d); err != nil {
+			return nil, err
+		}
+	}
+
+	pub.payload = d.b[d.off:]
+
+	return pub, nil
+}
+
+// decodePublishProperties decodes the properties of a PUBLISH packet, returning the Topic Alias if any.
+// See https://docs.oasis-open.org/mqtt/mqtt/v5.0/os/mqtt-v5.0-os.html#_Toc3901109.
+func decodePublishProperties(d *decoder) (uint16, error) { //nolint:gocyclo
+	n, err := d.varint()
+	if err != nil {
+		return 0, err
+	}
+
+	raw, err := d.read(n)
+	if err != nil {
+		return 0, err
+	}
+
+	var alias uint16
+	props := &decoder{b: raw}
+	for props.off < len(props.b) {
+		id, err := props.varint()
+		if err != nil {
+			return 0, err
+		}
+
+		switch id {
+		case 0x01: // Payload Format Indicator
+			_, err = props.byte()
+		case 0x02: // Message Expiry Interval
+			_, err = props.read(4)
+		case propertyTopicAlias:
+			alias, err = props.uint16()
+		case 0x08, 0x03: // Response Topic, Content Type
+			_, err = props.string()
+		case 0x09: // Correlation Data
+			_, err = props.binary()
+		case 0x0B: // Subscription Identifier
+			_, err = props.varint()
+		case 0x26: // User Property
+			if _, err = props.string(); err == nil {
+				_, err = props.string()
+			}
+		default:
+			return 0, fmt.Errorf("unknown PUBLISH property %#x", id)
+		}
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return alias, nil
+}
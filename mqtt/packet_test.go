@@ -0,0 +1,131 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPacket(t *testing.T) {
+	payload := bytes.Repeat([]byte("a"), 200) // Remaining length needs 2 bytes.
+	raw := encodePacket(packetTypePublish<<4, append(encodeString("demo"), payload...))
+
+	pkt, err := readPacket(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.EqualValues(t, packetTypePublish, pkt.packetType())
+	assert.Equal(t, raw, pkt.raw)
+	assert.Len(t, pkt.body, 206)
+
+	_, err = readPacket(bytes.NewReader([]byte{packetTypePublish << 4, 0xff, 0xff, 0xff, 0xff, 0x01}))
+	assert.EqualError(t, err, "malformed remaining length")
+}
+
+func TestDecodePublish(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        byte
+		body          []byte
+		protocolLevel byte
+		expected      *publish
+		expectedErr   string
+	}{
+		{
+			name:          "MQTT 3.1.1. QoS 0",
+			header:        packetTypePublish << 4,
+			body:          concat(encodeString("smartylighting/streetlights"), []byte(`{"lumens":3}`)),
+			protocolLevel: 4,
+			expected:      &publish{topic: "smartylighting/streetlights", payload: []byte(`{"lumens":3}`)},
+		},
+		{
+			name:          "MQTT 3.1.1. QoS 1",
+			header:        packetTypePublish<<4 | 1<<1,
+			body:          concat(encodeString("smartylighting/streetlights"), []byte{0, 10}, []byte(`{"lumens":3}`)),
+			protocolLevel: 4,
+			expected:      &publish{topic: "smartylighting/streetlights", payload: []byte(`{"lumens":3}`)},
+		},
+		{
+			name:   "MQTT 5. QoS 2 with properties",
+			header: packetTypePublish<<4 | 2<<1,
+			body: concat(
+				encodeString("smartylighting/streetlights"),
+				[]byte{0, 10},
+				encodeProperties(
+					[]byte{0x01, 1},
+					concat([]byte{0x03}, encodeString("application/json")),
+					[]byte{propertyTopicAlias, 0, 5},
+					concat([]byte{0x26}, encodeString("key"), encodeString("value")),
+				),
+				[]byte(`{"lumens":3}`),
+			),
+			protocolLevel: 5,
+			expected:      &publish{topic: "smartylighting/streetlights", topicAlias: 5, payload: []byte(`{"lumens":3}`)},
+		},
+		{
+			name:          "MQTT 5. Unknown property",
+			header:        packetTypePublish << 4,
+			body:          concat(encodeString("demo"), encodeProperties([]byte{0x7f, 1})),
+			protocolLevel: 5,
+			expectedErr:   "unknown PUBLISH property 0x7f",
+		},
+		{
+			name:          "Malformed packet",
+			header:        packetTypePublish << 4,
+			body:          []byte{0, 10, 'd'},
+			protocolLevel: 4,
+			expectedErr:   "malformed packet",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pub, err := decodePublish(&packet{header: test.header, body: test.body}, test.protocolLevel)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, pub)
+		})
+	}
+}
+
+func encodePacket(header byte, body []byte) []byte {
+	return concat([]byte{header}, encodeVarint(len(body)), body)
+}
+
+func encodeVarint(v int) []byte {
+	var b []byte
+	for {
+		digit := byte(v % 128)
+		v /= 128
+		if v > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+func encodeString(s string) []byte {
+	b := make([]byte, 2, 2+len(s))
+	binary.BigEndian.PutUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func encodeProperties(props ...[]byte) []byte {
+	raw := concat(props...)
+	return concat(encodeVarint(len(raw)), raw)
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
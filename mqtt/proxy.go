@@ -0,0 +1,129 @@
+package mqtt
+
+import (
+	"io"
+	"net"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/asyncapi/event-gateway/proxy"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultProxyName = "mqtt"
+
+// Protocols are the AsyncAPI server protocols supported by the MQTT proxy.
+var Protocols = []string{"mqtt"}
+
+// Proxy is an MQTT proxy. MQTT clients connect to the broker through it.
+// Messages of PUBLISH packets sent by clients are handled by the configured message handler before reaching the broker.
+type Proxy struct {
+	*proxy.TCP
+	// handle publishes the messages for being handled. Nil if there is no message handler.
+	handle proxy.PublishFunc
+}
+
+// NewProxy creates a new MQTT Proxy based on a given configuration.
+func NewProxy(c *ProxyConfig, r *watermillmessage.Router) (*Proxy, error) {
+	if c == nil {
+		return nil, errors.New("config should be provided")
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	name := c.Name
+	if name == "" {
+		name = defaultProxyName
+	}
+
+	p := new(Proxy)
+	p.TCP = proxy.NewTCP(name, c.ListenAddress, c.BrokerAddress, p.handleConn)
+
+	if c.MessageHandler != nil {
+		p.handle = proxy.NewMessageHandler("on-mqtt-publish-"+name, r, c.MessageConfig)
+	}
+
+	return p, nil
+}
+
+func (p *Proxy) handleConn(client, broker net.Conn) error {
+	c := &connection{publish: p.publish, topicAliases: make(map[uint16]string)}
+	return proxy.Relay(client, broker, func() error {
+		return c.relayClientPackets(client, broker)
+	})
+}
+
+// publish publishes the message of a PUBLISH packet for being handled.
+func (p *Proxy) publish(topic string, payload []byte) {
+	if p.handle == nil {
+		return
+	}
+
+	if err := p.handle(message.New(payload, topic)); err != nil {
+		logrus.WithError(err).Error("error handling message")
+	}
+}
+
+// connection holds the state of an MQTT connection.
+type connection struct {
+	publish func(topic string, payload []byte)
+
+	protocolLevel byte
+	// topicAliases maps the Topic Aliases set by the client to their topic (MQTT 5).
+	topicAliases map[uint16]string
+}
+
+// relayClientPackets relays the packets sent by the client to the broker, inspecting them on the way.
+func (c *connection) relayClientPackets(client io.Reader, broker io.Writer) error {
+	for {
+		pkt, err := readPacket(client)
+		if err != nil {
+			return err
+		}
+
+		c.inspect(pkt)
+
+		if _, err := broker.Write(pkt.raw); err != nil {
+			return err
+		}
+	}
+}
+
+// inspect inspects a packet sent by the client. Malformed packets are forwarded anyway, so the broker rejects them.
+func (c *connection) inspect(pkt *packet) {
+	switch pkt.packetType() {
+	case packetTypeConnect:
+		conn, err := decodeConnect(pkt)
+		if err != nil {
+			logrus.WithError(err).Warn("error decoding MQTT CONNECT packet")
+			return
+		}
+
+		c.protocolLevel = conn.protocolLevel
+	case packetTypePublish:
+		pub, err := decodePublish(pkt, c.protocolLevel)
+		if err != nil {
+			logrus.WithError(err).Warn("error decoding MQTT PUBLISH packet")
+			return
+		}
+
+		topic := pub.topic
+		if pub.topicAlias != 0 {
+			if topic == "" {
+				topic = c.topicAliases[pub.topicAlias]
+			} else {
+				c.topicAliases[pub.topicAlias] = topic
+			}
+		}
+
+		if topic == "" {
+			logrus.Warnf("MQTT PUBLISH packet with unknown topic alias %d", pub.topicAlias)
+			return
+		}
+
+		c.publish(topic, pub.payload)
+	}
+}
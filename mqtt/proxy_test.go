@@ -0,0 +1,158 @@
+package mqtt
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	messagetest "github.com/asyncapi/event-gateway/message/test"
+	"github.com/asyncapi/event-gateway/proxy"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProxy(t *testing.T) {
+	tests := []struct {
+		name        string
+		c           *ProxyConfig
+		expectedErr error
+	}{
+		{
+			name: "Proxy is created when config is valid",
+			c:    &ProxyConfig{BrokerAddress: "broker.mybrokers.org:1883", ListenAddress: ":1883"},
+		},
+		{
+			name:        "Proxy creation errors when config is invalid",
+			c:           &ProxyConfig{BrokerAddress: "broker.mybrokers.org:1883"},
+			expectedErr: errors.New("ListenAddress is mandatory"),
+		},
+		{
+			name:        "Proxy creation errors when config is missing",
+			expectedErr: errors.New("config should be provided"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := NewProxy(test.c, messagetest.NewRouter(t))
+			if test.expectedErr != nil {
+				assert.EqualError(t, err, test.expectedErr.Error())
+				assert.Nil(t, p)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "mqtt", p.Name())
+			}
+		})
+	}
+}
+
+func TestProxy_Start(t *testing.T) {
+	tests := []struct {
+		name          string
+		protocolLevel byte
+		packets       [][]byte
+		expected      map[string]string
+	}{
+		{
+			name:          "MQTT 3.1.1",
+			protocolLevel: 4,
+			packets: [][]byte{
+				encodePacket(packetTypePublish<<4, concat(encodeString("lights/1"), []byte(`{"lumens":3}`))),
+				encodePacket(packetTypePublish<<4|1<<1, concat(encodeString("lights/2"), []byte{0, 1}, []byte(`{"lumens":4}`))),
+			},
+			expected: map[string]string{`{"lumens":3}`: "lights/1", `{"lumens":4}`: "lights/2"},
+		},
+		{
+			name:          "MQTT 5 with topic alias",
+			protocolLevel: 5,
+			packets: [][]byte{
+				encodePacket(packetTypePublish<<4, concat(encodeString("lights/1"), encodeProperties([]byte{propertyTopicAlias, 0, 1}), []byte(`{"lumens":3}`))),
+				encodePacket(packetTypePublish<<4, concat(encodeString(""), encodeProperties([]byte{propertyTopicAlias, 0, 1}), []byte(`{"lumens":4}`))),
+			},
+			expected: map[string]string{`{"lumens":3}`: "lights/1", `{"lumens":4}`: "lights/1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker, received := runFakeBroker(t)
+
+			handled := make(chan *watermillmessage.Message, len(test.packets))
+			handler := func(msg *watermillmessage.Message) ([]*watermillmessage.Message, error) {
+				handled <- msg
+				return nil, nil
+			}
+
+			c, err := NewProxyConfig(broker, "127.0.0.1:0", WithName("test"), WithMessageHandler(handler))
+			require.NoError(t, err)
+
+			r := messagetest.NewRouter(t)
+			p, err := NewProxy(c, r)
+			require.NoError(t, err)
+
+			go func() {
+				require.NoError(t, r.Run(context.Background()))
+			}()
+			<-r.Running()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() {
+				done <- proxy.Run(ctx, p)
+			}()
+			<-p.Ready()
+
+			client, err := net.Dial("tcp", p.Addr().String())
+			require.NoError(t, err)
+			defer client.Close()
+
+			connect := encodePacket(packetTypeConnect<<4, concat(encodeString("MQTT"), []byte{test.protocolLevel, 0x02, 0, 60}, encodeString("client")))
+			sent := concat(append([][]byte{connect}, test.packets...)...)
+			_, err = client.Write(sent)
+			require.NoError(t, err)
+
+			for range test.packets {
+				select {
+				case msg := <-handled:
+					assert.Equal(t, test.expected[string(msg.Payload)], msg.Metadata.Get(message.MetadataChannel))
+				case <-time.After(2 * time.Second):
+					t.Fatal("message was not handled")
+				}
+			}
+
+			// Packets reach the broker untouched.
+			raw := make([]byte, len(sent))
+			_, err = io.ReadFull(received, raw)
+			require.NoError(t, err)
+			assert.Equal(t, sent, raw)
+
+			cancel()
+			assert.NoError(t, <-done)
+		})
+	}
+}
+
+// runFakeBroker runs a broker stand-in accepting a single connection. Everything received is written to the returned reader.
+func runFakeBroker(t *testing.T) (string, io.Reader) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = l.Close()
+	})
+
+	r, w := io.Pipe()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = io.Copy(w, conn)
+	}()
+
+	return l.Addr().String(), r
+}
@@ -0,0 +1,179 @@
+package nats
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NATS client protocol operations inspected by the proxy. See https://docs.nats.io/reference/reference-protocols/nats-protocol.
+const (
+	opPub  = "PUB"
+	opHPub = "HPUB"
+)
+
+const (
+	// maxControlLineSize is the max size a control line can have, including the trailing CRLF.
+	maxControlLineSize = 64 * 1024
+	// maxPayloadSize is the max size the payload of a message can have (64 MB), including headers.
+	maxPayloadSize = 64 * 1024 * 1024
+	// headerVersion is the version line every message headers start with.
+	headerVersion = "NATS/1.0"
+)
+
+var crlf = []byte("\r\n")
+
+// operation is a protocol operation sent by a NATS client.
+type operation struct {
+	// publish is set if the operation is PUB or HPUB.
+	publish *publish
+	// raw holds the whole operation as read, including the payload if any.
+	raw []byte
+}
+
+// publish holds the fields of a PUB or HPUB operation needed by the proxy.
+type publish struct {
+	subject string
+	// headers holds the raw headers of HPUB operations. Decoded by decodeHeaders.
+	headers []byte
+	payload []byte
+}
+
+// readOperation reads a protocol operation sent by a NATS client.
+// Operations other than PUB and HPUB are returned without being decoded, so they are relayed as is.
+func readOperation(r *bufio.Reader) (*operation, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, errors.New("control line too long")
+		}
+		return nil, err
+	}
+
+	op := &operation{raw: append([]byte(nil), line...)}
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return op, nil
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case opPub:
+		err = op.readPub(r, fields[1:])
+	case opHPub:
+		err = op.readHPub(r, fields[1:])
+	}
+
+	return op, err
+}
+
+// readPub reads the payload of a PUB operation. Args are: <subject> [reply-to] <#bytes>.
+func (op *operation) readPub(r io.Reader, args []string) error {
+	if len(args) != 2 && len(args) != 3 {
+		return fmt.Errorf("malformed %s operation: %q", opPub, op.raw)
+	}
+
+	size, err := parseSize(args[len(args)-1])
+	if err != nil {
+		return err
+	}
+
+	payload, err := op.readPayload(r, size)
+	if err != nil {
+		return err
+	}
+
+	op.publish = &publish{subject: args[0], payload: payload}
+
+	return nil
+}
+
+// readHPub reads the headers and payload of a HPUB operation. Args are: <subject> [reply-to] <#header bytes> <#total bytes>.
+func (op *operation) readHPub(r io.Reader, args []string) error {
+	if len(args) != 3 && len(args) != 4 {
+		return fmt.Errorf("malformed %s operation: %q", opHPub, op.raw)
+	}
+
+	headerSize, err := parseSize(args[len(args)-2])
+	if err != nil {
+		return err
+	}
+
+	totalSize, err := parseSize(args[len(args)-1])
+	if err != nil {
+		return err
+	}
+
+	if headerSize > totalSize {
+		return fmt.Errorf("malformed %s operation: header size %d exceeds total size %d", opHPub, headerSize, totalSize)
+	}
+
+	data, err := op.readPayload(r, totalSize)
+	if err != nil {
+		return err
+	}
+
+	op.publish = &publish{subject: args[0], headers: data[:headerSize], payload: data[headerSize:]}
+
+	return nil
+}
+
+// readPayload reads a payload of the given size followed by CRLF, appending it to the raw operation.
+func (op *operation) readPayload(r io.Reader, size int) ([]byte, error) {
+	start := len(op.raw)
+	op.raw = append(op.raw, make([]byte, size+len(crlf))...)
+	if _, err := io.ReadFull(r, op.raw[start:]); err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasSuffix(op.raw, crlf) {
+		return nil, errors.New("payload is not followed by CRLF")
+	}
+
+	return op.raw[start : start+size], nil
+}
+
+func parseSize(s string) (int, error) {
+	size, err := strconv.Atoi(s)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	if size > maxPayloadSize {
+		return 0, fmt.Errorf("payload of size %d too large", size)
+	}
+
+	return size, nil
+}
+
+// decodeHeaders decodes message headers. Values of headers set several times are joined by a comma.
+func decodeHeaders(raw []byte) (map[string]string, error) {
+	lines := strings.Split(string(raw), "\r\n")
+	if !strings.HasPrefix(lines[0], headerVersion) {
+		return nil, fmt.Errorf("unsupported headers version %q", lines[0])
+	}
+
+	headers := make(map[string]string)
+	for _, l := range lines[1:] {
+		if l == "" {
+			continue
+		}
+
+		i := strings.IndexByte(l, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("malformed header %q", l)
+		}
+
+		key, value := l[:i], strings.TrimSpace(l[i+1:])
+		if existing, ok := headers[key]; ok {
+			value = existing + "," + value
+		}
+		headers[key] = value
+	}
+
+	return headers, nil
+}
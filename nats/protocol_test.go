@@ -0,0 +1,88 @@
+package nats
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOperation(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		expected    *publish
+		expectedErr string
+	}{
+		{
+			name:     "PUB",
+			raw:      "PUB lights.1.measured 12\r\n{\"lumens\":3}\r\n",
+			expected: &publish{subject: "lights.1.measured", payload: []byte(`{"lumens":3}`)},
+		},
+		{
+			name:     "PUB with reply subject and lowercase",
+			raw:      "pub lights.1.measured INBOX.1 12\r\n{\"lumens\":3}\r\n",
+			expected: &publish{subject: "lights.1.measured", payload: []byte(`{"lumens":3}`)},
+		},
+		{
+			name:     "PUB without payload",
+			raw:      "PUB lights.1.measured 0\r\n\r\n",
+			expected: &publish{subject: "lights.1.measured", payload: []byte{}},
+		},
+		{
+			name: "HPUB",
+			raw:  "HPUB lights.1.measured 19 31\r\nNATS/1.0\r\nId: 1\r\n\r\n{\"lumens\":3}\r\n",
+			expected: &publish{
+				subject: "lights.1.measured",
+				headers: []byte("NATS/1.0\r\nId: 1\r\n\r\n"),
+				payload: []byte(`{"lumens":3}`),
+			},
+		},
+		{
+			name: "Any other operation",
+			raw:  "SUB lights.> 1\r\n",
+		},
+		{
+			name:        "PUB with invalid size",
+			raw:         "PUB lights.1.measured abc\r\n",
+			expectedErr: `invalid size "abc"`,
+		},
+		{
+			name:        "PUB with payload longer than declared",
+			raw:         "PUB lights.1.measured 2\r\n{\"lumens\":3}\r\n",
+			expectedErr: "payload is not followed by CRLF",
+		},
+		{
+			name:        "HPUB with header size exceeding total size",
+			raw:         "HPUB lights.1.measured 34 22\r\n",
+			expectedErr: "malformed HPUB operation: header size 34 exceeds total size 22",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			op, err := readOperation(bufio.NewReader(strings.NewReader(test.raw)))
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, op.publish)
+			assert.Equal(t, test.raw, string(op.raw))
+		})
+	}
+}
+
+func TestDecodeHeaders(t *testing.T) {
+	headers, err := decodeHeaders([]byte("NATS/1.0\r\nId: 1\r\nTrace: a\r\nTrace: b\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Id": "1", "Trace": "a,b"}, headers)
+
+	_, err = decodeHeaders([]byte("HTTP/1.1\r\n\r\n"))
+	assert.EqualError(t, err, `unsupported headers version "HTTP/1.1"`)
+
+	_, err = decodeHeaders([]byte("NATS/1.0\r\nId\r\n\r\n"))
+	assert.EqualError(t, err, `malformed header "Id"`)
+}
@@ -0,0 +1,114 @@
+package nats
+
+import (
+	"bufio"
+	"io"
+	"net"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/asyncapi/event-gateway/proxy"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultProxyName = "nats"
+
+// Protocols are the AsyncAPI server protocols supported by the NATS proxy.
+var Protocols = []string{"nats"}
+
+// Proxy is a NATS proxy. NATS clients connect to the server through it.
+// Messages of PUB and HPUB operations sent by clients are handled by the configured message handler before reaching the server.
+type Proxy struct {
+	*proxy.TCP
+	resolver ChannelResolver
+	// handle publishes the messages for being handled. Nil if there is no message handler.
+	handle proxy.PublishFunc
+}
+
+// NewProxy creates a new NATS Proxy based on a given configuration.
+func NewProxy(c *ProxyConfig, r *watermillmessage.Router) (*Proxy, error) {
+	if c == nil {
+		return nil, errors.New("config should be provided")
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	name := c.Name
+	if name == "" {
+		name = defaultProxyName
+	}
+
+	p := &Proxy{resolver: c.ChannelResolver}
+	p.TCP = proxy.NewTCP(name, c.ListenAddress, c.BrokerAddress, p.handleConn)
+
+	if c.MessageHandler != nil {
+		p.handle = proxy.NewMessageHandler("on-nats-publish-"+name, r, c.MessageConfig)
+	}
+
+	return p, nil
+}
+
+func (p *Proxy) handleConn(client, broker net.Conn) error {
+	return proxy.Relay(client, broker, func() error {
+		return p.relayClientOperations(client, broker)
+	})
+}
+
+// relayClientOperations relays the operations sent by the client to the server, inspecting them on the way.
+// Malformed operations close the connection, same as the server does.
+func (p *Proxy) relayClientOperations(client io.Reader, broker io.Writer) error {
+	r := bufio.NewReaderSize(client, maxControlLineSize)
+	for {
+		op, err := readOperation(r)
+		if err != nil {
+			return err
+		}
+
+		if op.publish != nil {
+			p.publish(op.publish)
+		}
+
+		if _, err := broker.Write(op.raw); err != nil {
+			return err
+		}
+	}
+}
+
+// publish publishes the message of a PUB or HPUB operation for being handled.
+func (p *Proxy) publish(pub *publish) {
+	if p.handle == nil {
+		return
+	}
+
+	channel := pub.subject
+	if p.resolver != nil {
+		channel = p.resolver(pub.subject)
+	}
+
+	if channel == "" {
+		logrus.Debugf("No AsyncAPI channel found for subject %q. Skipping message...", pub.subject)
+		return
+	}
+
+	msg := message.New(pub.payload, channel)
+	if len(pub.headers) > 0 {
+		headers, err := decodeHeaders(pub.headers)
+		if err != nil {
+			logrus.WithError(err).Warnf("error decoding headers of message published to subject %q", pub.subject)
+		}
+
+		// Headers are stored in the message Metadata, same as Kafka headers. Clients can't set the metadata of the gateway.
+		for k, v := range headers {
+			if !message.IsInternalMetadata(k) {
+				msg.Metadata.Set(k, v)
+			}
+		}
+	}
+
+	if err := p.handle(msg); err != nil {
+		logrus.WithError(err).Error("error handling message")
+	}
+}
@@ -0,0 +1,164 @@
+package nats
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	messagetest "github.com/asyncapi/event-gateway/message/test"
+	"github.com/asyncapi/event-gateway/proxy"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProxy(t *testing.T) {
+	tests := []struct {
+		name        string
+		c           *ProxyConfig
+		expectedErr error
+	}{
+		{
+			name: "Proxy is created when config is valid",
+			c:    &ProxyConfig{BrokerAddress: "broker.mybrokers.org:4222", ListenAddress: ":4222"},
+		},
+		{
+			name:        "Proxy creation errors when config is invalid",
+			c:           &ProxyConfig{BrokerAddress: "broker.mybrokers.org:4222"},
+			expectedErr: errors.New("ListenAddress is mandatory"),
+		},
+		{
+			name:        "Proxy creation errors when config is missing",
+			expectedErr: errors.New("config should be provided"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := NewProxy(test.c, messagetest.NewRouter(t))
+			if test.expectedErr != nil {
+				assert.EqualError(t, err, test.expectedErr.Error())
+				assert.Nil(t, p)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "nats", p.Name())
+			}
+		})
+	}
+}
+
+func TestProxy_Start(t *testing.T) {
+	tests := []struct {
+		name             string
+		resolver         ChannelResolver
+		operations       string
+		expected         map[string]string
+		expectedMetadata map[string]string
+	}{
+		{
+			name:       "Channel is the subject by default",
+			operations: "CONNECT {}\r\nPING\r\nPUB lights.1.measured 12\r\n{\"lumens\":3}\r\n",
+			expected:   map[string]string{`{"lumens":3}`: "lights.1.measured"},
+		},
+		{
+			name:     "Subjects are resolved to channels. Headers are stored as metadata, except the ones of the gateway",
+			resolver: SubjectChannelResolver("lights.{streetlightId}.measured"),
+			operations: "CONNECT {\"headers\":true}\r\n" +
+				"SUB lights.> 1\r\n" +
+				"PUB lights.1.measured INBOX.1 12\r\n{\"lumens\":3}\r\n" +
+				"HPUB lights.2.measured 48 60\r\nNATS/1.0\r\nId: 1\r\n_asyncapi_eg_redacted: true\r\n\r\n{\"lumens\":4}\r\n",
+			expected:         map[string]string{`{"lumens":3}`: "lights.{streetlightId}.measured", `{"lumens":4}`: "lights.{streetlightId}.measured"},
+			expectedMetadata: map[string]string{`{"lumens":4}`: "1"},
+		},
+		{
+			name:     "Messages without channel are skipped",
+			resolver: SubjectChannelResolver("lights.measured"),
+			operations: "PUB unknown 2\r\n{}\r\n" +
+				"PUB lights.measured 12\r\n{\"lumens\":3}\r\n",
+			expected: map[string]string{`{"lumens":3}`: "lights.measured"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker, received := runFakeBroker(t)
+
+			handled := make(chan *watermillmessage.Message, len(test.expected)+1)
+			handler := func(msg *watermillmessage.Message) ([]*watermillmessage.Message, error) {
+				handled <- msg
+				return nil, nil
+			}
+
+			c, err := NewProxyConfig(broker, "127.0.0.1:0", WithName("test"), WithMessageHandler(handler), WithChannelResolver(test.resolver))
+			require.NoError(t, err)
+
+			r := messagetest.NewRouter(t)
+			p, err := NewProxy(c, r)
+			require.NoError(t, err)
+
+			go func() {
+				require.NoError(t, r.Run(context.Background()))
+			}()
+			<-r.Running()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() {
+				done <- proxy.Run(ctx, p)
+			}()
+			<-p.Ready()
+
+			client, err := net.Dial("tcp", p.Addr().String())
+			require.NoError(t, err)
+			defer client.Close()
+
+			_, err = client.Write([]byte(test.operations))
+			require.NoError(t, err)
+
+			for range test.expected {
+				select {
+				case msg := <-handled:
+					assert.Equal(t, test.expected[string(msg.Payload)], msg.Metadata.Get(message.MetadataChannel))
+					assert.Equal(t, test.expectedMetadata[string(msg.Payload)], msg.Metadata.Get("Id"))
+					assert.Empty(t, msg.Metadata.Get("_asyncapi_eg_redacted"))
+				case <-time.After(2 * time.Second):
+					t.Fatal("message was not handled")
+				}
+			}
+
+			// Operations reach the server untouched.
+			raw := make([]byte, len(test.operations))
+			_, err = io.ReadFull(received, raw)
+			require.NoError(t, err)
+			assert.Equal(t, test.operations, string(raw))
+			assert.Empty(t, handled)
+
+			cancel()
+			assert.NoError(t, <-done)
+		})
+	}
+}
+
+// runFakeBroker runs a server stand-in accepting a single connection. Everything received is written to the returned reader.
+func runFakeBroker(t *testing.T) (string, io.Reader) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = l.Close()
+	})
+
+	r, w := io.Pipe()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = io.Copy(w, conn)
+	}()
+
+	return l.Addr().String(), r
+}
@@ -0,0 +1,93 @@
+package nats
+
+import (
+	"sort"
+	"strings"
+)
+
+// NATS subject wildcards. See https://docs.nats.io/nats-concepts/subjects#wildcards.
+const (
+	wildcardToken = "*"
+	wildcardTail  = ">"
+)
+
+// SubjectChannelResolver creates a ChannelResolver matching subjects against the given channel names.
+// Channel names can be wildcard-shaped: tokens `*` and AsyncAPI channel parameters (e.g. `{streetlightId}`) match any single token,
+// while a trailing `>` matches one or more tokens.
+// Channels matching the subject exactly win. Otherwise, the channel with more literal tokens wins.
+func SubjectChannelResolver(channels ...string) ChannelResolver {
+	exact := make(map[string]string)
+	var patterns []subjectPattern
+	for _, c := range channels {
+		p := newSubjectPattern(c)
+		if p.literals == len(p.tokens) {
+			exact[c] = c
+			continue
+		}
+
+		patterns = append(patterns, p)
+	}
+
+	sort.SliceStable(patterns, func(i, j int) bool {
+		if patterns[i].literals != patterns[j].literals {
+			return patterns[i].literals > patterns[j].literals
+		}
+
+		return patterns[i].channel < patterns[j].channel
+	})
+
+	return func(subject string) string {
+		if c, ok := exact[subject]; ok {
+			return c
+		}
+
+		tokens := strings.Split(subject, ".")
+		for _, p := range patterns {
+			if p.matches(tokens) {
+				return p.channel
+			}
+		}
+
+		return ""
+	}
+}
+
+// subjectPattern is a wildcard-shaped channel name split into tokens.
+type subjectPattern struct {
+	channel  string
+	tokens   []string
+	literals int
+}
+
+func newSubjectPattern(channel string) subjectPattern {
+	p := subjectPattern{channel: channel, tokens: strings.Split(channel, ".")}
+	for _, t := range p.tokens {
+		if !isWildcard(t) {
+			p.literals++
+		}
+	}
+
+	return p
+}
+
+func (p subjectPattern) matches(subject []string) bool {
+	for i, t := range p.tokens {
+		if t == wildcardTail && i == len(p.tokens)-1 {
+			return len(subject) > i
+		}
+
+		if i >= len(subject) {
+			return false
+		}
+
+		if !isWildcard(t) && t != subject[i] {
+			return false
+		}
+	}
+
+	return len(subject) == len(p.tokens)
+}
+
+func isWildcard(token string) bool {
+	return token == wildcardToken || token == wildcardTail || (strings.HasPrefix(token, "{") && strings.HasSuffix(token, "}"))
+}
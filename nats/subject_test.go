@@ -0,0 +1,35 @@
+package nats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubjectChannelResolver(t *testing.T) {
+	resolver := SubjectChannelResolver(
+		"lights.measured",
+		"lights.{streetlightId}.measured",
+		"lights.*.dimmed",
+		"lights.1.*",
+		"lights.>",
+	)
+
+	tests := []struct {
+		subject  string
+		expected string
+	}{
+		{subject: "lights.measured", expected: "lights.measured"},
+		{subject: "lights.2.measured", expected: "lights.{streetlightId}.measured"},
+		{subject: "lights.2.dimmed", expected: "lights.*.dimmed"},
+		{subject: "lights.1.measured", expected: "lights.1.*"},
+		{subject: "lights.2.turned.on", expected: "lights.>"},
+		{subject: "lights"},
+		{subject: "streetlights.1.measured"},
+	}
+	for _, test := range tests {
+		t.Run(test.subject, func(t *testing.T) {
+			assert.Equal(t, test.expected, resolver(test.subject))
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package producer
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultMaxBodyBytes is the default max size of the messages produced through the API (1 MB).
+const DefaultMaxBodyBytes = 1024 * 1024
+
+// KeyHeader is the HTTP header holding the key of the produced message. Messages are produced with null key if missing.
+const KeyHeader = "X-EventGateway-Key"
+
+// ChannelMatcher returns the channel the given topic belongs to, if any.
+type ChannelMatcher func(topic string) (channel string, ok bool)
+
+// API is an HTTP API for producing messages to the channels declared in the AsyncAPI docs.
+// Messages are validated before being produced, so invalid messages never reach the broker.
+type API struct {
+	matchChannel ChannelMatcher
+	validator    message.Validator
+	publisher    watermillmessage.Publisher
+	maxBodyBytes int64
+}
+
+// Opt is a functional option used for configuring an API.
+type Opt func(*API)
+
+// WithChannelMatcher configures the matcher finding the channel of the topics messages are produced to.
+// Messages can only be produced to topics belonging to a channel, so none are accepted if not set.
+func WithChannelMatcher(matcher ChannelMatcher) Opt {
+	return func(a *API) {
+		a.matchChannel = matcher
+	}
+}
+
+// WithValidator configures the validator messages are validated with before being produced.
+func WithValidator(validator message.Validator) Opt {
+	return func(a *API) {
+		a.validator = validator
+	}
+}
+
+// WithPublisher configures the publisher messages are produced with. The channel is used as topic. Mandatory.
+func WithPublisher(publisher watermillmessage.Publisher) Opt {
+	return func(a *API) {
+		a.publisher = publisher
+	}
+}
+
+// WithMaxBodyBytes configures the max size of the messages. Default is DefaultMaxBodyBytes.
+func WithMaxBodyBytes(n int64) Opt {
+	return func(a *API) {
+		a.maxBodyBytes = n
+	}
+}
+
+// NewAPI creates a new API.
+func NewAPI(opts ...Opt) *API {
+	a := &API{
+		matchChannel: func(string) (string, bool) { return "", false },
+		maxBodyBytes: DefaultMaxBodyBytes,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// Router returns a router serving all the API endpoints.
+// Topics containing slashes should be URL-encoded (e.g. `/channels/smartylighting%2Fmeasured`) or sent as is.
+func (a *API) Router() chi.Router {
+	r := chi.NewRouter()
+	r.Post("/channels/*", a.handleProduce)
+
+	return r
+}
+
+// Close closes the publisher.
+func (a *API) Close() error {
+	if a.publisher == nil {
+		return nil
+	}
+
+	return a.publisher.Close()
+}
+
+// errorResponse is the body of the responses of failed requests, except for validation errors.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// produceResponse is the body of the responses of produced messages.
+type produceResponse struct {
+	UUID    string `json:"uuid"`
+	Channel string `json:"channel"`
+	Topic   string `json:"topic"`
+}
+
+// handleProduce produces the request body to the topic of the path, once validated as a message of the channel the topic
+// belongs to. Topics of parameterized channels (i.e. `user.{userId}.signedup`) are accepted, e.g. `user.1.signedup`.
+func (a *API) handleProduce(w http.ResponseWriter, r *http.Request) {
+	topic, err := url.PathUnescape(chi.URLParam(r, "*"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid channel name"})
+		return
+	}
+
+	topic = strings.TrimSuffix(topic, "/")
+	channel, ok := a.matchChannel(topic)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "channel " + topic + " is not declared in the AsyncAPI docs"})
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, a.maxBodyBytes+1))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "error reading body"})
+		return
+	}
+
+	if int64(len(body)) > a.maxBodyBytes {
+		writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: "message is too large"})
+		return
+	}
+
+	msg := message.New(body, channel)
+	if key, ok := r.Header[http.CanonicalHeaderKey(KeyHeader)]; ok {
+		msg.Metadata.Set(message.MetadataKey, key[0])
+	}
+
+	if a.validator != nil {
+		validationErr, err := a.validator(msg)
+		if err != nil {
+			logrus.WithError(err).WithField("channel", channel).Error("error validating message")
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "error validating message"})
+			return
+		}
+
+		if validationErr != nil {
+			writeJSON(w, http.StatusBadRequest, validationErr)
+			return
+		}
+	}
+
+	// The channel is not needed as metadata once validated, as the message is produced to its topic.
+	delete(msg.Metadata, message.MetadataChannel)
+	if err := a.publisher.Publish(topic, msg); err != nil {
+		logrus.WithError(err).WithField("topic", topic).Error("error producing message")
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: "error producing message"})
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, produceResponse{UUID: msg.UUID, Channel: channel, Topic: topic})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.WithError(err).Error("error encoding produce API response")
+	}
+}
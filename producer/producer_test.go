@@ -0,0 +1,227 @@
+package producer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+func TestAPI_Router(t *testing.T) {
+	schemas := map[string]gojsonschema.JSONLoader{
+		"streetlights/measured":  gojsonschema.NewStringLoader(`{"type":"object","properties":{"lumens":{"type":"integer","minimum":0}}}`),
+		"user.{userId}.signedup": gojsonschema.NewStringLoader(`{"type":"object","required":["email"]}`),
+	}
+	validator, err := message.JSONSchemaMessageValidator(schemas, func(msg *watermillmessage.Message) string {
+		return msg.Metadata.Get(message.MetadataChannel)
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		path              string
+		key               *string
+		body              string
+		publishErr        error
+		expectedStatus    int
+		expectedBody      string
+		expectedPublished bool
+		expectedChannel   string
+		expectedTopic     string
+	}{
+		{
+			name:              "Valid message is produced",
+			path:              "/channels/streetlights%2Fmeasured",
+			body:              `{"lumens":3}`,
+			expectedStatus:    http.StatusAccepted,
+			expectedPublished: true,
+			expectedChannel:   "streetlights/measured",
+			expectedTopic:     "streetlights/measured",
+		},
+		{
+			name:              "Channel name is not URL-encoded",
+			path:              "/channels/streetlights/measured",
+			body:              `{"lumens":3}`,
+			expectedStatus:    http.StatusAccepted,
+			expectedPublished: true,
+			expectedChannel:   "streetlights/measured",
+			expectedTopic:     "streetlights/measured",
+		},
+		{
+			name:              "Message is produced with key",
+			path:              "/channels/streetlights%2Fmeasured",
+			key:               stringPtr("lamp-1"),
+			body:              `{"lumens":3}`,
+			expectedStatus:    http.StatusAccepted,
+			expectedPublished: true,
+			expectedChannel:   "streetlights/measured",
+			expectedTopic:     "streetlights/measured",
+		},
+		{
+			name:              "Message is produced with empty key",
+			path:              "/channels/streetlights%2Fmeasured",
+			key:               stringPtr(""),
+			body:              `{"lumens":3}`,
+			expectedStatus:    http.StatusAccepted,
+			expectedPublished: true,
+			expectedChannel:   "streetlights/measured",
+			expectedTopic:     "streetlights/measured",
+		},
+		{
+			name:              "Topic of a parameterized channel",
+			path:              "/channels/user.1.signedup",
+			body:              `{"email":"me@example.com"}`,
+			expectedStatus:    http.StatusAccepted,
+			expectedPublished: true,
+			expectedChannel:   "user.{userId}.signedup",
+			expectedTopic:     "user.1.signedup",
+		},
+		{
+			name:           "Invalid message of a parameterized channel is rejected",
+			path:           "/channels/user.1.signedup",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `email is required`,
+		},
+		{
+			name:              "Channel without schema is not validated",
+			path:              "/channels/events",
+			body:              `not json`,
+			expectedStatus:    http.StatusAccepted,
+			expectedPublished: true,
+			expectedChannel:   "events",
+			expectedTopic:     "events",
+		},
+		{
+			name:           "Invalid message is rejected",
+			path:           "/channels/streetlights%2Fmeasured",
+			body:           `{"lumens":-1}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `lumens: Must be greater than or equal to 0`,
+		},
+		{
+			name:           "Undeclared channel",
+			path:           "/channels/unknown",
+			body:           `{}`,
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"channel unknown is not declared in the AsyncAPI docs"}`,
+		},
+		{
+			name:           "Message too large",
+			path:           "/channels/events",
+			body:           strings.Repeat("a", 33),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   `{"error":"message is too large"}`,
+		},
+		{
+			name:           "Error producing",
+			path:           "/channels/events",
+			body:           `{}`,
+			publishErr:     errors.New("kafka: client has run out of available brokers to talk to"),
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   `{"error":"error producing message"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			publisher := &fakePublisher{err: test.publishErr}
+			api := NewAPI(
+				WithChannelMatcher(testChannelMatcher),
+				WithValidator(validator),
+				WithPublisher(publisher),
+				WithMaxBodyBytes(32),
+			)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body))
+			if test.key != nil {
+				req.Header.Set(KeyHeader, *test.key)
+			}
+			api.Router().ServeHTTP(rec, req)
+
+			assert.Equal(t, test.expectedStatus, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			if test.expectedBody != "" {
+				assert.Contains(t, rec.Body.String(), test.expectedBody)
+			}
+
+			if !test.expectedPublished {
+				assert.Empty(t, publisher.published)
+				return
+			}
+
+			require.Len(t, publisher.published, 1)
+			msg := publisher.published[0]
+			assert.Equal(t, test.body, string(msg.Payload))
+			assert.Empty(t, msg.Metadata.Get(message.MetadataChannel))
+			key, hasKey := msg.Metadata[message.MetadataKey]
+			assert.Equal(t, test.key != nil, hasKey)
+			if test.key != nil {
+				assert.Equal(t, *test.key, key)
+			}
+
+			assert.Equal(t, test.expectedTopic, publisher.topic)
+			resp := new(produceResponse)
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), resp))
+			assert.Equal(t, produceResponse{UUID: msg.UUID, Channel: test.expectedChannel, Topic: test.expectedTopic}, *resp)
+		})
+	}
+}
+
+func TestAPI_Router_validationError(t *testing.T) {
+	validator := func(msg *watermillmessage.Message) (*message.ValidationError, error) {
+		return &message.ValidationError{Errors: []string{"lumens: Invalid type. Expected: integer, given: string"}}, nil
+	}
+	api := NewAPI(WithChannelMatcher(testChannelMatcher), WithValidator(validator), WithPublisher(&fakePublisher{}))
+
+	rec := httptest.NewRecorder()
+	api.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/channels/events", strings.NewReader(`{"lumens":"3"}`)))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	validationErr := new(message.ValidationError)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), validationErr))
+	assert.Equal(t, []string{"lumens: Invalid type. Expected: integer, given: string"}, validationErr.Errors)
+}
+
+func testChannelMatcher(topic string) (string, bool) {
+	switch {
+	case topic == "streetlights/measured" || topic == "events":
+		return topic, true
+	case strings.HasPrefix(topic, "user.") && strings.HasSuffix(topic, ".signedup"):
+		return "user.{userId}.signedup", true
+	default:
+		return "", false
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+type fakePublisher struct {
+	err       error
+	topic     string
+	published []*watermillmessage.Message
+}
+
+func (p *fakePublisher) Publish(topic string, msgs ...*watermillmessage.Message) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	p.topic = topic
+	p.published = append(p.published, msgs...)
+	return nil
+}
+
+func (p *fakePublisher) Close() error {
+	return nil
+}
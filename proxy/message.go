@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+)
+
+const handledMessagesTopic = "messages"
+
+// MessageConfig holds the config about handling the messages going through a proxy.
+// It is meant to be embedded in the config of proxies.
+type MessageConfig struct {
+	MessageHandler   watermillmessage.HandlerFunc
+	MessagePublisher watermillmessage.Publisher
+	PublishToTopic   string
+	// Sampler decides which messages are handled. All of them if not set. Skipped messages are not even published for being handled.
+	Sampler *message.Sampler
+	// ValidationQueue configures the queue messages wait in until being handled by MessageHandler.
+	ValidationQueue ValidationQueueConfig
+}
+
+// Messages returns the config about handling messages.
+func (c *MessageConfig) Messages() *MessageConfig {
+	return c
+}
+
+// PublishFunc publishes messages for being handled.
+type PublishFunc func(msgs ...*watermillmessage.Message) error
+
+// NewMessageHandler adds a handler with the given name to the router, returning the function that publishes messages to it.
+// Messages wait in a ValidationQueue until being handled. Handled messages are published to c.PublishToTopic through
+// c.MessagePublisher, if any. The name should be unique in the router.
+func NewMessageHandler(name string, r *watermillmessage.Router, c MessageConfig) PublishFunc {
+	queue := NewValidationQueue(c.ValidationQueue)
+	if c.MessagePublisher == nil {
+		h := func(msg *watermillmessage.Message) error {
+			_, err := c.MessageHandler(msg)
+			return err
+		}
+		r.AddNoPublisherHandler(name, handledMessagesTopic, queue, h)
+	} else {
+		r.AddHandler(name, handledMessagesTopic, queue, c.PublishToTopic, c.MessagePublisher, c.MessageHandler)
+	}
+
+	return func(msgs ...*watermillmessage.Message) error {
+		if c.Sampler != nil {
+			msgs = sample(c.Sampler, msgs)
+		}
+
+		if len(msgs) == 0 {
+			return nil
+		}
+
+		return queue.Publish(handledMessagesTopic, msgs...)
+	}
+}
+
+func sample(sampler *message.Sampler, msgs []*watermillmessage.Message) []*watermillmessage.Message {
+	sampled := make([]*watermillmessage.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		if sampler.Sample(msg) {
+			sampled = append(sampled, msg)
+		}
+	}
+
+	return sampled
+}
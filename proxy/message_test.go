@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	messagetest "github.com/asyncapi/event-gateway/message/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMessageHandler_sampling(t *testing.T) {
+	sampler, err := message.NewSampler(1, message.WithChannelSampleRates(map[string]float64{"clicks": 0}))
+	require.NoError(t, err)
+
+	handled := make(chan *watermillmessage.Message, 2)
+	r := messagetest.NewRouter(t)
+	publish := NewMessageHandler("test", r, MessageConfig{
+		MessageHandler: func(msg *watermillmessage.Message) ([]*watermillmessage.Message, error) {
+			handled <- msg
+			return nil, nil
+		},
+		Sampler: sampler,
+	})
+
+	go func() {
+		require.NoError(t, r.Run(context.Background()))
+	}()
+	<-r.Running()
+
+	// Skipped messages are not even published for being handled.
+	require.NoError(t, publish(message.New([]byte("click"), "clicks")))
+	require.NoError(t, publish(message.New([]byte("order"), "orders")))
+
+	select {
+	case msg := <-handled:
+		assert.Equal(t, "orders", msg.Metadata.Get(message.MetadataChannel))
+	case <-time.After(time.Second):
+		t.Fatal("message was not handled")
+	}
+
+	assert.Empty(t, handled)
+	assert.Equal(t, map[string]message.SamplingStats{"clicks": {Skipped: 1}, "orders": {Sampled: 1}}, sampler.Stats())
+}
@@ -1,6 +1,92 @@
 package proxy
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/asyncapi/event-gateway/asyncapi"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
 
 // Proxy represents an event-gateway proxy.
-type Proxy func(ctx context.Context) error
+type Proxy interface {
+	// Name returns the name of the proxy. Usually the name of the AsyncAPI server it proxies.
+	Name() string
+	// Start starts the proxy without blocking. A proxy can only be started once.
+	Start(ctx context.Context) error
+	// Stop stops the proxy, blocking until all its listeners and connections are closed.
+	Stop() error
+	// Ready is closed once the proxy is ready for accepting clients.
+	Ready() <-chan struct{}
+}
+
+// Run starts the given proxy and blocks until the given context is done. The proxy is stopped before returning.
+func Run(ctx context.Context, p Proxy) error {
+	if err := p.Start(ctx); err != nil {
+		return errors.Wrapf(err, "error starting proxy %s", p.Name())
+	}
+
+	logrus.Infof("Proxy %s started", p.Name())
+	<-ctx.Done()
+
+	return p.Stop()
+}
+
+// Factory creates a proxy for the given AsyncAPI server.
+type Factory func(s asyncapi.Server) (Proxy, error)
+
+// Registry maps AsyncAPI server protocols to the factories of the proxies supporting them.
+type Registry struct {
+	factories map[string]Factory
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]Factory)}
+}
+
+// Register registers the factory for the given protocols. Previous factories for the same protocols are replaced.
+func (r *Registry) Register(f Factory, protocols ...string) {
+	for _, p := range protocols {
+		r.factories[strings.ToLower(p)] = f
+	}
+}
+
+// Protocols returns the supported protocols, sorted.
+func (r *Registry) Protocols() []string {
+	protocols := make([]string, 0, len(r.factories))
+	for p := range r.factories {
+		protocols = append(protocols, p)
+	}
+	sort.Strings(protocols)
+
+	return protocols
+}
+
+// Proxies creates one proxy per server. Servers whose protocol is not supported are skipped.
+func (r *Registry) Proxies(servers ...asyncapi.Server) ([]Proxy, error) {
+	var proxies []Proxy
+	for _, s := range servers {
+		f, ok := r.factories[strings.ToLower(s.Protocol())]
+		if !ok {
+			logrus.Warnf("Server %s has protocol %q which is not supported. Skipping", s.Name(), s.Protocol())
+			continue
+		}
+
+		p, err := f(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating proxy for server %s", s.Name())
+		}
+
+		proxies = append(proxies, p)
+	}
+
+	if len(proxies) == 0 {
+		return nil, fmt.Errorf("no server has a supported protocol. Supported protocols are %s", strings.Join(r.Protocols(), ", "))
+	}
+
+	return proxies, nil
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/asyncapi/event-gateway/asyncapi"
+	v2 "github.com/asyncapi/event-gateway/asyncapi/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Proxies(t *testing.T) {
+	factory := func(s asyncapi.Server) (Proxy, error) {
+		if s.Name() == "broken" {
+			return nil, errors.New("invalid url")
+		}
+
+		return &fakeProxy{name: s.Name()}, nil
+	}
+
+	tests := []struct {
+		name        string
+		servers     []asyncapi.Server
+		expected    []string
+		expectedErr string
+	}{
+		{
+			name: "A proxy is created per supported server",
+			servers: []asyncapi.Server{
+				&v2.Server{NameField: "kafka", ProtocolField: "kafka"},
+				&v2.Server{NameField: "kafka-secure", ProtocolField: "KAFKA-SECURE"},
+				&v2.Server{NameField: "http", ProtocolField: "http"},
+			},
+			expected: []string{"kafka", "kafka-secure"},
+		},
+		{
+			name:        "Errors are returned",
+			servers:     []asyncapi.Server{&v2.Server{NameField: "broken", ProtocolField: "kafka"}},
+			expectedErr: "error creating proxy for server broken: invalid url",
+		},
+		{
+			name:        "At least a server should be supported",
+			servers:     []asyncapi.Server{&v2.Server{NameField: "http", ProtocolField: "http"}},
+			expectedErr: "no server has a supported protocol. Supported protocols are kafka, kafka-secure",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewRegistry()
+			r.Register(factory, "kafka", "kafka-secure")
+
+			proxies, err := r.Proxies(test.servers...)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			names := make([]string, len(proxies))
+			for i, p := range proxies {
+				names[i] = p.Name()
+			}
+			assert.Equal(t, test.expected, names)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	p := &fakeProxy{name: "test", ready: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Run(ctx, p)
+	}()
+
+	<-p.Ready()
+	cancel()
+	assert.NoError(t, <-done)
+	assert.True(t, p.stopped)
+
+	p = &fakeProxy{name: "test", startErr: errors.New("address already in use")}
+	assert.EqualError(t, Run(context.Background(), p), "error starting proxy test: address already in use")
+}
+
+type fakeProxy struct {
+	name     string
+	startErr error
+	ready    chan struct{}
+	stopped  bool
+}
+
+func (p *fakeProxy) Name() string {
+	return p.name
+}
+
+func (p *fakeProxy) Start(_ context.Context) error {
+	if p.startErr != nil {
+		return p.startErr
+	}
+
+	close(p.ready)
+	return nil
+}
+
+func (p *fakeProxy) Stop() error {
+	p.stopped = true
+	return nil
+}
+
+func (p *fakeProxy) Ready() <-chan struct{} {
+	return p.ready
+}
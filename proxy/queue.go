@@ -0,0 +1,291 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultValidationWorkers   = 1
+	defaultValidationQueueSize = 100
+)
+
+// QueueFullPolicy sets what happens to messages when the validation queue is full.
+type QueueFullPolicy string
+
+// Queue full policies.
+const (
+	// QueueFullPolicyBlock waits until the queue has room. Clients are delayed meanwhile, e.g. Kafka Produce requests.
+	QueueFullPolicyBlock QueueFullPolicy = "block"
+	// QueueFullPolicyDropNewest discards the incoming message, so it is not validated. A warning is logged.
+	QueueFullPolicyDropNewest QueueFullPolicy = "drop-newest"
+	// QueueFullPolicyDropOldest discards the oldest queued message, making room for the incoming one. A warning is logged.
+	QueueFullPolicyDropOldest QueueFullPolicy = "drop-oldest"
+	// QueueFullPolicySkipValidation lets the incoming message through without being validated. Unlike dropping, it is an
+	// accepted trade-off rather than a problem, so nothing is logged. Skipped messages are counted on their own.
+	QueueFullPolicySkipValidation QueueFullPolicy = "skip-validation"
+)
+
+// Validate validates QueueFullPolicy.
+func (p QueueFullPolicy) Validate() error {
+	switch p {
+	case "", QueueFullPolicyBlock, QueueFullPolicyDropNewest, QueueFullPolicyDropOldest, QueueFullPolicySkipValidation:
+		return nil
+	default:
+		return fmt.Errorf("queue full policy %q is not valid. Valid values are %s, %s, %s and %s", p, QueueFullPolicyBlock, QueueFullPolicyDropNewest, QueueFullPolicyDropOldest, QueueFullPolicySkipValidation)
+	}
+}
+
+// ValidationQueueConfig holds the configuration of the queue messages wait in until they are validated.
+// Zero values mean defaults.
+type ValidationQueueConfig struct {
+	// Workers is the number of messages validated concurrently. Default is 1.
+	Workers int
+	// Size is the number of messages that can wait for being validated. Default is 100.
+	Size int
+	// FullPolicy sets what happens to messages when the queue is full. Default is block.
+	FullPolicy QueueFullPolicy
+}
+
+// Validate validates ValidationQueueConfig.
+func (c ValidationQueueConfig) Validate() error {
+	if c.Workers < 0 {
+		return errors.New("workers should not be negative")
+	}
+
+	if c.Size < 0 {
+		return errors.New("size should not be negative")
+	}
+
+	return c.FullPolicy.Validate()
+}
+
+func (c ValidationQueueConfig) withDefaults() ValidationQueueConfig {
+	if c.Workers == 0 {
+		c.Workers = defaultValidationWorkers
+	}
+
+	if c.Size == 0 {
+		c.Size = defaultValidationQueueSize
+	}
+
+	if c.FullPolicy == "" {
+		c.FullPolicy = QueueFullPolicyBlock
+	}
+
+	return c
+}
+
+// ValidationQueueStats holds the count of messages per outcome of the validation queue.
+type ValidationQueueStats struct {
+	// Queued messages were accepted by the queue, after waiting for room if Blocked.
+	Queued uint64 `json:"queued"`
+	// Handled messages were validated by a worker.
+	Handled uint64 `json:"handled"`
+	// Blocked messages found the queue full and waited for room.
+	Blocked       uint64 `json:"blocked"`
+	DroppedNewest uint64 `json:"droppedNewest"`
+	DroppedOldest uint64 `json:"droppedOldest"`
+	// SkippedValidation messages found the queue full and were let through without being validated.
+	SkippedValidation uint64 `json:"skippedValidation"`
+	// Pending is the number of messages currently waiting in the queue.
+	Pending int `json:"pending"`
+}
+
+// ValidationQueue is a bounded pub/sub feeding a pool of workers with the messages to be validated.
+// Each worker delivers one message at a time, waiting for it to be acked, so the number of workers is the number of messages
+// validated concurrently. Nacked messages are resent.
+type ValidationQueue struct {
+	// stats is the first field, so its counters are 64-bit aligned for atomic operations.
+	stats    ValidationQueueStats
+	config   ValidationQueueConfig
+	messages chan *watermillmessage.Message
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+var (
+	_ watermillmessage.Publisher  = (*ValidationQueue)(nil)
+	_ watermillmessage.Subscriber = (*ValidationQueue)(nil)
+)
+
+// NewValidationQueue creates a ValidationQueue. Workers are started once subscribed.
+func NewValidationQueue(c ValidationQueueConfig) *ValidationQueue {
+	c = c.withDefaults()
+
+	return &ValidationQueue{
+		config:   c,
+		messages: make(chan *watermillmessage.Message, c.Size),
+		closing:  make(chan struct{}),
+	}
+}
+
+// Publish enqueues the given messages. The topic is ignored, as the queue only holds messages to be validated.
+// Depending on the queue full policy, it may block until the queue has room.
+func (q *ValidationQueue) Publish(_ string, msgs ...*watermillmessage.Message) error {
+	for _, msg := range msgs {
+		if err := q.enqueue(msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (q *ValidationQueue) enqueue(msg *watermillmessage.Message) error {
+	select {
+	case <-q.closing:
+		return errors.New("validation queue is closed")
+	case q.messages <- msg:
+		atomic.AddUint64(&q.stats.Queued, 1)
+		return nil
+	default:
+	}
+
+	switch q.config.FullPolicy {
+	case QueueFullPolicyDropNewest:
+		atomic.AddUint64(&q.stats.DroppedNewest, 1)
+		logDropped(msg)
+	case QueueFullPolicySkipValidation:
+		atomic.AddUint64(&q.stats.SkippedValidation, 1)
+	case QueueFullPolicyDropOldest:
+		for {
+			select {
+			case q.messages <- msg:
+				atomic.AddUint64(&q.stats.Queued, 1)
+				return nil
+			default:
+			}
+
+			select {
+			case oldest := <-q.messages:
+				atomic.AddUint64(&q.stats.DroppedOldest, 1)
+				logDropped(oldest)
+			default:
+			}
+		}
+	default:
+		atomic.AddUint64(&q.stats.Blocked, 1)
+		select {
+		case <-q.closing:
+			return errors.New("validation queue is closed")
+		case q.messages <- msg:
+			atomic.AddUint64(&q.stats.Queued, 1)
+		}
+	}
+
+	return nil
+}
+
+func logDropped(msg *watermillmessage.Message) {
+	logrus.WithFields(logrus.Fields{
+		"uuid":    msg.UUID,
+		"channel": msg.Metadata.Get(message.MetadataChannel),
+	}).Warn("Validation queue is full. Message is dropped without being validated")
+}
+
+// Subscribe starts the workers, returning the channel they deliver the messages to. The topic is ignored.
+// The channel is closed once the given context is done or the queue is closed.
+func (q *ValidationQueue) Subscribe(ctx context.Context, _ string) (<-chan *watermillmessage.Message, error) {
+	select {
+	case <-q.closing:
+		return nil, errors.New("validation queue is closed")
+	default:
+	}
+
+	out := make(chan *watermillmessage.Message)
+	var workers sync.WaitGroup
+	for i := 0; i < q.config.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			q.work(ctx, out)
+		}()
+	}
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		workers.Wait()
+		close(out)
+	}()
+
+	return out, nil
+}
+
+func (q *ValidationQueue) work(ctx context.Context, out chan<- *watermillmessage.Message) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.closing:
+			return
+		case msg := <-q.messages:
+			if !q.deliver(ctx, msg, out) {
+				return
+			}
+			atomic.AddUint64(&q.stats.Handled, 1)
+		}
+	}
+}
+
+// deliver sends the given message to out until it is acked. It returns false if the queue is closed meanwhile.
+func (q *ValidationQueue) deliver(ctx context.Context, msg *watermillmessage.Message, out chan<- *watermillmessage.Message) bool {
+	for {
+		// Copying the message, as a message can't be acked or nacked twice.
+		delivery := msg.Copy()
+		delivery.SetContext(ctx)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-q.closing:
+			return false
+		case out <- delivery:
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-q.closing:
+			return false
+		case <-delivery.Acked():
+			return true
+		case <-delivery.Nacked():
+			// Resending the message, as the handler failed.
+		}
+	}
+}
+
+// Stats returns the count of messages per outcome.
+func (q *ValidationQueue) Stats() ValidationQueueStats {
+	return ValidationQueueStats{
+		Queued:            atomic.LoadUint64(&q.stats.Queued),
+		Handled:           atomic.LoadUint64(&q.stats.Handled),
+		Blocked:           atomic.LoadUint64(&q.stats.Blocked),
+		DroppedNewest:     atomic.LoadUint64(&q.stats.DroppedNewest),
+		DroppedOldest:     atomic.LoadUint64(&q.stats.DroppedOldest),
+		SkippedValidation: atomic.LoadUint64(&q.stats.SkippedValidation),
+		Pending:           len(q.messages),
+	}
+}
+
+// Close stops the workers. Queued messages are discarded.
+func (q *ValidationQueue) Close() error {
+	q.closeOnce.Do(func() {
+		close(q.closing)
+	})
+
+	q.wg.Wait()
+
+	return nil
+}
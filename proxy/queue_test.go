@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	watermillmessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidationQueue_Publish(t *testing.T) {
+	tests := []struct {
+		name             string
+		policy           QueueFullPolicy
+		expectedStats    ValidationQueueStats
+		expectedMessages []string
+	}{
+		{
+			name:             "Drop newest",
+			policy:           QueueFullPolicyDropNewest,
+			expectedStats:    ValidationQueueStats{Queued: 2, Handled: 2, DroppedNewest: 1},
+			expectedMessages: []string{"1", "2"},
+		},
+		{
+			name:             "Drop oldest",
+			policy:           QueueFullPolicyDropOldest,
+			expectedStats:    ValidationQueueStats{Queued: 3, Handled: 2, DroppedOldest: 1},
+			expectedMessages: []string{"2", "3"},
+		},
+		{
+			name:             "Skip validation",
+			policy:           QueueFullPolicySkipValidation,
+			expectedStats:    ValidationQueueStats{Queued: 2, Handled: 2, SkippedValidation: 1},
+			expectedMessages: []string{"1", "2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := NewValidationQueue(ValidationQueueConfig{Size: 2, FullPolicy: test.policy})
+			t.Cleanup(func() {
+				assert.NoError(t, q.Close())
+			})
+
+			// Workers are not running yet, so the queue gets full.
+			require.NoError(t, q.Publish(handledMessagesTopic, newMessages("1", "2", "3")...))
+			assert.Equal(t, 2, q.Stats().Pending)
+
+			msgs, err := q.Subscribe(context.Background(), handledMessagesTopic)
+			require.NoError(t, err)
+
+			var received []string
+			for range test.expectedMessages {
+				msg := <-msgs
+				received = append(received, msg.UUID)
+				msg.Ack()
+			}
+
+			assert.Equal(t, test.expectedMessages, received)
+			assert.Eventually(t, func() bool {
+				return q.Stats() == test.expectedStats
+			}, time.Second, time.Millisecond)
+		})
+	}
+}
+
+func TestValidationQueue_PublishBlocks(t *testing.T) {
+	q := NewValidationQueue(ValidationQueueConfig{Size: 1})
+	t.Cleanup(func() {
+		assert.NoError(t, q.Close())
+	})
+
+	published := make(chan error)
+	go func() {
+		published <- q.Publish(handledMessagesTopic, newMessages("1", "2")...)
+	}()
+
+	select {
+	case <-published:
+		require.Fail(t, "publishing to a full queue should block")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	msgs, err := q.Subscribe(context.Background(), handledMessagesTopic)
+	require.NoError(t, err)
+
+	for _, expected := range []string{"1", "2"} {
+		msg := <-msgs
+		assert.Equal(t, expected, msg.UUID)
+		msg.Ack()
+	}
+
+	require.NoError(t, <-published)
+	assert.Equal(t, uint64(1), q.Stats().Blocked)
+	assert.Equal(t, uint64(2), q.Stats().Queued)
+}
+
+func TestValidationQueue_Workers(t *testing.T) {
+	q := NewValidationQueue(ValidationQueueConfig{Workers: 3})
+	t.Cleanup(func() {
+		assert.NoError(t, q.Close())
+	})
+
+	require.NoError(t, q.Publish(handledMessagesTopic, newMessages("1", "2", "3", "4")...))
+
+	msgs, err := q.Subscribe(context.Background(), handledMessagesTopic)
+	require.NoError(t, err)
+
+	// Messages are delivered concurrently by the workers, as long as they are not acked.
+	var delivered []*watermillmessage.Message
+	for i := 0; i < 3; i++ {
+		delivered = append(delivered, <-msgs)
+	}
+
+	select {
+	case msg := <-msgs:
+		require.Fail(t, "no more messages than workers should be delivered at the same time", "message %s was delivered", msg.UUID)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Nacked messages are resent.
+	delivered[0].Nack()
+	resent := <-msgs
+	assert.Equal(t, delivered[0].UUID, resent.UUID)
+}
+
+func TestValidationQueueConfig_Validate(t *testing.T) {
+	assert.NoError(t, ValidationQueueConfig{}.Validate())
+	assert.NoError(t, ValidationQueueConfig{Workers: 4, Size: 1000, FullPolicy: QueueFullPolicyDropOldest}.Validate())
+	assert.EqualError(t, ValidationQueueConfig{Workers: -1}.Validate(), "workers should not be negative")
+	assert.EqualError(t, ValidationQueueConfig{Size: -1}.Validate(), "size should not be negative")
+	assert.EqualError(t, ValidationQueueConfig{FullPolicy: "drop"}.Validate(), `queue full policy "drop" is not valid. Valid values are block, drop-newest, drop-oldest and skip-validation`)
+}
+
+func newMessages(uuids ...string) []*watermillmessage.Message {
+	msgs := make([]*watermillmessage.Message, len(uuids))
+	for i, uuid := range uuids {
+		msgs[i] = watermillmessage.NewMessage(uuid, []byte(`{}`))
+	}
+
+	return msgs
+}
@@ -0,0 +1,231 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const dialTimeout = 15 * time.Second
+
+// ConnHandler relays the traffic between a client and the broker. It should return once any of both connections is closed.
+// Both connections are closed once it returns.
+type ConnHandler func(client, broker net.Conn) error
+
+// TCP is a Proxy relaying the TCP connections of clients to a single broker.
+// The traffic is relayed by a ConnHandler, which usually inspects it on the way.
+type TCP struct {
+	name          string
+	listenAddress string
+	brokerAddress string
+	handler       ConnHandler
+
+	lock     sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	ctx      context.Context
+	running  bool
+	stopped  bool
+	wg       sync.WaitGroup
+	ready    chan struct{}
+	// done is closed once the proxy is stopped.
+	done chan struct{}
+}
+
+var _ Proxy = (*TCP)(nil)
+
+// NewTCP creates a TCP proxy listening at listenAddress for clients of the broker at brokerAddress.
+func NewTCP(name, listenAddress, brokerAddress string, handler ConnHandler) *TCP {
+	return &TCP{
+		name:          name,
+		listenAddress: listenAddress,
+		brokerAddress: brokerAddress,
+		handler:       handler,
+		conns:         make(map[net.Conn]struct{}),
+		ready:         make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Name returns the name of the proxy.
+func (p *TCP) Name() string {
+	return p.name
+}
+
+// Start starts listening for clients without blocking. The proxy is stopped once the given context is done.
+func (p *TCP) Start(ctx context.Context) error {
+	p.lock.Lock()
+	if p.running {
+		p.lock.Unlock()
+		return errors.New("proxy is already running")
+	}
+
+	listener, err := net.Listen("tcp", p.listenAddress)
+	if err != nil {
+		p.lock.Unlock()
+		return errors.Wrapf(err, "error listening at %s for broker %s", p.listenAddress, p.brokerAddress)
+	}
+
+	p.running = true
+	p.ctx = ctx
+	p.listener = listener
+	p.wg.Add(1)
+	go p.accept()
+	p.lock.Unlock()
+
+	logrus.Infof("Broker %s proxied at %s", p.brokerAddress, listener.Addr())
+	close(p.ready)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = p.Stop()
+		case <-p.done:
+		}
+	}()
+
+	return nil
+}
+
+// Stop closes the listener and all connections, blocking until they are closed.
+func (p *TCP) Stop() error {
+	p.lock.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.done)
+	}
+	if p.listener != nil {
+		_ = p.listener.Close()
+	}
+	for c := range p.conns {
+		_ = c.Close()
+	}
+	p.lock.Unlock()
+
+	p.wg.Wait()
+
+	return nil
+}
+
+// Ready is closed once the proxy is listening for clients.
+func (p *TCP) Ready() <-chan struct{} {
+	return p.ready
+}
+
+// ListenAddress returns the address the proxy is configured to listen at.
+func (p *TCP) ListenAddress() string {
+	return p.listenAddress
+}
+
+// BrokerAddress returns the address of the broker connections are relayed to.
+func (p *TCP) BrokerAddress() string {
+	return p.brokerAddress
+}
+
+// Addr returns the address the proxy is listening at. Nil if it has not been started.
+func (p *TCP) Addr() net.Addr {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.listener == nil {
+		return nil
+	}
+
+	return p.listener.Addr()
+}
+
+func (p *TCP) accept() {
+	defer p.wg.Done()
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logrus.WithError(err).Errorf("Error accepting connections at %s for broker %s", p.listenAddress, p.brokerAddress)
+			}
+			return
+		}
+
+		p.wg.Add(1)
+		go p.handleConn(conn)
+	}
+}
+
+func (p *TCP) handleConn(client net.Conn) {
+	defer p.wg.Done()
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	broker, err := dialer.DialContext(p.ctx, "tcp", p.brokerAddress)
+	if err != nil {
+		logrus.WithError(err).Errorf("Error connecting to broker %s", p.brokerAddress)
+		_ = client.Close()
+		return
+	}
+
+	if !p.track(client, broker) {
+		_ = client.Close()
+		_ = broker.Close()
+		return
+	}
+
+	err = p.handler(client, broker)
+	_ = client.Close()
+	_ = broker.Close()
+	p.untrack(client, broker)
+
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"proxy":  p.name,
+			"client": client.RemoteAddr().String(),
+			"broker": p.brokerAddress,
+		}).Warn("Closing connection due to an error")
+	}
+}
+
+// track tracks the given connections, so they are closed when stopping. Returns false if the proxy is already stopped.
+func (p *TCP) track(conns ...net.Conn) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.stopped {
+		return false
+	}
+
+	for _, c := range conns {
+		p.conns[c] = struct{}{}
+	}
+
+	return true
+}
+
+func (p *TCP) untrack(conns ...net.Conn) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, c := range conns {
+		delete(p.conns, c)
+	}
+}
+
+// Relay relays the traffic from the broker to the client until any of both connections is closed,
+// while the traffic from the client to the broker is relayed by the given function.
+// Both connections are closed once any of both directions is done. The error of the given function is returned.
+func Relay(client, broker net.Conn, clientToBroker func() error) error {
+	brokerDone := make(chan struct{})
+	go func() {
+		defer close(brokerDone)
+		_, _ = io.Copy(client, broker)
+		_ = client.Close()
+	}()
+
+	err := clientToBroker()
+	_ = broker.Close()
+	_ = client.Close()
+	<-brokerDone
+
+	return err
+}
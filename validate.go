@@ -0,0 +1,280 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/asyncapi/event-gateway/amqp"
+	"github.com/asyncapi/event-gateway/asyncapi"
+	v2 "github.com/asyncapi/event-gateway/asyncapi/v2"
+	"github.com/asyncapi/event-gateway/kafka"
+	"github.com/asyncapi/event-gateway/message"
+	"github.com/asyncapi/event-gateway/mqtt"
+	"github.com/asyncapi/event-gateway/nats"
+	"github.com/sirupsen/logrus"
+)
+
+// runValidateDoc decodes the given AsyncAPI docs, or the configured ones if none is given, printing their problems.
+// It fails if any doc has problems. Warnings are printed but don't fail.
+func runValidateDoc(args []string) int {
+	fs := flag.NewFlagSet("validate-doc", flag.ContinueOnError)
+	configFile := configFlag(fs)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "Usage: event-gateway validate-doc [flags] [doc...]")
+		_, _ = fmt.Fprintln(fs.Output(), "Validates AsyncAPI docs. The configured docs are validated if none is given.")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	sources := fs.Args()
+	if len(sources) == 0 {
+		c, err := loadConfig(*configFile)
+		if err != nil {
+			logrus.WithError(err).Error()
+			return exitUsage
+		}
+
+		sources = configuredDocuments(c.AsyncAPIDoc, c.AsyncAPIDocs.Values...)
+		if len(sources) == 0 {
+			fs.Usage()
+			return exitUsage
+		}
+	}
+
+	exitCode := exitOK
+	docs := make([]asyncapi.Document, 0, len(sources))
+	for _, source := range sources {
+		doc, err := decodeDocument(source)
+		if err != nil {
+			printProblems(source, "error", err.Error())
+			exitCode = exitFailure
+			continue
+		}
+		docs = append(docs, doc)
+
+		errs, warnings := documentProblems(doc)
+		printProblems(source, "error", errs...)
+		printProblems(source, "warning", warnings...)
+		if len(errs) > 0 {
+			exitCode = exitFailure
+		} else if _, err := fmt.Fprintf(os.Stdout, "%s: valid\n", source); err != nil {
+			return exitFailure
+		}
+	}
+
+	// Channels of all docs are merged, so they should not conflict.
+	if len(docs) > 1 {
+		if _, err := v2.ValidatedChannels(docs...); err != nil {
+			printProblems(strings.Join(sources, ", "), "error", err.Error())
+			exitCode = exitFailure
+		}
+	}
+
+	return exitCode
+}
+
+// documentProblems returns the errors and warnings found in the given doc.
+// Errors are problems preventing the Event-Gateway from validating messages, such as invalid payload schemas.
+func documentProblems(doc asyncapi.Document) (errs []string, warnings []string) {
+	channels, err := v2.ValidatedChannels(doc)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+
+	for _, c := range channels {
+		if _, err := message.GoJSONSchemaCompiler(c.Schema); err != nil {
+			errs = append(errs, fmt.Sprintf("channel %s has an invalid message payload schema: %s", c.Channel, err))
+		}
+
+		if c.Key == nil || c.Key.Schema == nil {
+			continue
+		}
+
+		compiler := message.GoJSONSchemaCompiler
+		if c.Key.Encoding == message.KeyEncodingAvro {
+			compiler = message.AvroSchemaCompiler
+		}
+
+		if _, err := compiler(c.Key.Schema); err != nil {
+			errs = append(errs, fmt.Sprintf("channel %s has an invalid message key schema: %s", c.Channel, err))
+		}
+	}
+
+	if len(channels) == 0 {
+		warnings = append(warnings, "no channel has messages published by clients, so no message is validated")
+	}
+
+	supported := make(map[string]bool)
+	for _, protocols := range [][]string{kafka.Protocols, mqtt.Protocols, amqp.Protocols, nats.Protocols} {
+		for _, p := range protocols {
+			supported[p] = true
+		}
+	}
+
+	for _, s := range doc.Servers() {
+		if !supported[strings.ToLower(s.Protocol())] {
+			warnings = append(warnings, fmt.Sprintf("server %s has protocol %q which is not supported. It won't be proxied", s.Name(), s.Protocol()))
+		}
+	}
+
+	return errs, warnings
+}
+
+func printProblems(source, level string, problems ...string) {
+	for _, p := range problems {
+		_, _ = fmt.Fprintf(os.Stdout, "%s: %s: %s\n", source, level, p)
+	}
+}
+
+// runValidateMessage validates the payloads read from the given files, or from stdin if none is given,
+// as messages of the given channel. It fails if any payload is invalid.
+func runValidateMessage(args []string) int {
+	fs := flag.NewFlagSet("validate-message", flag.ContinueOnError)
+	configFile := configFlag(fs)
+	channel := fs.String("channel", "", "Channel the messages belong to. Mandatory")
+	key := fs.String("key", "", "Key of the messages. Messages have a null key if not set")
+	docsFlag := fs.String("docs", "", "Paths or URLs to the AsyncAPI docs to validate against, overriding the configured ones. Multiple values can be configured by using pipe separation (|)")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "Usage: event-gateway validate-message -channel <channel> [flags] [payload file...]")
+		_, _ = fmt.Fprintln(fs.Output(), "Validates message payloads against the AsyncAPI docs. Payload is read from stdin if no file is given.")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if *channel == "" {
+		fs.Usage()
+		return exitUsage
+	}
+
+	c, err := loadConfig(*configFile)
+	if err != nil {
+		logrus.WithError(err).Error()
+		return exitUsage
+	}
+
+	if *docsFlag != "" {
+		c.AsyncAPIDoc = ""
+		_ = c.AsyncAPIDocs.Set(*docsFlag)
+	}
+
+	docs, err := c.Documents()
+	if err != nil {
+		logrus.WithError(err).Error()
+		return exitUsage
+	}
+
+	validator, err := channelValidator(docs, *channel)
+	if err != nil {
+		logrus.WithError(err).Error()
+		return exitUsage
+	}
+
+	sources := fs.Args()
+	if len(sources) == 0 {
+		sources = []string{"-"}
+	}
+
+	var msgKey *string
+	if isFlagSet(fs, "key") {
+		msgKey = key
+	}
+
+	return validateMessages(validator, *channel, msgKey, sources)
+}
+
+// validateMessages validates the payloads read from the given files as messages of the given channel, with the given key
+// (nil means null key), printing their problems.
+func validateMessages(validator message.Validator, channel string, key *string, sources []string) int {
+	exitCode := exitOK
+	for _, source := range sources {
+		payload, err := readPayload(source)
+		if err != nil {
+			logrus.WithError(err).Error()
+			return exitUsage
+		}
+
+		msg := message.New(payload, channel)
+		if key != nil {
+			msg.Metadata.Set(message.MetadataKey, *key)
+		}
+
+		validationErr, err := validator(msg)
+		if err != nil {
+			printProblems(source, "error", err.Error())
+			exitCode = exitFailure
+			continue
+		}
+
+		if validationErr != nil {
+			printProblems(source, "invalid", validationErr.Errors...)
+			printProblems(source, "invalid key", validationErr.KeyErrors...)
+			exitCode = exitFailure
+			continue
+		}
+
+		if _, err := fmt.Fprintf(os.Stdout, "%s: valid\n", source); err != nil {
+			return exitFailure
+		}
+	}
+
+	return exitCode
+}
+
+// channelValidator creates the validator of the messages of the given channel. The channel should be validated.
+func channelValidator(docs []asyncapi.Document, channel string) (message.Validator, error) {
+	channels, err := v2.ValidatedChannels(docs...)
+	if err != nil {
+		return nil, err
+	}
+
+	var found bool
+	for _, c := range channels {
+		found = found || c.Channel == channel
+	}
+
+	if !found {
+		return nil, fmt.Errorf("channel %s has no messages published by clients in any AsyncAPI doc, so its messages are not validated", channel)
+	}
+
+	return v2.FromDocsJSONSchemaMessageValidator(docs...)
+}
+
+// isFlagSet tells if the given flag has been set in the command line.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	var set bool
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+
+	return set
+}
+
+// readPayload reads the payload from the given file. Stdin is read if the file is -.
+func readPayload(file string) ([]byte, error) {
+	if file == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+
+	return ioutil.ReadFile(file)
+}
+
+// configuredDocuments returns the non-empty AsyncAPI docs sources.
+func configuredDocuments(doc string, docs ...string) []string {
+	var sources []string
+	for _, d := range append([]string{doc}, docs...) {
+		if d != "" {
+			sources = append(sources, d)
+		}
+	}
+
+	return sources
+}